@@ -0,0 +1,100 @@
+package main
+
+import (
+  "bytes"
+  "image"
+  "image/color"
+  "image/gif"
+  "math"
+)
+
+/**
+ * An animated preview: the disc being written along the spiral, frames
+ * evenly spaced in time, so that the write head slows down as it moves
+ * outwards, at a constant linear speed. A red dot marks where the head is.
+ *
+ * GIF only: it's what the standard library writes, and it plays anywhere a
+ * png shows.
+ */
+const (
+  Frame_delay = 10 // in 1/100s
+  Last_frame_delay = 300 // the finished disc stays a while before looping
+)
+
+var animation_palette = func() color.Palette {
+  p := color.Palette{}
+  for i:=0; i<255; i++ {
+    v := uint8(i * 255 / 254)
+    p = append(p, color.Gray{v})
+  }
+  return append(p, color.RGBA{0xff, 0x20, 0x20, 0xff})
+}()
+
+/**
+ * The frame showing the bytes accumulated so far, with the head at x, y.
+ */
+func animation_frame(sum []float64, count []int, size int, x float64, y float64) *image.Paletted {
+  img := image.NewPaletted(image.Rect(0, 0, size, size), animation_palette)
+  for i := range img.Pix {
+    v := 0x80
+    if count[i] > 0 {
+      v = int(sum[i] / float64(count[i]))
+    }
+    img.Pix[i] = uint8(v * 254 / 255)
+  }
+  scale := float64(size) / (2 * Disc_radius)
+  px, py := (x + Disc_radius) * scale, (Disc_radius - y) * scale
+  r := max(2, float64(size) / 150)
+  for j:=int(py - r); j<=int(py + r); j++ {
+    for i:=int(px - r); i<=int(px + r); i++ {
+      if i >= 0 && j >= 0 && i < size && j < size && math.Hypot(float64(i) - px, float64(j) - py) <= r {
+        img.Pix[j * size + i] = uint8(len(animation_palette) - 1)
+      }
+    }
+  }
+  return img
+}
+
+/**
+ * Renders the samples the way render does, in the given number of frames,
+ * each one adding the same share of the samples.
+ */
+func animate(data []byte, g Geometry, size int, frames int) *gif.GIF {
+  sum := make([]float64, size * size)
+  count := make([]int, size * size)
+  scale := float64(size) / (2 * Disc_radius)
+  anim := &gif.GIF{}
+  total := len(data) / 4 * 4
+  next := 1
+  for _, ring := range g.rings(Duration(len(data) / 4)) {
+    radius, angle := float64(ring.radius), float64(ring.angle)
+    delta := float64(g.sample_length()) / 4 / radius
+    cos_d, sin_d := math.Cos(delta), math.Sin(delta)
+    x, y := radius * math.Cos(angle), radius * math.Sin(angle)
+    for i:=ring.start * 4; i<(ring.start + ring.samples) * 4; i++ {
+      px, py := int((x + Disc_radius) * scale), int((Disc_radius - y) * scale)
+      if px >= 0 && py >= 0 && px < size && py < size {
+        sum[py * size + px] += tone(data[i])
+        count[py * size + px]++
+      }
+      if i + 1 >= total * next / frames {
+        anim.Image = append(anim.Image, animation_frame(sum, count, size, x, y))
+        anim.Delay = append(anim.Delay, Frame_delay)
+        next++
+      }
+      x, y = x * cos_d - y * sin_d, x * sin_d + y * cos_d
+    }
+  }
+  if len(anim.Delay) > 0 {
+    anim.Delay[len(anim.Delay) - 1] = Last_frame_delay
+  }
+  return anim
+}
+
+func write_gif(filename string, anim *gif.GIF) error {
+  buf := bytes.Buffer{}
+  if err := gif.EncodeAll(&buf, anim); err != nil {
+    return err
+  }
+  return write_output(filename, buf.Bytes())
+}
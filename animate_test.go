@@ -0,0 +1,45 @@
+package main
+
+import (
+  "image"
+  "testing"
+)
+
+/**
+ * An animation ends on the preview, but for the write head, and grows frame
+ * by frame.
+ */
+func TestAnimation(t *testing.T) {
+  data := generate_test_pattern(t, Pie, []string{"-duration", "4m"})[Wav_header_size:]
+  g := default_geometry()
+  g.samples = Duration(4 * 60 * Sample_rate)
+  anim := animate(data, g, Preview_size, 12)
+  if len(anim.Image) != 12 {
+    t.Fatalf("got %d frames, expecting 12", len(anim.Image))
+  }
+  img := render(data, g, Preview_size)
+  last := anim.Image[len(anim.Image) - 1]
+  differ := 0
+  for i, p := range last.Pix {
+    if d := int(img.Pix[i]) - int(p) * 255 / 254; p != uint8(len(animation_palette) - 1) && (d < -2 || d > 2) {
+      differ++
+    }
+  }
+  if differ > 0 {
+    t.Errorf("%d pixels of the last frame differ from the preview", differ)
+  }
+  written := func(frame *image.Paletted) int {
+    n := 0
+    for _, p := range frame.Pix {
+      if p != 0x80 * 254 / 255 {
+        n++
+      }
+    }
+    return n
+  }
+  for i:=1; i<len(anim.Image); i++ {
+    if written(anim.Image[i]) < written(anim.Image[i - 1]) {
+      t.Errorf("frame %d shows less of the disc than frame %d", i + 1, i)
+    }
+  }
+}
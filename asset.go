@@ -0,0 +1,118 @@
+package main
+
+import (
+  "crypto/sha256"
+  "fmt"
+  "io"
+  "net/http"
+  "os"
+  "path/filepath"
+  "strings"
+  "time"
+)
+
+/**
+ * Images given as a path may also be http or https urls, e.g. for assets
+ * which live in cloud storage rather than on the machine doing the burning.
+ * Downloads are capped in size and kept in the user's cache directory, a
+ * cached copy is used as is for a while and as a fallback when the server
+ * can't be reached.
+ */
+const (
+  Max_asset_size int64 = 32 << 20 // in bytes
+  Asset_timeout = 30 * time.Second
+  Asset_cache_ttl = time.Hour
+)
+
+func is_url(name string) bool {
+  return strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://")
+}
+
+/**
+ * Returns where the download of url is cached, "" when there's no cache
+ * directory.
+ */
+func asset_cache(url string) string {
+  if cache_dir == "" {
+    return ""
+  }
+  return filepath.Join(cache_dir, "assets", fmt.Sprintf("%x", sha256.Sum256([]byte(url))))
+}
+
+func download(url string) ([]byte, error) {
+  client := http.Client{Timeout: Asset_timeout}
+  resp, err := client.Get(url)
+  if err != nil {
+    return nil, err
+  }
+  defer resp.Body.Close()
+  if resp.StatusCode != http.StatusOK {
+    return nil, fmt.Errorf("%s: %s", url, resp.Status)
+  }
+  if resp.ContentLength > Max_asset_size {
+    return nil, fmt.Errorf("%s: %d bytes, more than the %d allowed", url, resp.ContentLength, Max_asset_size)
+  }
+  data, err := io.ReadAll(io.LimitReader(resp.Body, Max_asset_size + 1))
+  if err != nil {
+    return nil, fmt.Errorf("%s: %s", url, err)
+  }
+  if int64(len(data)) > Max_asset_size {
+    return nil, fmt.Errorf("%s: more than the %d bytes allowed", url, Max_asset_size)
+  }
+  return data, nil
+}
+
+/**
+ * Reads an image, from a file or a url.
+ */
+func read_asset(name string) ([]byte, error) {
+  if !is_url(name) {
+    return os.ReadFile(name)
+  }
+  cache := asset_cache(name)
+  var cached []byte
+  if cache != "" {
+    if stat, err := os.Stat(cache); err == nil {
+      if cached, err = os.ReadFile(cache); err == nil && time.Since(stat.ModTime()) < Asset_cache_ttl {
+        logger.debugf("%s: using %s", name, cache)
+        return cached, nil
+      }
+    }
+  }
+  logger.infof("downloading %s", name)
+  data, err := download(name)
+  if err != nil {
+    if cached != nil {
+      logger.warnf("%s, using the copy downloaded earlier", err)
+      return cached, nil
+    }
+    return nil, err
+  }
+  if cache != "" {
+    err := os.MkdirAll(filepath.Dir(cache), 0755)
+    if err == nil {
+      err = os.WriteFile(cache, data, 0644)
+    }
+    if err != nil {
+      logger.warnf("not caching %s: %s", name, err)
+    }
+  }
+  return data, nil
+}
+
+/**
+ * Identifies the content of the files the pattern stage reads, the drawing
+ * and the payload: they can change under the same name.
+ */
+func (o Pattern_options) inputs() string {
+  r := ""
+  for _, name := range []string{o.drawing, o.payload} {
+    if name == "" {
+      continue
+    }
+    if data, err := read_asset(name); err == nil {
+      r += fmt.Sprintf(" %x", sha256.Sum256(data))
+    }
+  }
+  return r
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+  "bytes"
+  "encoding/binary"
+  "fmt"
+  "math"
+  "os"
+  "os/exec"
+  "path/filepath"
+  "strings"
+)
+
+/**
+ * Audio the design carries, the intro and the protected ranges, may come in
+ * any format: wav files at any rate, bit depth or number of channels get
+ * converted to CD audio here, compressed files (mp3, flac, ogg...) get
+ * decoded by ffmpeg, when it's installed, the build sticks to the standard
+ * library.
+ *
+ * Resampling uses a windowed sinc, which low-passes below the lower of both
+ * Nyquist frequencies, so that 48kHz or 96kHz recordings don't alias into
+ * audible tones. Mono gets copied to both channels, only the first two
+ * channels of anything wider are kept.
+ */
+const (
+  Resample_zeros = 16 // zero crossings of the sinc on each side
+  Resample_phases = 256 // kernel values per zero crossing, interpolated between
+)
+
+var compressed_audio = []string{".mp3", ".flac", ".ogg", ".oga", ".opus", ".m4a", ".aac"}
+
+/**
+ * Returns the samples of an audio file, as CD audio.
+ */
+func read_audio(filename string) ([]byte, error) {
+  ext := strings.ToLower(filepath.Ext(filename))
+  for _, e := range compressed_audio {
+    if ext == e {
+      return decode_audio(filename)
+    }
+  }
+  data, err := os.ReadFile(filename)
+  if err != nil {
+    return nil, err
+  }
+  f, samples, err := parse_wav(filename, data)
+  if err != nil {
+    return nil, err
+  }
+  if f.cd_audio() {
+    return samples[:len(samples) / 4 * 4], nil
+  }
+  channels, err := wav_channels(filename, f, samples)
+  if err != nil {
+    return nil, err
+  }
+  logger.infof("%s: converting %s to CD audio", filename, f)
+  return pcm16(resample(channels[0], f.rate, Sample_rate), resample(channels[1], f.rate, Sample_rate)), nil
+}
+
+/**
+ * Runs ffmpeg, which writes CD audio samples, without a header, to stdout.
+ */
+func decode_audio(filename string) ([]byte, error) {
+  if _, err := exec.LookPath("ffmpeg"); err != nil {
+    return nil, fmt.Errorf("%s: decoding %s files needs ffmpeg, which isn't installed. Convert it to a wav file instead", filename, filepath.Ext(filename))
+  }
+  cmd := []string{"ffmpeg", "-v", "error", "-i", filename, "-f", "s16le", "-acodec", "pcm_s16le", "-ac", "2", "-ar", fmt.Sprint(Sample_rate), "-"}
+  logger.infof("%s", strings.Join(cmd, " "))
+  c := exec.Command(cmd[0], cmd[1:]...)
+  out, stderr := bytes.Buffer{}, bytes.Buffer{}
+  c.Stdout, c.Stderr = &out, &stderr
+  if err := c.Run(); err != nil {
+    return nil, fmt.Errorf("%s: ffmpeg: %s %s", filename, err, strings.TrimSpace(stderr.String()))
+  }
+  return out.Bytes()[:out.Len() / 4 * 4], nil
+}
+
+/**
+ * Splits the samples of a wav file into its left and right channels, as
+ * values between -1 and 1.
+ */
+func wav_channels(filename string, f Wav_format, data []byte) ([2][]float64, error) {
+  var value func(b []byte) float64
+  switch {
+    case f.format == 1 && f.bits == 8:
+      value = func(b []byte) float64 { return (float64(b[0]) - 128) / 128 }
+    case f.format == 1 && f.bits == 16:
+      value = func(b []byte) float64 { return float64(int16(binary.LittleEndian.Uint16(b))) / 32768 }
+    case f.format == 1 && f.bits == 24:
+      value = func(b []byte) float64 { return float64(int32(uint32(b[0]) << 8 | uint32(b[1]) << 16 | uint32(b[2]) << 24) >> 8) / (1 << 23) }
+    case f.format == 1 && f.bits == 32:
+      value = func(b []byte) float64 { return float64(int32(binary.LittleEndian.Uint32(b))) / (1 << 31) }
+    case f.format == 3 && f.bits == 32:
+      value = func(b []byte) float64 { return float64(math.Float32frombits(binary.LittleEndian.Uint32(b))) }
+    case f.format == 3 && f.bits == 64:
+      value = func(b []byte) float64 { return math.Float64frombits(binary.LittleEndian.Uint64(b)) }
+    default:
+      return [2][]float64{}, fmt.Errorf("%s: %s, can't convert it, expecting 8 to 32 bit pcm or 32 or 64 bit floats", filename, f)
+  }
+  if f.channels < 1 || f.rate <= 0 {
+    return [2][]float64{}, fmt.Errorf("%s: invalid format, %s", filename, f)
+  }
+  size := f.bits / 8
+  frame := size * f.channels
+  n := len(data) / frame
+  left, right := make([]float64, n), make([]float64, n)
+  for i:=0; i<n; i++ {
+    left[i] = value(data[i * frame:])
+    right[i] = left[i]
+    if f.channels > 1 {
+      right[i] = value(data[i * frame + size:])
+    }
+  }
+  return [2][]float64{left, right}, nil
+}
+
+/**
+ * Resamples a channel from one rate to another.
+ */
+func resample(in []float64, from int, to int) []float64 {
+  if from == to {
+    return in
+  }
+  ratio := float64(to) / float64(from)
+  cutoff := math.Min(1, ratio) // of the input's Nyquist frequency
+  kernel := make([]float64, Resample_zeros * Resample_phases + 2)
+  for i := range kernel {
+    x := float64(i) / Resample_phases
+    // blackman window
+    w := 0.42 + 0.5 * math.Cos(math.Pi * x / Resample_zeros) + 0.08 * math.Cos(2 * math.Pi * x / Resample_zeros)
+    kernel[i] = w
+    if x > 0 {
+      kernel[i] *= math.Sin(math.Pi * x) / (math.Pi * x)
+    }
+    if x >= Resample_zeros {
+      kernel[i] = 0
+    }
+  }
+  at := func(x float64) float64 {
+    p := math.Abs(x) * Resample_phases
+    i := int(p)
+    if i + 1 >= len(kernel) {
+      return 0
+    }
+    return kernel[i] + (kernel[i + 1] - kernel[i]) * (p - float64(i))
+  }
+
+  out := make([]float64, int(float64(len(in)) * ratio))
+  reach := float64(Resample_zeros) / cutoff // in input samples
+  for j := range out {
+    t := float64(j) / ratio
+    sum := 0.0
+    for i:=max(0, int(math.Ceil(t - reach))); i<=min(len(in) - 1, int(t + reach)); i++ {
+      sum += in[i] * at((t - float64(i)) * cutoff)
+    }
+    out[j] = sum * cutoff
+  }
+  return out
+}
+
+/**
+ * Interleaves two channels into 16 bit samples, clipping.
+ */
+func pcm16(left []float64, right []float64) []byte {
+  buf := bytes.Buffer{}
+  for i := range left {
+    for _, v := range []float64{left[i], right[i]} {
+      write_int16(&buf, int(math.Round(math.Max(-32768, math.Min(32767, v * 32768)))))
+    }
+  }
+  return buf.Bytes()
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+  "math"
+  "testing"
+)
+
+/**
+ * Resampling keeps tones below both Nyquist frequencies, and removes the
+ * ones above the output's, which would alias.
+ */
+func TestResample(t *testing.T) {
+  tone := func(frequency float64, rate int, n int) []float64 {
+    r := make([]float64, n)
+    for i := range r {
+      r[i] = 0.5 * math.Sin(2 * math.Pi * frequency * float64(i) / float64(rate))
+    }
+    return r
+  }
+  out := resample(tone(1000, 48000, 48000), 48000, Sample_rate)
+  expected := tone(1000, Sample_rate, len(out))
+  worst := 0.0
+  for i:=1000; i<len(out) - 1000; i++ {
+    worst = math.Max(worst, math.Abs(out[i] - expected[i]))
+  }
+  if worst > 0.001 {
+    t.Errorf("1kHz from 48kHz: off by up to %g", worst)
+  }
+
+  out = resample(tone(30000, 96000, 96000), 96000, Sample_rate)
+  loudest := 0.0
+  for i:=1000; i<len(out) - 1000; i++ {
+    loudest = math.Max(loudest, math.Abs(out[i]))
+  }
+  if loudest > 0.005 {
+    t.Errorf("30kHz from 96kHz: got up to %g, expecting it filtered out", loudest)
+  }
+}
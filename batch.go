@@ -0,0 +1,177 @@
+package main
+
+import (
+  "encoding/csv"
+  "flag"
+  "fmt"
+  "io"
+  "os"
+  "path/filepath"
+  "sort"
+  "strings"
+)
+
+/**
+ * Column holding the name of the file to create for a row. Rows without one
+ * get numbered.
+ */
+const Output_column = "output"
+
+/**
+ * Registers the flags which describe a design: pattern options, geometry and
+ * seed. These are the flags a row may set.
+ */
+func design_flags(fs *flag.FlagSet) (*Pattern_options, *Geometry, *Metadata) {
+  return pattern_flags(fs), geometry_flags(fs), seed_flag(fs)
+}
+
+/**
+ * Checks the columns. A column is either a design flag (with _ instead of -),
+ * the output column or a template variable. Since a typo'd flag becomes a
+ * variable, columns which look like a flag get a warning.
+ */
+func check_columns(filename string, header []string) error {
+  fs := flag.NewFlagSet("", flag.ContinueOnError)
+  design_flags(fs)
+  names := []string{Output_column}
+  fs.VisitAll(func(f *flag.Flag) {
+    names = append(names, strings.ReplaceAll(f.Name, "-", "_"))
+  })
+  sort.Strings(names)
+  for i, column := range header {
+    if column == Output_column || fs.Lookup(strings.ReplaceAll(column, "_", "-")) != nil {
+      continue
+    }
+    if !variable_name.MatchString(column) {
+      return fmt.Errorf("%s:1:%d: invalid variable name %q", filename, i + 1, column)
+    }
+    if s := suggest(column, names); s != "" {
+      logger.warnf("%s:1:%d: column %q is a template variable%s", filename, i + 1, column, s)
+    }
+  }
+  return nil
+}
+
+/**
+ * Creates the wav file for one row. The row wins over the command line, which
+ * wins over the project file.
+ */
+func batch_row(cmdline *flag.FlagSet, project string, dir string, n int, header []string, row []string, r *csv.Reader, filename string) error {
+  fs := flag.NewFlagSet("", flag.ContinueOnError)
+  fs.SetOutput(io.Discard)
+  o, g, m := design_flags(fs)
+  o.variables = Variables{}
+  cmdline.Visit(func(f *flag.Flag) {
+    if v, ok := f.Value.(*Variables); ok {
+      for name, value := range *v {
+        o.variables[name] = value
+      }
+    } else if fs.Lookup(f.Name) != nil {
+      fs.Set(f.Name, f.Value.String())
+    }
+  })
+
+  name := fmt.Sprintf("%03d.wav", n)
+  for i, column := range header {
+    if fs.Lookup(strings.ReplaceAll(column, "_", "-")) == nil && column != Output_column {
+      // unlike options, an empty variable is a legit value
+      o.variables[column] = row[i]
+      continue
+    }
+    if row[i] == "" {
+      // empty cells keep the template's value
+      continue
+    }
+    if column == Output_column {
+      name = row[i]
+      continue
+    }
+    if err := fs.Set(strings.ReplaceAll(column, "_", "-"), row[i]); err != nil {
+      line, col := r.FieldPos(i)
+      return fmt.Errorf("%s:%d:%d: %s: %s", filename, line, col, column, err)
+    }
+  }
+
+  pattern, err := load_project(fs, project, o.variables)
+  if err != nil {
+    return err
+  }
+  line, _ := r.FieldPos(0)
+  logger.infof("%s:%d: creating %s: %s", filename, line, name, pattern)
+  m.reseed()
+  buf, _, err := generate_pattern(pattern, o, *g)
+  if err != nil {
+    return fmt.Errorf("%s:%d: %s", filename, line, err)
+  }
+  if err := check_length(buf, o.output_geometry(*g).samples); err != nil {
+    return err
+  }
+  stamp(buf, *m)
+  return write_output(filepath.Join(dir, name), buf.Bytes())
+}
+
+func batch_command(fs *flag.FlagSet) func() int {
+  design_flags(fs)
+  project := project_flag(fs)
+  output := fs.String("o", ".", "directory to write the wav files to")
+  fs.Usage = func() {
+    out := fs.Output()
+    fmt.Fprintf(out, "usage: %s batch [options] -project <file> <rows.csv>\n\n", os.Args[0])
+    fmt.Fprintf(out, "creates one wav file per row of the csv file. The project file is the\n")
+    fmt.Fprintf(out, "template, each column overrides one of its options. Other columns are\n")
+    fmt.Fprintf(out, "template variables, e.g. {{name}} in the text. E.g.:\n\n")
+    fmt.Fprintf(out, "  %s,marker,name\n  alice.wav,\"37.77,-122.42\",Alice\n  bob.wav,\"51.51,-0.13\",Bob\n\n", Output_column)
+    fmt.Fprintf(out, "options given on the command line apply to every row, unless the row sets them.\n\noptions:\n")
+    fs.PrintDefaults()
+  }
+  return func() int {
+    if fs.NArg() != 1 || *project == "" {
+      fs.Usage()
+      return Exit_usage
+    }
+    filename := fs.Arg(0)
+    f, err := os.Open(filename)
+    if err != nil {
+      logger.errorf("%s", err)
+      return Exit_failure
+    }
+    defer f.Close()
+
+    r := csv.NewReader(f)
+    r.TrimLeadingSpace = true
+    header, err := r.Read()
+    if err != nil {
+      logger.errorf("%s: %s", filename, err)
+      return Exit_failure
+    }
+    // catch typo'd columns before creating anything
+    if err := check_columns(filename, header); err != nil {
+      logger.errorf("%s", err)
+      return Exit_usage
+    }
+
+    rows, failures := 0, 0
+    for {
+      row, err := r.Read()
+      if err == io.EOF {
+        break
+      }
+      if err != nil {
+        logger.errorf("%s: %s", filename, err)
+        return Exit_failure
+      }
+      rows++
+      if err := batch_row(fs, *project, *output, rows, header, row, r, filename); err != nil {
+        logger.errorf("%s", err)
+        failures++
+      }
+    }
+
+    if failures > 0 {
+      logger.errorf("%d out of %d rows failed", failures, rows)
+      return Exit_failure
+    }
+    logger.infof("created %d files in %s", rows, *output)
+    return 0
+  }
+}
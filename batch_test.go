@@ -0,0 +1,52 @@
+package main
+
+import (
+  "flag"
+  "os"
+  "path/filepath"
+  "testing"
+)
+
+/**
+ * With -project -, every row gets the project read from stdin, not only the
+ * first one.
+ */
+func TestBatchProjectFromStdin(t *testing.T) {
+  dir := t.TempDir()
+  rows := filepath.Join(dir, "rows.csv")
+  if err := os.WriteFile(rows, []byte("output,frequency\na.wav,440\nb.wav,880\n"), 0644); err != nil {
+    t.Fatal(err)
+  }
+  project := filepath.Join(dir, "project.json")
+  if err := os.WriteFile(project, []byte(`{"pattern": "pitch", "geometry": {"duration": "1s"}}`), 0644); err != nil {
+    t.Fatal(err)
+  }
+  f, err := os.Open(project)
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer f.Close()
+  stdin, level := os.Stdin, logger.level
+  os.Stdin, stdin_input, logger.level = f, nil, Level_error
+  defer func() {
+    os.Stdin, stdin_input, logger.level = stdin, nil, level
+  }()
+
+  fs := flag.NewFlagSet("batch", flag.ContinueOnError)
+  run := batch_command(fs)
+  if err := fs.Parse([]string{"-project", "-", "-no-cache", "-o", dir, rows}); err != nil {
+    t.Fatal(err)
+  }
+  if code := run(); code != 0 {
+    t.Fatalf("exit code %d", code)
+  }
+  for _, name := range []string{"a.wav", "b.wav"} {
+    data, err := os.ReadFile(filepath.Join(dir, name))
+    if err != nil {
+      t.Fatal(err)
+    }
+    if _, samples, err := parse_wav(name, data); err != nil || len(samples) != Sample_rate * 4 {
+      t.Errorf("%s: %d bytes of samples, %v", name, len(samples), err)
+    }
+  }
+}
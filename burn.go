@@ -0,0 +1,234 @@
+package main
+
+import (
+  "flag"
+  "fmt"
+  "math"
+  "os"
+  "os/exec"
+  "path/filepath"
+  "regexp"
+  "runtime"
+  "strconv"
+  "strings"
+)
+
+type Burn_options struct {
+  device string
+  speed int
+  multi bool // leave the disc open for another session
+}
+
+/**
+ * A program which knows how to burn a file. Returns the command line to burn
+ * the given file. Some backends need a directory rather than a file, dir is a
+ * scratch directory for them.
+ *
+ * progress, when set, recognizes the lines which report the progress of the
+ * burn and returns the percentage done.
+ *
+ * drive is the drive to query for the laser power calibration once the burn
+ * is over, "" when the platform doesn't allow it. The backend mustn't eject
+ * the disc, it gets ejected after the query.
+ */
+type Burner struct {
+  name string
+  media string
+  drive string
+  command func(file string, dir string, o Burn_options) ([]string, error)
+  progress func(line string) (float64, bool)
+}
+
+var burners = []Burner{
+  {"drutil", "cd", "", drutil_command, nil},
+  {"wodim", "cd", "/dev/sr0", wodim_command, nil},
+  {"growisofs", "dvd", "/dev/dvd", growisofs_command, growisofs_progress},
+}
+
+/**
+ * Mac OS X. drutil burns every file in a folder, so the wav file gets linked
+ * into its own folder first.
+ */
+func drutil_command(file string, dir string, o Burn_options) ([]string, error) {
+  abs, err := filepath.Abs(file)
+  if err != nil {
+    return nil, err
+  }
+  if err := os.Symlink(abs, filepath.Join(dir, filepath.Base(file))); err != nil {
+    return nil, err
+  }
+  cmd := []string{"drutil", "burn", "-noverify", "-nofs", "-audio", "-notest", "-noappendable", "-erase", "-eject"}
+  if o.multi {
+    // erasing a rewritable disc would lose the sessions already on it
+    cmd = []string{"drutil", "burn", "-noverify", "-nofs", "-audio", "-notest", "-appendable", "-eject"}
+  }
+  if o.device != "" {
+    cmd = append(cmd, "-drive", o.device)
+  }
+  if o.speed > 0 {
+    cmd = append(cmd, "-speed", strconv.Itoa(o.speed))
+  }
+  return append(cmd, dir), nil
+}
+
+/**
+ * Linux, and anything else cdrkit runs on.
+ */
+func wodim_command(file string, dir string, o Burn_options) ([]string, error) {
+  cmd := []string{"wodim", "-v", "-dao"}
+  if o.multi {
+    // wodim only leaves the disc open in track at once mode
+    cmd = []string{"wodim", "-v", "-tao", "-multi"}
+  }
+  if o.device != "" {
+    cmd = append(cmd, "dev=" + o.device)
+  }
+  if o.speed > 0 {
+    cmd = append(cmd, "speed=" + strconv.Itoa(o.speed))
+  }
+  return append(cmd, "-audio", "-pad", file), nil
+}
+
+/**
+ * DVD±R/RW, with dvd+rw-tools. A DVD has no audio mode: the file is written
+ * as is, as a raw image, one 2048 byte sector after the other.
+ */
+func growisofs_command(file string, dir string, o Burn_options) ([]string, error) {
+  if o.multi {
+    return nil, fmt.Errorf("growisofs only appends file systems, not raw images")
+  }
+  device := o.device
+  if device == "" {
+    device = "/dev/dvd"
+  }
+  cmd := []string{"growisofs", "-dvd-compat"}
+  if o.speed > 0 {
+    cmd = append(cmd, "-speed=" + strconv.Itoa(o.speed))
+  }
+  return append(cmd, "-Z", device + "=" + file), nil
+}
+
+// e.g. "  1540096/4700372992 ( 0.0%) @0.0x, remaining 6:12 RBU 100.0% UBU  99.2%"
+var growisofs_progress_line = regexp.MustCompile(`^\s*\d+/\d+\s*\(\s*([0-9.]+)%\)`)
+
+func growisofs_progress(line string) (float64, bool) {
+  m := growisofs_progress_line.FindStringSubmatch(line)
+  if m == nil {
+    return 0, false
+  }
+  p, err := strconv.ParseFloat(m[1], 64)
+  return p, err == nil
+}
+
+func default_burner() string {
+  if runtime.GOOS == "darwin" {
+    return "drutil"
+  }
+  return "wodim"
+}
+
+func burn_command(fs *flag.FlagSet) func() int {
+  backend := fs.String("backend", default_burner(), "program used to burn the disc")
+  o := Burn_options{}
+  fs.StringVar(&o.device, "device", "", "drive to burn with, defaults to the backend's choice (/dev/dvd for growisofs)")
+  fs.IntVar(&o.speed, "speed", 0, "burn speed, 0 for the backend's default")
+  fs.BoolVar(&o.multi, "multi", false, "leave the disc open, for the journal command's next session")
+  dry_run := fs.Bool("dry-run", false, "print the command instead of running it")
+  fs.Usage = func() {
+    names := []string{}
+    for _, b := range burners {
+      names = append(names, b.name)
+    }
+    fmt.Fprintf(fs.Output(), "usage: %s burn [options] <file.wav>\n\nbackends: %s\n\noptions:\n",
+      os.Args[0], strings.Join(names, ", "))
+    fs.PrintDefaults()
+  }
+  return func() int {
+    if fs.NArg() != 1 || o.speed < 0 {
+      fs.Usage()
+      return Exit_usage
+    }
+    file := fs.Arg(0)
+
+    var burner *Burner
+    for i := range burners {
+      if burners[i].name == *backend {
+        burner = &burners[i]
+      }
+    }
+    if burner == nil {
+      logger.errorf("unknown backend: %s", *backend)
+      return Exit_usage
+    }
+    if burner.media == "cd" {
+      // a malformed file wastes a blank
+      r, err := selfcheck(file, 0)
+      if err != nil {
+        logger.errorf("%s", err)
+        return Exit_failure
+      }
+      for _, line := range r.lines {
+        logger.debugf("%s", line)
+      }
+      if r.failures > 0 {
+        logger.errorf("%s failed the self check, run '%s selfcheck %s' for details", file, os.Args[0], file)
+        return Exit_failure
+      }
+    } else if strings.EqualFold(filepath.Ext(file), ".wav") {
+      logger.warnf("%s burns a raw image, the wav file's header will be burned along with the samples", burner.name)
+    }
+
+    dir, err := os.MkdirTemp("", "micro-engraving")
+    if err != nil {
+      logger.errorf("%s", err)
+      return Exit_failure
+    }
+    defer os.RemoveAll(dir)
+    logger.debugf("scratch directory: %s", dir)
+
+    cmd, err := burner.command(file, dir, o)
+    if err != nil {
+      logger.errorf("%s", err)
+      return Exit_failure
+    }
+    logger.infof("%s", strings.Join(cmd, " "))
+    if *dry_run {
+      return 0
+    }
+
+    c := exec.Command(cmd[0], cmd[1:]...)
+    c.Stdout = logger.writer(Level_info)
+    c.Stderr = logger.writer(Level_info)
+    if burner.progress != nil {
+      // progress lines come several times a second, report every 10%
+      next := 0.0
+      c.Stderr = line_writer(func(line string) {
+        p, ok := burner.progress(line)
+        if !ok {
+          logger.infof("%s", line)
+        } else if p >= next {
+          logger.infof("%s: %.0f%% done", burner.name, math.Floor(p))
+          next = p - math.Mod(p, 10) + 10
+        } else {
+          logger.debugf("%s", line)
+        }
+      })
+    }
+    if err := c.Run(); err != nil {
+      logger.errorf("%s: %s", cmd[0], err)
+      return Exit_failure
+    }
+
+    if burner.drive != "" {
+      drive := o.device
+      if drive == "" {
+        drive = burner.drive
+      }
+      log_opc(drive, burner.media)
+      if err := exec.Command("eject", drive).Run(); err != nil {
+        logger.warnf("eject %s: %s", drive, err)
+      }
+    }
+    return 0
+  }
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+  "bytes"
+  "crypto/sha256"
+  "encoding/binary"
+  "fmt"
+  "os"
+  "path/filepath"
+  "sort"
+  "time"
+)
+
+/**
+ * The pattern stage is the slow one: a full disc is close to a billion bytes,
+ * each one looked up on the canvas. What comes after it, the fill, the
+ * watermark and the protected ranges, is quick. The output of slow pattern
+ * stages is kept in the user's cache directory, so that changing one of the
+ * later options, or the seed, only redoes the quick stages.
+ *
+ * Designs are mostly long runs of the same byte, they are stored run length
+ * encoded. Designs which don't compress, e.g. sounds, aren't worth caching.
+ */
+const (
+  Cache_min_time = time.Second // stages quicker than this aren't cached
+  Cache_max_size int64 = 1 << 30 // in bytes, the oldest entries go first
+)
+
+/**
+ * Directory holding the cached designs and downloads, "" when there's none.
+ * Tests point it at a temporary directory, away from the user's cache.
+ */
+var cache_dir = func() string {
+  dir, err := os.UserCacheDir()
+  if err != nil {
+    return ""
+  }
+  return filepath.Join(dir, "micro-engraving")
+}()
+
+/**
+ * Identifies the output of a pattern stage: the build, the pattern, the
+ * options the stage uses, the files it reads and the geometry.
+ */
+func design_key(pattern Pattern, o *Pattern_options, g Geometry) string {
+  stage := *o
+  stage.fill_to, stage.background, stage.watermark, stage.protect, stage.intro, stage.signature, stage.no_cache = 0, "", Watermark_options{}, nil, "", "", false
+  stage.provenance, stage.zone_pairs, stage.silent_intro = false, nil, 0
+  stage.stack, stage.stack_index, stage.kaleidoscope, stage.kaleidoscope_fold = "", 0, 0, ""
+  build := version
+  if exe, err := os.Executable(); err == nil {
+    if stat, err := os.Stat(exe); err == nil {
+      build += fmt.Sprintf(" %d %d", stat.Size(), stat.ModTime().UnixNano())
+    }
+  }
+  h := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%+v|%s|%+v", build, pattern, stage, o.inputs(), g)))
+  return fmt.Sprintf("%x", h[:16])
+}
+
+func design_cache(key string) string {
+  if cache_dir == "" {
+    return ""
+  }
+  return filepath.Join(cache_dir, "designs", key)
+}
+
+/**
+ * Pairs of a byte and how many times it repeats, as a uvarint.
+ */
+func run_length_encode(data []byte) []byte {
+  r := []byte{}
+  for i:=0; i<len(data); {
+    j := i + 1
+    for j < len(data) && data[j] == data[i] {
+      j++
+    }
+    r = append(r, data[i])
+    r = binary.AppendUvarint(r, uint64(j - i))
+    i = j
+  }
+  return r
+}
+
+func run_length_decode(data []byte, size int) ([]byte, error) {
+  r := make([]byte, 0, size)
+  for i:=0; i<len(data); {
+    n, k := binary.Uvarint(data[i+1:])
+    if k <= 0 || len(r) + int(n) > size {
+      return nil, fmt.Errorf("corrupted cache entry")
+    }
+    v := data[i]
+    for ; n > 0; n-- {
+      r = append(r, v)
+    }
+    i += 1 + k
+  }
+  if len(r) != size {
+    return nil, fmt.Errorf("corrupted cache entry")
+  }
+  return r, nil
+}
+
+/**
+ * Returns the cached output of a pattern stage, nil when there isn't any.
+ */
+func cached_design(key string, size int) []byte {
+  filename := design_cache(key)
+  if filename == "" {
+    return nil
+  }
+  data, err := os.ReadFile(filename)
+  if err != nil {
+    return nil
+  }
+  r, err := run_length_decode(data, size)
+  if err != nil {
+    logger.warnf("%s: %s", filename, err)
+    os.Remove(filename)
+    return nil
+  }
+  // the entry was just used, it goes last when pruning
+  now := time.Now()
+  os.Chtimes(filename, now, now)
+  return r
+}
+
+func cache_design(key string, design []byte, took time.Duration) {
+  filename := design_cache(key)
+  if filename == "" || took < Cache_min_time {
+    return
+  }
+  data := run_length_encode(design)
+  if len(data) > len(design) / 4 {
+    logger.debugf("not caching the design, it doesn't compress")
+    return
+  }
+  err := os.MkdirAll(filepath.Dir(filename), 0755)
+  if err == nil {
+    err = os.WriteFile(filename, data, 0644)
+  }
+  if err != nil {
+    logger.warnf("not caching the design: %s", err)
+    return
+  }
+  logger.debugf("cached the design in %s, %d bytes", filename, len(data))
+  prune_cache(filepath.Dir(filename))
+}
+
+/**
+ * Removes the least recently used entries until the cache fits in
+ * Cache_max_size.
+ */
+func prune_cache(dir string) {
+  entries, err := os.ReadDir(dir)
+  if err != nil {
+    return
+  }
+  infos := []os.FileInfo{}
+  total := int64(0)
+  for _, e := range entries {
+    if info, err := e.Info(); err == nil {
+      infos = append(infos, info)
+      total += info.Size()
+    }
+  }
+  sort.Slice(infos, func(i int, j int) bool {
+    return infos[i].ModTime().Before(infos[j].ModTime())
+  })
+  for _, info := range infos {
+    if total <= Cache_max_size {
+      break
+    }
+    if os.Remove(filepath.Join(dir, info.Name())) == nil {
+      total -= info.Size()
+    }
+  }
+}
+
+/**
+ * Appends the output of the pattern stage to buf, from the cache when
+ * possible.
+ */
+func cached_stage(buf *bytes.Buffer, pattern Pattern, o *Pattern_options, g Geometry, stage func() error) error {
+  if o.no_cache {
+    return stage()
+  }
+  key := design_key(pattern, o, g)
+  if design := cached_design(key, int(g.samples) * 4); design != nil {
+    logger.infof("%s: reusing the cached design", pattern)
+    buf.Write(design)
+    return nil
+  }
+  start, n := time.Now(), buf.Len()
+  if err := stage(); err != nil {
+    return err
+  }
+  cache_design(key, buf.Bytes()[n:], time.Since(start))
+  return nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+  "bytes"
+  "os"
+  "testing"
+)
+
+/**
+ * Runs the tests with a cache of their own, the designs they generate don't
+ * end up in the user's cache.
+ */
+func TestMain(m *testing.M) {
+  dir, err := os.MkdirTemp("", "micro-engraving-cache")
+  if err != nil {
+    panic(err)
+  }
+  cache_dir = dir
+  code := m.Run()
+  os.RemoveAll(dir)
+  os.Exit(code)
+}
+
+func TestRunLength(t *testing.T) {
+  for _, data := range [][]byte{{}, {Dark}, bytes.Repeat([]byte{Light}, 300), []byte{Dark, Dark, Light, 0x40, 0x40, 0x40}} {
+    encoded := run_length_encode(data)
+    decoded, err := run_length_decode(encoded, len(data))
+    if err != nil || !bytes.Equal(decoded, data) {
+      t.Errorf("%x: decoded as %x, %v", data, decoded, err)
+    }
+    if len(data) > 0 {
+      if _, err := run_length_decode(encoded, len(data) - 1); err == nil {
+        t.Errorf("%x: decoded into %d bytes", data, len(data) - 1)
+      }
+    }
+  }
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+  "bytes"
+  "flag"
+  "fmt"
+  "math"
+  "os"
+)
+
+/**
+ * Candidate values for dark and light. The first pair is the one used by
+ * every pattern.
+ */
+var calibration_pairs = [][2]byte{
+  {Dark, Light},
+  {0x00, 0xff},
+  {0x55, 0xaa},
+  {0x0f, 0xf0},
+  {0x33, 0xcc},
+  {0x3c, 0xc3},
+  {0x66, 0x99},
+  {0x11, 0xee},
+}
+
+/**
+ * A ring of the calibration disc, made of line_pairs dark sectors alternating
+ * with as many light sectors.
+ */
+type Calibration_band struct {
+  inner float64 // in mm
+  outer float64 // in mm
+  dark byte
+  light byte
+  line_pairs int
+}
+
+/**
+ * The inner two thirds of the program area compare the candidate pairs, each
+ * band being split in four like the pie pattern. The outer third is a line
+ * pair chart, with finer and finer sectors as the radius grows.
+ */
+func calibration_layout(g Geometry) []Calibration_band {
+  inner := float64(g.start_radius)
+  outer := float64(g.end_radius())
+  split := inner + (outer - inner) * 2 / 3
+
+  bands := []Calibration_band{}
+  step := (split - inner) / float64(len(calibration_pairs))
+  for i, pair := range calibration_pairs {
+    r := inner + float64(i) * step
+    bands = append(bands, Calibration_band{r, r + step, pair[0], pair[1], 2})
+  }
+  charts := 8
+  step = (outer - split) / float64(charts)
+  for i:=0; i<charts; i++ {
+    r := split + float64(i) * step
+    bands = append(bands, Calibration_band{r, r + step, Dark, Light, 32 << uint(i)})
+  }
+  // make sure the last ring falls in the last band
+  bands[len(bands)-1].outer = math.Inf(1)
+  return bands
+}
+
+func calibration(buf *bytes.Buffer, g Geometry) {
+  bands := calibration_layout(g)
+  b := 0
+  spiral(buf, g, func(radius float64, angle float64) byte {
+    for radius >= bands[b].outer {
+      b++
+    }
+    band := bands[b]
+    if int(angle / (2 * math.Pi) * float64(2 * band.line_pairs)) % 2 == 0 {
+      return band.dark
+    }
+    return band.light
+  })
+}
+
+func calibrate_command(fs *flag.FlagSet) func() int {
+  g := geometry_flags(fs)
+  m := seed_flag(fs)
+  output := fs.String("o", "-", "output file, - for stdout")
+  fs.Usage = func() {
+    fmt.Fprintf(fs.Output(), "usage: %s calibrate [options]\n\n", os.Args[0])
+    fmt.Fprintf(fs.Output(), "The calibration disc compares the following dark/light pairs, from the\n")
+    fmt.Fprintf(fs.Output(), "inside out, followed by a line pair chart:\n")
+    for _, pair := range calibration_pairs {
+      fmt.Fprintf(fs.Output(), "  0x%02x/0x%02x\n", pair[0], pair[1])
+    }
+    fmt.Fprintf(fs.Output(), "\noptions:\n")
+    fs.PrintDefaults()
+  }
+  return func() int {
+    if fs.NArg() != 0 {
+      fs.Usage()
+      return Exit_usage
+    }
+
+    if err := g.validate(); err != nil {
+      logger.errorf("%s", err)
+      return Exit_usage
+    }
+
+    logger.infof("creating calibration disc")
+    logger.infof("%s", g.describe())
+    m.reseed()
+    buf := &bytes.Buffer{}
+    wav_header(buf, g.samples)
+    calibration(buf, *g)
+    if err := check_length(buf, g.samples); err != nil {
+      logger.errorf("%s", err)
+      return Exit_failure
+    }
+    stamp(buf, *m)
+    if err := write_output(*output, buf.Bytes()); err != nil {
+      logger.errorf("%s", err)
+      return Exit_failure
+    }
+    return 0
+  }
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+  "bytes"
+  "math"
+)
+
+const (
+  Dark byte = 0x40
+  Light byte = 0x45
+
+  Disc_radius float64 = 60.0 // in mm
+  Canvas_resolution float64 = 0.05 // in mm
+  Jitter_step = 0.6180339887498949 // golden ratio, see engrave
+)
+
+type Point struct {
+  x float64
+  y float64
+}
+
+/**
+ * A square raster covering the whole disc, as seen from the data side. The
+ * origin is at the center of the disc, coordinates are in mm. Each pixel
+ * holds a tone between 0 (light) and 1 (dark), and, for layers drawn from
+ * images with transparent parts, how much of the pixel the layer covers.
+ */
+type Canvas struct {
+  radius float64
+  resolution float64
+  size int
+  pixels []float32
+  diffuse bool // greys get diffused along the spiral, see halftone
+  mask []float32 // from 0 (transparent) to 1, nil when the tones alone tell what the layer covers
+}
+
+func new_canvas(radius float64, resolution float64) *Canvas {
+  size := int(math.Ceil(2 * radius / resolution))
+  return &Canvas{
+    radius: radius,
+    resolution: resolution,
+    size: size,
+    pixels: make([]float32, size * size),
+  }
+}
+
+func (c *Canvas) index(x float64, y float64) (int, bool) {
+  i := int((x + c.radius) / c.resolution)
+  j := int((c.radius - y) / c.resolution)
+  if i < 0 || j < 0 || i >= c.size || j >= c.size {
+    return 0, false
+  }
+  return j * c.size + i, true
+}
+
+func (c *Canvas) at(x float64, y float64) float32 {
+  if i, ok := c.index(x, y); ok {
+    return c.pixels[i]
+  }
+  return 0
+}
+
+func (c *Canvas) set(x float64, y float64, v float32) {
+  if i, ok := c.index(x, y); ok {
+    c.pixels[i] = v
+  }
+}
+
+func (c *Canvas) coverage(x float64, y float64) float32 {
+  if i, ok := c.index(x, y); ok && c.mask != nil {
+    return c.mask[i]
+  }
+  return 0
+}
+
+func (c *Canvas) set_coverage(x float64, y float64, v float32) {
+  if c.mask == nil {
+    c.mask = make([]float32, len(c.pixels))
+  }
+  if i, ok := c.index(x, y); ok {
+    c.mask[i] = v
+  }
+}
+
+/**
+ * Draws a straight dark line with round ends.
+ */
+func (c *Canvas) line(a Point, b Point, width float64) {
+  half := width / 2
+  min_x, max_x := math.Min(a.x, b.x) - half, math.Max(a.x, b.x) + half
+  min_y, max_y := math.Min(a.y, b.y) - half, math.Max(a.y, b.y) + half
+  dx, dy := b.x - a.x, b.y - a.y
+  l := dx * dx + dy * dy
+  for y:=min_y; y<=max_y; y+=c.resolution {
+    for x:=min_x; x<=max_x; x+=c.resolution {
+      // distance from (x, y) to the closest point of the segment
+      t := 0.0
+      if l > 0 {
+        t = math.Max(0, math.Min(1, ((x - a.x) * dx + (y - a.y) * dy) / l))
+      }
+      px, py := a.x + t * dx - x, a.y + t * dy - y
+      if px * px + py * py <= half * half {
+        c.set(x, y, 1)
+      }
+    }
+  }
+}
+
+func (c *Canvas) polyline(points []Point, width float64) {
+  for i:=1; i<len(points); i++ {
+    c.line(points[i-1], points[i], width)
+  }
+}
+
+func (c *Canvas) circle(center Point, radius float64, width float64) {
+  points := []Point{}
+  n := int(math.Max(16, 2 * math.Pi * radius / c.resolution))
+  for i:=0; i<=n; i++ {
+    a := 2 * math.Pi * float64(i) / float64(n)
+    points = append(points, Point{center.x + radius * math.Cos(a), center.y + radius * math.Sin(a)})
+  }
+  c.polyline(points, width)
+}
+
+/**
+ * Walks along the spiral and writes one byte at a time, dark or light
+ * depending on the canvas underneath. When the canvas diffuses its greys,
+ * what each byte gets wrong is carried over to the next one.
+ *
+ * With jitter, each revolution reads the canvas a little ahead or behind
+ * along the track, by up to half a pixel. The dozens of revolutions which
+ * cross a row of pixels all switch tone at the same angle otherwise, and a
+ * curved or diagonal edge shows as stair steps. The offsets follow the
+ * golden ratio from one revolution to the next, so that neighbours always
+ * get offsets far apart and any few of them spread evenly over the pixel:
+ * the steps turn into fine noise along the edge.
+ */
+func engrave(buf *bytes.Buffer, c *Canvas, g Geometry, jitter bool) {
+  rings := g.rings(g.samples)
+  logger.debugf("engraving %d revolutions, %s per sample", len(rings), g.sample_length())
+  e := float32(0)
+  for _, ring := range rings {
+    if ring.index % 1000 == 0 {
+      logger.tracef("revolution %d: radius %s, first sample %d", ring.index, ring.radius, ring.start)
+    }
+    // each sample is 4 bytes long
+    radius, angle := float64(ring.radius), float64(ring.angle)
+    delta := float64(g.sample_length()) / 4 / radius
+    cos_d, sin_d := math.Cos(delta), math.Sin(delta)
+    if jitter {
+      angle += (math.Mod(float64(ring.index) * Jitter_step, 1) - 0.5) * c.resolution / radius
+    }
+    x, y := radius * math.Cos(angle), radius * math.Sin(angle)
+    for i:=0; i<ring.samples * 4; i++ {
+      v := c.at(x, y)
+      if c.diffuse {
+        e += v
+        v = e
+        if e >= 0.5 {
+          e--
+        }
+      }
+      if v >= 0.5 {
+        buf.WriteByte(Dark)
+      } else {
+        buf.WriteByte(Light)
+      }
+      x, y = x * cos_d - y * sin_d, x * sin_d + y * cos_d
+    }
+  }
+}
+
+/**
+ * Walks along the spiral and writes one byte at a time, as returned by value
+ * for the position of the byte. The angle is between 0 and 2π.
+ */
+func spiral(buf *bytes.Buffer, g Geometry, value func(radius float64, angle float64) byte) {
+  rings := g.rings(g.samples)
+  logger.debugf("writing %d revolutions, %s per sample", len(rings), g.sample_length())
+  for _, ring := range rings {
+    if ring.index % 1000 == 0 {
+      logger.tracef("revolution %d: radius %s, first sample %d", ring.index, ring.radius, ring.start)
+    }
+    radius, angle := float64(ring.radius), float64(ring.angle)
+    delta := float64(g.sample_length()) / 4 / radius
+    for i:=0; i<ring.samples * 4; i++ {
+      buf.WriteByte(value(radius, math.Mod(angle + float64(i) * delta, 2 * math.Pi)))
+    }
+  }
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+  "encoding/json"
+  "fmt"
+  "hash/crc32"
+)
+
+/**
+ * A table of crcs of the samples, one per second or one per ring, with the
+ * radii each one covers. verify-rip checks a rip of any design against it,
+ * and tells where on the disc the damage is, e.g. at the rim, which isn't
+ * the same problem as at the hub.
+ */
+type Checksum_table struct {
+  Per string `json:"per"` // second or ring
+  Samples int `json:"samples"`
+  Entries []Checksum_entry `json:"entries"`
+}
+
+type Checksum_entry struct {
+  Start int `json:"start"` // in samples
+  Samples int `json:"samples"`
+  Crc32 uint32 `json:"crc32"`
+  Inner float64 `json:"inner"` // in mm
+  Outer float64 `json:"outer"`
+}
+
+/**
+ * Checksums the samples of a whole output, laid out with g.
+ */
+func checksum_table(data []byte, g Geometry, per string) (Checksum_table, error) {
+  total := len(data) / 4
+  t := Checksum_table{Per: per, Samples: total}
+  rings := g.rings(Duration(total))
+  spans := [][2]int{}
+  switch per {
+    case "second":
+      for start:=0; start<total; start+=Sample_rate {
+        spans = append(spans, [2]int{start, min(Sample_rate, total - start)})
+      }
+    case "ring":
+      for _, r := range rings {
+        spans = append(spans, [2]int{r.start, r.samples})
+      }
+    default:
+      return t, fmt.Errorf("unknown checksum interval: %s, expecting second or ring", per)
+  }
+  for _, s := range spans {
+    inner, _ := g.position(rings, float64(s[0]))
+    outer, _ := g.position(rings, float64(s[0] + s[1] - 1))
+    t.Entries = append(t.Entries, Checksum_entry{s[0], s[1], crc32.ChecksumIEEE(data[s[0] * 4:(s[0] + s[1]) * 4]), float64(inner), float64(outer)})
+  }
+  return t, nil
+}
+
+func write_checksums(filename string, data []byte, g Geometry, per string) error {
+  t, err := checksum_table(data, g, per)
+  if err != nil {
+    return err
+  }
+  j, err := json.MarshalIndent(t, "", "  ")
+  if err != nil {
+    return err
+  }
+  logger.infof("writing %d checksums, one per %s, to %s", len(t.Entries), per, filename)
+  return write_output(filename, append(j, '\n'))
+}
+
+/**
+ * Checks a rip against the table, the burned samples starting at sample
+ * offset of the rip. Returns the entries which differ, and the ones the rip
+ * is too short to hold.
+ */
+func verify_checksums(data []byte, t Checksum_table, offset int) ([]Checksum_entry, []Checksum_entry) {
+  differ, missing := []Checksum_entry{}, []Checksum_entry{}
+  for _, e := range t.Entries {
+    from, to := (offset + e.Start) * 4, (offset + e.Start + e.Samples) * 4
+    if from < 0 || to > len(data) {
+      missing = append(missing, e)
+      continue
+    }
+    if crc32.ChecksumIEEE(data[from:to]) != e.Crc32 {
+      differ = append(differ, e)
+    }
+  }
+  return differ, missing
+}
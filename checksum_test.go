@@ -0,0 +1,36 @@
+package main
+
+import (
+  "testing"
+)
+
+/**
+ * Corrupted bytes show up in the entry which holds them, with the radii
+ * they're at.
+ */
+func TestChecksums(t *testing.T) {
+  data := generate_test_pattern(t, Pie, []string{"-duration", "10s"})[Wav_header_size:10 * Sample_rate * 4 + Wav_header_size]
+  g := default_geometry()
+  g.samples = Duration(10 * Sample_rate)
+  for _, per := range []string{"second", "ring"} {
+    table, err := checksum_table(data, g, per)
+    if err != nil {
+      t.Fatal(err)
+    }
+    rip := append([]byte{}, data...)
+    sample := 5 * Sample_rate + 1234
+    rip[sample * 4] ^= 0xff
+    differ, missing := verify_checksums(rip, table, 0)
+    if len(differ) != 1 || len(missing) != 0 {
+      t.Fatalf("per %s: got %d differing and %d missing entries, expecting one differing", per, len(differ), len(missing))
+    }
+    e := differ[0]
+    radius, _ := g.position(g.rings(g.samples), float64(sample))
+    if sample < e.Start || sample >= e.Start + e.Samples || float64(radius) < e.Inner || float64(radius) > e.Outer {
+      t.Errorf("per %s: sample %d at %s reported in %d-%d, %s to %s", per, sample, radius, e.Start, e.Start + e.Samples, Length(e.Inner), Length(e.Outer))
+    }
+    if differ, _ := verify_checksums(data, table, 0); len(differ) != 0 {
+      t.Errorf("per %s: %d entries of the original differ", per, len(differ))
+    }
+  }
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+  "bytes"
+  "flag"
+  "fmt"
+  "image"
+  "math"
+  "os"
+  "sort"
+)
+
+/**
+ * The decode and preview commands, backwards: from a photo or scan of a
+ * burned disc, any disc, to the samples which would burn about the same
+ * picture. A research mode, to round trip the rendering code and to copy
+ * art found on other discs.
+ *
+ * The tone under each byte goes from the lightest to the darkest parts of
+ * the disc at that radius, which evens out a photo's uneven lighting. Rings
+ * which are about the same tone all around use the whole disc's range
+ * instead, lest noise gets stretched into a pattern. Greys become a share of
+ * dark bytes along the track, diffusing the error from one byte to the next.
+ */
+const (
+  Clone_bin = 0.25 // width of the rings whose tones get compared, in mm
+  Clone_angles = 720
+)
+
+type Tone_range struct {
+  dark float64
+  light float64
+}
+
+/**
+ * Darkness of v in the range, between 0 and 1.
+ */
+func (t Tone_range) darkness(v float64) float64 {
+  return math.Max(0, math.Min(1, (t.light - v) / (t.light - t.dark)))
+}
+
+/**
+ * The tone ranges of the rings of the program area, from the 5th to the 95th
+ * percentile of each.
+ */
+func tone_ranges(img *image.Gray, center Point, px_per_mm float64, g Geometry) []Tone_range {
+  b := img.Bounds()
+  pixel := func(r float64, a float64) (float64, bool) {
+    p := image.Pt(int((center.x + r * math.Cos(a)) * px_per_mm), int((center.y - r * math.Sin(a)) * px_per_mm))
+    if !p.In(b) {
+      return 0, false
+    }
+    return float64(img.GrayAt(p.X, p.Y).Y), true
+  }
+  percentiles := func(values []float64) Tone_range {
+    sort.Float64s(values)
+    return Tone_range{values[len(values) * 5 / 100], values[len(values) * 95 / 100]}
+  }
+
+  ranges := []Tone_range{}
+  all := []float64{}
+  for r:=float64(g.start_radius); r<float64(g.end_radius()) + Clone_bin; r+=Clone_bin {
+    values := []float64{}
+    for i:=0; i<Clone_angles; i++ {
+      if v, ok := pixel(r + Clone_bin / 2, 2 * math.Pi * float64(i) / Clone_angles); ok {
+        values = append(values, v)
+      }
+    }
+    if len(values) == 0 {
+      values = []float64{0x80}
+    }
+    all = append(all, values...)
+    ranges = append(ranges, percentiles(values))
+  }
+  disc := percentiles(all)
+  for i, t := range ranges {
+    if t.light - t.dark < (disc.light - disc.dark) / 4 {
+      ranges[i] = disc
+    }
+  }
+  return ranges
+}
+
+func clone(buf *bytes.Buffer, img *image.Gray, center Point, px_per_mm float64, g Geometry) {
+  ranges := tone_ranges(img, center, px_per_mm, g)
+  b := img.Bounds()
+  e := 0.0
+  spiral(buf, g, func(radius float64, angle float64) byte {
+    p := image.Pt(int((center.x + radius * math.Cos(angle)) * px_per_mm), int((center.y - radius * math.Sin(angle)) * px_per_mm))
+    if !p.In(b) {
+      return Light
+    }
+    t := ranges[min(len(ranges) - 1, int((radius - float64(g.start_radius)) / Clone_bin))]
+    e += t.darkness(float64(img.GrayAt(p.X, p.Y).Y))
+    if e >= 0.5 {
+      e--
+      return Dark
+    }
+    return Light
+  })
+}
+
+func clone_command(fs *flag.FlagSet) func() int {
+  g := geometry_flags(fs)
+  load := disc_image_flags(fs, g)
+  m := seed_flag(fs)
+  output := fs.String("o", "-", "output file, - for stdout")
+  fs.Usage = func() {
+    fmt.Fprintf(fs.Output(), "usage: %s clone [options] <scan.png | file.wav>\n\n", os.Args[0])
+    fmt.Fprintf(fs.Output(), "creates the samples which would burn about the same picture as a photo or\n")
+    fmt.Fprintf(fs.Output(), "scan of a disc. A wav file gets rendered first, which round trips the\n")
+    fmt.Fprintf(fs.Output(), "preview. The geometry options are the ones of the new disc.\n\noptions:\n")
+    fs.PrintDefaults()
+  }
+  return func() int {
+    if fs.NArg() != 1 {
+      fs.Usage()
+      return Exit_usage
+    }
+    if err := g.validate(); err != nil {
+      logger.errorf("%s", err)
+      return Exit_usage
+    }
+    img, c, px_per_mm, err := load(fs.Arg(0))
+    if err != nil {
+      logger.errorf("%s", err)
+      return Exit_failure
+    }
+    logger.infof("%s", g.describe())
+    m.reseed()
+    buf := &bytes.Buffer{}
+    wav_header(buf, g.samples)
+    clone(buf, img, c, px_per_mm, *g)
+    if err := check_length(buf, g.samples); err != nil {
+      logger.errorf("%s", err)
+      return Exit_failure
+    }
+    stamp(buf, *m)
+    if err := write_output(*output, buf.Bytes()); err != nil {
+      logger.errorf("%s", err)
+      return Exit_failure
+    }
+    return 0
+  }
+}
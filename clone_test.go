@@ -0,0 +1,26 @@
+package main
+
+import (
+  "bytes"
+  "testing"
+)
+
+/**
+ * A disc cloned from its own preview looks the same.
+ */
+func TestClone(t *testing.T) {
+  data := generate_test_pattern(t, Pie, []string{"-duration", "4m"})
+  g := default_geometry()
+  g.samples = Duration(4 * 60 * Sample_rate)
+  size := 600
+  img := render(data[Wav_header_size:], g, size)
+  buf := &bytes.Buffer{}
+  wav_header(buf, g.samples)
+  clone(buf, img, Point{Disc_radius, Disc_radius}, float64(size) / (2 * Disc_radius), g)
+  if err := check_length(buf, g.samples); err != nil {
+    t.Fatal(err)
+  }
+  if changed := compare_previews(img, render(buf.Bytes()[Wav_header_size:], g, size)); changed > 0.01 {
+    t.Errorf("%.1f%% of the clone's preview differs", changed * 100)
+  }
+}
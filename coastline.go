@@ -0,0 +1,177 @@
+package main
+
+/**
+ * Very coarse world coastlines, as closed loops of (longitude, latitude)
+ * pairs in degrees. Good enough at the scale of a disc, where a degree of
+ * latitude is a fraction of a mm. Longitudes past 180 are used to keep loops
+ * continuous across the antimeridian.
+ */
+var coastlines = [][]float64{
+  // North America
+  {-168, 65.5, -165, 68, -157, 71.2, -141, 69.7, -129, 70, -115, 68.5, -105, 68, -95, 68.5,
+   -88, 67, -93, 62, -94, 59, -92, 57, -85, 55.2, -82, 52.5, -79, 54.5, -77, 60, -78, 62.5,
+   -72, 61, -69, 58.5, -64, 60, -61, 56, -56, 52.3, -60, 50.2, -66, 50.2, -69, 48.5,
+   -64.2, 48.5, -65, 47, -64, 46, -61, 45.6, -60, 46.2, -63.5, 44.5, -65.8, 43.6, -67, 44.8,
+   -70.2, 43.6, -70, 41.7, -74, 40.5, -76, 37, -75.5, 35.2, -79, 33.5, -81, 31, -80, 27,
+   -80.4, 25.2, -82, 26.5, -83, 29, -85, 29.8, -89, 30.3, -89.5, 29, -94, 29.6, -97.2, 27.5,
+   -97.5, 25, -97.8, 22, -96, 19, -94.5, 18.2, -91, 18.8, -90.4, 21, -87, 21.5, -88, 18,
+   -88.5, 16, -84, 15.8, -83.4, 11, -81.5, 9, -79.5, 9.5, -77.4, 8.7, -80, 7.5, -83, 8.3,
+   -86, 11.5, -88, 13.3, -92, 14.5, -95, 16, -98, 16.2, -101, 17.5, -105.5, 20, -105, 22.5,
+   -109, 25.5, -112.5, 29.5, -114.8, 31.7, -112.5, 27.5, -109.5, 23, -112, 24.5, -115, 28,
+   -117, 32.5, -118.5, 34, -120.6, 34.6, -122.5, 37.7, -124.2, 40.4, -124, 46.2, -124.7, 48.4,
+   -123, 49, -128, 51, -130.5, 54.5, -134, 58, -137.5, 58.8, -140, 59.8, -146, 60.8, -151, 59.5,
+   -154, 57.8, -158, 56.5, -163, 54.8, -162, 56, -158, 58.5, -162, 60, -165, 62, -164, 64.5,
+   -168, 65.5},
+  // Greenland
+  {-73, 78, -60, 82, -40, 83.5, -20, 82, -18, 77, -22, 72, -25, 69, -32, 68, -40, 65, -43, 60,
+   -48, 61, -52, 64.5, -54, 68, -55, 71, -60, 75.7, -68, 76.5, -73, 78},
+  // Baffin Island
+  {-80, 73.7, -72, 71.5, -67, 69, -62, 66.8, -65, 63, -71, 62.8, -77, 64.5, -73, 68, -84, 70,
+   -80, 73.7},
+  // Victoria Island
+  {-118, 72.8, -105, 73.4, -101, 70, -110, 68.5, -118, 69.5, -118, 72.8},
+  // Ellesmere Island
+  {-90, 76.5, -80, 76.3, -70, 78.5, -62, 82, -80, 83, -93, 81, -90, 76.5},
+  // Newfoundland
+  {-59.3, 47.6, -55.5, 51.6, -55.6, 49.5, -53.5, 49.3, -52.7, 47.5, -55.8, 46.8, -59.3, 47.6},
+  // Cuba
+  {-84.9, 21.9, -82, 23.2, -80.3, 23, -77, 21.6, -74.1, 20.2, -77.7, 19.9, -78, 20.7,
+   -81.4, 22.1, -83.5, 22.1, -84.9, 21.9},
+  // Hispaniola
+  {-74.4, 18.4, -72.7, 19.9, -70, 19.7, -68.3, 18.6, -71.4, 17.6, -74.4, 18.4},
+  // South America
+  {-77.4, 8.7, -75.5, 10.5, -72, 12.4, -71, 11, -68, 10.5, -64, 10.7, -61.5, 10.6, -60, 8.4,
+   -57, 6, -54, 5.8, -51.5, 4.2, -50, 1.7, -48.5, -1, -44, -2.5, -41, -3, -37.5, -4.8, -35, -5.5,
+   -35, -9, -38.5, -13, -39, -17.5, -40.5, -21.5, -43, -23, -48.5, -26, -48.8, -28.5, -51, -31,
+   -53.5, -34, -56, -34.8, -58, -34.5, -57.3, -36.3, -57.5, -38.1, -62, -39, -65, -41,
+   -63.5, -42.7, -65.5, -45, -67.5, -46.5, -65.8, -47.8, -68.4, -50, -68.4, -52.3, -67.3, -55.9,
+   -71.5, -53.5, -74.5, -52, -75.5, -48, -74, -44, -73.8, -41, -73.6, -37, -71.6, -33,
+   -71.5, -29, -70.5, -25, -70.2, -20, -70.3, -18.4, -76.2, -14, -77.8, -11, -79.8, -7.5,
+   -81.3, -5.5, -80.3, -3.4, -80.9, -2.2, -80, 0.8, -79, 1.7, -77.5, 4, -77.3, 7.5, -77.4, 8.7},
+  // Africa
+  {-5.9, 35.8, -6.8, 34, -7.6, 33.6, -9.6, 30.4, -13, 27.5, -14.5, 26, -16.9, 21.3, -16, 19,
+   -17.5, 14.7, -16.7, 12.3, -15, 10.9, -13.3, 9, -11.5, 6.9, -7.5, 4.4, -4, 5.2, 0, 5.5,
+   2.5, 6.3, 4.5, 6.3, 6.2, 4.3, 8.5, 4.5, 9.8, 2, 9.2, -1, 11.8, -5, 12.2, -6, 13.3, -9,
+   12.6, -13.5, 11.8, -17, 14.4, -22.9, 15.2, -27, 16.5, -28.6, 18.3, -33, 18.5, -34.4, 20, -34.8,
+   22.5, -34, 25.6, -34, 28, -32.6, 31, -29.8, 32.6, -26, 35.5, -24, 35.5, -21.8, 34.7, -19.8,
+   36.8, -17.8, 40.5, -15, 40.5, -10.5, 39.4, -7, 39.2, -4.6, 41, -2, 43.5, 0.7, 45.5, 2,
+   48.5, 5.5, 51.3, 10.5, 48, 11.2, 44.5, 10.4, 43.2, 11.5, 42.6, 13.8, 39.5, 15.6, 37.3, 18.8,
+   36.9, 21.9, 35.3, 24.2, 33.8, 27.5, 32.5, 29.9, 32.3, 31.3, 29.9, 31.2, 25, 31.7, 20, 32,
+   19.5, 30.3, 15.2, 32.3, 13.2, 32.9, 11, 33.3, 10.2, 37.2, 8.6, 36.9, 3, 36.8, -1, 35.7,
+   -2.9, 35.3, -5.4, 35.9, -5.9, 35.8},
+  // Madagascar
+  {49.3, -12, 50.5, -15.5, 49.5, -17.5, 47.1, -24.9, 45, -25.5, 43.5, -22, 44.4, -16.2,
+   47.5, -14.5, 49.3, -12},
+  // Eurasia
+  {-5.6, 36, -6.3, 36.8, -8.9, 37, -9.5, 38.7, -8.8, 42, -9.3, 43, -8, 43.7, -1.8, 43.4,
+   -1.2, 46, -2.5, 47.3, -4.7, 48.4, -1.9, 49.7, 0.2, 49.5, 1.6, 50.2, 3, 51.2, 4.8, 53, 7, 53.6,
+   8.6, 55.5, 8.1, 56.6, 10.5, 57.7, 10, 54.8, 14.3, 53.9, 18.5, 54.8, 21, 55, 21, 56.8,
+   24, 57.1, 23.5, 59.3, 28, 59.6, 30, 60, 28, 60.5, 22.5, 60, 21.5, 61.5, 21.6, 63.3, 25.4, 65,
+   24.2, 65.8, 22, 65.6, 21, 64.2, 18, 62.5, 17.2, 61, 18.8, 59.9, 16.5, 57.5, 16.2, 56.2,
+   14.3, 55.5, 12.9, 55.5, 11.8, 58, 11.2, 59, 8, 58, 5.6, 58.8, 5, 61, 5, 62.2, 8.5, 63.5,
+   12, 65.5, 14, 67.3, 16, 68.5, 19, 70, 23.6, 70.6, 28, 71, 31, 70, 33, 69.3, 41, 67.7,
+   44, 66, 53, 68.6, 60, 69, 68, 72.5, 73, 68, 80, 73.5, 87, 74, 98, 76.1, 104, 77.7,
+   113, 73.7, 128, 72.8, 140, 72.5, 150, 71.5, 160, 69.6, 170, 69.9, 180, 69, 190.3, 66,
+   183, 64.5, 178, 62.5, 170, 60, 163, 58, 162.5, 56, 156.7, 51, 156, 57, 160, 61.5,
+   155, 59.3, 143, 59.3, 137.5, 54.3, 141, 52.5, 140.5, 48.5, 135, 43.5, 131, 42.5, 129.5, 41,
+   129.4, 36, 129, 35.1, 126.5, 34.4, 126.2, 37.5, 124.5, 39.8, 121, 40.8, 118, 39, 119, 37.2,
+   122.7, 37.3, 120.5, 36, 119.3, 34.6, 121, 32.1, 121.8, 30.8, 121.7, 28.5, 119.6, 25.5,
+   117, 23.5, 114, 22.3, 110.5, 21.2, 108, 21.5, 106.5, 20, 106.6, 17.5, 108.8, 15.2, 109.3, 12,
+   107.5, 10.5, 105, 8.6, 104.8, 10.3, 103, 11, 100.9, 12.7, 100, 13.5, 99.2, 10, 100.3, 7.5,
+   101.5, 6.8, 103.4, 4.5, 104.2, 1.4, 101.5, 2.8, 100.3, 5.3, 98.3, 8.2, 98.6, 10, 97.6, 16.5,
+   94.5, 16, 94.3, 19.3, 92.3, 21, 90.5, 22, 88, 21.6, 86.8, 20.7, 84.8, 19.3, 82.3, 16.7,
+   80.3, 13.5, 79.8, 10.3, 77.5, 8.1, 76.2, 10, 74.8, 12.8, 73, 17, 72.8, 19, 72.6, 21.3,
+   69, 22.3, 68.5, 23.7, 67, 24.8, 62.5, 25.2, 57.3, 25.8, 56.4, 27.1, 54, 26.6, 51.3, 27.8,
+   50.1, 30, 48, 30, 48.5, 28.5, 50.2, 26.2, 51.6, 25.3, 51.3, 24.3, 53.5, 24.1, 55.3, 25.3,
+   56.3, 26.3, 56.4, 24.8, 58.5, 23.6, 59.8, 22.4, 57.8, 19, 55, 17, 52.2, 15.6, 48.9, 14,
+   45, 12.8, 43.5, 12.7, 42.7, 16, 41, 19.5, 39.2, 21.5, 37, 25, 35, 28, 34.9, 29.5, 34.3, 27.8,
+   32.6, 29.9, 32.3, 31.3, 34.2, 31.3, 35, 32.8, 35.9, 35, 36.2, 36.6, 34, 36.2, 32, 36.6,
+   30.5, 36.4, 28, 36.7, 27.2, 37.9, 26.2, 39.4, 26.5, 40.3, 26, 40.8, 25, 40.9, 22.9, 40.6,
+   24, 38.2, 22.4, 36.5, 21.7, 36.8, 21.1, 38.3, 20.2, 39.5, 19.4, 41.8, 18.5, 42.5, 16, 43.5,
+   14.5, 45.3, 13.7, 45.6, 12.3, 45.3, 12.5, 44, 13.6, 43.6, 14.2, 42.4, 16, 41.9, 18.5, 40.2,
+   17, 40.5, 16.5, 39.6, 17.1, 39, 15.6, 38, 16.2, 38.9, 15.6, 40, 14.2, 40.8, 12.2, 41.8,
+   10.5, 42.9, 10.2, 44, 8.8, 44.4, 7.2, 43.7, 5, 43.3, 3.2, 43, 3.2, 41.9, 2.2, 41.4, 0.8, 40.8,
+   -0.3, 39.4, 0.2, 38.7, -0.7, 37.6, -2.1, 36.7, -4.4, 36.7, -5.6, 36},
+  // Black Sea
+  {29, 41.2, 31.5, 41.2, 35, 42, 38, 40.9, 41.5, 41.5, 41.6, 42.6, 39, 44.2, 37.6, 44.7,
+   36.6, 45.2, 35, 45, 33.5, 44.5, 32.5, 45.4, 31, 46.6, 29.7, 45.3, 28.6, 43.5, 27.9, 42.2,
+   29, 41.2},
+  // Caspian Sea
+  {49, 37.5, 54, 37.3, 53, 40, 52.8, 41.9, 50.5, 44.6, 53, 45.5, 51.5, 47, 49.3, 46.5,
+   47.5, 45.6, 47.5, 43, 49.5, 40.3, 49, 37.5},
+  // Great Britain
+  {-5.7, 50.1, -3.5, 50.4, 1.4, 51.2, 1.7, 52.7, 0.3, 53.5, -0.1, 54.2, -1.6, 55.6, -2.1, 57.1,
+   -1.8, 57.6, -3.8, 57.6, -3, 58.6, -5, 58.6, -5.8, 57.5, -5.6, 56.3, -6.2, 55.6, -5, 55,
+   -3, 54.9, -3.4, 54.2, -3, 53.4, -4.6, 53.3, -4.2, 52.7, -5.2, 51.8, -3.2, 51.5, -4.4, 51.2,
+   -5.7, 50.1},
+  // Ireland
+  {-6, 52.2, -6.2, 53.5, -5.5, 54.6, -7.3, 55.3, -8.5, 54.5, -10, 54.2, -9.9, 53.4, -10.3, 52.1,
+   -9.5, 51.6, -8.4, 51.8, -6, 52.2},
+  // Iceland
+  {-22.6, 64, -24, 65.4, -22, 66.4, -16.5, 66.5, -14.5, 65.8, -13.5, 65, -15, 64.3, -18.7, 63.4,
+   -22.6, 64},
+  // Svalbard
+  {11, 78.5, 16, 80, 27, 80, 22, 77.5, 16.5, 76.6, 11, 78.5},
+  // Novaya Zemlya
+  {52.5, 71.3, 56, 74.5, 68, 76.9, 61, 75.5, 56, 72.5, 52.5, 71.3},
+  // Sicily
+  {12.4, 37.8, 15.6, 38.2, 15.1, 36.7, 12.4, 37.8},
+  // Sardinia
+  {8.4, 39, 9.6, 39.2, 9.8, 41, 8.2, 40.9, 8.4, 39},
+  // Sri Lanka
+  {79.9, 9.8, 81.9, 7.5, 81.2, 6.1, 80, 6.2, 79.8, 8, 79.9, 9.8},
+  // Sakhalin
+  {142, 46, 143.5, 49, 142.7, 54.2, 142, 51.5, 142, 46},
+  // Hokkaido
+  {140, 41.5, 141.5, 42.6, 143.3, 42, 145.5, 43.3, 144.5, 44, 141.7, 45.4, 141.3, 43.5, 140, 42.5,
+   140, 41.5},
+  // Honshu
+  {141.5, 41.4, 142, 39.5, 141, 38.3, 141, 36.5, 140.8, 35.7, 139.8, 35, 139.2, 35.3, 138.8, 34.6,
+   137, 34.6, 135.8, 33.5, 135.4, 34.6, 134, 34.5, 132.5, 34.3, 130.9, 34, 132.7, 35.5,
+   135.5, 35.6, 136.7, 37.3, 137.2, 36.8, 138.5, 37.5, 139.5, 38.5, 140, 40, 140, 41, 141.5, 41.4},
+  // Kyushu
+  {130.9, 33.9, 132, 33.2, 131.5, 31.5, 130.7, 31, 130.2, 31.4, 129.7, 33, 130.3, 33.6, 130.9, 33.9},
+  // Taiwan
+  {121.5, 25.3, 122, 24.8, 120.8, 21.9, 120.1, 23, 121, 25, 121.5, 25.3},
+  // Luzon
+  {120.6, 18.5, 122.3, 18.5, 122.2, 16.3, 121.6, 14.2, 124, 12.8, 120.6, 14.3, 120, 16.2, 120.6, 18.5},
+  // Mindanao
+  {122, 7, 125.5, 9.8, 126.5, 7.3, 125.5, 5.7, 124, 6.9, 122, 7},
+  // Borneo
+  {109, 1.8, 109.6, -1, 110.5, -3, 114.5, -4, 116.5, -2.5, 117.8, 1, 118.8, 4.5, 117, 7,
+   115.5, 5.3, 113, 3.2, 111, 1.8, 109, 1.8},
+  // Sumatra
+  {95.3, 5.6, 97.5, 5.2, 100.4, 2.2, 103.8, -1, 106, -3, 105.8, -5.8, 104.5, -5.9, 102.3, -4,
+   100.3, -1, 98.7, 1.7, 95.3, 5.6},
+  // Java
+  {105.2, -6.8, 106.1, -6, 108.3, -6.3, 110.4, -6.9, 112.7, -6.9, 114.5, -7.7, 114.4, -8.7,
+   110.5, -8.2, 106.4, -7.4, 105.2, -6.8},
+  // Sulawesi
+  {119.5, -5.5, 120.5, -5.5, 121.2, -2.8, 123.2, -0.9, 125, 1.5, 124.3, 0.4, 120.5, 0.5,
+   119.8, 0, 118.8, -2.7, 119.5, -5.5},
+  // New Guinea
+  {131, -1.2, 134, -0.9, 135.2, -3.3, 138, -1.6, 141, -2.6, 145.8, -4.8, 147.5, -6.3,
+   150.2, -10.5, 147, -10, 146.1, -8.1, 143.6, -9, 142.5, -9.3, 140.9, -9.1, 138.9, -8.1,
+   137.6, -5.2, 133.6, -4, 132, -2.8, 131, -1.2},
+  // Australia
+  {113.5, -22, 114, -26.5, 115, -30, 115.7, -32.5, 115, -34.3, 117.9, -35, 123, -33.9,
+   126, -32.3, 131, -31.5, 134.2, -32.6, 135.5, -34.8, 137.7, -33, 138, -35.6, 140, -37.9,
+   143.5, -38.8, 146.3, -39.1, 150, -37.5, 151.2, -33.9, 153.6, -28.2, 153, -25, 150.8, -22.6,
+   149, -20.5, 146, -17.8, 145.4, -15, 143.5, -14, 142.5, -10.7, 141.6, -13, 141.5, -16.5,
+   140.8, -17.5, 139.3, -17.3, 136.9, -15.8, 135.9, -13.4, 136.8, -12.2, 132.5, -11.3,
+   130.8, -12.4, 129.5, -14.9, 128, -15, 125, -14.3, 122.2, -17, 122.2, -18, 119.5, -20,
+   116.7, -20.6, 113.9, -21.9, 113.5, -22},
+  // Tasmania
+  {144.7, -40.7, 148.3, -40.9, 148, -43.2, 146.6, -43.6, 145.2, -42.3, 144.7, -40.7},
+  // New Zealand, North Island
+  {172.7, -34.4, 174.8, -36.8, 178.5, -37.7, 177.9, -39.3, 176.9, -39.6, 175.3, -41.6,
+   174.6, -39.8, 173.8, -39.2, 174.7, -38, 172.7, -34.4},
+  // New Zealand, South Island
+  {172.6, -40.5, 174.2, -41.4, 173.4, -43, 172.8, -43.8, 171.3, -44.4, 170.7, -45.9, 168.3, -46.6,
+   166.5, -46, 168, -44, 171.2, -42, 172.6, -40.5},
+  // Antarctica
+  {-57.5, -63.5, -61, -68, -61, -74, -45, -78, -30, -76, -15, -72, 0, -70, 30, -69, 40, -69,
+   55, -66.5, 70, -68, 77, -69.5, 90, -66.5, 110, -66, 135, -66, 160, -70, 170, -72, 167, -78,
+   180, -78, 200, -78, 210, -76.5, 230, -74, 250, -74, 260, -72, 280, -73, 285, -70, 292, -67,
+   302.5, -63.5},
+}
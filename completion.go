@@ -0,0 +1,206 @@
+package main
+
+import (
+  "flag"
+  "fmt"
+  "io"
+  "os"
+  "path/filepath"
+  "strings"
+)
+
+/**
+ * Hidden command called by the completion scripts. The last argument is the
+ * word being completed, the previous ones are the words before it. Prints
+ * one candidate per line. When nothing is printed, the scripts fall back to
+ * completing file names.
+ */
+const Complete_command = "__complete"
+
+var shells = []string{"bash", "zsh", "fish"}
+
+/**
+ * Values offered for the flags which take one out of a known set.
+ */
+func flag_values(command string, name string) []string {
+  r := []string{}
+  switch {
+    case command == "scan" && name == "backend":
+      for _, s := range scanners {
+        r = append(r, s.name)
+      }
+      return r
+  }
+  switch name {
+    case "projection":
+      for _, p := range projections {
+        r = append(r, string(p))
+      }
+    case "format":
+      for _, f := range formats {
+        r = append(r, f.name)
+      }
+    case "quality":
+      r = append(r, "full", "fast")
+    case "dye":
+      for _, d := range dyes {
+        r = append(r, d.name)
+      }
+    case "border":
+      r = append(r, string(No_border), string(Line_border), string(Ornament_border))
+    case "preset":
+      r = append(r, string(High_contrast))
+    case "blank":
+      for _, b := range blanks {
+        r = append(r, b.name)
+      }
+    case "paper":
+      for _, p := range papers {
+        r = append(r, p.name)
+      }
+    case "light":
+      r = append(r, string(Reflected_light), string(Transmitted_light))
+    case "dither", "watermark-dither":
+      if name == "watermark-dither" {
+        r = append(r, Random_dither)
+      }
+      for _, d := range dithers {
+        r = append(r, string(d))
+      }
+    case "blend-style":
+      r = append(r, string(Dither_blend), string(Palette_blend))
+    case "kaleidoscope-fold":
+      r = append(r, string(Mirror_fold), string(Repeat_fold))
+    case "watermark-fit":
+      r = append(r, string(Contain_fit), string(Cover_fit), string(Stretch_fit), string(Tile_fit))
+    case "justify":
+      r = append(r, string(Left_justify), string(Center_justify), string(Right_justify), string(Full_justify))
+    case "project":
+      r = append(r, template_names()...)
+    case "backend":
+      for _, b := range burners {
+        r = append(r, b.name)
+      }
+  }
+  return r
+}
+
+func is_bool_flag(f *flag.Flag) bool {
+  b, ok := f.Value.(interface{ IsBoolFlag() bool })
+  return ok && b.IsBoolFlag()
+}
+
+func complete(args []string) int {
+  if len(args) == 0 {
+    return 0
+  }
+  words, current := args[:len(args)-1], args[len(args)-1]
+
+  candidates := []string{}
+  if len(words) == 0 {
+    for _, c := range commands() {
+      candidates = append(candidates, c.name)
+    }
+  } else {
+    for _, c := range commands() {
+      if c.name != words[0] {
+        continue
+      }
+      fs := flag.NewFlagSet(c.name, flag.ContinueOnError)
+      fs.SetOutput(io.Discard)
+      c.setup(fs)
+
+      var previous *flag.Flag
+      if len(words) > 1 {
+        previous = fs.Lookup(strings.TrimLeft(words[len(words)-1], "-"))
+      }
+      if previous != nil && !is_bool_flag(previous) && strings.HasPrefix(words[len(words)-1], "-") {
+        candidates = flag_values(c.name, previous.Name)
+      } else if strings.HasPrefix(current, "-") {
+        fs.VisitAll(func(f *flag.Flag) {
+          candidates = append(candidates, "-" + f.Name)
+        })
+      } else if fs.Parse(words[1:]); fs.NArg() == 0 {
+        switch c.arguments {
+          case Pattern_argument:
+            for _, p := range patterns {
+              candidates = append(candidates, string(p.name))
+            }
+          case Shell_argument:
+            candidates = shells
+        }
+      }
+    }
+  }
+
+  for _, c := range candidates {
+    if strings.HasPrefix(c, current) {
+      fmt.Println(c)
+    }
+  }
+  return 0
+}
+
+const bash_completion = `# bash completion for %[1]s
+_%[2]s() {
+  local IFS=$'\n'
+  local cur="${COMP_WORDS[COMP_CWORD]}"
+  COMPREPLY=($("${COMP_WORDS[0]}" %[3]s "${COMP_WORDS[@]:1:COMP_CWORD-1}" "$cur" 2>/dev/null))
+}
+complete -o default -F _%[2]s %[1]s
+`
+
+const zsh_completion = `#compdef %[1]s
+_%[2]s() {
+  local -a candidates
+  candidates=("${(@f)$(${words[1]} %[3]s ${words[2,CURRENT-1]} "${words[CURRENT]}" 2>/dev/null)}")
+  if [[ -z "${candidates[1]}" ]]; then
+    _files
+  else
+    compadd -a candidates
+  fi
+}
+compdef _%[2]s %[1]s
+`
+
+const fish_completion = `# fish completion for %[1]s
+function __%[2]s_complete
+  set -l tokens (commandline -opc)
+  set -l current (commandline -ct)
+  set -l candidates ($tokens[1] %[3]s $tokens[2..-1] $current 2>/dev/null)
+  if test (count $candidates) -eq 0
+    __fish_complete_path $current
+  else
+    printf '%%s\n' $candidates
+  end
+end
+complete -c %[1]s -f -a '(__%[2]s_complete)'
+`
+
+func completion_command(fs *flag.FlagSet) func() int {
+  fs.Usage = func() {
+    fmt.Fprintf(fs.Output(), "usage: %s completion <%s>\n\n", os.Args[0], strings.Join(shells, "|"))
+    fmt.Fprintf(fs.Output(), "e.g. add the following line to ~/.bashrc:\n")
+    fmt.Fprintf(fs.Output(), "  source <(%s completion bash)\n", os.Args[0])
+  }
+  return func() int {
+    if fs.NArg() != 1 {
+      fs.Usage()
+      return Exit_usage
+    }
+    name := filepath.Base(os.Args[0])
+    function := strings.NewReplacer("-", "_", ".", "_").Replace(name)
+    switch fs.Arg(0) {
+      case "bash":
+        fmt.Printf(bash_completion, name, function, Complete_command)
+      case "zsh":
+        fmt.Printf(zsh_completion, name, function, Complete_command)
+      case "fish":
+        fmt.Printf(fish_completion, name, function, Complete_command)
+      default:
+        logger.errorf("unknown shell: %s", fs.Arg(0))
+        return Exit_usage
+    }
+    return 0
+  }
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+  "bytes"
+  "encoding/json"
+  "flag"
+  "fmt"
+  "image"
+  "image/draw"
+  "math"
+  "os"
+  "sort"
+  "strconv"
+  "strings"
+)
+
+/**
+ * Measures a scan or a photo of a burned calibration disc. The image must
+ * show the data side, with a known scale. The disc's rotation doesn't
+ * matter: sectors are located from the image itself.
+ */
+type Pair_contrast struct {
+  Dark string `json:"dark"`
+  Light string `json:"light"`
+  Inner float64 `json:"inner_mm"`
+  Outer float64 `json:"outer_mm"`
+  Bright float64 `json:"bright"`
+  Dim float64 `json:"dim"`
+  Michelson float64 `json:"michelson"`
+}
+
+type Chart_contrast struct {
+  Line_pairs int `json:"line_pairs"`
+  Radius float64 `json:"radius_mm"`
+  Frequency float64 `json:"frequency_lp_per_mm"`
+  Modulation float64 `json:"modulation"`
+  Mtf float64 `json:"mtf"`
+}
+
+type Contrast struct {
+  Image string `json:"image"`
+  Dpi float64 `json:"dpi"`
+  Center [2]float64 `json:"center_mm"`
+  Pairs []Pair_contrast `json:"pairs"`
+  Chart []Chart_contrast `json:"chart"`
+  Mtf50 float64 `json:"mtf50_lp_per_mm"`
+}
+
+type Pixel_sample struct {
+  angle float32
+  value float32
+}
+
+/**
+ * Splits the samples of a band into its bright and dim halves. The phase of
+ * the n-th harmonic (n being the number of line pairs) tells where the
+ * bright sectors are.
+ */
+func band_levels(samples []Pixel_sample, n int) (bright float64, dim float64) {
+  re, im := 0.0, 0.0
+  for _, s := range samples {
+    a := float64(n) * float64(s.angle)
+    re += float64(s.value) * math.Cos(a)
+    im += float64(s.value) * math.Sin(a)
+  }
+  phase := math.Atan2(im, re)
+  sum := [2]float64{}
+  count := [2]int{}
+  for _, s := range samples {
+    i := 0
+    if math.Cos(float64(n) * float64(s.angle) - phase) < 0 {
+      i = 1
+    }
+    sum[i] += float64(s.value)
+    count[i]++
+  }
+  if count[0] == 0 || count[1] == 0 {
+    return 0, 0
+  }
+  return sum[0] / float64(count[0]), sum[1] / float64(count[1])
+}
+
+func michelson(bright float64, dim float64) float64 {
+  if bright + dim == 0 {
+    return 0
+  }
+  return (bright - dim) / (bright + dim)
+}
+
+/**
+ * Collects the pixels of each band. Pixels near the edges of a band are left
+ * out, the scale and center are never perfectly accurate.
+ */
+func band_samples(img *image.Gray, center Point, px_per_mm float64, bands []Calibration_band, end float64) [][]Pixel_sample {
+  r := make([][]Pixel_sample, len(bands))
+  b := img.Bounds()
+  for y:=b.Min.Y; y<b.Max.Y; y++ {
+    for x:=b.Min.X; x<b.Max.X; x++ {
+      dx := (float64(x) + 0.5) / px_per_mm - center.x
+      dy := center.y - (float64(y) + 0.5) / px_per_mm
+      radius := math.Hypot(dx, dy)
+      i := sort.Search(len(bands), func(i int) bool {
+        return math.Min(bands[i].outer, end) > radius
+      })
+      if i == len(bands) || radius < bands[i].inner {
+        continue
+      }
+      inner, outer := bands[i].inner, math.Min(bands[i].outer, end)
+      if t := (radius - inner) / (outer - inner); t < 0.2 || t > 0.8 {
+        continue
+      }
+      r[i] = append(r[i], Pixel_sample{float32(math.Atan2(dy, dx)), float32(img.Pix[(y - b.Min.Y) * img.Stride + x - b.Min.X])})
+    }
+  }
+  return r
+}
+
+func measure_contrast(img *image.Gray, center Point, dpi float64, g Geometry) Contrast {
+  px_per_mm := dpi / 25.4
+  bands := calibration_layout(g)
+  end := float64(g.end_radius())
+  samples := band_samples(img, center, px_per_mm, bands, end)
+
+  c := Contrast{Dpi: dpi, Center: [2]float64{center.x, center.y}, Pairs: []Pair_contrast{}, Chart: []Chart_contrast{}}
+  reference := 0.0
+  for i, band := range bands {
+    bright, dim := band_levels(samples[i], band.line_pairs)
+    m := michelson(bright, dim)
+    outer := math.Min(band.outer, end)
+    if i < len(calibration_pairs) {
+      c.Pairs = append(c.Pairs, Pair_contrast{fmt.Sprintf("0x%02x", band.dark), fmt.Sprintf("0x%02x", band.light),
+        band.inner, outer, bright, dim, m})
+      if i == 0 {
+        // the pair every pattern uses, in sectors too wide to be blurred
+        reference = m
+      }
+      continue
+    }
+    radius := (band.inner + outer) / 2
+    chart := Chart_contrast{band.line_pairs, radius, float64(band.line_pairs) / (2 * math.Pi * radius), m, 0}
+    if reference > 0 {
+      chart.Mtf = m / reference
+    }
+    c.Chart = append(c.Chart, chart)
+  }
+
+  // where the mtf drops below 50%, interpolated between chart bands
+  for i, chart := range c.Chart {
+    if chart.Mtf >= 0.5 {
+      c.Mtf50 = chart.Frequency
+      continue
+    }
+    if i > 0 && c.Chart[i-1].Mtf >= 0.5 {
+      p := c.Chart[i-1]
+      t := (p.Mtf - 0.5) / (p.Mtf - chart.Mtf)
+      c.Mtf50 = p.Frequency + t * (chart.Frequency - p.Frequency)
+    }
+    break
+  }
+  return c
+}
+
+/**
+ * Reads an image, along with the resolution it records (0 when unknown).
+ */
+func read_image(filename string) (*image.Gray, float64, error) {
+  data, err := os.ReadFile(filename)
+  if err != nil {
+    return nil, 0, err
+  }
+  img, _, err := image.Decode(bytes.NewReader(data))
+  if err != nil {
+    return nil, 0, fmt.Errorf("%s: %s", filename, err)
+  }
+  gray, ok := img.(*image.Gray)
+  if !ok {
+    gray = image.NewGray(img.Bounds())
+    draw.Draw(gray, gray.Bounds(), img, img.Bounds().Min, draw.Src)
+  }
+  return gray, float64(png_dpi(data)), nil
+}
+
+/**
+ * Parses "x,y", in mm.
+ */
+func parse_point(s string) (Point, error) {
+  parts := strings.Split(s, ",")
+  if len(parts) != 2 {
+    return Point{}, fmt.Errorf("expecting x,y, got %q", s)
+  }
+  x, err1 := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+  y, err2 := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+  if err1 != nil || err2 != nil {
+    return Point{}, fmt.Errorf("expecting x,y, got %q", s)
+  }
+  return Point{x, y}, nil
+}
+
+/**
+ * Registers the options needed to measure an image. Returns the function
+ * which measures one.
+ */
+func contrast_flags(fs *flag.FlagSet) func(filename string) (Contrast, error) {
+  g := geometry_flags(fs)
+  dpi := fs.Float64("dpi", 0, "resolution of the image, defaults to the one recorded by the scan command")
+  center := fs.String("center", fmt.Sprintf("%g,%g", Disc_radius, Disc_radius), "center of the disc, in mm from the top left corner of the image, as x,y")
+  return func(filename string) (Contrast, error) {
+    if err := g.validate(); err != nil {
+      return Contrast{}, err
+    }
+    p, err := parse_point(*center)
+    if err != nil {
+      return Contrast{}, err
+    }
+    img, recorded, err := read_image(filename)
+    if err != nil {
+      return Contrast{}, err
+    }
+    d := *dpi
+    if d == 0 {
+      d = recorded
+    }
+    if d <= 0 {
+      return Contrast{}, fmt.Errorf("%s: unknown resolution, use -dpi", filename)
+    }
+    logger.debugf("%s: %dx%d pixels at %g dpi", filename, img.Bounds().Dx(), img.Bounds().Dy(), d)
+    c := measure_contrast(img, p, d, *g)
+    c.Image = filename
+    return c, nil
+  }
+}
+
+func contrast_command(fs *flag.FlagSet) func() int {
+  measure := contrast_flags(fs)
+  output := fs.String("o", "-", "output file, - for stdout")
+  fs.Usage = func() {
+    fmt.Fprintf(fs.Output(), "usage: %s contrast [options] <scan.png>\n\n", os.Args[0])
+    fmt.Fprintf(fs.Output(), "measures a burned calibration disc. The geometry options must match the ones\n")
+    fmt.Fprintf(fs.Output(), "the disc was created with.\n\noptions:\n")
+    fs.PrintDefaults()
+  }
+  return func() int {
+    if fs.NArg() != 1 {
+      fs.Usage()
+      return Exit_usage
+    }
+    c, err := measure(fs.Arg(0))
+    if err != nil {
+      logger.errorf("%s", err)
+      return Exit_failure
+    }
+    data, err := json.MarshalIndent(c, "", "  ")
+    if err != nil {
+      logger.errorf("%s", err)
+      return Exit_failure
+    }
+    if err := write_output(*output, append(data, '\n')); err != nil {
+      logger.errorf("%s", err)
+      return Exit_failure
+    }
+    return 0
+  }
+}
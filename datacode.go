@@ -0,0 +1,303 @@
+package main
+
+import (
+  "bytes"
+  "encoding/binary"
+  "flag"
+  "fmt"
+  "hash/crc32"
+  "image"
+  "math"
+  "os"
+  "sort"
+)
+
+/**
+ * A circular 2-D code, holding a few kilobytes meant to be read from a scan
+ * or a photo of the disc rather than by a drive: a disc which no longer
+ * plays still holds its data.
+ *
+ * The code is made of concentric rings of -cell-size, from the visible part
+ * of the program area outwards. Each ring starts at the top with a sync
+ * mark, four dark cells then four light ones. The marks line up into a
+ * spoke, which gives the disc's rotation. The other cells hold one bit each,
+ * dark for 1, clockwise seen from the data side.
+ *
+ * The payload, preceded by its length and crc32, goes in Reed-Solomon blocks
+ * of Code_data bytes and Code_parity parity bytes, as many blocks as the
+ * disc holds: the reader knows how many from the geometry. The blocks are
+ * interleaved, byte i of every block before byte i+1 of any, so that a
+ * scratch spreads over many blocks. Last, the bytes are mixed with a pseudo
+ * random sequence: every ring gets about as many dark cells as light ones,
+ * and the reader can tell them apart from the ring's own tones.
+ */
+const (
+  Code_sync = "DDDDLLLL"
+  Code_data = 223
+  Code_parity = 32
+  Code_block = Code_data + Code_parity
+  Code_header = 8 // length and crc32 of the payload
+)
+
+type Code_ring struct {
+  inner float64 // in mm
+  cells int
+}
+
+func code_rings(g Geometry, cell float64) []Code_ring {
+  r := []Code_ring{}
+  for k:=0; ; k++ {
+    inner := float64(g.visible_radius()) + float64(k) * cell
+    if inner + cell > float64(g.end_radius()) {
+      return r
+    }
+    r = append(r, Code_ring{inner, int(2 * math.Pi * (inner + cell / 2) / cell)})
+  }
+}
+
+/**
+ * Returns how many bytes the rings hold, and how many blocks that makes.
+ */
+func code_size(rings []Code_ring) (int, int) {
+  bits := 0
+  for _, ring := range rings {
+    bits += max(0, ring.cells - len(Code_sync))
+  }
+  return (bits + 7) / 8, bits / 8 / Code_block
+}
+
+/**
+ * Mixes the bytes with a fixed xorshift sequence, in place. Mixing twice
+ * gives the bytes back.
+ */
+func whiten(data []byte) {
+  x := uint32(0x2545f491)
+  for i := range data {
+    x ^= x << 13
+    x ^= x >> 17
+    x ^= x << 5
+    data[i] ^= byte(x)
+  }
+}
+
+/**
+ * Returns the tones of the cells of each ring, true for dark.
+ */
+func code_cells(payload []byte, rings []Code_ring) ([][]bool, error) {
+  size, blocks := code_size(rings)
+  if capacity := blocks * Code_data - Code_header; len(payload) > capacity {
+    return nil, fmt.Errorf("the payload doesn't fit: %d bytes, the code holds %d with this geometry and cell size", len(payload), max(0, capacity))
+  }
+  data := make([]byte, blocks * Code_data)
+  binary.BigEndian.PutUint32(data, uint32(len(payload)))
+  binary.BigEndian.PutUint32(data[4:], crc32.ChecksumIEEE(payload))
+  copy(data[Code_header:], payload)
+
+  stream := make([]byte, size)
+  for b:=0; b<blocks; b++ {
+    for i, v := range rs_encode(data[b * Code_data:(b + 1) * Code_data], Code_parity) {
+      stream[i * blocks + b] = v
+    }
+  }
+  whiten(stream)
+
+  r := [][]bool{}
+  k := 0
+  for _, ring := range rings {
+    cells := make([]bool, ring.cells)
+    for j:=0; j<ring.cells; j++ {
+      if j < len(Code_sync) {
+        cells[j] = Code_sync[j] == 'D'
+      } else {
+        cells[j] = stream[k / 8] >> (7 - k % 8) & 1 == 1
+        k++
+      }
+    }
+    r = append(r, cells)
+  }
+  return r, nil
+}
+
+func datacode(buf *bytes.Buffer, g Geometry, payload []byte, cell float64) error {
+  if cell <= 0 {
+    return fmt.Errorf("invalid cell size: %s", Length(cell))
+  }
+  rings := code_rings(g, cell)
+  cells, err := code_cells(payload, rings)
+  if err != nil {
+    return err
+  }
+  _, blocks := code_size(rings)
+  logger.infof("code: %d bytes in %d rings, the code holds %d", len(payload), len(rings), blocks * Code_data - Code_header)
+  inner := float64(g.visible_radius())
+  spiral(buf, g, func(radius float64, angle float64) byte {
+    k := int((radius - inner) / cell)
+    if radius < inner || k >= len(rings) {
+      return Light
+    }
+    // clockwise from the top
+    a := math.Mod(2.5 * math.Pi - angle, 2 * math.Pi)
+    if cells[k][int(a / (2 * math.Pi) * float64(rings[k].cells)) % rings[k].cells] {
+      return Dark
+    }
+    return Light
+  })
+  return nil
+}
+
+/**
+ * Reads the code from an image of the disc. center is the center of the
+ * disc, in mm from the top left corner of the image. Returns the payload
+ * and how many bytes had to be corrected.
+ */
+func read_code(img *image.Gray, center Point, px_per_mm float64, g Geometry, cell float64) ([]byte, int, error) {
+  rings := code_rings(g, cell)
+  size, blocks := code_size(rings)
+  if blocks == 0 {
+    return nil, 0, fmt.Errorf("no room for a code with this geometry and cell size")
+  }
+  b := img.Bounds()
+  pixel := func(r float64, a float64) (float64, bool) {
+    p := image.Pt(int((center.x + r * math.Sin(a)) * px_per_mm), int((center.y - r * math.Cos(a)) * px_per_mm))
+    if !p.In(b) {
+      return 0, false
+    }
+    return float64(img.GrayAt(p.X, p.Y).Y), true
+  }
+  // the tone of cell j of a ring, from the middle of the cell
+  tone := func(ring Code_ring, j int, rotation float64, direction float64, spread bool) float64 {
+    sum, count := 0.0, 0
+    offsets := []float64{0}
+    if spread {
+      offsets = []float64{-0.25, 0, 0.25}
+    }
+    for _, dr := range offsets {
+      for _, dj := range offsets {
+        a := rotation + direction * 2 * math.Pi * (float64(j) + 0.5 + dj) / float64(ring.cells)
+        if v, ok := pixel(ring.inner + cell * (0.5 + dr), a); ok {
+          sum += v
+          count++
+        }
+      }
+    }
+    if count == 0 {
+      return 0
+    }
+    return sum / float64(count)
+  }
+
+  thresholds := make([]float64, len(rings))
+  for k, ring := range rings {
+    values := []float64{}
+    for j:=0; j<ring.cells; j++ {
+      values = append(values, tone(ring, j, 0, 1, false))
+    }
+    sort.Float64s(values)
+    // halfway between the tones, the median itself is one of them
+    thresholds[k] = (values[len(values) / 4] + values[len(values) * 3 / 4]) / 2
+  }
+
+  // the rotation, and whether the image is mirrored, is where the sync marks
+  // stand out the most
+  best, rotation, direction := math.Inf(-1), 0.0, 1.0
+  steps := 4 * rings[len(rings) - 1].cells
+  for _, d := range []float64{1, -1} {
+    for s:=0; s<steps; s++ {
+      a := 2 * math.Pi * float64(s) / float64(steps)
+      score := 0.0
+      for k, ring := range rings {
+        for j:=0; j<len(Code_sync); j++ {
+          v := tone(ring, j, a, d, false) - thresholds[k]
+          if Code_sync[j] == 'D' {
+            v = -v
+          }
+          score += v
+        }
+      }
+      if score > best {
+        best, rotation, direction = score, a, d
+      }
+    }
+  }
+  logger.debugf("code: rotated by %.1f degrees, mirrored: %t", rotation * 180 / math.Pi, direction < 0)
+
+  stream := make([]byte, size)
+  k := 0
+  for i, ring := range rings {
+    for j:=len(Code_sync); j<ring.cells; j++ {
+      if tone(ring, j, rotation, direction, true) < thresholds[i] {
+        stream[k / 8] |= 1 << (7 - k % 8)
+      }
+      k++
+    }
+  }
+  whiten(stream)
+
+  data := []byte{}
+  corrected := 0
+  for b:=0; b<blocks; b++ {
+    block := make([]byte, Code_block)
+    for i := range block {
+      block[i] = stream[i * blocks + b]
+    }
+    n, err := rs_decode(block, Code_parity)
+    if err != nil {
+      return nil, 0, fmt.Errorf("block %d of %d: %s", b + 1, blocks, err)
+    }
+    corrected += n
+    data = append(data, block[:Code_data]...)
+  }
+  length := int(binary.BigEndian.Uint32(data))
+  if length > len(data) - Code_header {
+    return nil, 0, fmt.Errorf("invalid payload length: %d", length)
+  }
+  payload := data[Code_header:Code_header + length]
+  if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(data[4:]) {
+    return nil, 0, fmt.Errorf("the payload's crc doesn't match")
+  }
+  return payload, corrected, nil
+}
+
+func read_code_command(fs *flag.FlagSet) func() int {
+  g := geometry_flags(fs)
+  load := disc_image_flags(fs, g)
+  cell := 0.5
+  fs.Var((*Length)(&cell), "cell-size", "size of the cells of the code, as generated")
+  output := fs.String("o", "-", "output file, - for stdout")
+  fs.Usage = func() {
+    fmt.Fprintf(fs.Output(), "usage: %s read-code [options] <file.wav | scan.png>\n\n", os.Args[0])
+    fmt.Fprintf(fs.Output(), "reads the payload of the code pattern. The geometry options and cell size\n")
+    fmt.Fprintf(fs.Output(), "must match the ones the disc was created with.\n\noptions:\n")
+    fs.PrintDefaults()
+  }
+  return func() int {
+    if fs.NArg() != 1 {
+      fs.Usage()
+      return Exit_usage
+    }
+    if err := g.validate(); err != nil {
+      logger.errorf("%s", err)
+      return Exit_usage
+    }
+    if cell <= 0 {
+      logger.errorf("invalid cell size: %s", Length(cell))
+      return Exit_usage
+    }
+    img, c, px_per_mm, err := load(fs.Arg(0))
+    if err != nil {
+      logger.errorf("%s", err)
+      return Exit_failure
+    }
+    payload, corrected, err := read_code(img, c, px_per_mm, *g, cell)
+    if err != nil {
+      logger.errorf("%s: %s", fs.Arg(0), err)
+      return Exit_failure
+    }
+    logger.infof("read %d bytes, corrected %d", len(payload), corrected)
+    if err := write_output(*output, payload); err != nil {
+      logger.errorf("%s", err)
+      return Exit_failure
+    }
+    return 0
+  }
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+  "bytes"
+  "flag"
+  "os"
+  "testing"
+)
+
+func TestCode(t *testing.T) {
+  if testing.Short() {
+    t.Skip("generating 20 minutes of spiral is slow")
+  }
+  payload := []byte("a disc which no longer plays still holds its data")
+  f, err := os.CreateTemp(t.TempDir(), "payload")
+  if err != nil {
+    t.Fatal(err)
+  }
+  f.Write(payload)
+  f.Close()
+  args := []string{"-duration", "20m", "-payload", f.Name(), "-cell-size", "0.5mm"}
+  data := generate_test_pattern(t, Code, args)
+  fs := flag.NewFlagSet("", flag.ContinueOnError)
+  _, g, _ := design_flags(fs)
+  fs.Parse(args)
+
+  size := 2400
+  img := render(data[Wav_header_size:], *g, size)
+  // a scratch across a few rings
+  for y:=size / 2 + 700; y<size / 2 + 720; y++ {
+    for x:=0; x<size; x++ {
+      img.Pix[y * size + x] = 255
+    }
+  }
+  got, corrected, err := read_code(img, Point{Disc_radius, Disc_radius}, float64(size) / (2 * Disc_radius), *g, 0.5)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if !bytes.Equal(got, payload) {
+    t.Errorf("got %q, expecting %q", got, payload)
+  }
+  if corrected == 0 {
+    t.Errorf("nothing corrected, expecting the scratch to be")
+  }
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+  "fmt"
+)
+
+/**
+ * How the greys of a canvas become dark and light bytes, for comparison
+ * burns. Bayer and floyd-steinberg work on the canvas' grid, like dithering
+ * a photo for print. Spiral diffuses the error from one byte to the next,
+ * in the order they get written, which is the way the eye sees the disc:
+ * along the tracks, as the light catches them, rather than in rows and
+ * columns, which the tracks cross at every angle.
+ */
+type Dither string
+const (
+  Bayer_dither Dither = "bayer"
+  Floyd_steinberg_dither Dither = "floyd-steinberg"
+  Spiral_dither Dither = "spiral"
+)
+
+var dithers = []Dither{Bayer_dither, Floyd_steinberg_dither, Spiral_dither}
+
+func parse_dither(s string) (Dither, error) {
+  for _, d := range dithers {
+    if Dither(s) == d {
+      return d, nil
+    }
+  }
+  return "", fmt.Errorf("unknown dither: %s, expecting %s, %s or %s", s, Bayer_dither, Floyd_steinberg_dither, Spiral_dither)
+}
+
+/**
+ * Turns the greys of the canvas into dark and light pixels, or leaves them
+ * for engrave to diffuse along the spiral.
+ */
+func (c *Canvas) halftone(d Dither) {
+  switch d {
+    case Bayer_dither:
+      // ordered dithering, which keeps the tone even at any level
+      bayer := [4][4]float32{{0, 8, 2, 10}, {12, 4, 14, 6}, {3, 11, 1, 9}, {15, 7, 13, 5}}
+      for j:=0; j<c.size; j++ {
+        for i:=0; i<c.size; i++ {
+          if v := &c.pixels[j * c.size + i]; *v > 0 && *v < 1 {
+            if *v > (bayer[j % 4][i % 4] + 0.5) / 16 {
+              *v = 1
+            } else {
+              *v = 0
+            }
+          }
+        }
+      }
+    case Floyd_steinberg_dither:
+      // serpentine, lest the error drifts towards one side
+      for j:=0; j<c.size; j++ {
+        step, from, to := 1, 0, c.size
+        if j % 2 == 1 {
+          step, from, to = -1, c.size - 1, -1
+        }
+        for i:=from; i!=to; i+=step {
+          v := c.pixels[j * c.size + i]
+          q := float32(0)
+          if v >= 0.5 {
+            q = 1
+          }
+          c.pixels[j * c.size + i] = q
+          e := v - q
+          if e == 0 {
+            continue
+          }
+          spread := func(di int, dj int, share float32) {
+            if x, y := i + di * step, j + dj; x >= 0 && x < c.size && y < c.size {
+              c.pixels[y * c.size + x] += e * share
+            }
+          }
+          spread(1, 0, 7.0 / 16)
+          spread(-1, 1, 3.0 / 16)
+          spread(0, 1, 5.0 / 16)
+          spread(1, 1, 1.0 / 16)
+        }
+      }
+    case Spiral_dither:
+      c.diffuse = true
+  }
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+  "fmt"
+  "math"
+  "sort"
+  "strconv"
+  "strings"
+)
+
+/**
+ * Reads the entities of a DXF file which draw strokes: LINE, CIRCLE, ARC,
+ * LWPOLYLINE and POLYLINE, with the bulges of their arcs. Other entities,
+ * e.g. splines, text or block references, are skipped with a warning:
+ * explode them in the CAD program first.
+ *
+ * A DXF file is a list of pairs of lines, a group code and a value. Entities
+ * start with code 0 and their type, the codes which follow are their
+ * properties: 10 and 20 for x and y, 40 for the radius, 50 and 51 for the
+ * start and end angles, 42 for the bulge of a polyline vertex.
+ */
+type Dxf_pair struct {
+  code int
+  value string
+}
+
+/**
+ * mm per unit, by value of $INSUNITS. Unitless drawings are taken as mm.
+ */
+var dxf_units = map[int]float64{
+  0: 1,
+  1: 25.4,
+  2: 304.8,
+  4: 1,
+  5: 10,
+  6: 1000,
+  13: 0.001,
+}
+
+/**
+ * Returns the value of the first pair with the given code, 0 when there
+ * isn't any.
+ */
+func dxf_float(pairs []Dxf_pair, code int) float64 {
+  for _, p := range pairs {
+    if p.code == code {
+      v, _ := strconv.ParseFloat(p.value, 64)
+      return v
+    }
+  }
+  return 0
+}
+
+type Dxf_vertex struct {
+  p Point
+  bulge float64 // tangent of a quarter of the arc's angle, 0 for a line
+}
+
+/**
+ * Draws the segments of a polyline. A bulge turns the segment which starts
+ * at its vertex into an arc, counter clockwise when positive.
+ */
+func dxf_polyline(pen *Pen, vertices []Dxf_vertex, closed bool) {
+  if len(vertices) == 0 {
+    return
+  }
+  pen.move_to(vertices[0].p, false)
+  n := len(vertices) - 1
+  if closed {
+    n++
+  }
+  for i:=0; i<n; i++ {
+    from, to := vertices[i], vertices[(i + 1) % len(vertices)]
+    if from.bulge == 0 {
+      pen.move_to(to.p, true)
+      continue
+    }
+    // the center is on the chord's bisector, on the left for positive
+    // angles
+    angle := 4 * math.Atan(from.bulge)
+    dx, dy := to.p.x - from.p.x, to.p.y - from.p.y
+    d := math.Hypot(dx, dy)
+    if d == 0 {
+      continue
+    }
+    h := d / 2 / math.Tan(angle / 2)
+    center := Point{(from.p.x + to.p.x) / 2 - h * dy / d, (from.p.y + to.p.y) / 2 + h * dx / d}
+    pen.arc(center, angle, to.p, true)
+  }
+}
+
+func parse_dxf(data []byte) (Drawing, error) {
+  lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+  pairs := []Dxf_pair{}
+  for i:=0; i+1<len(lines); i+=2 {
+    code, err := strconv.Atoi(strings.TrimSpace(lines[i]))
+    if err != nil {
+      return nil, fmt.Errorf("line %d: invalid group code %q", i + 1, strings.TrimSpace(lines[i]))
+    }
+    pairs = append(pairs, Dxf_pair{code, strings.TrimSpace(lines[i+1])})
+  }
+
+  // split the pairs into entities, each starting with code 0
+  unit := 1.0
+  section := ""
+  entities := [][]Dxf_pair{}
+  for i:=0; i<len(pairs); i++ {
+    p := pairs[i]
+    switch {
+      case p.code == 0 && p.value == "SECTION" && i + 1 < len(pairs):
+        section = pairs[i+1].value
+      case p.code == 0 && p.value == "ENDSEC":
+        section = ""
+      case p.code == 9 && p.value == "$INSUNITS" && i + 1 < len(pairs):
+        v, _ := strconv.Atoi(pairs[i+1].value)
+        if u, ok := dxf_units[v]; ok {
+          unit = u
+        } else {
+          logger.warnf("unknown drawing units: %d, using mm", v)
+        }
+      case p.code == 0 && section == "ENTITIES":
+        entities = append(entities, []Dxf_pair{p})
+      case section == "ENTITIES" && len(entities) > 0:
+        entities[len(entities)-1] = append(entities[len(entities)-1], p)
+    }
+  }
+
+  pen := Pen{}
+  skipped := map[string]int{}
+  var polyline []Dxf_vertex // of the POLYLINE being read, until SEQEND
+  closed := false
+  point := func(e []Dxf_pair, x int, y int) Point {
+    return Point{dxf_float(e, x) * unit, dxf_float(e, y) * unit}
+  }
+  for _, e := range entities {
+    switch e[0].value {
+      case "LINE":
+        pen.move_to(point(e, 10, 20), false)
+        pen.move_to(point(e, 11, 21), true)
+      case "CIRCLE", "ARC":
+        center, r := point(e, 10, 20), dxf_float(e, 40) * unit
+        from, sweep := 0.0, 2 * math.Pi
+        if e[0].value == "ARC" {
+          from = dxf_float(e, 50) * math.Pi / 180
+          sweep = math.Mod(dxf_float(e, 51) * math.Pi / 180 - from + 4 * math.Pi, 2 * math.Pi)
+          if sweep == 0 {
+            sweep = 2 * math.Pi
+          }
+        }
+        start := Point{center.x + r * math.Cos(from), center.y + r * math.Sin(from)}
+        end := Point{center.x + r * math.Cos(from + sweep), center.y + r * math.Sin(from + sweep)}
+        pen.move_to(start, false)
+        pen.arc(center, sweep, end, true)
+      case "LWPOLYLINE":
+        vertices := []Dxf_vertex{}
+        for _, p := range e {
+          v, _ := strconv.ParseFloat(p.value, 64)
+          switch p.code {
+            case 10:
+              vertices = append(vertices, Dxf_vertex{p: Point{v * unit, 0}})
+            case 20:
+              if len(vertices) > 0 {
+                vertices[len(vertices)-1].p.y = v * unit
+              }
+            case 42:
+              if len(vertices) > 0 {
+                vertices[len(vertices)-1].bulge = v
+              }
+          }
+        }
+        dxf_polyline(&pen, vertices, int(dxf_float(e, 70)) & 1 != 0)
+      case "POLYLINE":
+        polyline = []Dxf_vertex{}
+        closed = int(dxf_float(e, 70)) & 1 != 0
+      case "VERTEX":
+        polyline = append(polyline, Dxf_vertex{point(e, 10, 20), dxf_float(e, 42)})
+      case "SEQEND":
+        dxf_polyline(&pen, polyline, closed)
+        polyline = nil
+      default:
+        skipped[e[0].value]++
+    }
+  }
+  kinds := []string{}
+  for kind, n := range skipped {
+    kinds = append(kinds, fmt.Sprintf("%d %s", n, kind))
+  }
+  if len(kinds) > 0 {
+    sort.Strings(kinds)
+    logger.warnf("skipped %s, only lines, circles, arcs and polylines are drawn", strings.Join(kinds, ", "))
+  }
+  return pen.drawing, nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+  "fmt"
+  "strings"
+  "testing"
+)
+
+/**
+ * A DXF file holding the entities, each one its group codes and values on
+ * alternate lines. units is the value of $INSUNITS, -1 for none.
+ */
+func dxf_file(units int, entities ...string) string {
+  s := ""
+  if units >= 0 {
+    s += fmt.Sprintf("0\nSECTION\n2\nHEADER\n9\n$INSUNITS\n70\n%d\n0\nENDSEC\n", units)
+  }
+  return s + "0\nSECTION\n2\nENTITIES\n" + strings.Join(entities, "\n") + "\n0\nENDSEC\n0\nEOF\n"
+}
+
+func TestParseDxf(t *testing.T) {
+  line := "0\nLINE\n10\n0\n20\n0\n11\n10\n21\n0"
+  check_drawings(t, parse_dxf, []Drawing_case{
+    {"mm", dxf_file(4, line),
+      [][]Point{{{0, 0}, {10, 0}}}},
+    {"no units", dxf_file(-1, line),
+      [][]Point{{{0, 0}, {10, 0}}}},
+    {"inches", dxf_file(1, "0\nLINE\n10\n0\n20\n0\n11\n1\n21\n2"),
+      [][]Point{{{0, 0}, {25.4, 50.8}}}},
+    {"closed polyline in cm", dxf_file(5, "0\nLWPOLYLINE\n90\n4\n70\n1\n10\n0\n20\n0\n10\n1\n20\n0\n10\n1\n20\n1\n10\n0\n20\n1"),
+      [][]Point{{{0, 0}, {10, 0}, {10, 10}, {0, 10}, {0, 0}}}},
+    {"counter clockwise bulge", dxf_file(4, "0\nLWPOLYLINE\n90\n2\n70\n0\n10\n0\n20\n0\n42\n1\n10\n10\n20\n0"),
+      [][]Point{{{0, 0}, {5, -5}, {10, 0}}}},
+    {"clockwise bulge", dxf_file(4, "0\nLWPOLYLINE\n90\n2\n70\n0\n10\n0\n20\n0\n42\n-1\n10\n10\n20\n0"),
+      [][]Point{{{0, 0}, {5, 5}, {10, 0}}}},
+    {"quarter turn bulge", dxf_file(4, "0\nLWPOLYLINE\n90\n2\n70\n0\n10\n10\n20\n0\n42\n0.41421356\n10\n0\n20\n10"),
+      [][]Point{{{10, 0}, {diagonal, diagonal}, {0, 10}}}},
+    {"bulge of a polyline's vertex, in inches", dxf_file(1, "0\nPOLYLINE\n70\n0", "0\nVERTEX\n10\n0\n20\n0\n42\n-1", "0\nVERTEX\n10\n1\n20\n0", "0\nSEQEND"),
+      [][]Point{{{0, 0}, {12.7, 12.7}, {25.4, 0}}}},
+    {"arc", dxf_file(4, "0\nARC\n10\n0\n20\n0\n40\n10\n50\n0\n51\n90"),
+      [][]Point{{{10, 0}, {diagonal, diagonal}, {0, 10}}}},
+    {"arc across 0 degrees", dxf_file(4, "0\nARC\n10\n0\n20\n0\n40\n10\n50\n270\n51\n0"),
+      [][]Point{{{0, -10}, {diagonal, -diagonal}, {10, 0}}}},
+    {"circle", dxf_file(4, "0\nCIRCLE\n10\n10\n20\n10\n40\n5"),
+      [][]Point{{{15, 10}, {5, 10}, {15, 10}}}},
+  })
+  if _, err := parse_dxf([]byte("LINE\n0\n")); err == nil {
+    t.Errorf("expected an error for an invalid group code")
+  }
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+  "flag"
+  "fmt"
+  "image"
+  "image/color"
+  "math"
+  "strings"
+)
+
+/**
+ * Recordable discs get their color from the dye the laser burns. A burned
+ * mark doesn't turn black, it turns a darker, duller shade of the dye, and
+ * how much darker depends on the dye. The colors below are those of typical
+ * blanks, looking at the data side under white light.
+ */
+type Dye struct {
+  name string
+  description string
+  unburned color.RGBA
+  burned color.RGBA
+}
+
+var dyes = []Dye{
+  {"cyanine", "greenish blue, e.g. most no-name blanks", color.RGBA{0x4f, 0xa8, 0x9c, 0xff}, color.RGBA{0x2a, 0x5c, 0x66, 0xff}},
+  {"azo", "deep blue, e.g. Verbatim DataLife Plus, low contrast", color.RGBA{0x2c, 0x3c, 0x8c, 0xff}, color.RGBA{0x26, 0x28, 0x5a, 0xff}},
+  {"phthalocyanine", "gold to pale green, e.g. Taiyo Yuden and Mitsui gold", color.RGBA{0xd6, 0xc2, 0x7a, 0xff}, color.RGBA{0x9a, 0x86, 0x4a, 0xff}},
+}
+
+const (
+  // the dye covers the lead-in, the program area and the lead-out
+  Dye_inner_radius float64 = 22.0 // in mm
+  Dye_outer_radius float64 = 58.5
+  Hole_radius float64 = 7.5
+)
+
+var polycarbonate = color.RGBA{0xc8, 0xc8, 0xcc, 0xff}
+
+func dye_flag(fs *flag.FlagSet) *string {
+  names := []string{}
+  for _, d := range dyes {
+    names = append(names, d.name)
+  }
+  return fs.String("dye", "", fmt.Sprintf("shows the colors of a blank made with this dye, one of %s. Grayscale by default", strings.Join(names, ", ")))
+}
+
+/**
+ * Returns nil, for a grayscale preview, when name is empty.
+ */
+func find_dye(name string) (*Dye, error) {
+  if name == "" {
+    return nil, nil
+  }
+  names := []string{}
+  for i, d := range dyes {
+    if d.name == name {
+      return &dyes[i], nil
+    }
+    names = append(names, d.name)
+  }
+  return nil, fmt.Errorf("unknown dye: %s%s", name, suggest(name, names))
+}
+
+func mix(a color.RGBA, b color.RGBA, t float64) color.RGBA {
+  lerp := func(x uint8, y uint8) uint8 {
+    return uint8(math.Round(float64(x) + (float64(y) - float64(x)) * t))
+  }
+  return color.RGBA{lerp(a.R, b.R), lerp(a.G, b.G), lerp(a.B, b.B), 0xff}
+}
+
+/**
+ * Like render, in the colors of the dye. The dye which doesn't receive any
+ * data stays unburned, the hub is bare polycarbonate.
+ */
+func render_dye(data []byte, g Geometry, size int, d *Dye) *image.RGBA {
+  sum, count := accumulate(data, g, size)
+  scale := float64(size) / (2 * Disc_radius)
+  img := image.NewRGBA(image.Rect(0, 0, size, size))
+  for y:=0; y<size; y++ {
+    for x:=0; x<size; x++ {
+      i := y * size + x
+      r := math.Hypot((float64(x) + 0.5) / scale - Disc_radius, (float64(y) + 0.5) / scale - Disc_radius)
+      c := color.RGBA{0x80, 0x80, 0x80, 0xff}
+      switch {
+        case count[i] > 0:
+          // from the darkest to the lightest tone
+          t := (sum[i] / float64(count[i]) - tone(Dark)) / (tone(Light) - tone(Dark))
+          c = mix(d.burned, d.unburned, math.Max(0, math.Min(1, t)))
+        case r >= Dye_inner_radius && r <= Dye_outer_radius:
+          c = d.unburned
+        case r >= Hole_radius && r <= Disc_radius:
+          c = polycarbonate
+      }
+      img.SetRGBA(x, y, c)
+    }
+  }
+  return img
+}
+
+/**
+ * The image written by the preview and decode commands.
+ */
+func preview_image(data []byte, g Geometry, size int, d *Dye, l Lighting) image.Image {
+  if l == Transmitted_light {
+    logger.infof("rendering with the light coming through the disc")
+    return render_transmitted(data, g, size, d)
+  }
+  if d == nil {
+    return render(data, g, size)
+  }
+  logger.infof("rendering on %s dye: %s", d.name, d.description)
+  return render_dye(data, g, size, d)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+  "flag"
+  "fmt"
+  "math"
+  "strconv"
+  "strings"
+  "time"
+)
+
+/**
+ * The burner spends time outside of the program area too: power calibration,
+ * the lead-in, the lead-out and closing the session. About the same on any
+ * drive, whatever the speed.
+ */
+const Burn_overhead = 45 * time.Second
+
+/**
+ * Common blanks, by the length of audio they're sold for. Longer ones get
+ * there with a tighter track pitch and a slower linear speed than this
+ * program's defaults: with the defaults, an 80 minute blank runs out of
+ * program area first.
+ */
+type Blank struct {
+  name string
+  description string
+  capacity Duration
+}
+
+var blanks = []Blank{
+  {"cd-r74", "74 minute CD-R, 650MB", Duration(74 * 60 * Sample_rate)},
+  {"cd-r80", "80 minute CD-R, 700MB", Duration(80 * 60 * Sample_rate)},
+  {"cd-r90", "90 minute CD-R, 800MB, overburned", Duration(90 * 60 * Sample_rate)},
+  {"cd-r99", "99 minute CD-R, 870MB, overburned", Duration(99 * 60 * Sample_rate)},
+}
+
+func find_blank(name string) (Blank, error) {
+  names := []string{}
+  for _, b := range blanks {
+    if b.name == name {
+      return b, nil
+    }
+    names = append(names, b.name)
+  }
+  return Blank{}, fmt.Errorf("unknown blank: %s%s", name, suggest(name, names))
+}
+
+/**
+ * Prints how far a design can go on the blank with this geometry, how much
+ * of the dye stays unburned past it, and how far the output, ending at end,
+ * is from there.
+ */
+func estimate_blank(b Blank, g Geometry, end Length) {
+  fmt.Printf("blank: %s, %s\n", b.name, b.description)
+  g.samples = b.capacity
+  reach := g.end_radius()
+  if capacity := g.capacity(); b.capacity > capacity {
+    fmt.Printf("its %s would end at %s with this geometry, the program area stops at %s, after %s\n", b.capacity, reach, Length(Max_radius), capacity / Duration(Sample_rate) * Duration(Sample_rate))
+    reach = Length(Max_radius)
+  }
+  share := (Dye_outer_radius * Dye_outer_radius - float64(reach * reach)) / (Dye_outer_radius * Dye_outer_radius - Dye_inner_radius * Dye_inner_radius)
+  fmt.Printf("the design can reach %s, %s short of the dye's edge: %.0f%% of the dye stays blank\n", reach, Length(Dye_outer_radius) - reach, 100 * share)
+  if end < reach {
+    fmt.Printf("this one stops at %s, %s short of that\n", end, reach - end)
+  }
+}
+
+/**
+ * Samples which fit in the program area with this geometry, up to Max_radius.
+ * The spiral covers the area between the start and end radii, one track
+ * pitch per turn.
+ */
+func (g Geometry) capacity() Duration {
+  length := math.Pi * (Max_radius * Max_radius - float64(g.start_radius * g.start_radius)) / float64(g.track_pitch)
+  return Duration(length / float64(g.sample_length()))
+}
+
+/**
+ * Time to burn samples at speed x. Drives burn at constant linear speed up
+ * to about 16x, faster speeds are only reached at the outer edge and the
+ * estimate is optimistic for them.
+ */
+func burn_time(samples Duration, speed int) time.Duration {
+  seconds := float64(samples) / float64(Sample_rate) / float64(speed)
+  return (time.Duration(seconds * float64(time.Second)) + Burn_overhead).Round(time.Second)
+}
+
+func parse_speeds(s string) ([]int, error) {
+  r := []int{}
+  for _, part := range strings.Split(s, ",") {
+    v, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(part), "x"))
+    if err != nil || v <= 0 {
+      return nil, fmt.Errorf("invalid speeds: %q, expecting speeds as s1,s2,..., e.g. 4,8x", s)
+    }
+    r = append(r, v)
+  }
+  return r, nil
+}
+
+func estimate_command(fs *flag.FlagSet) func() int {
+  o := pattern_flags(fs)
+  g := geometry_flags(fs)
+  project := project_flag(fs)
+  speeds := fs.String("speed", "1,4,8,16,24", "burn speeds to estimate, as s1,s2,...")
+  var reach Length
+  blank := fs.String("blank", "", "blank to burn, e.g. cd-r80: tells how far the design can go on it")
+  fs.Var(&reach, "reach", "radius the design must reach, e.g. 55mm: estimates the duration it takes, instead of using -duration")
+  fs.Usage = pattern_usage(fs, "<pattern> | -project <file>")
+  return func() int {
+    pattern, err := pattern_argument(fs, *project, o.variables)
+    if err != nil {
+      logger.errorf("%s", err)
+      return Exit_usage
+    }
+    if pattern == "" {
+      fs.Usage()
+      return Exit_usage
+    }
+    known := false
+    for _, p := range patterns {
+      known = known || p.name == pattern
+    }
+    if !known {
+      logger.errorf("unknown pattern: %s", pattern)
+      return Exit_usage
+    }
+    s, err := parse_speeds(*speeds)
+    if err != nil {
+      logger.errorf("%s", err)
+      return Exit_usage
+    }
+
+    var b Blank
+    if *blank != "" {
+      if b, err = find_blank(*blank); err != nil {
+        logger.errorf("%s", err)
+        return Exit_usage
+      }
+    }
+
+    capacity := g.capacity()
+    if reach > 0 {
+      if reach <= g.start_radius {
+        logger.errorf("-reach %s is inside the program area's start, %s", reach, g.start_radius)
+        return Exit_usage
+      }
+      // whole seconds, which stop a few revolutions short rather than past it
+      d := g.duration_to(reach) / Duration(Sample_rate) * Duration(Sample_rate)
+      if d == 0 {
+        logger.errorf("-reach %s is less than a second past the program area's start, %s", reach, g.start_radius)
+        return Exit_usage
+      }
+      if o.fill_to > 0 && d > o.fill_to {
+        logger.warnf("reaching %s takes %s, more than the blank's %s (-fill-to)", reach, d, o.fill_to)
+      }
+      if *blank != "" && d > b.capacity {
+        logger.warnf("reaching %s takes %s, more than the %s's %s", reach, d, b.name, b.capacity)
+      }
+      fmt.Printf("reaching %s: -duration %s\n", reach, d)
+      g.samples = d
+    }
+    out := o.output_geometry(*g)
+    if *blank != "" {
+      estimate_blank(b, *g, out.end_radius())
+    }
+    fmt.Printf("design: %s, %s to %s\n", g.samples, g.start_radius, g.end_radius())
+    if out.samples > g.samples {
+      fmt.Printf("output: %s with the fill, up to %s\n", out.samples, out.end_radius())
+    }
+    fmt.Printf("capacity: %s up to %s, %.0f%% used\n", capacity / Duration(Sample_rate) * Duration(Sample_rate), Length(Max_radius), 100 * float64(out.samples) / float64(capacity))
+    for _, speed := range s {
+      fmt.Printf("burn time at %dx: %s\n", speed, burn_time(out.samples, speed))
+    }
+    if out.samples > capacity {
+      logger.errorf("%s doesn't fit, the program area would end at %s, past %s", out.samples, out.end_radius(), Length(Max_radius))
+      return Exit_failure
+    }
+    return 0
+  }
+}
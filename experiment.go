@@ -0,0 +1,250 @@
+package main
+
+import (
+  "bytes"
+  "encoding/json"
+  "flag"
+  "fmt"
+  "math"
+  "os"
+  "strconv"
+  "strings"
+)
+
+/**
+ * A blind test of burn parameters. Every variant, a dark/light pair and a
+ * way to mix the two, gets a few cells of the disc, in an order shuffled
+ * with -seed. The disc itself doesn't tell which cell holds what: the key
+ * file does, to be read once the cells have been judged.
+ *
+ * Cells are pie slices of concentric bands, numbered from the innermost band
+ * outwards, clockwise from the top in each band, seen from the data side. A
+ * thin dark spoke marks the top.
+ */
+const Experiment_spoke = 1.0 // width of the spoke, in degrees
+
+/**
+ * How a cell mixes its pair: runs of dark bytes then runs of light ones,
+ * run bytes long on average, duty being the share of dark bytes.
+ */
+type Variant struct {
+  Dark byte `json:"dark"`
+  Light byte `json:"light"`
+  Run int `json:"run"`
+  Duty float64 `json:"duty"`
+}
+
+func (v Variant) byte_at(i int) byte {
+  period := 2 * v.Run
+  if float64(i % period) < v.Duty * float64(period) {
+    return v.Dark
+  }
+  return v.Light
+}
+
+type Experiment_cell struct {
+  Cell int `json:"cell"`
+  Band int `json:"band"`
+  Slice int `json:"slice"`
+  Inner float64 `json:"inner"` // in mm
+  Outer float64 `json:"outer"`
+  From float64 `json:"from"`    // in degrees, clockwise from the top
+  To float64 `json:"to"`
+  Variant *Variant `json:"variant"` // nil for a cell left light
+}
+
+func parse_pairs(s string) ([][2]byte, error) {
+  r := [][2]byte{}
+  for _, part := range strings.Split(s, ",") {
+    values := strings.Split(strings.TrimSpace(part), "/")
+    if len(values) != 2 {
+      return nil, fmt.Errorf("invalid pairs: %q, expecting dark/light,..., e.g. 0x40/0x45,0x00/0xff", s)
+    }
+    pair := [2]byte{}
+    for i, v := range values {
+      b, err := strconv.ParseUint(v, 0, 8)
+      if err != nil {
+        return nil, fmt.Errorf("invalid pairs: %q, %q isn't a byte", s, v)
+      }
+      pair[i] = byte(b)
+    }
+    r = append(r, pair)
+  }
+  return r, nil
+}
+
+func parse_list(s string, name string, parse func(string) (float64, error)) ([]float64, error) {
+  r := []float64{}
+  for _, part := range strings.Split(s, ",") {
+    v, err := parse(strings.TrimSpace(part))
+    if err != nil {
+      return nil, fmt.Errorf("invalid %s: %q", name, s)
+    }
+    r = append(r, v)
+  }
+  return r, nil
+}
+
+/**
+ * Every combination of the pairs, runs and duties, repeats times, shuffled
+ * into the cells of the given number of bands. Cells past the last variant
+ * are left light.
+ */
+func experiment_layout(g Geometry, variants []Variant, repeats int, bands int) []Experiment_cell {
+  shuffled := []*Variant{}
+  for i:=0; i<repeats; i++ {
+    for j := range variants {
+      shuffled = append(shuffled, &variants[j])
+    }
+  }
+  random.Shuffle(len(shuffled), func(i int, j int) {
+    shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+  })
+
+  slices := (len(shuffled) + bands - 1) / bands
+  inner, outer := float64(g.visible_radius()), float64(g.end_radius())
+  width := (outer - inner) / float64(bands)
+  cells := []Experiment_cell{}
+  for b:=0; b<bands; b++ {
+    for s:=0; s<slices; s++ {
+      c := Experiment_cell{
+        Cell: len(cells) + 1,
+        Band: b + 1,
+        Slice: s + 1,
+        Inner: inner + float64(b) * width,
+        Outer: inner + float64(b + 1) * width,
+        From: 360 * float64(s) / float64(slices),
+        To: 360 * float64(s + 1) / float64(slices),
+      }
+      if len(cells) < len(shuffled) {
+        c.Variant = shuffled[len(cells)]
+      }
+      cells = append(cells, c)
+    }
+  }
+  return cells
+}
+
+func experiment(buf *bytes.Buffer, g Geometry, cells []Experiment_cell, bands int) {
+  slices := len(cells) / bands
+  inner := float64(g.visible_radius())
+  width := (float64(g.end_radius()) - inner) / float64(bands)
+  i := 0
+  spiral(buf, g, func(radius float64, angle float64) byte {
+    i++
+    // degrees clockwise from the top
+    a := math.Mod(2.5 * math.Pi - angle, 2 * math.Pi) * 180 / math.Pi
+    if radius < inner || a < Experiment_spoke / 2 || a > 360 - Experiment_spoke / 2 {
+      if radius >= inner {
+        return Dark
+      }
+      return Light
+    }
+    b := min(bands - 1, int((radius - inner) / width))
+    c := cells[b * slices + min(slices - 1, int(a / 360 * float64(slices)))]
+    if c.Variant == nil {
+      return Light
+    }
+    return c.Variant.byte_at(i)
+  })
+}
+
+func experiment_command(fs *flag.FlagSet) func() int {
+  g := geometry_flags(fs)
+  m := seed_flag(fs)
+  pairs := fs.String("pairs", "0x40/0x45,0x00/0xff,0x55/0xaa,0x0f/0xf0", "dark/light pairs to compare, as dark/light,...")
+  runs := fs.String("runs", "1,4,16", "lengths of the runs of dark or light bytes to compare, as r1,r2,...")
+  duties := fs.String("duties", "0.5", "shares of dark bytes to compare, between 0 and 1, as d1,d2,...")
+  repeats := fs.Int("repeats", 2, "cells per variant")
+  bands := fs.Int("bands", 4, "number of concentric bands the cells are laid out in")
+  key := fs.String("key", "", "file to write the answer key to, as json. Defaults to the output file with a .key.json extension")
+  output := fs.String("o", "-", "output file, - for stdout")
+  fs.Usage = func() {
+    fmt.Fprintf(fs.Output(), "usage: %s experiment [options]\n\n", os.Args[0])
+    fmt.Fprintf(fs.Output(), "fills the disc with cells of every combination of -pairs, -runs and\n")
+    fmt.Fprintf(fs.Output(), "-duties, in an order shuffled with -seed. The key file tells which cell\n")
+    fmt.Fprintf(fs.Output(), "holds what: judge the burned disc before reading it. Cells are numbered\n")
+    fmt.Fprintf(fs.Output(), "from the inner band outwards, clockwise from the spoke at the top.\n\noptions:\n")
+    fs.PrintDefaults()
+  }
+  return func() int {
+    if fs.NArg() != 0 || *repeats < 1 || *bands < 1 {
+      fs.Usage()
+      return Exit_usage
+    }
+    if err := g.validate(); err != nil {
+      logger.errorf("%s", err)
+      return Exit_usage
+    }
+    if *key == "" {
+      if *output == "-" {
+        logger.errorf("-key is needed when writing to stdout")
+        return Exit_usage
+      }
+      *key = companion(*output, ".key.json")
+    }
+    p, err := parse_pairs(*pairs)
+    if err != nil {
+      logger.errorf("%s", err)
+      return Exit_usage
+    }
+    r, err := parse_list(*runs, "runs", func(s string) (float64, error) {
+      v, err := strconv.Atoi(s)
+      if v < 1 {
+        return 0, fmt.Errorf("invalid run")
+      }
+      return float64(v), err
+    })
+    if err != nil {
+      logger.errorf("%s", err)
+      return Exit_usage
+    }
+    d, err := parse_list(*duties, "duties", func(s string) (float64, error) {
+      v, err := strconv.ParseFloat(s, 64)
+      if v < 0 || v > 1 {
+        return 0, fmt.Errorf("invalid duty")
+      }
+      return v, err
+    })
+    if err != nil {
+      logger.errorf("%s", err)
+      return Exit_usage
+    }
+    variants := []Variant{}
+    for _, pair := range p {
+      for _, run := range r {
+        for _, duty := range d {
+          variants = append(variants, Variant{pair[0], pair[1], int(run), duty})
+        }
+      }
+    }
+
+    m.reseed()
+    cells := experiment_layout(*g, variants, *repeats, *bands)
+    logger.infof("%d variants, %d cells in %d bands", len(variants), len(cells), *bands)
+    logger.infof("%s", g.describe())
+    buf := &bytes.Buffer{}
+    wav_header(buf, g.samples)
+    experiment(buf, *g, cells, *bands)
+    if err := check_length(buf, g.samples); err != nil {
+      logger.errorf("%s", err)
+      return Exit_failure
+    }
+    stamp(buf, *m)
+    if err := write_output(*output, buf.Bytes()); err != nil {
+      logger.errorf("%s", err)
+      return Exit_failure
+    }
+    data, err := json.MarshalIndent(cells, "", "  ")
+    if err != nil {
+      logger.errorf("%s", err)
+      return Exit_failure
+    }
+    logger.infof("writing the key to %s", *key)
+    if err := write_output(*key, append(data, '\n')); err != nil {
+      logger.errorf("%s", err)
+      return Exit_failure
+    }
+    return 0
+  }
+}
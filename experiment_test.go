@@ -0,0 +1,32 @@
+package main
+
+import (
+  "math/rand"
+  "testing"
+)
+
+func TestExperimentLayout(t *testing.T) {
+  g := default_geometry()
+  g.samples = Duration(20 * 60 * Sample_rate)
+  variants := []Variant{{Dark, Light, 1, 0.5}, {0x00, 0xff, 4, 0.5}, {0x55, 0xaa, 16, 0.25}}
+  old := random
+  random = rand.New(rand.NewSource(1))
+  defer func() {
+    random = old
+  }()
+  cells := experiment_layout(g, variants, 3, 4)
+  if len(cells) != 12 {
+    t.Fatalf("got %d cells, expecting 12", len(cells))
+  }
+  seen := map[Variant]int{}
+  for _, c := range cells {
+    if c.Variant != nil {
+      seen[*c.Variant]++
+    }
+  }
+  for _, v := range variants {
+    if seen[v] != 3 {
+      t.Errorf("variant %+v has %d cells, expecting 3", v, seen[v])
+    }
+  }
+}
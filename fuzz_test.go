@@ -0,0 +1,263 @@
+package main
+
+import (
+  "bytes"
+  "encoding/csv"
+  "encoding/json"
+  "flag"
+  "math"
+  "os"
+  "path/filepath"
+  "strings"
+  "testing"
+)
+
+/**
+ * Fuzz targets for the parsers which read what users hand over: project
+ * files, batch files, drawings, and the option values found in them. Whatever
+ * the input, a parser returns an error rather than panic, and what it
+ * accepts reads back the same way. Run one with e.g.:
+ *
+ *   go test *.go -run '^$' -fuzz FuzzProject -fuzztime 1m
+ *
+ * Without -fuzz, go test only runs the seeds below, like any other test.
+ */
+
+/**
+ * Seeds from a directory of testdata, and the embedded templates.
+ */
+func add_files(f *testing.F, pattern string) {
+  filenames, err := filepath.Glob(pattern)
+  if err != nil {
+    f.Fatal(err)
+  }
+  for _, filename := range filenames {
+    data, err := os.ReadFile(filename)
+    if err != nil {
+      f.Fatal(err)
+    }
+    f.Add(data)
+  }
+}
+
+/**
+ * Checks a node against what encoding/json makes of the same document.
+ */
+func same_json(pos Position, n *Node, v interface{}) bool {
+  if n.offset < 0 || n.offset >= len(pos.data) {
+    return false
+  }
+  switch v := v.(type) {
+    case map[string]interface{}:
+      if n.kind != "object" || pos.data[n.offset] != '{' || len(n.keys) != len(v) {
+        return false
+      }
+      for _, key := range n.keys {
+        if w, ok := v[key]; !ok || !same_json(pos, n.values[key], w) {
+          return false
+        }
+      }
+      return true
+    case []interface{}:
+      if n.kind != "array" || pos.data[n.offset] != '[' || len(n.items) != len(v) {
+        return false
+      }
+      for i, item := range n.items {
+        if !same_json(pos, item, v[i]) {
+          return false
+        }
+      }
+      return true
+    case string:
+      return n.kind == "string" && pos.data[n.offset] == '"' && n.raw == v
+    case json.Number:
+      return n.kind == "number" && n.raw == string(v)
+    case bool:
+      return n.kind == "bool" && n.raw == map[bool]string{true: "true", false: "false"}[v]
+    case nil:
+      return n.kind == "null"
+  }
+  return false
+}
+
+/**
+ * Project files: parse_json only accepts valid json, without duplicate keys,
+ * and reads it the way encoding/json does. Expanding the placeholders and
+ * checking the schema then never fail other than with an error.
+ */
+func FuzzProject(f *testing.F) {
+  add_files(f, "templates/*.json")
+  f.Add([]byte(`{"pattern": "text", "options": {"text": "{{name}}"}, "variables": {"name": "x"}}`))
+  f.Add([]byte(`{"a": [1, -2.5e3, true, null, "é\n"], "a": {}}`))
+  f.Add([]byte(`[[[[{"": ""}]]]] `))
+  schema := load_schema(project_schema)
+  f.Fuzz(func(t *testing.T, data []byte) {
+    pos := Position{filename: "fuzz.json", data: data}
+    root, err := parse_json(pos)
+    if err != nil {
+      if !strings.HasPrefix(err.Error(), "fuzz.json:") {
+        t.Errorf("error without a position: %s", err)
+      }
+      return
+    }
+    if !json.Valid(data) {
+      t.Fatalf("accepted invalid json")
+    }
+    d := json.NewDecoder(bytes.NewReader(data))
+    d.UseNumber()
+    var v interface{}
+    if err := d.Decode(&v); err != nil {
+      t.Fatal(err)
+    }
+    if !same_json(pos, root, v) {
+      t.Fatalf("read differently from encoding/json")
+    }
+    variables := Variables{}
+    if defaults, ok := root.values["variables"]; ok {
+      for _, name := range defaults.keys {
+        variables[name] = defaults.values[name].raw
+      }
+    }
+    if expand_json(pos, root, variables) == nil {
+      validate_json(pos, root, schema)
+    }
+  })
+}
+
+/**
+ * Placeholders: once every name used is defined, expanding succeeds and
+ * leaves no placeholder behind, unless braces around the placeholders or in
+ * the value make up new ones.
+ */
+func FuzzExpand(f *testing.F) {
+  f.Add("dear {{ name }}, {{when}}", "x")
+  f.Add("{{}}{{{a}}}}", "{{a}}")
+  f.Add("no placeholder", "")
+  f.Fuzz(func(t *testing.T, s string, value string) {
+    v := Variables{}
+    if _, err := expand(s, v); err == nil && placeholder.MatchString(s) {
+      t.Fatalf("%q: expanded without variables", s)
+    }
+    for _, m := range placeholder.FindAllStringSubmatch(s, -1) {
+      v[m[1]] = value
+    }
+    r, err := expand(s, v)
+    if err != nil {
+      t.Fatalf("%q: %s", s, err)
+    }
+    if !placeholder.MatchString(s) && r != s {
+      t.Fatalf("%q: expanded to %q", s, r)
+    }
+    if !strings.ContainsAny(value + placeholder.ReplaceAllString(s, ""), "{}") && placeholder.MatchString(r) {
+      t.Fatalf("%q: expanded to %q", s, r)
+    }
+  })
+}
+
+/**
+ * Batch files: any header gets checked without panicking, and a column
+ * which is neither a flag nor a valid variable name is refused.
+ */
+func FuzzBatchColumns(f *testing.F) {
+  f.Add([]byte("output,text,duration\n1.wav,hello,4m\n"))
+  f.Add([]byte("name,\"text\"\"\",bad-name\n"))
+  f.Add([]byte("zone_pair,seed\n\"25mm-40mm:0x00/0xff\",1\n"))
+  level := logger.level
+  logger.level = Level_error
+  f.Cleanup(func() {
+    logger.level = level
+  })
+  f.Fuzz(func(t *testing.T, data []byte) {
+    r := csv.NewReader(bytes.NewReader(data))
+    header, err := r.Read()
+    if err != nil {
+      return
+    }
+    err = check_columns("fuzz.csv", header)
+    fs := flag.NewFlagSet("", flag.ContinueOnError)
+    design_flags(fs)
+    for _, column := range header {
+      known := fs.Lookup(strings.ReplaceAll(column, "_", "-")) != nil
+      if !known && column != Output_column && !variable_name.MatchString(column) && err == nil {
+        t.Fatalf("column %q accepted", column)
+      }
+    }
+    // the rows get read the same way batch reads them
+    for {
+      if _, err := r.Read(); err != nil {
+        break
+      }
+    }
+  })
+}
+
+/**
+ * Drawings: any file parses or fails without panicking, and every point of
+ * a drawing which parses is finite, so that fit can place it.
+ */
+func FuzzDrawings(f *testing.F) {
+  add_files(f, "testdata/plot/*")
+  f.Add([]byte("G21\nG90\nG0 X0 Y0\nG1 X10 Y0 Z-1\nG2 X0 Y10 I-10 J0\n"))
+  f.Add([]byte("IN;SP1;PU0,0;PD100,0,100,100;PA;PR-100,0;"))
+  f.Add([]byte("0\nSECTION\n2\nENTITIES\n0\nLINE\n10\n0\n20\n0\n11\n1\n21\n1\n0\nENDSEC\n0\nEOF\n"))
+  f.Fuzz(func(t *testing.T, data []byte) {
+    for _, format := range drawing_formats {
+      d, err := format.parse(data)
+      if err != nil {
+        continue
+      }
+      for _, stroke := range d {
+        for _, p := range stroke {
+          if math.IsNaN(p.x) || math.IsNaN(p.y) || math.IsInf(p.x, 0) || math.IsInf(p.y, 0) {
+            t.Fatalf("%s: point %v", format.name, p)
+          }
+        }
+      }
+      if len(d) > 0 {
+        d.fit(Dye_outer_radius)
+      }
+    }
+  })
+}
+
+/**
+ * Option values found in project and batch files: what parses prints in a
+ * form which parses back to the same print.
+ */
+func FuzzOptionValues(f *testing.F) {
+  f.Add("25mm-40mm:0x00/0xff, 40mm-58mm:0x40/0x45")
+  f.Add("1.48um")
+  f.Add("21m30s")
+  f.Add("96,36,30")
+  f.Fuzz(func(t *testing.T, s string) {
+    var z Zone_pairs
+    if z.Set(s) == nil {
+      var again Zone_pairs
+      if err := again.Set(z.String()); err != nil || again.String() != z.String() {
+        t.Fatalf("%q: prints as %q, which reads back as %q, %v", s, z, again, err)
+      }
+    }
+    var l Length
+    if l.Set(s) == nil && !math.IsInf(float64(l), 0) {
+      var again Length
+      if err := again.Set(l.String()); err != nil || again.String() != l.String() {
+        t.Fatalf("%q: prints as %q, which reads back as %q, %v", s, l, again, err)
+      }
+    }
+    var d Duration
+    if d.Set(s) == nil && d >= 0 {
+      var again Duration
+      if err := again.Set(d.String()); err != nil || again != d {
+        t.Fatalf("%q: prints as %q, which reads back as %d samples, %v", s, d, int(again), err)
+      }
+    }
+    if g, err := parse_gears(s); err == nil {
+      if g.fixed <= 0 || g.rolling <= 0 || g.rolling >= g.fixed || !(g.pen >= 0) {
+        t.Fatalf("%q: accepted as %+v", s, g)
+      }
+    }
+    parse_point(s)
+    parse_tones(s)
+    parse_background(s)
+  })
+}
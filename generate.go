@@ -0,0 +1,524 @@
+package main
+
+import (
+  "bytes"
+  "flag"
+  "fmt"
+  "io"
+  "os"
+  "strconv"
+  "strings"
+  "time"
+)
+
+/**
+ * Every pattern, along with the options it takes. The options are the names
+ * of the flags registered by pattern_flags.
+ */
+var patterns = []struct {
+  name Pattern
+  description string
+  parameters []string
+}{
+  {Pitch, "plays a fixed pitch sound, for testing", []string{"frequency"}},
+  {Sweep, "plays a logarithmic sweep from -frequency to -sweep-to, for testing", []string{"frequency", "sweep-to", "sweep-duration"}},
+  {Tones, "plays several pitches at once, for testing", []string{"tones"}},
+  {Verify, "numbered blocks with a crc, to check rips with verify-rip", []string{}},
+  {Channels, "bands of left only, right only, in phase and anti-phase sound, for testing", []string{"frequency"}},
+  {Bands, "concentric bands", []string{"bands", "blend", "blend-style"}},
+  {Pie, "a pie", []string{}},
+  {World, "coastlines of the world, with an optional marker", []string{"projection", "marker", "width", "jitter"}},
+  {Spirograph, "hypotrochoid curves", []string{"gears", "width", "jitter"}},
+  {Text, "text along circles, {{name}} is replaced by the value of -var name=...", []string{"text", "text-height", "border", "sector", "justify", "width", "jitter", "var"}},
+  {Code, "a circular 2-D code holding the -payload file, readable from a scan with read-code", []string{"payload", "cell-size"}},
+  {Plot, "a pen plotter or CAD drawing, G-code, HPGL or DXF, scaled to fill the program area", []string{"drawing", "actual-size", "width", "jitter"}},
+}
+
+/**
+ * Options shared by every command which creates a pattern.
+ */
+type Pattern_options struct {
+  frequency float64
+  sweep_to float64
+  sweep_duration Duration
+  tones string
+  bands int
+  blend float64
+  blend_style string
+  projection string
+  marker string
+  gears string
+  drawing string
+  actual_size bool
+  payload string
+  cell_size float64
+  text string
+  text_height float64
+  border string
+  sector Sector
+  justify string
+  width float64
+  jitter bool
+  variables Variables
+  fill_to Duration
+  background string
+  watermark Watermark_options
+  protect Protected
+  intro string
+  silent_intro Duration
+  signature string
+  provenance bool
+  stack string
+  stack_index int
+  kaleidoscope int
+  kaleidoscope_fold string
+  preset string
+  contrast string
+  zone_pairs Zone_pairs
+  no_cache bool
+}
+
+func pattern_flags(fs *flag.FlagSet) *Pattern_options {
+  o := &Pattern_options{}
+  fs.Float64Var(&o.frequency, "frequency", 440, "frequency of the sound, in Hz")
+  fs.Float64Var(&o.sweep_to, "sweep-to", 20000, "frequency at which the sweep ends, in Hz")
+  fs.Var(&o.sweep_duration, "sweep-duration", "length of one sweep, e.g. 10s. The sweep repeats, the whole output by default")
+  fs.StringVar(&o.tones, "tones", "440,880,1760", "frequencies to play at once, in Hz, as f1,f2,...")
+  fs.IntVar(&o.bands, "bands", 8, "number of bands")
+  fs.Float64Var(&o.blend, "blend", 0, "blends each boundary between bands over this many revolutions, instead of a sharp ring. 0 for none")
+  fs.StringVar(&o.blend_style, "blend-style", string(Dither_blend), "how boundaries get blended: dither, mixing bytes of both bands, or palette, with the byte values in between, whose tones depend on the blank's dye")
+  fs.StringVar(&o.projection, "projection", string(Azimuthal),
+    fmt.Sprintf("map projection, one of %s", projections))
+  fs.StringVar(&o.marker, "marker", "", "location to highlight, as lat,long")
+  fs.StringVar(&o.gears, "gears", "96,36,30", "fixed gear, rolling gear and pen offset, as fixed,rolling,pen")
+  fs.StringVar(&o.drawing, "drawing", "", "G-code (.gcode, .nc), HPGL (.hpgl, .plt) or DXF (.dxf) file to engrave. May be an http(s) url")
+  fs.BoolVar(&o.actual_size, "actual-size", false, "engraves the drawing as is, in mm from the center of the disc, instead of scaling it to fill the program area")
+  fs.StringVar(&o.payload, "payload", "", "file to store in the code, up to a few kilobytes. May be an http(s) url")
+  o.cell_size = 0.5
+  fs.Var((*Length)(&o.cell_size), "cell-size", "size of the cells of the code, larger ones are easier to read from a photo")
+  fs.StringVar(&o.text, "text", "micro-engraving", "text to write, one circle per line")
+  fs.Float64Var(&o.text_height, "text-height", 4, "height of the capital letters, in mm")
+  fs.StringVar(&o.border, "border", string(No_border), "border along the edges of the text: none, lines or ornament")
+  fs.Var(&o.sector, "sector", "wraps the text into paragraphs between two radii and two angles, in degrees clockwise from the top, as inner-outer:from-to")
+  fs.StringVar(&o.justify, "justify", string(Center_justify), "how lines sit in the sector: left, center, right or full")
+  fs.Float64Var(&o.width, "width", 0.3, "stroke width, in mm")
+  fs.BoolVar(&o.jitter, "jitter", false, "offsets where each revolution reads the drawing by up to half a pixel along the track, differently from its neighbours, turning the stair steps of curved and diagonal edges into fine noise")
+  fs.Var(&o.variables, "var", "template variable, as name=value. May be repeated")
+  fs.Var(&o.fill_to, "fill-to", "capacity of the blank, e.g. 80m. The disc past the design gets the background, no fill by default")
+  fs.StringVar(&o.background, "background", "light", "what goes past the design: light, dark, noise or a byte, e.g. 0x42")
+  watermark_flags(fs, &o.watermark)
+  fs.BoolVar(&o.no_cache, "no-cache", false, "always redo the pattern, instead of reusing the one cached by an earlier run")
+  fs.StringVar(&o.intro, "intro", "", "audio file played as track 1, the design follows as track 2: a wav file at any rate, or mp3, flac, ogg... with ffmpeg installed. Writes a cue sheet next to the output")
+  fs.Var(&o.silent_intro, "silent-intro", "track 1 of digital silence, at least 4s, then a 2s pregap before the design as track 2, so that a player which starts the disc on its own doesn't play the design's noise first. Writes a cue sheet next to the output")
+  fs.StringVar(&o.signature, "signature", "", "writes a ring near the hub holding a hash of the design's options (design) or of a file, read back by the signature command")
+  fs.BoolVar(&o.provenance, "provenance", false, "writes when the disc was generated, the version and a digest of the design's options as text near the hub")
+  fs.IntVar(&o.kaleidoscope, "kaleidoscope", 0, "repeats the wedge of the design clockwise from the top this many times around the disc, hiding where the spiral starts. 0 for none")
+  fs.StringVar(&o.kaleidoscope_fold, "kaleidoscope-fold", string(Mirror_fold), "how the wedges repeat: mirror, every other one flipped, or repeat")
+  fs.StringVar(&o.stack, "stack", "", "json file defining the alignment marks shared by a set of stacked discs: their band, the notches' angles and where the index marks go")
+  fs.IntVar(&o.stack_index, "stack-index", 0, "position of the disc in the stack, from 1, for its index mark. 0 for none")
+  fs.StringVar(&o.preset, "preset", "", "adjusts the design for a purpose: high-contrast, for low-vision viewing, burns the pair with the most contrast and raises features below the smallest reliable size")
+  fs.StringVar(&o.contrast, "contrast", "", "measurement of a calibration disc burned on the same blanks, as written by the contrast command, for the high-contrast preset")
+  fs.Var(&o.zone_pairs, "zone-pair", "dark/light pair to burn the design with between two radii, instead of the default or the preset's, as inner-outer:dark/light, e.g. 25mm-40mm:0x00/0xff. May be repeated")
+  fs.Var(&o.protect, "protect", "radius range the design leaves alone, holding silence or an audio file, as inner-outer[:file]. May be repeated")
+  return o
+}
+
+/**
+ * Parses "f1,f2,...", in Hz.
+ */
+func parse_tones(s string) ([]float64, error) {
+  r := []float64{}
+  for _, part := range strings.Split(s, ",") {
+    f, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+    if err != nil || f <= 0 {
+      return nil, fmt.Errorf("invalid tones: %q, expecting frequencies as f1,f2,...", s)
+    }
+    r = append(r, f)
+  }
+  return r, nil
+}
+
+/**
+ * Geometry of the whole output: the design, followed by the fill.
+ */
+func (o Pattern_options) output_geometry(g Geometry) Geometry {
+  g.samples = max(g.samples, o.fill_to)
+  return g
+}
+
+/**
+ * Returns the source of background bytes. noise is mostly light, with a
+ * sprinkle of dark bytes, for a texture which doesn't look like a mistake.
+ */
+func parse_background(s string) (func() byte, error) {
+  switch s {
+    case "light":
+      return func() byte { return Light }, nil
+    case "dark":
+      return func() byte { return Dark }, nil
+    case "noise":
+      return func() byte {
+        if random.Intn(8) == 0 {
+          return Dark
+        }
+        return Light
+      }, nil
+  }
+  v, err := strconv.ParseUint(s, 0, 8)
+  if err != nil {
+    return nil, fmt.Errorf("invalid background: %s, expecting light, dark, noise or a byte", s)
+  }
+  return func() byte { return byte(v) }, nil
+}
+
+/**
+ * Fills the disc past the design, up to the capacity of the blank. Otherwise
+ * the burner leaves it blank, with an abrupt change of tone where the design
+ * ends.
+ */
+func fill(buf *bytes.Buffer, design Geometry, total Geometry, background func() byte) {
+  if total.samples <= design.samples {
+    return
+  }
+  logger.infof("background: %s to %s, %s to %s", design.samples, total.samples,
+    design.end_radius(), total.end_radius())
+  for i:=design.samples * 4; i<total.samples * 4; i++ {
+    buf.WriteByte(background())
+  }
+}
+
+/**
+ * Prints the usage of a command which takes a pattern, including the list of
+ * patterns.
+ */
+func pattern_usage(fs *flag.FlagSet, args string) func() {
+  return func() {
+    out := fs.Output()
+    fmt.Fprintf(out, "usage: %s %s [options] %s\n\n", os.Args[0], fs.Name(), args)
+    fmt.Fprintf(out, "patterns:\n")
+    for _, p := range patterns {
+      fmt.Fprintf(out, "  %-12s %s\n", p.name, p.description)
+      if len(p.parameters) > 0 {
+        fmt.Fprintf(out, "  %-12s options: -%s\n", "", strings.Join(p.parameters, ", -"))
+      }
+    }
+    fmt.Fprintf(out, "\noptions:\n")
+    fs.PrintDefaults()
+  }
+}
+
+/**
+ * Creates the wav file for a given pattern, and tells what went before the
+ * design. Errors are caused by invalid options.
+ */
+func generate_pattern(pattern Pattern, o *Pattern_options, g Geometry) (*bytes.Buffer, Intro, error) {
+  if err := g.validate(); err != nil {
+    return nil, Intro{}, err
+  }
+  return compose(pattern, o, g)
+}
+
+/**
+ * Does the work of generate_pattern, for any geometry, even one which
+ * couldn't be burned.
+ */
+func compose(pattern Pattern, o *Pattern_options, g Geometry) (*bytes.Buffer, Intro, error) {
+  if o.width <= 0 {
+    return nil, Intro{}, fmt.Errorf("invalid width: %f", o.width)
+  }
+  // the preset works on a copy, the caller's options stay as given
+  adjusted := *o
+  o = &adjusted
+  pair, err := apply_preset(pattern, o, g)
+  if err != nil {
+    return nil, Intro{}, err
+  }
+  background, err := parse_background(o.background)
+  if err != nil {
+    return nil, Intro{}, err
+  }
+
+  start := time.Now()
+  buf := &bytes.Buffer{}
+  wav_header(buf, o.output_geometry(g).samples)
+  // the design goes past the intro, if any
+  disc := g
+  audio, pregap, err := intro_samples(o)
+  if err != nil {
+    return nil, Intro{}, err
+  }
+  if len(audio) > 0 {
+    intro := Duration(len(audio) / 4)
+    if intro >= g.samples {
+      return nil, Intro{}, fmt.Errorf("the intro lasts %s, leaving no room for the design in %s", intro, g.samples)
+    }
+    buf.Write(audio)
+    g = g.skip(intro)
+    logger.infof("intro: %s, the design starts at %s", intro, g.start_radius)
+  }
+
+  if err := cached_stage(buf, pattern, o, g, func() error { return pattern_stage(buf, pattern, o, g) }); err != nil {
+    return nil, Intro{}, err
+  }
+  if err := kaleidoscope(buf, pattern, o.kaleidoscope, o.kaleidoscope_fold, g, disc); err != nil {
+    return nil, Intro{}, err
+  }
+  fill(buf, disc, o.output_geometry(disc), background)
+  if err := watermark(buf, o.watermark, o.output_geometry(disc), o.width); err != nil {
+    return nil, Intro{}, err
+  }
+  if err := signature(buf, o.signature, pattern, o, g, o.output_geometry(disc)); err != nil {
+    return nil, Intro{}, err
+  }
+  if err := provenance(buf, o.provenance, pattern, o, g, o.output_geometry(disc)); err != nil {
+    return nil, Intro{}, err
+  }
+  if err := stack(buf, o.stack, o.stack_index, o.output_geometry(disc)); err != nil {
+    return nil, Intro{}, err
+  }
+  if o.preset != "" || len(o.zone_pairs) > 0 {
+    // past the intro, which is sound
+    if err := remap(buf.Bytes()[Wav_header_size:], o.output_geometry(disc), int(disc.samples - g.samples), pair, o.zone_pairs); err != nil {
+      return nil, Intro{}, err
+    }
+  }
+  if err := protect(buf, o.protect, o.output_geometry(disc)); err != nil {
+    return nil, Intro{}, err
+  }
+  logger.debugf("%s took %s", pattern, time.Since(start).Round(time.Millisecond))
+  return buf, Intro{len(audio) / 4, pregap}, nil
+}
+
+/**
+ * Appends the samples of the pattern itself.
+ */
+func pattern_stage(buf *bytes.Buffer, pattern Pattern, o *Pattern_options, g Geometry) error {
+  switch pattern {
+    case Pitch:
+      pitch(buf, int(g.samples), o.frequency)
+    case Sweep:
+      if o.frequency <= 0 || o.sweep_to <= 0 {
+        return fmt.Errorf("invalid sweep: %gHz to %gHz", o.frequency, o.sweep_to)
+      }
+      period := int(o.sweep_duration)
+      if period <= 0 {
+        period = int(g.samples)
+      }
+      sweep(buf, int(g.samples), o.frequency, o.sweep_to, period)
+    case Tones:
+      frequencies, err := parse_tones(o.tones)
+      if err != nil {
+        return err
+      }
+      tones(buf, int(g.samples), frequencies)
+    case Verify:
+      verify_pattern(buf, int(g.samples))
+    case Channels:
+      channels(buf, g, o.frequency)
+    case Bands:
+      if o.bands <= 0 {
+        return fmt.Errorf("invalid number of bands: %d", o.bands)
+      }
+      if o.blend < 0 {
+        return fmt.Errorf("invalid blend: %g revolutions", o.blend)
+      }
+      if style := Blend(o.blend_style); style != Palette_blend && style != Dither_blend {
+        return fmt.Errorf("unknown blend style: %s, expecting palette or dither", o.blend_style)
+      }
+      bands(buf, g, o.bands, o.blend, Blend(o.blend_style))
+    case Pie:
+      pie(buf, g, 0.25)
+    case World:
+      var marker *LatLong
+      if o.marker != "" {
+        var err error
+        if marker, err = parse_lat_long(o.marker); err != nil {
+          return err
+        }
+      }
+      if err := worldmap(buf, g, Projection(o.projection), marker, o.width, o.jitter); err != nil {
+        return err
+      }
+    case Spirograph:
+      gears, err := parse_gears(o.gears)
+      if err != nil {
+        return err
+      }
+      spirograph(buf, g, gears, o.width, o.jitter)
+    case Text:
+      s, err := expand(o.text, o.variables)
+      if err != nil {
+        return err
+      }
+      if err := text(buf, g, s, o.text_height, o.width, Border(o.border), o.sector, Justify(o.justify), o.jitter); err != nil {
+        return err
+      }
+    case Code:
+      if o.payload == "" {
+        return fmt.Errorf("the code pattern needs a -payload")
+      }
+      payload, err := read_asset(o.payload)
+      if err != nil {
+        return err
+      }
+      if err := datacode(buf, g, payload, o.cell_size); err != nil {
+        return err
+      }
+    case Plot:
+      if o.drawing == "" {
+        return fmt.Errorf("the plot pattern needs a -drawing")
+      }
+      d, err := read_drawing(o.drawing)
+      if err != nil {
+        return err
+      }
+      if err := plot(buf, g, d, o.width, o.actual_size, o.jitter); err != nil {
+        return err
+      }
+    default:
+      return fmt.Errorf("unknown pattern: %s", pattern)
+  }
+  return nil
+}
+
+/**
+ * Checks that the buffer holds exactly one header and all the samples.
+ */
+func check_length(buf *bytes.Buffer, samples Duration) error {
+  if buf.Len() != int(samples) * 4 + Wav_header_size {
+    return fmt.Errorf("incorrect total bytes. Expecting %d, got %d",
+      int(samples) * 4 + Wav_header_size,
+      buf.Len())
+  }
+  return nil
+}
+
+func generate_command(fs *flag.FlagSet) func() int {
+  o := pattern_flags(fs)
+  g := geometry_flags(fs)
+  m := seed_flag(fs)
+  project := project_flag(fs)
+  names := []string{}
+  for _, f := range formats {
+    names = append(names, f.name)
+  }
+  format := fs.String("format", "wav", "output format, one of " + strings.Join(names, ", "))
+  s := sector_flags(fs)
+  output := fs.String("o", "-", "output file, - for stdout")
+  export := fs.String("export-geometry", "", "also writes the ring table, as json, to this file: revolution, radius, angle, start sample and samples of each ring")
+  checksums := fs.String("checksums", "", "also writes a crc of every second or ring of the output, as json, to this file, for verify-rip to tell where a rip differs")
+  per := fs.String("checksums-per", "second", "what each crc covers: second or ring")
+  since := fs.String("changed-since", "", "previous output of the design: writes only the sectors which differ from it, and a cue sheet telling where they go")
+  fs.Usage = pattern_usage(fs, "<pattern> | -project <file>")
+  return func() int {
+    f, err := find_format(*format)
+    if err != nil {
+      logger.errorf("%s", err)
+      return Exit_usage
+    }
+    pattern, err := pattern_argument(fs, *project, o.variables)
+    if err != nil {
+      logger.errorf("%s", err)
+      return Exit_usage
+    }
+    if pattern == "" {
+      fs.Usage()
+      return Exit_usage
+    }
+    intro := o.intro != "" || o.silent_intro > 0
+    if intro && (*format != "wav" || *output == "-") {
+      logger.errorf("-intro and -silent-intro write a wav file and its cue sheet, use -format wav and -o")
+      return Exit_usage
+    }
+    if *since != "" && (*format != "wav" || *output == "-" || intro) {
+      logger.errorf("-changed-since writes a wav file and its cue sheet, use -format wav and -o, without an intro")
+      return Exit_usage
+    }
+
+    logger.infof("creating pattern: %s", pattern)
+    logger.infof("%s", g.describe())
+    m.reseed()
+    buf, written, err := generate_pattern(pattern, o, *g)
+    if err != nil {
+      logger.errorf("%s", err)
+      return Exit_usage
+    }
+    out := o.output_geometry(*g)
+    if err := check_length(buf, out.samples); err != nil {
+      logger.errorf("%s", err)
+      return Exit_failure
+    }
+    if *checksums != "" {
+      // the whole disc, even when only the changes get written
+      if err := write_checksums(*checksums, buf.Bytes()[Wav_header_size:], out, *per); err != nil {
+        logger.errorf("%s", err)
+        return Exit_failure
+      }
+    }
+    if *since != "" {
+      span, err := keep_changes(buf, *since, out)
+      if err != nil {
+        logger.errorf("%s", err)
+        return Exit_failure
+      }
+      if err := write_output(companion(*output, ".cue"), []byte(span_cue(*output, span, *m))); err != nil {
+        logger.errorf("%s", err)
+        return Exit_failure
+      }
+    }
+    stamp(buf, *m)
+
+    if err := f.write(*output, buf.Bytes(), out, *m, *s); err != nil {
+      logger.errorf("%s", err)
+      return Exit_failure
+    }
+    if *export != "" {
+      if err := export_geometry(*export, out); err != nil {
+        logger.errorf("%s", err)
+        return Exit_failure
+      }
+    }
+    if intro {
+      logger.infof("writing %s", companion(*output, ".cue"))
+      if err := write_output(companion(*output, ".cue"), []byte(intro_cue(*output, written.samples, written.pregap, *m))); err != nil {
+        logger.errorf("%s", err)
+        return Exit_failure
+      }
+    }
+    return 0
+  }
+}
+
+/**
+ * Writes data to a file, or to stdout when filename is "-".
+ */
+func write_output(filename string, data []byte) error {
+  if filename == "-" {
+    _, err := os.Stdout.Write(data)
+    return err
+  }
+  return os.WriteFile(filename, data, 0644)
+}
+
+/**
+ * What was read from stdin. It can only be read once, later reads get the
+ * same data, e.g. batch loads -project - once per row.
+ */
+var stdin_input []byte
+
+/**
+ * Reads a file, or stdin when filename is "-".
+ */
+func read_input(filename string) ([]byte, error) {
+  if filename == "-" {
+    if stdin_input == nil {
+      data, err := io.ReadAll(os.Stdin)
+      if err != nil {
+        return nil, err
+      }
+      stdin_input = data
+    }
+    return stdin_input, nil
+  }
+  return os.ReadFile(filename)
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+  "encoding/json"
+  "flag"
+  "fmt"
+  "math"
+  "sort"
+)
+
+/**
+ * Physical layout of the spiral track. The spiral is approximated as a
+ * series of rings, one per revolution, each ring being one track pitch
+ * further out than the previous one.
+ */
+const (
+  Max_radius float64 = 58.0 // outer edge of the program area, in mm
+)
+
+/**
+ * Parts of the disc hidden once it sits in a tray, on a spindle or in a jewel
+ * case: the clamping area the drive's hub grips (ECMA-130, 26mm to 33mm in
+ * diameter) and the stacking ring molded right outside of it, which keeps
+ * stacked discs from touching. The program area normally starts well past
+ * them, unless -start-radius says otherwise.
+ */
+type Hub_zone struct {
+  name string
+  inner Length
+  outer Length
+}
+
+var hub_zones = []Hub_zone{
+  {"clamping area", 13.0, 16.5},
+  {"stacking ring", 16.5, 17.0},
+}
+
+type Geometry struct {
+  start_radius Length
+  track_pitch Length   // distance between tracks
+  linear_speed Speed
+  samples Duration     // the length of the program area
+  start_angle Angle    // of the first sample
+}
+
+/**
+ * A single revolution of the spiral.
+ */
+type Ring struct {
+  index int
+  radius Length
+  angle Angle    // of the first sample
+  start int      // index of the first sample in the revolution
+  samples int    // number of samples in the revolution
+}
+
+func default_geometry() Geometry {
+  return Geometry{
+    start_radius: 25.0,
+    track_pitch: 0.00148,
+    linear_speed: 1300.0, // TODO: how to figure out the right value for this?
+    samples: Duration(Sample_rate * Samples),
+  }
+}
+
+/**
+ * Registers the flags which override the default geometry.
+ */
+func geometry_flags(fs *flag.FlagSet) *Geometry {
+  g := default_geometry()
+  fs.Var(&g.start_radius, "start-radius", "radius at which the program area starts, e.g. 25mm")
+  fs.Var(&g.track_pitch, "track-pitch", "distance between tracks, e.g. 1.48um")
+  fs.Var(&g.linear_speed, "linear-speed", "linear speed of the track, e.g. 1.3m/s")
+  fs.Var(&g.samples, "duration", "length of the output, e.g. 21m or 70min")
+  return &g
+}
+
+/**
+ * Rejects values which can't be right for a CD. The ranges are a little wider
+ * than what the Red Book allows, to leave room for experiments.
+ */
+func (g Geometry) validate() error {
+  if g.start_radius < 15 || g.start_radius > 58 {
+    return fmt.Errorf("start radius %s is out of range (15mm to 58mm)", g.start_radius)
+  }
+  if g.track_pitch < 0.001 || g.track_pitch > 0.002 {
+    return fmt.Errorf("track pitch %s is out of range (1um to 2um)", g.track_pitch)
+  }
+  if g.linear_speed < 1000 || g.linear_speed > 1500 {
+    return fmt.Errorf("linear speed %s is out of range (1m/s to 1.5m/s)", g.linear_speed)
+  }
+  if g.samples <= 0 {
+    return fmt.Errorf("duration %s is too short", g.samples)
+  }
+  if r := g.end_radius(); r > Length(Max_radius) {
+    return fmt.Errorf("duration %s is too long, the program area would end at %s, past %s",
+      g.samples, r, Length(Max_radius))
+  }
+  return nil
+}
+
+/**
+ * Length of a (stereo, 16-bit) sample along the track.
+ */
+func (g Geometry) sample_length() Length {
+  return Length(g.linear_speed / Speed(Sample_rate))
+}
+
+/**
+ * Splits total samples into revolutions. A revolution rarely contains a whole
+ * number of samples, so the angle at which each ring starts drifts a little.
+ * The last ring is usually partial.
+ */
+func (g Geometry) rings(total Duration) []Ring {
+  rings := []Ring{}
+  radius := g.start_radius
+  angle := g.start_angle
+  for start:=0; start<int(total); {
+    delta := float64(g.sample_length() / radius)
+    n := int(2 * math.Pi / delta)
+    if start + n > int(total) {
+      n = int(total) - start
+    }
+    rings = append(rings, Ring{index: len(rings), radius: radius, angle: angle, start: start, samples: n})
+    start += n
+    angle = Angle(math.Mod(float64(angle) + float64(n) * delta, 2 * math.Pi))
+    radius += g.track_pitch
+  }
+  return rings
+}
+
+/**
+ * Radius and angle of a position along the spiral, in samples from the start
+ * of the rings, which may fall between two.
+ */
+func (g Geometry) position(rings []Ring, at float64) (Length, Angle) {
+  i := sort.Search(len(rings), func(i int) bool { return float64(rings[i].start) > at })
+  r := rings[max(i - 1, 0)]
+  return r.radius, r.angle + Angle((at - float64(r.start)) * float64(g.sample_length()) / float64(r.radius))
+}
+
+/**
+ * Duration of the spiral whose last revolution is the last one within the
+ * radius, i.e. how long a design must be for its outer edge to get there.
+ * 0 when the radius is inside the first revolution.
+ */
+func (g Geometry) duration_to(radius Length) Duration {
+  total := 0
+  for r:=g.start_radius; r<=radius; r+=g.track_pitch {
+    total += int(2 * math.Pi / float64(g.sample_length() / r))
+  }
+  return Duration(total)
+}
+
+/**
+ * Geometry of the rest of the spiral, past its first n samples.
+ */
+func (g Geometry) skip(n Duration) Geometry {
+  rings := g.rings(n)
+  if len(rings) > 0 {
+    last := rings[len(rings)-1]
+    delta := float64(g.sample_length() / last.radius)
+    g.start_radius = last.radius
+    g.start_angle = Angle(math.Mod(float64(last.angle) + float64(last.samples) * delta, 2 * math.Pi))
+    if last.samples == int(2 * math.Pi / delta) {
+      g.start_radius += g.track_pitch
+    }
+  }
+  g.samples -= n
+  return g
+}
+
+/**
+ * Radius of the last revolution.
+ */
+func (g Geometry) end_radius() Length {
+  rings := g.rings(g.samples)
+  if len(rings) == 0 {
+    return g.start_radius
+  }
+  return rings[len(rings)-1].radius
+}
+
+/**
+ * Radius from which the program area stays in sight, designs which are laid
+ * out rather than filled start there.
+ */
+func (g Geometry) visible_radius() Length {
+  r := g.start_radius
+  for _, z := range hub_zones {
+    r = max(r, z.outer)
+  }
+  return r
+}
+
+func (g Geometry) describe() string {
+  s := fmt.Sprintf("duration: %s (%d samples), program area: %s to %s",
+    g.samples, int(g.samples), g.start_radius, g.end_radius())
+  for _, z := range hub_zones {
+    if g.start_radius < z.outer {
+      s += fmt.Sprintf(", %s to %s hidden by the %s", max(g.start_radius, z.inner), z.outer, z.name)
+    }
+  }
+  return s
+}
+
+type Ring_description struct {
+  Revolution int `json:"revolution"`
+  Radius float64 `json:"radius"`
+  Angle float64 `json:"angle"`
+  Start int `json:"start"`
+  Samples int `json:"samples"`
+}
+
+/**
+ * The ring table, for tools which lay out designs themselves. Lengths are in
+ * mm, angles in radians, counterclockwise from the x axis, seen from the data
+ * side.
+ */
+type Geometry_description struct {
+  Sample_rate int `json:"sample_rate"`
+  Samples int `json:"samples"`
+  Start_radius float64 `json:"start_radius"`
+  Track_pitch float64 `json:"track_pitch"`
+  Linear_speed float64 `json:"linear_speed"`
+  Sample_length float64 `json:"sample_length"`
+  Rings []Ring_description `json:"rings"`
+}
+
+func export_geometry(filename string, g Geometry) error {
+  d := Geometry_description{
+    Sample_rate: Sample_rate,
+    Samples: int(g.samples),
+    Start_radius: float64(g.start_radius),
+    Track_pitch: float64(g.track_pitch),
+    Linear_speed: float64(g.linear_speed),
+    Sample_length: float64(g.sample_length()),
+    Rings: []Ring_description{},
+  }
+  for _, ring := range g.rings(g.samples) {
+    d.Rings = append(d.Rings, Ring_description{ring.index, float64(ring.radius), float64(ring.angle), ring.start, ring.samples})
+  }
+  data, err := json.MarshalIndent(d, "", "  ")
+  if err != nil {
+    return err
+  }
+  logger.infof("writing %d rings to %s", len(d.Rings), filename)
+  return write_output(filename, append(data, '\n'))
+}
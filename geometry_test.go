@@ -0,0 +1,326 @@
+package main
+
+import (
+  "bytes"
+  "math"
+  "math/rand"
+  "reflect"
+  "testing"
+  "testing/quick"
+)
+
+/**
+ * Property tests: the invariants below must hold for any geometry which
+ * passes validate(). A broken invariant means samples end up at the wrong
+ * place on the disc, which otherwise only shows once the disc is burned.
+ */
+var quick_config = &quick.Config{MaxCount: 200, Rand: rand.New(rand.NewSource(1))}
+
+/**
+ * Random geometry within the ranges accepted by validate(), lasting up to
+ * size seconds. Implements quick.Generator.
+ */
+func (Geometry) Generate(r *rand.Rand, size int) reflect.Value {
+  g := Geometry{
+    start_radius: Length(15 + r.Float64() * 30),
+    track_pitch: Length(0.001 + r.Float64() * 0.001),
+    linear_speed: Speed(1000 + r.Float64() * 500),
+    samples: Duration(1 + r.Intn(Sample_rate * (size + 1))),
+  }
+  return reflect.ValueOf(g)
+}
+
+func TestRingsCoverEverySample(t *testing.T) {
+  f := func(g Geometry) bool {
+    rings := g.rings(g.samples)
+    next := 0
+    for _, ring := range rings {
+      if ring.start != next || ring.samples <= 0 {
+        return false
+      }
+      next += ring.samples
+    }
+    return Duration(next) == g.samples
+  }
+  if err := quick.Check(f, quick_config); err != nil {
+    t.Error(err)
+  }
+}
+
+/**
+ * Skipping whole rings leaves the rest of the spiral where it was.
+ */
+func TestSkipContinuesTheSpiral(t *testing.T) {
+  f := func(g Geometry, k uint8) bool {
+    rings := g.rings(g.samples)
+    if len(rings) < 2 {
+      return true
+    }
+    n := int(k) % (len(rings) - 1) + 1
+    rest := g.skip(Duration(rings[n].start)).rings(g.samples - Duration(rings[n].start))
+    if len(rest) != len(rings) - n {
+      return false
+    }
+    for i, ring := range rest {
+      expected := rings[n + i]
+      if ring.samples != expected.samples || math.Abs(float64(ring.radius - expected.radius)) > 1e-9 || math.Abs(float64(ring.angle - expected.angle)) > 1e-9 {
+        return false
+      }
+    }
+    return true
+  }
+  if err := quick.Check(f, quick_config); err != nil {
+    t.Error(err)
+  }
+}
+
+/**
+ * A journal's sessions follow each other with room for the drive's lead-out
+ * and lead-in in between, never overlapping.
+ */
+func TestJournalSessionsDontOverlap(t *testing.T) {
+  f := func(g Geometry, n uint8) bool {
+    s := Journal_state{Next_radius: g.start_radius, Track_pitch: g.track_pitch, Linear_speed: g.linear_speed}
+    end := Length(0)
+    for i:=0; i<int(n) % 4 + 1; i++ {
+      session := s.next_session(g, g.samples)
+      if session.start_radius <= end {
+        return false
+      }
+      end = session.end_radius()
+      s.advance(session)
+    }
+    return s.Sessions == int(n) % 4 + 1
+  }
+  if err := quick.Check(f, quick_config); err != nil {
+    t.Error(err)
+  }
+}
+
+func TestRingsAreMonotonic(t *testing.T) {
+  f := func(g Geometry) bool {
+    rings := g.rings(g.samples)
+    for i, ring := range rings {
+      if ring.index != i || ring.angle < 0 || ring.angle >= 2 * math.Pi {
+        return false
+      }
+      if i > 0 && (ring.radius <= rings[i-1].radius || ring.start <= rings[i-1].start) {
+        return false
+      }
+    }
+    return true
+  }
+  if err := quick.Check(f, quick_config); err != nil {
+    t.Error(err)
+  }
+}
+
+func TestRingsAreFullRevolutions(t *testing.T) {
+  f := func(g Geometry) bool {
+    rings := g.rings(g.samples)
+    for i, ring := range rings {
+      // a ring can't hold more than one revolution, only the last one may
+      // hold less
+      capacity := int(2 * math.Pi * ring.radius / g.sample_length())
+      if ring.samples > capacity || (i < len(rings) - 1 && ring.samples != capacity) {
+        return false
+      }
+    }
+    return true
+  }
+  if err := quick.Check(f, quick_config); err != nil {
+    t.Error(err)
+  }
+}
+
+func TestDurationRoundTrip(t *testing.T) {
+  f := func(g Geometry) bool {
+    var d Duration
+    if err := d.Set(g.samples.String()); err != nil {
+      return false
+    }
+    return d == g.samples
+  }
+  if err := quick.Check(f, quick_config); err != nil {
+    t.Error(err)
+  }
+}
+
+/**
+ * A position at the start of a ring is the ring's, and moves along it by a
+ * sample length per sample.
+ */
+func TestPosition(t *testing.T) {
+  f := func(g Geometry) bool {
+    g.samples = g.samples % Duration(Sample_rate * 2) + 1
+    rings := g.rings(g.samples)
+    for _, ring := range rings {
+      r, a := g.position(rings, float64(ring.start))
+      _, next := g.position(rings, float64(ring.start) + 1)
+      if r != ring.radius || a != ring.angle || math.Abs(float64(next - a) * float64(ring.radius) - float64(g.sample_length())) > 1e-9 {
+        return false
+      }
+    }
+    return true
+  }
+  if err := quick.Check(f, quick_config); err != nil {
+    t.Error(err)
+  }
+  for a, degrees := range map[Angle]float64{math.Pi / 2: 0, 0: 90, -math.Pi / 2: 180, math.Pi: 270} {
+    if math.Abs(a.degrees() - degrees) > 1e-9 {
+      t.Errorf("%g radians: got %g degrees, expecting %g", float64(a), a.degrees(), degrees)
+    }
+  }
+}
+
+/**
+ * The duration to a radius is the longest whose spiral stays within it.
+ */
+func TestDurationTo(t *testing.T) {
+  g := default_geometry()
+  for _, radius := range []float64{25.1, 30, 42.5, 55} {
+    g.samples = g.duration_to(Length(radius))
+    if r := g.end_radius(); r > Length(radius) || r <= Length(radius) - g.track_pitch {
+      t.Errorf("%gmm: ends at %s", radius, r)
+    }
+    g.samples++
+    if r := g.end_radius(); r <= Length(radius) {
+      t.Errorf("%gmm: one more sample still ends at %s", radius, r)
+    }
+  }
+}
+
+/**
+ * With the default geometry, a 74 minute blank fits in the program area and
+ * an 80 minute one doesn't, as estimate -blank tells.
+ */
+func TestBlanks(t *testing.T) {
+  g := default_geometry()
+  for name, fits := range map[string]bool{"cd-r74": true, "cd-r80": false} {
+    b, err := find_blank(name)
+    if err != nil {
+      t.Fatal(err)
+    }
+    if b.capacity <= g.capacity() != fits {
+      t.Errorf("%s: %s, the program area holds %s", name, b.capacity, g.capacity())
+    }
+  }
+  if _, err := find_blank("cd-r100"); err == nil {
+    t.Errorf("expected an error for an unknown blank")
+  }
+}
+
+func TestSpiralWritesEverySampleOnce(t *testing.T) {
+  config := &quick.Config{MaxCount: 50, Rand: rand.New(rand.NewSource(1))}
+  f := func(g Geometry) bool {
+    g.samples = g.samples % Duration(Sample_rate * 2) + 1
+    buf := &bytes.Buffer{}
+    calls := 0
+    spiral(buf, g, func(radius float64, angle float64) byte {
+      calls++
+      return Dark
+    })
+    return calls == int(g.samples) * 4 && buf.Len() == int(g.samples) * 4
+  }
+  if err := quick.Check(f, config); err != nil {
+    t.Error(err)
+  }
+}
+
+func TestEngraveWritesEverySampleOnce(t *testing.T) {
+  config := &quick.Config{MaxCount: 50, Rand: rand.New(rand.NewSource(1))}
+  c := new_canvas(Disc_radius, 1)
+  f := func(g Geometry) bool {
+    g.samples = g.samples % Duration(Sample_rate * 2) + 1
+    buf := &bytes.Buffer{}
+    engrave(buf, c, g, false)
+    return buf.Len() == int(g.samples) * 4
+  }
+  if err := quick.Check(f, config); err != nil {
+    t.Error(err)
+  }
+}
+
+/**
+ * Every dither keeps a grey's tone: the share of dark bytes under it is
+ * about the grey.
+ */
+func TestDithersKeepTheTone(t *testing.T) {
+  g := default_geometry()
+  g.samples = Duration(20 * Sample_rate)
+  for _, d := range dithers {
+    c := new_canvas(Disc_radius, Canvas_resolution)
+    for i := range c.pixels {
+      c.pixels[i] = 0.3
+    }
+    c.halftone(d)
+    buf := &bytes.Buffer{}
+    engrave(buf, c, g, false)
+    if dark := float64(bytes.Count(buf.Bytes(), []byte{Dark})) / float64(buf.Len()); math.Abs(dark - 0.3) > 0.02 {
+      t.Errorf("%s: %.3f of the bytes are dark, expecting 0.3", d, dark)
+    }
+  }
+}
+
+func TestPatternsHaveTheRightLength(t *testing.T) {
+  config := &quick.Config{MaxCount: 20, Rand: rand.New(rand.NewSource(1))}
+  o := &Pattern_options{frequency: 440, sweep_to: 880, bands: 7}
+  f := func(g Geometry) bool {
+    g.samples = g.samples % Duration(Sample_rate * 2) + 1
+    for _, p := range []Pattern{Pitch, Sweep, Tones, Channels, Verify, Bands, Pie} {
+      buf := &bytes.Buffer{}
+      wav_header(buf, g.samples)
+      switch p {
+        case Pitch:
+          pitch(buf, int(g.samples), o.frequency)
+        case Sweep:
+          sweep(buf, int(g.samples), o.frequency, o.sweep_to, int(g.samples))
+        case Tones:
+          tones(buf, int(g.samples), []float64{o.frequency, o.sweep_to})
+        case Channels:
+          channels(buf, g, o.frequency)
+        case Verify:
+          verify_pattern(buf, int(g.samples))
+        case Bands:
+          bands(buf, g, o.bands, 0, Dither_blend)
+        case Pie:
+          pie(buf, g, 0.25)
+      }
+      if check_length(buf, g.samples) != nil {
+        return false
+      }
+    }
+    return true
+  }
+  if err := quick.Check(f, config); err != nil {
+    t.Error(err)
+  }
+}
+
+/**
+ * CIRC's delays shuffle bytes between frames, but every data symbol of a
+ * frame, once the pipeline is full, comes from exactly one byte.
+ */
+func TestTraceFillsEveryFrame(t *testing.T) {
+  slots := map[[2]int]int{}
+  for n:=0; n<300 * Frame_samples; n++ {
+    for b:=0; b<4; b++ {
+      x := trace(n, b)
+      if x.symbol < 0 || x.symbol >= 28 || (x.symbol >= 12 && x.symbol < 16) {
+        t.Fatalf("sample %d, byte %d: symbol %d is a parity's", n, b, x.symbol)
+      }
+      slot := [2]int{x.frame + x.delay, x.symbol}
+      if _, ok := slots[slot]; ok {
+        t.Fatalf("sample %d, byte %d lands on the same symbol as byte %d", n, b, slots[slot])
+      }
+      slots[slot] = n * 4 + b
+    }
+  }
+  for f:=120; f<300; f++ {
+    for s:=0; s<28; s++ {
+      if _, ok := slots[[2]int{f, s}]; !ok && (s < 12 || s >= 16) {
+        t.Errorf("F3 frame %d: nothing lands on symbol %d", f, s)
+      }
+    }
+  }
+}
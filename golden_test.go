@@ -0,0 +1,162 @@
+package main
+
+import (
+  "bytes"
+  "compress/gzip"
+  "flag"
+  "io"
+  "os"
+  "path/filepath"
+  "testing"
+)
+
+/**
+ * Generates every pattern with fixed options and compares the result with
+ * the files in testdata/golden. After an intended change, regenerate them
+ * with:
+ *
+ *   go test *.go -run Golden -update
+ *
+ * Durations are kept short so that the files stay small, the canvas based
+ * patterns shrink to fit in the program area anyway.
+ */
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+var golden_cases = []struct {
+  name string
+  pattern Pattern
+  args []string
+}{
+  {"pitch", Pitch, []string{"-duration", "1s"}},
+  {"sweep", Sweep, []string{"-duration", "1s", "-frequency", "20", "-sweep-to", "20000", "-sweep-duration", "0.5s"}},
+  {"channels", Channels, []string{"-duration", "1s"}},
+  {"tones", Tones, []string{"-duration", "1s", "-tones", "440,554.37,659.26"}},
+  {"bands", Bands, []string{"-duration", "1s", "-bands", "5"}},
+  {"bands-blend", Bands, []string{"-duration", "1s", "-bands", "5", "-blend", "1"}},
+  {"bands-zone-pair", Bands, []string{"-duration", "1s", "-bands", "5", "-zone-pair", "25.005mm-26mm:0x10/0xef"}},
+  {"pie", Pie, []string{"-duration", "5s"}},
+  {"pie-high-contrast", Pie, []string{"-duration", "5s", "-preset", "high-contrast"}},
+  {"pie-watermark-tile", Pie, []string{"-duration", "5s", "-watermark-image", "testdata/watermark/motif.png", "-watermark-size", "0.2mm", "-watermark-fit", "tile", "-watermark-at", "0,-25.05", "-watermark-opacity", "1"}},
+  {"pie-watermark-alpha", Pie, []string{"-duration", "5s", "-watermark-image", "testdata/watermark/logo.png", "-watermark-size", "0.1mm", "-watermark-at", "0,-25.05", "-watermark-opacity", "1"}},
+  {"pie-silent-intro", Pie, []string{"-duration", "10s", "-silent-intro", "4s"}},
+  {"text-stack", Text, []string{"-duration", "60s", "-text", "stack", "-text-height", "0.2", "-width", "0.05", "-stack", "testdata/stack/set.json", "-stack-index", "3"}},
+  {"world", World, []string{"-duration", "60s", "-width", "0.05", "-marker", "37.77,-122.42"}},
+  {"world-mercator", World, []string{"-duration", "60s", "-width", "0.05", "-projection", "mercator"}},
+  {"world-kaleidoscope", World, []string{"-duration", "60s", "-width", "0.05", "-kaleidoscope", "5", "-kaleidoscope-fold", "repeat"}},
+  {"spirograph", Spirograph, []string{"-duration", "60s", "-gears", "105,30,20", "-width", "0.05"}},
+  {"spirograph-jitter", Spirograph, []string{"-duration", "60s", "-gears", "105,30,20", "-width", "0.05", "-jitter"}},
+  {"text", Text, []string{"-duration", "60s", "-text", "{{name}}", "-var", "name=golden", "-text-height", "0.4", "-width", "0.1"}},
+  {"plot-gcode", Plot, []string{"-duration", "60s", "-drawing", "testdata/plot/flower.gcode", "-width", "0.05"}},
+  {"plot-hpgl", Plot, []string{"-duration", "60s", "-drawing", "testdata/plot/star.hpgl", "-width", "0.05"}},
+  {"plot-dxf", Plot, []string{"-duration", "60s", "-drawing", "testdata/plot/bracket.dxf", "-width", "0.05"}},
+  {"text-sector", Text, []string{"-duration", "60s", "-text", "golden paragraphs wrap inside their sector, with both sides lined up when justified", "-sector", "25.15mm-25.7mm:350-10", "-justify", "full", "-text-height", "0.15", "-width", "0.03"}},
+}
+
+/**
+ * Creates a pattern the way the generate command does, options are given as
+ * command line flags.
+ */
+func generate_test_pattern(t *testing.T, pattern Pattern, args []string) []byte {
+  t.Helper()
+  fs := flag.NewFlagSet(string(pattern), flag.ContinueOnError)
+  o, g, m := design_flags(fs)
+  if err := fs.Parse(args); err != nil {
+    t.Fatal(err)
+  }
+  m.reseed()
+  buf, _, err := generate_pattern(pattern, o, *g)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if err := check_length(buf, g.samples); err != nil {
+    t.Fatal(err)
+  }
+  stamp(buf, *m)
+  return buf.Bytes()
+}
+
+func read_golden(filename string) ([]byte, error) {
+  f, err := os.Open(filename)
+  if err != nil {
+    return nil, err
+  }
+  defer f.Close()
+  r, err := gzip.NewReader(f)
+  if err != nil {
+    return nil, err
+  }
+  return io.ReadAll(r)
+}
+
+func write_golden(filename string, data []byte) error {
+  buf := bytes.Buffer{}
+  w, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+  w.Write(data)
+  if err := w.Close(); err != nil {
+    return err
+  }
+  return os.WriteFile(filename, buf.Bytes(), 0644)
+}
+
+func TestGolden(t *testing.T) {
+  for _, c := range golden_cases {
+    t.Run(c.name, func(t *testing.T) {
+      data := generate_test_pattern(t, c.pattern, c.args)
+      filename := filepath.Join("testdata", "golden", c.name + ".wav.gz")
+      if *update {
+        if err := write_golden(filename, data); err != nil {
+          t.Fatal(err)
+        }
+        return
+      }
+
+      golden, err := read_golden(filename)
+      if err != nil {
+        t.Fatalf("%s (run with -update to create it)", err)
+      }
+      if len(data) != len(golden) {
+        t.Fatalf("got %d bytes, expecting %d", len(data), len(golden))
+      }
+      for i := range data {
+        if data[i] != golden[i] {
+          t.Fatalf("first difference at byte %d (sample %d): got 0x%02x, expecting 0x%02x",
+            i, (i - Wav_header_size) / 4, data[i], golden[i])
+        }
+      }
+    })
+  }
+}
+
+/**
+ * A recipe recreates the run it was exported from, files included.
+ */
+func TestRecipeRoundTrip(t *testing.T) {
+  args := []string{"-duration", "60s", "-drawing", "testdata/plot/star.hpgl", "-width", "0.05", "-seed", "7"}
+  fs := flag.NewFlagSet("", flag.ContinueOnError)
+  o, _, m := design_flags(fs)
+  if err := fs.Parse(args); err != nil {
+    t.Fatal(err)
+  }
+  r, err := export_recipe(fs, Plot, o, m.seed)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if len(r.Files) != 1 {
+    t.Fatalf("got %d files, expecting the drawing", len(r.Files))
+  }
+
+  imported := flag.NewFlagSet("", flag.ContinueOnError)
+  o2, g2, m2 := design_flags(imported)
+  if err := import_recipe(imported, r, t.TempDir()); err != nil {
+    t.Fatal(err)
+  }
+  m2.reseed()
+  buf, _, err := generate_pattern(r.Pattern, o2, *g2)
+  if err != nil {
+    t.Fatal(err)
+  }
+  stamp(buf, *m2)
+  if !bytes.Equal(buf.Bytes(), generate_test_pattern(t, Plot, args)) {
+    t.Errorf("the imported recipe generates something else")
+  }
+}
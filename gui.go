@@ -0,0 +1,391 @@
+package main
+
+import (
+  "bytes"
+  "crypto/rand"
+  "crypto/subtle"
+  "encoding/hex"
+  "flag"
+  "fmt"
+  "html/template"
+  "io"
+  "net"
+  "net/http"
+  "net/url"
+  "os"
+  "os/exec"
+  "path/filepath"
+  "runtime"
+  "strings"
+)
+
+/**
+ * A point and click front end, in the browser: pick a template or a pattern,
+ * fill in its variables, add an image, look at the preview and burn. It only
+ * listens on localhost and runs this program's own commands, the page holds
+ * nothing the command line can't do.
+ *
+ * An uploaded image becomes the logo variable of templates which have one,
+ * a watermark otherwise.
+ *
+ * Listening on localhost doesn't keep other web pages out: any page the
+ * browser shows may point an image or a form at the gui, and a name of
+ * theirs may resolve to 127.0.0.1. So requests must name the gui by its
+ * address or localhost, and those which preview, upload or burn must carry
+ * the token of the page the gui served. The options only take the design's
+ * flags, none which writes a file.
+ */
+type Gui struct {
+  dir string // uploaded images
+  backend string
+  port string
+  token string
+}
+
+type Gui_choice struct {
+  Value string
+  Label string
+}
+
+type Gui_page struct {
+  Designs []Gui_choice
+  Design string
+  Description string
+  Variables []Template_variable
+  Values map[string]string
+  Options string
+  Image string
+  Token string
+  Query template.URL
+}
+
+/**
+ * Checks the options given in the form: design flags only, e.g. no -o, and
+ * no argument which could be taken for the pattern.
+ */
+func gui_options(s string) ([]string, error) {
+  fs := flag.NewFlagSet("options", flag.ContinueOnError)
+  fs.SetOutput(io.Discard)
+  design_flags(fs)
+  args := strings.Fields(s)
+  if err := fs.Parse(args); err != nil {
+    return nil, fmt.Errorf("options: %s, only the design's options can be given", err)
+  }
+  if fs.NArg() > 0 {
+    return nil, fmt.Errorf("options: unexpected %q, only the design's options can be given", fs.Arg(0))
+  }
+  return args, nil
+}
+
+/**
+ * Refuses requests which don't name the gui by its address or localhost,
+ * e.g. after a DNS rebinding, and when token is set, those without the
+ * page's token.
+ */
+func (gui *Gui) check(w http.ResponseWriter, r *http.Request, token bool) bool {
+  host, port, err := net.SplitHostPort(r.Host)
+  if err != nil || port != gui.port || (host != "localhost" && net.ParseIP(host) == nil) {
+    http.Error(w, "unexpected host: " + r.Host, http.StatusForbidden)
+    return false
+  }
+  if token && subtle.ConstantTimeCompare([]byte(r.FormValue("token")), []byte(gui.token)) != 1 {
+    http.Error(w, "missing or invalid token, reload the page", http.StatusForbidden)
+    return false
+  }
+  return true
+}
+
+/**
+ * Turns the fields of the form into arguments for the preview and generate
+ * commands.
+ */
+func (gui *Gui) arguments(form url.Values) ([]string, error) {
+  kind, name, _ := strings.Cut(form.Get("design"), ":")
+  args := []string{}
+  uses_logo := false
+  if kind == "template" {
+    _, variables, err := describe_template(name)
+    if err != nil {
+      return nil, err
+    }
+    for _, v := range variables {
+      if v.Name == "logo" {
+        uses_logo = true
+        continue
+      }
+      if value := form.Get("var_" + v.Name); value != "" || v.Required {
+        args = append(args, "-var", v.Name + "=" + value)
+      }
+    }
+  }
+  if image := form.Get("image"); image != "" {
+    path := filepath.Join(gui.dir, filepath.Base(image))
+    if uses_logo {
+      args = append(args, "-var", "logo=" + path)
+      uses_logo = false
+    } else {
+      args = append(args, "-watermark-image", path, "-watermark-opacity", "1", "-watermark-size", "30mm")
+    }
+  }
+  if uses_logo {
+    return nil, fmt.Errorf("this template needs an image")
+  }
+  options, err := gui_options(form.Get("options"))
+  if err != nil {
+    return nil, err
+  }
+  args = append(args, options...)
+  switch kind {
+    case "template":
+      return append(args, "-project", name), nil
+    case "pattern":
+      return append(args, name), nil
+  }
+  return nil, fmt.Errorf("pick a design")
+}
+
+/**
+ * Runs a command of this program. Errors are the first line it printed, the
+ * rest is usually the usage.
+ */
+func run_self(out io.Writer, args ...string) error {
+  exe, err := os.Executable()
+  if err != nil {
+    return err
+  }
+  c := exec.Command(exe, args...)
+  c.Stdout = out
+  errors := bytes.Buffer{}
+  c.Stderr = &errors
+  if err := c.Run(); err != nil {
+    first, _, _ := strings.Cut(strings.TrimSpace(errors.String()), "\n")
+    return fmt.Errorf("%s", first)
+  }
+  return nil
+}
+
+func (gui *Gui) page(w http.ResponseWriter, r *http.Request) {
+  if err := r.ParseMultipartForm(Max_asset_size); err != nil && err != http.ErrNotMultipart {
+    http.Error(w, err.Error(), http.StatusBadRequest)
+    return
+  }
+  // the first visit is a GET, uploads come from the page
+  if !gui.check(w, r, r.Method != http.MethodGet) {
+    return
+  }
+  p := Gui_page{Design: r.Form.Get("design"), Options: r.Form.Get("options"), Image: r.Form.Get("image"), Token: gui.token, Values: map[string]string{}}
+  for _, name := range template_names() {
+    p.Designs = append(p.Designs, Gui_choice{"template:" + name, "template: " + name})
+  }
+  for _, pattern := range patterns {
+    p.Designs = append(p.Designs, Gui_choice{"pattern:" + string(pattern.name), "pattern: " + string(pattern.name)})
+  }
+  if p.Design == "" {
+    p.Design = p.Designs[0].Value
+  }
+  if kind, name, _ := strings.Cut(p.Design, ":"); kind == "template" {
+    p.Description, p.Variables, _ = describe_template(name)
+  }
+  for _, v := range p.Variables {
+    p.Values[v.Name] = v.Default
+    if value, ok := r.Form["var_" + v.Name]; ok {
+      p.Values[v.Name] = value[0]
+    }
+  }
+
+  if f, header, err := r.FormFile("upload"); err == nil {
+    defer f.Close()
+    upload, err := os.CreateTemp(gui.dir, "upload-*" + filepath.Ext(header.Filename))
+    if err == nil {
+      _, err = io.Copy(upload, io.LimitReader(f, Max_asset_size))
+      upload.Close()
+    }
+    if err != nil {
+      http.Error(w, err.Error(), http.StatusInternalServerError)
+      return
+    }
+    p.Image = filepath.Base(upload.Name())
+  }
+
+  query := url.Values{"design": {p.Design}, "options": {p.Options}, "image": {p.Image}, "token": {gui.token}}
+  for name, value := range p.Values {
+    query.Set("var_" + name, value)
+  }
+  p.Query = template.URL(query.Encode())
+  if err := gui_template.Execute(w, p); err != nil {
+    logger.errorf("%s", err)
+  }
+}
+
+func (gui *Gui) preview(w http.ResponseWriter, r *http.Request) {
+  if !gui.check(w, r, true) {
+    return
+  }
+  args, err := gui.arguments(r.URL.Query())
+  if err != nil {
+    http.Error(w, err.Error(), http.StatusBadRequest)
+    return
+  }
+  quality := "fast"
+  if r.URL.Query().Get("quality") == "full" {
+    quality = "full"
+  }
+  png := bytes.Buffer{}
+  if err := run_self(&png, append([]string{"preview", "-quiet", "-quality", quality, "-size", "600", "-o", "-"}, args...)...); err != nil {
+    http.Error(w, err.Error(), http.StatusBadRequest)
+    return
+  }
+  w.Header().Set("Content-Type", "image/png")
+  w.Write(png.Bytes())
+}
+
+/**
+ * Generates the wav file and burns it, reporting as it goes.
+ */
+func (gui *Gui) burn(w http.ResponseWriter, r *http.Request) {
+  if r.Method != http.MethodPost {
+    http.Error(w, "burning needs a POST", http.StatusMethodNotAllowed)
+    return
+  }
+  r.ParseForm()
+  if !gui.check(w, r, true) {
+    return
+  }
+  args, err := gui.arguments(r.PostForm)
+  if err != nil {
+    http.Error(w, err.Error(), http.StatusBadRequest)
+    return
+  }
+  w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+  say := func(format string, v ...interface{}) {
+    fmt.Fprintf(w, format + "\n", v...)
+    if f, ok := w.(http.Flusher); ok {
+      f.Flush()
+    }
+  }
+  wav := filepath.Join(gui.dir, "burn.wav")
+  say("generating %s", wav)
+  if err := run_self(io.Discard, append([]string{"generate", "-o", wav}, args...)...); err != nil {
+    say("failed: %s", err)
+    return
+  }
+  say("burning with %s, this takes a while", gui.backend)
+  if err := run_self(io.Discard, "burn", "-backend", gui.backend, wav); err != nil {
+    say("failed: %s", err)
+    return
+  }
+  say("done")
+}
+
+func open_browser(u string) {
+  opener := "xdg-open"
+  switch runtime.GOOS {
+    case "darwin":
+      opener = "open"
+    case "windows":
+      opener = "explorer"
+  }
+  if err := exec.Command(opener, u).Start(); err != nil {
+    logger.debugf("%s: %s", opener, err)
+  }
+}
+
+func gui_command(fs *flag.FlagSet) func() int {
+  listen := fs.String("listen", "127.0.0.1:0", "address to listen on, port 0 picks a free one")
+  backend := fs.String("backend", default_burner(), "program used to burn the disc")
+  browser := fs.Bool("browser", true, "opens the page in the browser")
+  fs.Usage = func() {
+    fmt.Fprintf(fs.Output(), "usage: %s gui [options]\n\nserves a page to design and burn discs from the browser.\n\noptions:\n", os.Args[0])
+    fs.PrintDefaults()
+  }
+  return func() int {
+    if fs.NArg() != 0 {
+      fs.Usage()
+      return Exit_usage
+    }
+    dir, err := os.MkdirTemp("", "micro-engraving-gui")
+    if err != nil {
+      logger.errorf("%s", err)
+      return Exit_failure
+    }
+    defer os.RemoveAll(dir)
+    token := make([]byte, 16)
+    if _, err := rand.Read(token); err != nil {
+      logger.errorf("%s", err)
+      return Exit_failure
+    }
+
+    l, err := net.Listen("tcp", *listen)
+    if err != nil {
+      logger.errorf("%s", err)
+      return Exit_failure
+    }
+    _, port, _ := net.SplitHostPort(l.Addr().String())
+    gui := &Gui{dir: dir, backend: *backend, port: port, token: hex.EncodeToString(token)}
+    u := "http://" + l.Addr().String() + "/"
+    logger.infof("serving on %s, ^C to stop", u)
+    if *browser {
+      open_browser(u)
+    }
+    mux := http.NewServeMux()
+    mux.HandleFunc("/", gui.page)
+    mux.HandleFunc("/preview.png", gui.preview)
+    mux.HandleFunc("/burn", gui.burn)
+    if err := http.Serve(l, mux); err != nil {
+      logger.errorf("%s", err)
+      return Exit_failure
+    }
+    return 0
+  }
+}
+
+var gui_template = template.Must(template.New("gui").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>micro-engraving</title>
+<style>
+  body { font-family: sans-serif; margin: 2em; display: flex; gap: 2em; }
+  form { min-width: 22em; }
+  label { display: block; margin: 0.8em 0 0.2em; }
+  input[type=text], select { width: 100%; }
+  img { background: #888; }
+  pre { white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<form method="post" enctype="multipart/form-data" action="/">
+  <h1>micro-engraving</h1>
+  <label>design</label>
+  <select name="design" onchange="this.form.submit()">
+    {{range .Designs}}<option value="{{.Value}}"{{if eq .Value $.Design}} selected{{end}}>{{.Label}}</option>{{end}}
+  </select>
+  {{if .Description}}<p>{{.Description}}</p>{{end}}
+  {{range .Variables}}{{if ne .Name "logo"}}
+  <label>{{.Name}}{{if .Required}} (required){{end}}</label>
+  <input type="text" name="var_{{.Name}}" value="{{index $.Values .Name}}">
+  {{end}}{{end}}
+  <label>image{{if .Image}} (uploaded){{end}}</label>
+  <input type="file" name="upload" accept="image/png,image/jpeg,image/gif">
+  <input type="hidden" name="image" value="{{.Image}}">
+  <input type="hidden" name="token" value="{{.Token}}">
+  <label>more options, e.g. -duration 60m -background noise</label>
+  <input type="text" name="options" value="{{.Options}}">
+  <p><button type="submit">preview</button></p>
+</form>
+<div>
+  <img src="/preview.png?{{.Query}}" width="600" height="600" alt="the preview failed, check the options">
+  <form method="post" action="/burn" target="log">
+    <input type="hidden" name="design" value="{{.Design}}">
+    {{range $name, $value := .Values}}<input type="hidden" name="var_{{$name}}" value="{{$value}}">{{end}}
+    <input type="hidden" name="image" value="{{.Image}}">
+    <input type="hidden" name="options" value="{{.Options}}">
+    <input type="hidden" name="token" value="{{.Token}}">
+    <p><a href="/preview.png?{{.Query}}&amp;quality=full" target="_blank">full quality preview</a>
+    <button type="submit">burn</button></p>
+  </form>
+  <iframe name="log" width="600" height="120" frameborder="0"></iframe>
+</div>
+</body>
+</html>
+`))
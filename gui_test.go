@@ -0,0 +1,47 @@
+package main
+
+import (
+  "net/http/httptest"
+  "testing"
+)
+
+/**
+ * The options only take design flags, and requests need the gui's host and
+ * the page's token, so that another web page can't write files through the
+ * gui.
+ */
+func TestGuiRefusesOtherPages(t *testing.T) {
+  for options, ok := range map[string]bool{
+    "-duration 1s -dye azo": false, // -dye is preview's
+    "-duration 1s -zone-pair 25mm-40mm:0x00/0xff": true,
+    "-duration 1s -o /tmp/x.png": false,
+    "-checksums x.json": false,
+    "-duration 1s pitch": false,
+  } {
+    if _, err := gui_options(options); (err == nil) != ok {
+      t.Errorf("%q: got %v", options, err)
+    }
+  }
+
+  gui := &Gui{port: "8000", token: "secret"}
+  for _, c := range []struct {
+    host string
+    target string
+    token bool
+    ok bool
+  }{
+    {"127.0.0.1:8000", "/preview.png?token=secret", true, true},
+    {"localhost:8000", "/preview.png?token=secret", true, true},
+    {"[::1]:8000", "/", false, true},
+    {"127.0.0.1:8000", "/preview.png", true, false},
+    {"127.0.0.1:8000", "/preview.png?token=guess", true, false},
+    {"rebound.example:8000", "/preview.png?token=secret", true, false},
+    {"127.0.0.1:9000", "/", false, false},
+  } {
+    r := httptest.NewRequest("GET", c.target, nil)
+    r.Host = c.host
+    if ok := gui.check(httptest.NewRecorder(), r, c.token); ok != c.ok {
+      t.Errorf("%s%s: got %v, expecting %v", c.host, c.target, ok, c.ok)
+    }
+  }
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+  "bytes"
+  "fmt"
+  "path/filepath"
+  "strings"
+)
+
+/**
+ * Regenerating a design after a small change, e.g. one text label, rewrites
+ * the whole disc. With -changed-since, generate writes only the sectors
+ * which differ from the previous output instead, from the first changed
+ * sector to the last one, and a cue sheet telling where they go.
+ *
+ * Whether the span can be burned on its own depends on where it lies. Past
+ * the end of the previous output, it is the next session of a disc left
+ * open with burn -multi, although the lead-out and lead-in in between push
+ * it outwards. Over what is already burned, a CD-R can't take it and audio
+ * can't be written to a CD-RW sector by sector: the disc needs a full
+ * rewrite, or tools which patch images at a given address.
+ */
+type Changed_span struct {
+  start int // first changed sector
+  end int   // past the last changed sector
+}
+
+/**
+ * Compares the samples of two outputs, sector by sector. A longer output
+ * changes the sectors past the end of the shorter one. ok is false when
+ * nothing changed.
+ */
+func changed_span(old []byte, data []byte) (Changed_span, bool) {
+  sector := Sector_samples * 4
+  n := (max(len(old), len(data)) + sector - 1) / sector
+  span := Changed_span{-1, -1}
+  for i:=0; i<n; i++ {
+    a := old[min(i * sector, len(old)):min((i + 1) * sector, len(old))]
+    b := data[min(i * sector, len(data)):min((i + 1) * sector, len(data))]
+    if !bytes.Equal(a, b) {
+      if span.start < 0 {
+        span.start = i
+      }
+      span.end = i + 1
+    }
+  }
+  return span, span.start >= 0
+}
+
+func span_cue(filename string, span Changed_span, m Metadata) string {
+  cue := strings.Builder{}
+  fmt.Fprintf(&cue, "REM COMMENT \"micro-engraving %s, seed=%d\"\n", version, m.seed)
+  fmt.Fprintf(&cue, "REM COMMENT \"sectors %d to %d of the design, from %s\"\n", span.start, span.end, format_msf(span.start))
+  fmt.Fprintf(&cue, "FILE %q WAVE\n", filepath.Base(filename))
+  fmt.Fprintf(&cue, "  TRACK 01 AUDIO\n    INDEX 01 %s\n", format_msf(0))
+  return cue.String()
+}
+
+/**
+ * Replaces buf, a whole output, with the sectors which changed since the
+ * previous output. g is the geometry of the whole output. Fails when nothing
+ * changed.
+ */
+func keep_changes(buf *bytes.Buffer, previous string, g Geometry) (Changed_span, error) {
+  old, err := read_wav(previous)
+  if err != nil {
+    return Changed_span{}, err
+  }
+  data := buf.Bytes()[Wav_header_size:Wav_header_size + int(g.samples) * 4]
+  span, ok := changed_span(old, data)
+  if !ok {
+    return span, fmt.Errorf("nothing changed since %s", previous)
+  }
+  if span.start * Sector_samples >= int(g.samples) {
+    return span, fmt.Errorf("the design got shorter since %s, which has to be burned again in full", previous)
+  }
+
+  from, to := span.start * Sector_samples, min(span.end * Sector_samples, int(g.samples))
+  rings := g.rings(Duration(to))
+  radius := g.skip(Duration(from)).start_radius
+  logger.infof("sectors %d to %d changed (%s to %s), %s to %s, %.1f%% of the disc",
+    span.start, span.end, format_msf(span.start), format_msf(span.end),
+    radius, rings[len(rings)-1].radius, float64(to - from) * 100 / float64(g.samples))
+  if from < len(old) / 4 {
+    logger.warnf("the change starts inside %s: a CD-R can't take it, and a CD-RW needs a full rewrite", previous)
+  } else {
+    // the previous output as the first session, then its lead-out and the
+    // next session's lead-in
+    first := g
+    first.samples = Duration(len(old) / 4)
+    s := Journal_state{}
+    s.advance(first)
+    logger.warnf("burned as the next session, the span starts at %s rather than %s", Length(s.Next_radius), radius)
+  }
+
+  changed := bytes.Buffer{}
+  wav_header(&changed, Duration(to - from))
+  changed.Write(data[from * 4:to * 4])
+  *buf = changed
+  return span, nil
+}
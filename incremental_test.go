@@ -0,0 +1,24 @@
+package main
+
+import (
+  "testing"
+)
+
+func TestChangedSpan(t *testing.T) {
+  sector := Sector_samples * 4
+  old := make([]byte, 10 * sector)
+  data := append([]byte{}, old...)
+  if _, ok := changed_span(old, data); ok {
+    t.Errorf("identical outputs changed")
+  }
+  data[3 * sector + 1] = 1
+  data[5 * sector] = 1
+  if span, _ := changed_span(old, data); span != (Changed_span{3, 6}) {
+    t.Errorf("got sectors %d to %d, expecting 3 to 6", span.start, span.end)
+  }
+  // a longer output changes everything past the end of the previous one
+  data = append(append([]byte{}, old...), make([]byte, sector / 2)...)
+  if span, _ := changed_span(old, data); span != (Changed_span{10, 11}) {
+    t.Errorf("got sectors %d to %d, expecting 10 to 11", span.start, span.end)
+  }
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+  "fmt"
+  "path/filepath"
+  "strings"
+)
+
+/**
+ * A disc which plays a message and shows a picture: the intro, an audio file,
+ * goes first as track 1, the design fills the rest of the disc as track 2.
+ * The intro is padded with silence to a whole number of sectors, so that
+ * track 2 starts exactly on a sector, and to the Red Book's shortest track.
+ *
+ * A silent intro is the safe choice for any disc which may end up in a
+ * player: the design, played as sound, is noise at full scale. Track 1 is
+ * digital silence, and track 2 gets the standard 2 second pregap, silent
+ * too, before the design. A player which starts the disc on its own
+ * starts quiet, and shows two tracks, which warns whoever skips to the
+ * second one. Nothing stops a player from going on into it though.
+ */
+const Pregap_samples = 2 * Sample_rate
+
+func read_intro(filename string) ([]byte, error) {
+  audio, err := read_audio(filename)
+  if err != nil {
+    return nil, err
+  }
+  samples := max(len(audio) / 4, Min_track_samples)
+  samples = (samples + Sector_samples - 1) / Sector_samples * Sector_samples
+  padded := make([]byte, samples * 4)
+  copy(padded, audio)
+  return padded, nil
+}
+
+/**
+ * What compose wrote before the design: the length of the intro, in samples,
+ * and how many of them are the pregap of the design's track.
+ */
+type Intro struct {
+  samples int
+  pregap int
+}
+
+/**
+ * The samples which go before the design, none without an intro, and how
+ * many of them are the pregap of the design's track.
+ */
+func intro_samples(o *Pattern_options) ([]byte, int, error) {
+  switch {
+    case o.intro != "" && o.silent_intro > 0:
+      return nil, 0, fmt.Errorf("-intro and -silent-intro both go before the design, use one of them")
+    case o.intro != "":
+      audio, err := read_intro(o.intro)
+      return audio, 0, err
+    case o.silent_intro > 0:
+      samples := max(int(o.silent_intro), Min_track_samples)
+      samples = (samples + Sector_samples - 1) / Sector_samples * Sector_samples
+      return make([]byte, (samples + Pregap_samples) * 4), Pregap_samples, nil
+  }
+  return nil, 0, nil
+}
+
+/**
+ * A cue sheet for a wav file which starts with an intro of the given number
+ * of samples, the last pregap of which are the pregap of track 2.
+ */
+func intro_cue(filename string, intro int, pregap int, m Metadata) string {
+  title := "intro"
+  if pregap > 0 {
+    title = "silence"
+  }
+  cue := strings.Builder{}
+  fmt.Fprintf(&cue, "REM COMMENT \"micro-engraving %s, seed=%d\"\n", version, m.seed)
+  fmt.Fprintf(&cue, "FILE %q WAVE\n", filepath.Base(filename))
+  fmt.Fprintf(&cue, "  TRACK 01 AUDIO\n    TITLE %q\n    INDEX 01 %s\n", title, format_msf(0))
+  fmt.Fprintf(&cue, "  TRACK 02 AUDIO\n    TITLE \"artwork\"\n")
+  if pregap > 0 {
+    fmt.Fprintf(&cue, "    INDEX 00 %s\n", format_msf((intro - pregap) / Sector_samples))
+  }
+  fmt.Fprintf(&cue, "    INDEX 01 %s\n", format_msf(intro / Sector_samples))
+  return cue.String()
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+  "bytes"
+  "encoding/json"
+  "errors"
+  "flag"
+  "fmt"
+  "math"
+  "os"
+  "time"
+)
+
+/**
+ * A disc which grows one ring at a time, e.g. one per day: each run of the
+ * journal command creates the next session, to be burned without closing
+ * the disc (burn -multi). A ring holds the date along its inner part and,
+ * outside of it, a strip whose tone tells a metric, from light for -min to
+ * dark for -max.
+ *
+ * Which part of the disc a session lands on depends on the sessions before
+ * it, so the state of the disc lives in a file next to the wav files. The
+ * first session starts at -start-radius, the next ones past the lead-out of
+ * the previous session and their own lead-in, which the drive writes.
+ */
+const (
+  First_lead_out_sectors int = 6750 // 1:30 after the first session
+  Lead_out_sectors int = 2250       // 0:30 after the next ones
+  Session_lead_in_sectors int = 4500 // 1:00 before every session but the first
+)
+
+type Journal_entry struct {
+  Session int
+  Date string
+  Value float64
+  Inner Length
+  Outer Length
+  File string
+}
+
+type Journal_state struct {
+  Sessions int
+  Next_radius Length // where the next session's program area starts
+  Next_angle Angle
+  Track_pitch Length
+  Linear_speed Speed
+  Entries []Journal_entry
+}
+
+/**
+ * The state as stored, radii in mm and angles in radians. Lengths in other
+ * json files are strings with their unit, which would round where the next
+ * session starts.
+ */
+type Journal_file struct {
+  Sessions int `json:"sessions"`
+  Next_radius float64 `json:"next_radius"`
+  Next_angle float64 `json:"next_angle"`
+  Track_pitch float64 `json:"track_pitch"`
+  Linear_speed float64 `json:"linear_speed"` // in mm/s
+  Entries []Journal_file_entry `json:"entries"`
+}
+
+type Journal_file_entry struct {
+  Session int `json:"session"`
+  Date string `json:"date"`
+  Value float64 `json:"value"`
+  Inner float64 `json:"inner"`
+  Outer float64 `json:"outer"`
+  File string `json:"file"`
+}
+
+/**
+ * Reads the state of the disc, a blank disc when the file doesn't exist.
+ */
+func read_journal(filename string, g Geometry) (Journal_state, error) {
+  s := Journal_state{Next_radius: g.start_radius, Track_pitch: g.track_pitch, Linear_speed: g.linear_speed, Entries: []Journal_entry{}}
+  data, err := os.ReadFile(filename)
+  if errors.Is(err, os.ErrNotExist) {
+    return s, nil
+  }
+  if err != nil {
+    return s, err
+  }
+  f := Journal_file{Next_radius: float64(s.Next_radius), Track_pitch: float64(s.Track_pitch), Linear_speed: float64(s.Linear_speed)}
+  if err := json.Unmarshal(data, &f); err != nil {
+    return s, fmt.Errorf("%s: %s", filename, err)
+  }
+  s.Sessions, s.Next_radius, s.Next_angle = f.Sessions, Length(f.Next_radius), Angle(f.Next_angle)
+  s.Track_pitch, s.Linear_speed = Length(f.Track_pitch), Speed(f.Linear_speed)
+  for _, e := range f.Entries {
+    s.Entries = append(s.Entries, Journal_entry{e.Session, e.Date, e.Value, Length(e.Inner), Length(e.Outer), e.File})
+  }
+  return s, nil
+}
+
+func write_journal(filename string, s Journal_state) error {
+  f := Journal_file{s.Sessions, float64(s.Next_radius), float64(s.Next_angle), float64(s.Track_pitch), float64(s.Linear_speed), []Journal_file_entry{}}
+  for _, e := range s.Entries {
+    f.Entries = append(f.Entries, Journal_file_entry{e.Session, e.Date, e.Value, float64(e.Inner), float64(e.Outer), e.File})
+  }
+  data, err := json.MarshalIndent(f, "", "  ")
+  if err != nil {
+    return err
+  }
+  return write_output(filename, append(data, '\n'))
+}
+
+/**
+ * Geometry of the next session, samples long.
+ */
+func (s Journal_state) next_session(g Geometry, samples Duration) Geometry {
+  g.start_radius, g.start_angle = s.Next_radius, s.Next_angle
+  g.track_pitch, g.linear_speed = s.Track_pitch, s.Linear_speed
+  g.samples = samples
+  return g
+}
+
+/**
+ * Moves past the session which was just created: its program area, its
+ * lead-out and the next session's lead-in.
+ */
+func (s *Journal_state) advance(g Geometry) {
+  gap := Lead_out_sectors
+  if s.Sessions == 0 {
+    gap = First_lead_out_sectors
+  }
+  g.samples += Duration((gap + Session_lead_in_sectors) * Sector_samples)
+  next := g.skip(g.samples)
+  s.Sessions++
+  s.Next_radius, s.Next_angle = next.start_radius, next.start_angle
+}
+
+/**
+ * Draws a session's ring: the date along its inner half, centered at the top
+ * when the session starts where expected, then the strip holding the metric,
+ * between 0 and 1, halftoned with d.
+ */
+func journal_ring(c *Canvas, g Geometry, date string, level float64, d Dither) error {
+  inner, outer := float64(g.start_radius), float64(g.end_radius())
+  band := outer - inner
+  height := band * 0.4
+  width := height / Glyph_height
+  scale := height / Glyph_height
+  baseline := inner + band * 0.1
+  runes := []rune(date)
+  length := line_length(len(runes), scale)
+  if length / baseline > 2 * math.Pi {
+    return fmt.Errorf("date %q is too long to fit on a single turn", date)
+  }
+  offsets := make([]float64, len(runes))
+  for i := range runes {
+    offsets[i] = Glyph_advance * float64(i) * scale
+  }
+  draw_line(c, runes, offsets, baseline, math.Pi / 2 + length / 2 / baseline, scale, width)
+
+  from := inner + band * 0.6
+  for j:=0; j<c.size; j++ {
+    for i:=0; i<c.size; i++ {
+      x := float64(i) * c.resolution - c.radius
+      y := c.radius - float64(j) * c.resolution
+      if r := math.Hypot(x, y); r >= from && r <= outer {
+        c.pixels[j * c.size + i] = float32(level)
+      }
+    }
+  }
+  c.halftone(d)
+  return nil
+}
+
+func journal_command(fs *flag.FlagSet) func() int {
+  g := geometry_flags(fs)
+  g.samples = Duration(3 * 60 * Sample_rate)
+  fs.Lookup("duration").DefValue = g.samples.String()
+  m := seed_flag(fs)
+  state := fs.String("state", "journal.json", "file holding the state of the disc, created by the first session")
+  date := fs.String("date", time.Now().Format("2006-01-02"), "text written along the ring")
+  value := fs.Float64("value", 0, "metric the strip's tone tells")
+  min := fs.Float64("min", 0, "value for a light strip")
+  max := fs.Float64("max", 1, "value for a dark strip")
+  dither := fs.String("dither", string(Bayer_dither), "how the strip's tone becomes dark and light bytes: bayer or floyd-steinberg, on a grid, or spiral, diffusing the error along the track")
+  output := fs.String("o", "-", "output file, - for stdout")
+  fs.Usage = func() {
+    fmt.Fprintf(fs.Output(), "usage: %s journal [options]\n\n", os.Args[0])
+    fmt.Fprintf(fs.Output(), "creates the next session of a disc which gets one ring per session, e.g.\n")
+    fmt.Fprintf(fs.Output(), "one per day. Burn each one with 'burn -multi', which leaves the disc open.\n")
+    fmt.Fprintf(fs.Output(), "The geometry of the disc is the one of its first session, -duration is the\n")
+    fmt.Fprintf(fs.Output(), "length of each session.\n\noptions:\n")
+    fs.PrintDefaults()
+  }
+  return func() int {
+    if fs.NArg() != 0 {
+      fs.Usage()
+      return Exit_usage
+    }
+    if *max == *min {
+      logger.errorf("-min and -max are the same, expecting a range of values")
+      return Exit_usage
+    }
+    d, err := parse_dither(*dither)
+    if err != nil {
+      logger.errorf("%s", err)
+      return Exit_usage
+    }
+    s, err := read_journal(*state, *g)
+    if err != nil {
+      logger.errorf("%s", err)
+      return Exit_failure
+    }
+    if s.Sessions > 0 {
+      fs.Visit(func(f *flag.Flag) {
+        if f.Name == "start-radius" || f.Name == "track-pitch" || f.Name == "linear-speed" {
+          logger.warnf("-%s is ignored, the disc's geometry comes from %s", f.Name, *state)
+        }
+      })
+    }
+    session := s.next_session(*g, g.samples)
+    if err := session.validate(); err != nil {
+      logger.errorf("session %d: %s", s.Sessions + 1, err)
+      return Exit_failure
+    }
+
+    level := (*value - *min) / (*max - *min)
+    if level < 0 || level > 1 {
+      logger.warnf("value %g is out of range (%g to %g), the strip gets the closest tone", *value, *min, *max)
+      level = math.Max(0, math.Min(1, level))
+    }
+    logger.infof("session %d: %s, %s to %s", s.Sessions + 1, *date, session.start_radius, session.end_radius())
+    c := new_canvas(Disc_radius, Canvas_resolution)
+    if err := journal_ring(c, session, *date, level, d); err != nil {
+      logger.errorf("%s", err)
+      return Exit_failure
+    }
+    m.reseed()
+    buf := &bytes.Buffer{}
+    wav_header(buf, session.samples)
+    engrave(buf, c, session, false)
+    if err := check_length(buf, session.samples); err != nil {
+      logger.errorf("%s", err)
+      return Exit_failure
+    }
+    stamp(buf, *m)
+    if err := write_output(*output, buf.Bytes()); err != nil {
+      logger.errorf("%s", err)
+      return Exit_failure
+    }
+
+    // only once the session exists, a failed run mustn't leave a gap
+    s.Entries = append(s.Entries, Journal_entry{s.Sessions + 1, *date, *value, session.start_radius, session.end_radius(), *output})
+    s.advance(session)
+    if err := write_journal(*state, s); err != nil {
+      logger.errorf("%s", err)
+      return Exit_failure
+    }
+    logger.infof("next session at %s", s.Next_radius)
+    return 0
+  }
+}
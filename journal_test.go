@@ -0,0 +1,34 @@
+package main
+
+import (
+  "path/filepath"
+  "reflect"
+  "testing"
+)
+
+/**
+ * The state reads back as written, to the last bit of where the next
+ * session starts.
+ */
+func TestJournalRoundTrip(t *testing.T) {
+  filename := filepath.Join(t.TempDir(), "journal.json")
+  g := default_geometry()
+  s, err := read_journal(filename, g)
+  if err != nil {
+    t.Fatal(err)
+  }
+  g.samples = Duration(3 * 60 * Sample_rate)
+  session := s.next_session(g, g.samples)
+  s.Entries = append(s.Entries, Journal_entry{1, "2026-10-16", 0.5, session.start_radius, session.end_radius(), "1.wav"})
+  s.advance(session)
+  if err := write_journal(filename, s); err != nil {
+    t.Fatal(err)
+  }
+  again, err := read_journal(filename, default_geometry())
+  if err != nil {
+    t.Fatal(err)
+  }
+  if !reflect.DeepEqual(again, s) {
+    t.Errorf("read back %+v, expecting %+v", again, s)
+  }
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+  "encoding/json"
+  "fmt"
+  "strings"
+)
+
+/**
+ * A parsed JSON value which remembers where it came from, so that errors can
+ * point at the offending line. encoding/json throws positions away.
+ */
+type Node struct {
+  kind string // object, array, string, number, bool or null
+  offset int  // position of the first byte of the value
+  raw string  // literal value, for strings, numbers and bools
+  keys []string
+  key_offsets []int
+  values map[string]*Node
+  items []*Node
+}
+
+/**
+ * Position of a byte in the document, for error messages.
+ */
+type Position struct {
+  filename string
+  data []byte
+}
+
+func (p Position) at(offset int) string {
+  line, col := 1, 1
+  for i:=0; i<offset && i<len(p.data); i++ {
+    if p.data[i] == '\n' {
+      line++
+      col = 1
+    } else {
+      col++
+    }
+  }
+  return fmt.Sprintf("%s:%d:%d", p.filename, line, col)
+}
+
+func (p Position) errorf(offset int, format string, v ...interface{}) error {
+  return fmt.Errorf("%s: %s", p.at(offset), fmt.Sprintf(format, v...))
+}
+
+type json_parser struct {
+  pos Position
+  i int
+}
+
+func parse_json(pos Position) (*Node, error) {
+  p := &json_parser{pos: pos}
+  n, err := p.value()
+  if err != nil {
+    return nil, err
+  }
+  p.skip()
+  if p.i < len(p.pos.data) {
+    return nil, p.pos.errorf(p.i, "unexpected data after the end of the document")
+  }
+  return n, nil
+}
+
+func (p *json_parser) skip() {
+  for p.i < len(p.pos.data) && strings.IndexByte(" \t\r\n", p.pos.data[p.i]) >= 0 {
+    p.i++
+  }
+}
+
+func (p *json_parser) expect(c byte) error {
+  p.skip()
+  if p.i >= len(p.pos.data) {
+    return p.pos.errorf(p.i, "unexpected end of file, expecting '%c'", c)
+  }
+  if p.pos.data[p.i] != c {
+    return p.pos.errorf(p.i, "unexpected '%c', expecting '%c'", p.pos.data[p.i], c)
+  }
+  p.i++
+  return nil
+}
+
+func (p *json_parser) value() (*Node, error) {
+  p.skip()
+  if p.i >= len(p.pos.data) {
+    return nil, p.pos.errorf(p.i, "unexpected end of file")
+  }
+  n := &Node{offset: p.i}
+  switch c := p.pos.data[p.i]; {
+    case c == '{':
+      p.i++
+      n.kind = "object"
+      n.values = map[string]*Node{}
+      p.skip()
+      if p.i < len(p.pos.data) && p.pos.data[p.i] == '}' {
+        p.i++
+        return n, nil
+      }
+      for {
+        p.skip()
+        key_offset := p.i
+        if p.i >= len(p.pos.data) || p.pos.data[p.i] != '"' {
+          return nil, p.pos.errorf(p.i, "expecting a key")
+        }
+        key, err := p.value()
+        if err != nil {
+          return nil, err
+        }
+        if _, ok := n.values[key.raw]; ok {
+          return nil, p.pos.errorf(key_offset, "duplicate key %q", key.raw)
+        }
+        if err := p.expect(':'); err != nil {
+          return nil, err
+        }
+        v, err := p.value()
+        if err != nil {
+          return nil, err
+        }
+        n.keys = append(n.keys, key.raw)
+        n.key_offsets = append(n.key_offsets, key_offset)
+        n.values[key.raw] = v
+        p.skip()
+        if p.i < len(p.pos.data) && p.pos.data[p.i] == ',' {
+          p.i++
+          continue
+        }
+        return n, p.expect('}')
+      }
+    case c == '[':
+      p.i++
+      n.kind = "array"
+      p.skip()
+      if p.i < len(p.pos.data) && p.pos.data[p.i] == ']' {
+        p.i++
+        return n, nil
+      }
+      for {
+        v, err := p.value()
+        if err != nil {
+          return nil, err
+        }
+        n.items = append(n.items, v)
+        p.skip()
+        if p.i < len(p.pos.data) && p.pos.data[p.i] == ',' {
+          p.i++
+          continue
+        }
+        return n, p.expect(']')
+      }
+    case c == '"':
+      end := p.i + 1
+      for end < len(p.pos.data) && p.pos.data[end] != '"' {
+        if p.pos.data[end] == '\\' {
+          end++
+        }
+        end++
+      }
+      if end >= len(p.pos.data) {
+        return nil, p.pos.errorf(p.i, "unterminated string")
+      }
+      n.kind = "string"
+      if err := json.Unmarshal(p.pos.data[p.i:end+1], &n.raw); err != nil {
+        return nil, p.pos.errorf(p.i, "invalid string")
+      }
+      p.i = end + 1
+      return n, nil
+    default:
+      end := p.i
+      for end < len(p.pos.data) && strings.IndexByte(" \t\r\n,]}", p.pos.data[end]) < 0 {
+        end++
+      }
+      n.raw = string(p.pos.data[p.i:end])
+      switch {
+        case n.raw == "true" || n.raw == "false":
+          n.kind = "bool"
+        case n.raw == "null":
+          n.kind = "null"
+        case json.Valid([]byte(n.raw)):
+          n.kind = "number"
+        default:
+          return nil, p.pos.errorf(p.i, "invalid value %q", n.raw)
+      }
+      p.i = end
+      return n, nil
+  }
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+  "bytes"
+  "fmt"
+  "math"
+)
+
+/**
+ * Repeats the wedge of a design which starts at the top, clockwise from it,
+ * n times around the disc: one wedge in n, mirrored every other time (mirror)
+ * or turned (repeat). A symmetric design hides where the spiral starts, which
+ * varies from one burner to the next, and small angular errors, the seams
+ * land on copies of the same edge.
+ */
+type Fold string
+const (
+  Mirror_fold Fold = "mirror"
+  Repeat_fold Fold = "repeat"
+)
+
+/**
+ * Replaces every byte of the samples with the one at the same radius in the
+ * first wedge. Bytes whose source falls outside their revolution, in a
+ * partial one, are left.
+ */
+func fold(samples []byte, g Geometry, n int, f Fold) {
+  source := append([]byte{}, samples...)
+  wedge := 2 * math.Pi / float64(n)
+  for _, ring := range g.rings(Duration(len(samples) / 4)) {
+    angle := float64(ring.angle)
+    delta := float64(g.sample_length()) / 4 / float64(ring.radius)
+    for j:=0; j<ring.samples * 4; j++ {
+      // clockwise from the top
+      a := math.Mod(2.5 * math.Pi - angle - float64(j) * delta, 2 * math.Pi)
+      if a < 0 {
+        a += 2 * math.Pi
+      }
+      k := math.Min(math.Floor(a / wedge), float64(n - 1))
+      a -= k * wedge
+      if f == Mirror_fold && int(k) % 2 == 1 {
+        a = wedge - a
+      }
+      from := math.Mod(2.5 * math.Pi - a - angle, 2 * math.Pi)
+      if from < 0 {
+        from += 2 * math.Pi
+      }
+      if s := int(math.Round(from / delta)); s < ring.samples * 4 {
+        samples[ring.start * 4 + j] = source[ring.start * 4 + s]
+      }
+    }
+  }
+}
+
+/**
+ * Folds the design, past the intro if any, n times. 0 leaves it as is.
+ */
+func kaleidoscope(buf *bytes.Buffer, pattern Pattern, n int, f string, g Geometry, disc Geometry) error {
+  if n == 0 {
+    return nil
+  }
+  switch pattern {
+    case Pitch, Sweep, Tones, Channels, Verify:
+      return fmt.Errorf("-kaleidoscope is for designs, %s is a sound", pattern)
+  }
+  if n < 2 {
+    return fmt.Errorf("invalid kaleidoscope: %d, expecting at least 2 wedges", n)
+  }
+  switch Fold(f) {
+    case Mirror_fold, Repeat_fold:
+    default:
+      return fmt.Errorf("unknown fold: %s, expecting %s or %s", f, Mirror_fold, Repeat_fold)
+  }
+  if Fold(f) == Mirror_fold && n % 2 == 1 {
+    // the last wedge would meet the first one unflipped
+    return fmt.Errorf("invalid kaleidoscope: %d, mirrored wedges go in pairs, expecting an even number", n)
+  }
+  logger.infof("kaleidoscope: %d wedges of %.4g degrees, %s", n, 360 / float64(n), f)
+  offset := Wav_header_size + int(disc.samples - g.samples) * 4
+  fold(buf.Bytes()[offset:offset + int(g.samples) * 4], g, n, Fold(f))
+  return nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+  "flag"
+  "image"
+  "math"
+)
+
+/**
+ * LightScribe drives burn the label side in polar coordinates: the sled
+ * steps outward one track at a time while the disc spins, and the drive
+ * marks spokes at fixed angles. The label area goes from the hub's
+ * LightScribe ring to the edge of the disc.
+ *
+ * The figures below are approximations, LightScribe never published its
+ * own. Both can be changed with options.
+ */
+const (
+  Label_inner_radius float64 = 23.5 // in mm
+  Label_outer_radius float64 = 58.5
+  Label_radial_step float64 = 0.02 // in mm
+  Label_spokes int = 4000
+  Label_dpi int = 600
+)
+
+type Label_options struct {
+  radial_step float64
+  spokes int
+  dpi int
+}
+
+/**
+ * Turns a rendering of the data side into the label which goes on the other
+ * side of the disc. Looking at the label, the data side is seen through the
+ * disc: left and right swap. Each pixel takes the value of the nearest track
+ * and spoke the drive can burn. Anything outside the program area is left
+ * blank, white, so the design only shows where it was burned on the data
+ * side.
+ *
+ * The drive picks the angle at which it starts, from the LightScribe ring on
+ * the hub, which has nothing to do with the angle at which the data side
+ * starts. The two sides line up up to a rotation.
+ */
+func label(data_side *image.Gray, g Geometry, o Label_options) *image.Gray {
+  size := data_side.Bounds().Dx()
+  scale := float64(size) / (2 * Disc_radius)
+  inner := math.Max(Label_inner_radius, float64(g.start_radius))
+  outer := math.Min(Label_outer_radius, float64(g.end_radius()))
+  spoke := 2 * math.Pi / float64(o.spokes)
+  img := image.NewGray(image.Rect(0, 0, size, size))
+  for y:=0; y<size; y++ {
+    for x:=0; x<size; x++ {
+      img.Pix[y * img.Stride + x] = 0xff
+      // mirrored
+      dx := Disc_radius - (float64(x) + 0.5) / scale
+      dy := Disc_radius - (float64(y) + 0.5) / scale
+      r := math.Hypot(dx, dy)
+      if r < inner || r > outer {
+        continue
+      }
+      r = (math.Floor(r / o.radial_step) + 0.5) * o.radial_step
+      a := (math.Floor(math.Atan2(dy, dx) / spoke) + 0.5) * spoke
+      p := image.Pt(int((Disc_radius + r * math.Cos(a)) * scale), int((Disc_radius - r * math.Sin(a)) * scale))
+      if p.In(data_side.Bounds()) {
+        img.Pix[y * img.Stride + x] = data_side.GrayAt(p.X, p.Y).Y
+      }
+    }
+  }
+  return img
+}
+
+func label_command(fs *flag.FlagSet) func() int {
+  o := pattern_flags(fs)
+  g := geometry_flags(fs)
+  m := seed_flag(fs)
+  project := project_flag(fs)
+  output := fs.String("o", "label.png", "output file, - for stdout")
+  l := Label_options{radial_step: Label_radial_step}
+  fs.Var((*Length)(&l.radial_step), "radial-step", "distance between the label's tracks")
+  fs.IntVar(&l.spokes, "spokes", Label_spokes, "number of positions the drive can burn in a revolution")
+  fs.IntVar(&l.dpi, "dpi", Label_dpi, "resolution of the png")
+  fs.Usage = pattern_usage(fs, "<pattern> | -project <file>")
+  return func() int {
+    pattern, err := pattern_argument(fs, *project, o.variables)
+    if err != nil {
+      logger.errorf("%s", err)
+      return Exit_usage
+    }
+    if pattern == "" || l.radial_step <= 0 || l.spokes <= 0 || l.dpi <= 0 {
+      fs.Usage()
+      return Exit_usage
+    }
+
+    logger.infof("creating pattern: %s", pattern)
+    logger.infof("%s", g.describe())
+    m.reseed()
+    buf, _, err := generate_pattern(pattern, o, *g)
+    if err != nil {
+      logger.errorf("%s", err)
+      return Exit_usage
+    }
+    size := int(math.Round(2 * Disc_radius / 25.4 * float64(l.dpi)))
+    img := label(render(buf.Bytes()[Wav_header_size:], *g, size), *g, l)
+    logger.infof("label: %dx%d pixels at %d dpi, %s between tracks, %d spokes", size, size, l.dpi, Length(l.radial_step), l.spokes)
+    if err := write_png_dpi(*output, img, l.dpi); err != nil {
+      logger.errorf("%s", err)
+      return Exit_failure
+    }
+    return 0
+  }
+}
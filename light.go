@@ -0,0 +1,77 @@
+package main
+
+import (
+  "flag"
+  "fmt"
+  "image"
+  "image/color"
+  "math"
+)
+
+/**
+ * How the disc is lit in a preview. Reflected is the usual view, under a
+ * lamp. Transmitted is the disc held up against a light, e.g. hanging in a
+ * window: the reflective layer lets only a little light through, the hole
+ * and the clear polycarbonate around the hub glow, and the burned marks,
+ * whose dye no longer absorbs as much, show lighter than the rest rather
+ * than darker, with less contrast. A design which reads well in one light
+ * may hardly show in the other.
+ */
+type Lighting string
+const (
+  Reflected_light Lighting = "reflected"
+  Transmitted_light Lighting = "transmitted"
+)
+
+const (
+  // shares of the light which get through, as seen from the data side
+  Transmitted_unburned = 0.25
+  Transmitted_burned = 0.5
+  Transmitted_polycarbonate = 0.9
+)
+
+func light_flag(fs *flag.FlagSet) *string {
+  return fs.String("light", string(Reflected_light), "how the disc is lit: reflected, under a lamp, or transmitted, held up against a light, e.g. in a window")
+}
+
+func parse_lighting(s string) (Lighting, error) {
+  switch Lighting(s) {
+    case Reflected_light, Transmitted_light:
+      return Lighting(s), nil
+  }
+  return "", fmt.Errorf("unknown light: %s, expecting %s or %s", s, Reflected_light, Transmitted_light)
+}
+
+/**
+ * Like render and render_dye, with the light coming through the disc. The
+ * light itself shows through the hole and around the disc.
+ */
+func render_transmitted(data []byte, g Geometry, size int, d *Dye) *image.RGBA {
+  sum, count := accumulate(data, g, size)
+  scale := float64(size) / (2 * Disc_radius)
+  through := color.RGBA{0xff, 0xff, 0xff, 0xff}
+  if d != nil {
+    through = d.unburned
+  }
+  img := image.NewRGBA(image.Rect(0, 0, size, size))
+  for y:=0; y<size; y++ {
+    for x:=0; x<size; x++ {
+      i := y * size + x
+      r := math.Hypot((float64(x) + 0.5) / scale - Disc_radius, (float64(y) + 0.5) / scale - Disc_radius)
+      c := color.RGBA{0xff, 0xff, 0xff, 0xff}
+      switch {
+        case count[i] > 0:
+          // from the lightest to the darkest tone, which lets the most light through
+          t := (tone(Light) - sum[i] / float64(count[i])) / (tone(Light) - tone(Dark))
+          t = math.Max(0, math.Min(1, t))
+          c = mix(color.RGBA{0, 0, 0, 0xff}, through, Transmitted_unburned + (Transmitted_burned - Transmitted_unburned) * t)
+        case r >= Dye_inner_radius && r <= Dye_outer_radius:
+          c = mix(color.RGBA{0, 0, 0, 0xff}, through, Transmitted_unburned)
+        case r >= Hole_radius && r <= Disc_radius:
+          c = mix(color.RGBA{0, 0, 0, 0xff}, polycarbonate, Transmitted_polycarbonate)
+      }
+      img.SetRGBA(x, y, c)
+    }
+  }
+  return img
+}
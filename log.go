@@ -0,0 +1,145 @@
+package main
+
+import (
+  "bytes"
+  "context"
+  "flag"
+  "fmt"
+  "io"
+  "log/slog"
+  "os"
+  "strings"
+)
+
+type Level int
+
+const (
+  Level_error Level = iota
+  Level_warning
+  Level_info
+  Level_debug
+  Level_trace
+)
+
+/**
+ * Logs to stderr, as plain text for humans or as one json object per line
+ * for scripts.
+ */
+type Logger struct {
+  level Level
+  out io.Writer
+  json *slog.Logger
+}
+
+var logger = &Logger{level: Level_info, out: os.Stderr}
+
+// slog has no trace level
+var slog_levels = map[Level]slog.Level{
+  Level_error: slog.LevelError,
+  Level_warning: slog.LevelWarn,
+  Level_info: slog.LevelInfo,
+  Level_debug: slog.LevelDebug,
+  Level_trace: slog.LevelDebug - 4,
+}
+
+func (l *Logger) log(level Level, format string, v ...interface{}) {
+  if level > l.level {
+    return
+  }
+  msg := strings.TrimRight(fmt.Sprintf(format, v...), "\n")
+  if l.json != nil {
+    l.json.Log(context.Background(), slog_levels[level], msg)
+    return
+  }
+  if level == Level_warning {
+    msg = "warning: " + msg
+  }
+  fmt.Fprintln(l.out, msg)
+}
+
+func (l *Logger) errorf(format string, v ...interface{}) {
+  l.log(Level_error, format, v...)
+}
+
+func (l *Logger) warnf(format string, v ...interface{}) {
+  l.log(Level_warning, format, v...)
+}
+
+func (l *Logger) infof(format string, v ...interface{}) {
+  l.log(Level_info, format, v...)
+}
+
+func (l *Logger) debugf(format string, v ...interface{}) {
+  l.log(Level_debug, format, v...)
+}
+
+func (l *Logger) tracef(format string, v ...interface{}) {
+  l.log(Level_trace, format, v...)
+}
+
+/**
+ * Returns a writer which logs each line written to it. Used to forward the
+ * output of external programs.
+ */
+func (l *Logger) writer(level Level) io.Writer {
+  return line_writer(func(line string) {
+    l.log(level, "%s", line)
+  })
+}
+
+/**
+ * Returns a writer which calls f for each non-empty line written to it.
+ */
+func line_writer(f func(line string)) io.Writer {
+  return &log_writer{f: f}
+}
+
+type log_writer struct {
+  f func(line string)
+  buf bytes.Buffer
+}
+
+func (w *log_writer) Write(p []byte) (int, error) {
+  w.buf.Write(p)
+  for {
+    // burners redraw their progress with \r
+    i := bytes.IndexAny(w.buf.Bytes(), "\r\n")
+    if i < 0 {
+      return len(p), nil
+    }
+    line := string(w.buf.Next(i + 1))
+    if line = strings.TrimSpace(line); line != "" {
+      w.f(line)
+    }
+  }
+}
+
+/**
+ * Registers the flags every command accepts. The returned function applies
+ * them, once the flags have been parsed.
+ */
+func logging_flags(fs *flag.FlagSet) func() error {
+  verbose := fs.Bool("v", false, "print debugging information")
+  very_verbose := fs.Bool("vv", false, "print even more debugging information")
+  quiet := fs.Bool("quiet", false, "only print errors")
+  format := fs.String("log-format", "text", "format of the logs, text or json")
+  return func() error {
+    switch {
+      case *quiet:
+        logger.level = Level_error
+      case *very_verbose:
+        logger.level = Level_trace
+      case *verbose:
+        logger.level = Level_debug
+    }
+    switch *format {
+      case "text":
+        logger.json = nil
+      case "json":
+        logger.json = slog.New(slog.NewJSONHandler(logger.out, &slog.HandlerOptions{Level: slog_levels[Level_trace]}))
+      default:
+        return fmt.Errorf("unknown log format: %s", *format)
+    }
+    return nil
+  }
+}
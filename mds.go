@@ -0,0 +1,167 @@
+package main
+
+import (
+  "bytes"
+  "encoding/binary"
+  "fmt"
+  "path/filepath"
+)
+
+/**
+ * Alcohol 120%'s image format, version 1.3: the raw sectors go in an .mdf
+ * file, an .mds file describes them. The descriptor is a header, a session,
+ * one block per entry of the full toc (A0, A1 and A2, then the tracks), the
+ * pregap and length of each track and the name of the .mdf file. Everything
+ * is little endian.
+ *
+ * Layouts as read by libmirage. The format has no room for indexes, they only
+ * live in the subchannel.
+ */
+type Mds_header struct {
+  signature [16]byte
+  version [2]uint8
+  medium_type uint16
+  sessions uint16
+  _ [2]uint16
+  bca_length uint16
+  _ [8]byte
+  bca_offset uint32
+  _ [24]byte
+  disc_structures_offset uint32
+  _ [12]byte
+  sessions_offset uint32
+  dpm_offset uint32
+}
+
+type Mds_session struct {
+  start int32
+  end int32
+  number uint16
+  blocks uint8
+  leadin_blocks uint8
+  first_track uint16
+  last_track uint16
+  _ uint32
+  tracks_offset uint32
+}
+
+type Mds_track struct {
+  mode uint8
+  subchannel uint8
+  adr_ctl uint8
+  tno uint8
+  point uint8
+  min uint8
+  sec uint8
+  frame uint8
+  zero uint8
+  pmin uint8
+  psec uint8
+  pframe uint8
+  extra_offset uint32
+  sector_size uint16
+  _ [18]byte
+  start_sector uint32
+  start_offset uint64
+  files uint32
+  footer_offset uint32
+  _ [24]byte
+}
+
+type Mds_extra struct {
+  pregap uint32
+  length uint32
+}
+
+type Mds_footer struct {
+  filename_offset uint32
+  widechar uint32
+  _ [2]uint32
+}
+
+const (
+  Mds_header_size = 88
+  Mds_session_size = 24
+  Mds_track_size = 80
+  Mds_extra_size = 8
+  Mds_footer_size = 16
+  Mds_audio uint8 = 0xa9
+  Mds_pw_interleaved uint8 = 0x08
+  Mds_adr_ctl uint8 = 0x10 // adr 1, control 0: audio
+)
+
+/**
+ * The descriptor. "*.mdf" stands for the .mdf file next to the .mds one.
+ */
+func mds_descriptor(sectors int, marks []Mark) []byte {
+  tracks := disc_tracks(marks, sectors)
+  leadin := 3
+  tracks_offset := Mds_header_size + Mds_session_size
+  extra_offset := tracks_offset + (leadin + len(tracks)) * Mds_track_size
+  footer_offset := extra_offset + len(tracks) * Mds_extra_size
+
+  buf := bytes.Buffer{}
+  h := Mds_header{version: [2]uint8{1, 3}, sessions: 1, sessions_offset: Mds_header_size}
+  copy(h.signature[:], "MEDIA DESCRIPTOR")
+  binary.Write(&buf, binary.LittleEndian, h)
+  binary.Write(&buf, binary.LittleEndian, Mds_session{
+    start: int32(-Lead_in_sectors),
+    end: int32(sectors),
+    number: 1,
+    blocks: uint8(leadin + len(tracks)),
+    leadin_blocks: uint8(leadin),
+    first_track: uint16(tracks[0].number),
+    last_track: uint16(tracks[len(tracks)-1].number),
+    tracks_offset: uint32(tracks_offset),
+  })
+
+  // A0: first track, A1: last track, A2: start of the lead-out
+  minutes, seconds, frames := msf(sectors + Lead_in_sectors)
+  binary.Write(&buf, binary.LittleEndian, Mds_track{adr_ctl: Mds_adr_ctl, point: 0xa0, pmin: uint8(tracks[0].number)})
+  binary.Write(&buf, binary.LittleEndian, Mds_track{adr_ctl: Mds_adr_ctl, point: 0xa1, pmin: uint8(tracks[len(tracks)-1].number)})
+  binary.Write(&buf, binary.LittleEndian, Mds_track{adr_ctl: Mds_adr_ctl, point: 0xa2,
+    pmin: uint8(minutes), psec: uint8(seconds), pframe: uint8(frames)})
+  for i, t := range tracks {
+    minutes, seconds, frames := msf(t.start + Lead_in_sectors)
+    binary.Write(&buf, binary.LittleEndian, Mds_track{
+      mode: Mds_audio,
+      subchannel: Mds_pw_interleaved,
+      adr_ctl: Mds_adr_ctl,
+      point: uint8(t.number),
+      pmin: uint8(minutes),
+      psec: uint8(seconds),
+      pframe: uint8(frames),
+      extra_offset: uint32(extra_offset + i * Mds_extra_size),
+      sector_size: uint16(Raw_sector_size),
+      start_sector: uint32(t.start),
+      start_offset: uint64(t.start * Raw_sector_size),
+      files: 1,
+      footer_offset: uint32(footer_offset),
+    })
+  }
+  for i, t := range tracks {
+    e := Mds_extra{length: uint32(t.end - t.start)}
+    if i == 0 {
+      e.pregap = uint32(Lead_in_sectors)
+    }
+    binary.Write(&buf, binary.LittleEndian, e)
+  }
+  binary.Write(&buf, binary.LittleEndian, Mds_footer{filename_offset: uint32(footer_offset + Mds_footer_size)})
+  buf.WriteString("*.mdf\x00")
+  return buf.Bytes()
+}
+
+func write_mds(filename string, wav []byte, g Geometry, m Metadata, o Sector_options) error {
+  if filename == "-" {
+    return fmt.Errorf("mds images are two files, use -o")
+  }
+  data, marks, err := raw_image(wav, g, o)
+  if err != nil {
+    return err
+  }
+  if err := write_output(companion(filename, ".mdf"), data); err != nil {
+    return err
+  }
+  logger.infof("writing %s and %s", companion(filename, ".mds"), filepath.Base(companion(filename, ".mdf")))
+  return write_output(companion(filename, ".mds"), mds_descriptor(len(data) / Raw_sector_size, marks))
+}
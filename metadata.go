@@ -0,0 +1,68 @@
+package main
+
+import (
+  "bytes"
+  "flag"
+  "fmt"
+  "math/rand"
+)
+
+// set at build time with -ldflags "-X main.version=..."
+var version = "dev"
+
+/**
+ * Source of randomness for every randomized stage. Always seeded from the
+ * -seed flag, so that the same options produce the same bytes.
+ */
+var random = rand.New(rand.NewSource(1))
+
+/**
+ * Information stamped into the output, so that a disc can be regenerated
+ * byte for byte.
+ */
+type Metadata struct {
+  seed int64
+}
+
+func seed_flag(fs *flag.FlagSet) *Metadata {
+  m := &Metadata{}
+  fs.Int64Var(&m.seed, "seed", 1, "seed for the randomized stages, the same seed and options produce the same output")
+  return m
+}
+
+func (m Metadata) reseed() {
+  random = rand.New(rand.NewSource(m.seed))
+}
+
+/**
+ * Appends a LIST/INFO chunk after the samples and fixes up the riff length.
+ * The chunk goes after the data so that the samples still start right after
+ * the 44 byte header.
+ */
+func stamp(buf *bytes.Buffer, m Metadata) {
+  info := bytes.Buffer{}
+  info.WriteString("INFO")
+  info_string(&info, "ISFT", "micro-engraving " + version)
+  info_string(&info, "ICMT", fmt.Sprintf("seed=%d", m.seed))
+
+  buf.WriteString("LIST")
+  write_int32(buf, info.Len())
+  info.WriteTo(buf)
+
+  riff_length := bytes.Buffer{}
+  write_int32(&riff_length, buf.Len() - 8)
+  copy(buf.Bytes()[4:8], riff_length.Bytes())
+}
+
+/**
+ * Writes a NUL terminated string sub-chunk, padded to an even length.
+ */
+func info_string(buf *bytes.Buffer, id string, s string) {
+  buf.WriteString(id)
+  write_int32(buf, len(s) + 1)
+  buf.WriteString(s)
+  buf.WriteByte(0)
+  if (len(s) + 1) % 2 == 1 {
+    buf.WriteByte(0)
+  }
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+  "bytes"
+  "encoding/binary"
+)
+
+/**
+ * Nero's image format, version 2 (NER5). The sectors come first, followed by
+ * chunks describing the disc and an 12 byte footer pointing at the first
+ * chunk. Everything is big endian.
+ *
+ * Layouts as read by libmirage, which documents the format better than Nero
+ * ever did.
+ */
+const (
+  Nrg_audio_subchannel uint8 = 0x10 // audio, 2352 bytes + 96 bytes of interleaved P-W
+  Nrg_cd_rom uint32 = 1
+)
+
+func nrg_chunk(buf *bytes.Buffer, id string, data []byte) {
+  buf.WriteString(id)
+  binary.Write(buf, binary.BigEndian, uint32(len(data)))
+  buf.Write(data)
+}
+
+/**
+ * Cue sheet: one entry per index, index 0 included, then the lead-out. The
+ * 2 second pregap of track 1 precedes the image.
+ */
+func nrg_cuex(tracks []Disc_track, sectors int) []byte {
+  buf := bytes.Buffer{}
+  entry := func(track byte, index int, sector int) {
+    buf.Write([]byte{0x01, track, bcd(index), 0}) // control 0, adr 1
+    binary.Write(&buf, binary.BigEndian, int32(sector))
+  }
+  entry(0, 0, -Lead_in_sectors)
+  for i, t := range tracks {
+    if i == 0 {
+      entry(bcd(t.number), 0, -Lead_in_sectors)
+    } else {
+      entry(bcd(t.number), 0, t.start)
+    }
+    entry(bcd(t.number), 1, t.start)
+    for j, sector := range t.indexes {
+      entry(bcd(t.number), j + 2, sector)
+    }
+  }
+  entry(0xaa, 1, sectors)
+  return buf.Bytes()
+}
+
+/**
+ * Disc at once information: byte offsets of each track in the image.
+ */
+func nrg_daox(tracks []Disc_track) []byte {
+  buf := bytes.Buffer{}
+  size := 22 + 42 * len(tracks)
+  binary.Write(&buf, binary.BigEndian, uint32(size))
+  buf.Write(make([]byte, 13 + 1 + 2)) // no catalog number, toc type 0 for audio
+  buf.Write([]byte{byte(tracks[0].number), byte(tracks[len(tracks)-1].number)})
+  for _, t := range tracks {
+    buf.Write(make([]byte, 12)) // no isrc
+    binary.Write(&buf, binary.BigEndian, uint16(Raw_sector_size))
+    buf.Write([]byte{Nrg_audio_subchannel, 0, 0, 0})
+    // no index 0 in the image, the pregap starts where the track does
+    binary.Write(&buf, binary.BigEndian, uint64(t.start * Raw_sector_size))
+    binary.Write(&buf, binary.BigEndian, uint64(t.start * Raw_sector_size))
+    binary.Write(&buf, binary.BigEndian, uint64(t.end * Raw_sector_size))
+  }
+  return buf.Bytes()
+}
+
+func nrg_image(data []byte, marks []Mark) []byte {
+  sectors := len(data) / Raw_sector_size
+  tracks := disc_tracks(marks, sectors)
+  buf := bytes.NewBuffer(append([]byte{}, data...))
+  nrg_chunk(buf, "CUEX", nrg_cuex(tracks, sectors))
+  nrg_chunk(buf, "DAOX", nrg_daox(tracks))
+  session := bytes.Buffer{}
+  binary.Write(&session, binary.BigEndian, uint32(len(tracks)))
+  nrg_chunk(buf, "SINF", session.Bytes())
+  media := bytes.Buffer{}
+  binary.Write(&media, binary.BigEndian, Nrg_cd_rom)
+  nrg_chunk(buf, "MTYP", media.Bytes())
+  nrg_chunk(buf, "END!", nil)
+  buf.WriteString("NER5")
+  binary.Write(buf, binary.BigEndian, uint64(len(data)))
+  return buf.Bytes()
+}
+
+func write_nrg(filename string, wav []byte, g Geometry, m Metadata, o Sector_options) error {
+  data, marks, err := raw_image(wav, g, o)
+  if err != nil {
+    return err
+  }
+  return write_output(filename, nrg_image(data, marks))
+}
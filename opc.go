@@ -0,0 +1,96 @@
+package main
+
+import (
+  "bytes"
+  "encoding/hex"
+  "fmt"
+  "os/exec"
+  "strings"
+)
+
+/**
+ * Before writing, a drive burns a few test areas at different laser powers
+ * and keeps the one which gives the best signal: the optimum power
+ * calibration (OPC). The power depends on the blank and the drive, and it
+ * shows in the contrast of the burned disc.
+ *
+ * Drives report their OPC results in the disc information (MMC READ DISC
+ * INFORMATION, 0x51). The values are vendor specific, they are logged as
+ * is, along with the speed they were measured at.
+ */
+type Opc_entry struct {
+  speed int // in kB/s
+  value []byte
+}
+
+const (
+  Read_disc_information byte = 0x51
+  Disc_information_size int = 2048
+  Cd_speed float64 = 176.4 // 1x, in kB/s
+  Dvd_speed float64 = 1385
+)
+
+/**
+ * Parses the disc information block: the number of OPC tables is at byte 33,
+ * followed by 8 byte entries, a 2 byte speed and a 6 byte value.
+ */
+func parse_opc(data []byte) ([]Opc_entry, error) {
+  if len(data) < 34 {
+    return nil, fmt.Errorf("disc information: %d bytes, expecting at least 34", len(data))
+  }
+  length := int(data[0]) << 8 | int(data[1]) + 2
+  n := int(data[33])
+  if 34 + n * 8 > min(length, len(data)) {
+    return nil, fmt.Errorf("disc information: %d opc tables in %d bytes", n, min(length, len(data)))
+  }
+  entries := []Opc_entry{}
+  for i:=0; i<n; i++ {
+    e := data[34 + i * 8:42 + i * 8]
+    entries = append(entries, Opc_entry{int(e[0]) << 8 | int(e[1]), e[2:8]})
+  }
+  return entries, nil
+}
+
+/**
+ * Reads the disc information with sg_raw, from sg3_utils. Only Linux exposes
+ * MMC commands this way.
+ */
+func read_opc(device string) ([]Opc_entry, error) {
+  cdb := []byte{Read_disc_information, 0, 0, 0, 0, 0, 0, byte(Disc_information_size >> 8), byte(Disc_information_size & 0xff), 0}
+  cmd := []string{"sg_raw", "--binary", "--request=" + fmt.Sprint(Disc_information_size), device}
+  for _, b := range cdb {
+    cmd = append(cmd, fmt.Sprintf("%02x", b))
+  }
+  logger.debugf("%s", strings.Join(cmd, " "))
+  stdout := bytes.Buffer{}
+  c := exec.Command(cmd[0], cmd[1:]...)
+  c.Stdout = &stdout
+  c.Stderr = logger.writer(Level_debug)
+  if err := c.Run(); err != nil {
+    return nil, fmt.Errorf("%s: %s", cmd[0], err)
+  }
+  return parse_opc(stdout.Bytes())
+}
+
+/**
+ * Logs the OPC results of the disc in the drive. A missing sg_raw or a drive
+ * which doesn't keep its results isn't worth failing a burn over.
+ */
+func log_opc(device string, media string) {
+  entries, err := read_opc(device)
+  if err != nil {
+    logger.warnf("couldn't read the laser power calibration: %s", err)
+    return
+  }
+  if len(entries) == 0 {
+    logger.infof("%s: the drive didn't report any laser power calibration", device)
+    return
+  }
+  x := Cd_speed
+  if media == "dvd" {
+    x = Dvd_speed
+  }
+  for _, e := range entries {
+    logger.infof("%s: laser power calibration at %d kB/s (%.0fx): %s", device, e.speed, float64(e.speed) / x, hex.EncodeToString(e.value))
+  }
+}
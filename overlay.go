@@ -0,0 +1,314 @@
+package main
+
+import (
+  "bytes"
+  "flag"
+  "fmt"
+  "math"
+  "sort"
+  "strings"
+)
+
+/**
+ * A true scale drawing of where the design goes, to print on a transparency
+ * and lay over the burned disc: the radii at which the design, the intro
+ * and the fill start and end, the parts of the disc they must be compared
+ * with, spokes every 30°, and a ruler. It's the cheapest way to check a burn
+ * without a scanner.
+ *
+ * The drawing is the disc as seen from the data side, print it on the
+ * transparency and lay it printed side up on the data side, the center
+ * cross on the middle of the hole. Printers like to scale pages to fit:
+ * the scale bar at the bottom must measure 100mm, otherwise nothing on the
+ * page does what it says.
+ */
+type Paper struct {
+  name string
+  width float64 // in mm
+  height float64
+}
+
+var papers = []Paper{
+  {"a4", 210, 297},
+  {"letter", 215.9, 279.4},
+}
+
+func find_paper(name string) (Paper, error) {
+  for _, p := range papers {
+    if p.name == name {
+      return p, nil
+    }
+  }
+  return Paper{}, fmt.Errorf("unknown paper: %s, expecting %s or %s", name, papers[0].name, papers[1].name)
+}
+
+const (
+  Pdf_points_per_mm = 72 / 25.4
+  Overlay_scale_bar = 100.0 // in mm
+)
+
+/**
+ * A single page pdf, drawn in mm from the bottom left corner of the page.
+ * Just enough of the format for lines, circles and text in Helvetica.
+ */
+type Pdf struct {
+  content bytes.Buffer
+}
+
+func (p *Pdf) stroke(width float64, rgb [3]float64, dashed bool) {
+  fmt.Fprintf(&p.content, "%.3f w %.2f %.2f %.2f RG %.2f %.2f %.2f rg ", width * Pdf_points_per_mm, rgb[0], rgb[1], rgb[2], rgb[0], rgb[1], rgb[2])
+  if dashed {
+    fmt.Fprintf(&p.content, "[%.2f %.2f] 0 d\n", Pdf_points_per_mm, Pdf_points_per_mm)
+  } else {
+    fmt.Fprintf(&p.content, "[] 0 d\n")
+  }
+}
+
+func (p *Pdf) line(a Point, b Point) {
+  fmt.Fprintf(&p.content, "%.3f %.3f m %.3f %.3f l S\n", a.x * Pdf_points_per_mm, a.y * Pdf_points_per_mm, b.x * Pdf_points_per_mm, b.y * Pdf_points_per_mm)
+}
+
+/**
+ * Four cubic béziers, each within 0.03% of a quarter of the circle.
+ */
+func (p *Pdf) circle(c Point, r float64) {
+  k := 4 * (math.Sqrt2 - 1) / 3 * r
+  at := func(x float64, y float64) string {
+    return fmt.Sprintf("%.3f %.3f", (c.x + x) * Pdf_points_per_mm, (c.y + y) * Pdf_points_per_mm)
+  }
+  fmt.Fprintf(&p.content, "%s m\n", at(r, 0))
+  fmt.Fprintf(&p.content, "%s %s %s c\n", at(r, k), at(k, r), at(0, r))
+  fmt.Fprintf(&p.content, "%s %s %s c\n", at(-k, r), at(-r, k), at(-r, 0))
+  fmt.Fprintf(&p.content, "%s %s %s c\n", at(-r, -k), at(-k, -r), at(0, -r))
+  fmt.Fprintf(&p.content, "%s %s %s c S\n", at(k, -r), at(r, -k), at(r, 0))
+}
+
+/**
+ * Text of size mm, its baseline starting at at, or centered on it.
+ */
+func (p *Pdf) text(at Point, size float64, centered bool, s string) {
+  if centered {
+    // helvetica's characters are about half as wide as they are tall
+    at.x -= float64(len([]rune(s))) * size * 0.28
+  }
+  r := strings.NewReplacer(`\`, `\\`, `(`, `\(`, `)`, `\)`, "°", `\260`, "µ", `\265`)
+  fmt.Fprintf(&p.content, "BT /F1 %.2f Tf %.3f %.3f Td (%s) Tj ET\n", size * Pdf_points_per_mm, at.x * Pdf_points_per_mm, at.y * Pdf_points_per_mm, r.Replace(s))
+}
+
+/**
+ * The whole file: catalog, pages, page, font and content, followed by the
+ * cross reference table with the offset of each object.
+ */
+func (p *Pdf) document(paper Paper) []byte {
+  objects := []string{
+    "<< /Type /Catalog /Pages 2 0 R >>",
+    "<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+    fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 4 0 R >> >> /Contents 5 0 R >>", paper.width * Pdf_points_per_mm, paper.height * Pdf_points_per_mm),
+    "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+    fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", p.content.Len(), p.content.String()),
+  }
+  buf := &bytes.Buffer{}
+  buf.WriteString("%PDF-1.4\n")
+  offsets := []int{}
+  for i, o := range objects {
+    offsets = append(offsets, buf.Len())
+    fmt.Fprintf(buf, "%d 0 obj\n%s\nendobj\n", i + 1, o)
+  }
+  xref := buf.Len()
+  fmt.Fprintf(buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects) + 1)
+  for _, offset := range offsets {
+    fmt.Fprintf(buf, "%010d 00000 n \n", offset)
+  }
+  fmt.Fprintf(buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects) + 1, xref)
+  return buf.Bytes()
+}
+
+/**
+ * A radius drawn on the overlay. Parts of the disc are dashed, those of the
+ * design solid.
+ */
+type Overlay_radius struct {
+  radius float64 // in mm
+  name string
+  design bool
+}
+
+var (
+  overlay_black = [3]float64{0, 0, 0}
+  overlay_grey = [3]float64{0.6, 0.6, 0.6}
+  overlay_red = [3]float64{0.85, 0, 0}
+)
+
+/**
+ * The radii worth checking on a burn of the design.
+ */
+func overlay_radii(o *Pattern_options, g Geometry) ([]Overlay_radius, error) {
+  r := []Overlay_radius{
+    {Hole_radius, "hole", false},
+    {Dye_inner_radius, "dye", false},
+    {Dye_outer_radius, "dye end", false},
+    {Disc_radius, "edge", false},
+  }
+  for _, z := range hub_zones {
+    r = append(r, Overlay_radius{float64(z.outer), z.name, false})
+  }
+  audio, _, err := intro_samples(o)
+  if err != nil {
+    return nil, err
+  }
+  design := g
+  if len(audio) > 0 {
+    intro := Duration(len(audio) / 4)
+    if intro >= g.samples {
+      return nil, fmt.Errorf("the intro lasts %s, leaving no room for the design in %s", intro, g.samples)
+    }
+    r = append(r, Overlay_radius{float64(g.start_radius), "intro", true})
+    design = g.skip(intro)
+  }
+  r = append(r, Overlay_radius{float64(design.start_radius), "design", true}, Overlay_radius{float64(g.end_radius()), "design end", true})
+  if out := o.output_geometry(g); out.samples > g.samples {
+    r = append(r, Overlay_radius{float64(out.end_radius()), "fill end", true})
+  }
+  for _, z := range o.zone_pairs {
+    r = append(r, Overlay_radius{z.inner, fmt.Sprintf("zone 0x%02x/0x%02x", z.dark, z.light), true}, Overlay_radius{z.outer, "zone end", true})
+  }
+  sort.SliceStable(r, func(i int, j int) bool {
+    return r[i].radius < r[j].radius
+  })
+  return r, nil
+}
+
+/**
+ * Draws the overlay, the disc's center at the middle of the page, below a
+ * header which says what it is for.
+ */
+func overlay_pdf(pattern Pattern, o *Pattern_options, g Geometry, paper Paper) ([]byte, error) {
+  radii, err := overlay_radii(o, g)
+  if err != nil {
+    return nil, err
+  }
+  p := &Pdf{}
+  c := Point{paper.width / 2, paper.height / 2}
+  // angles clockwise from the top, as on the command line
+  at := func(r float64, degrees float64) Point {
+    a := degrees * math.Pi / 180
+    return Point{c.x + r * math.Sin(a), c.y + r * math.Cos(a)}
+  }
+
+  top := paper.height - 15
+  p.text(Point{15, top}, 4, false, fmt.Sprintf("micro-engraving %s: %s", version, pattern))
+  p.text(Point{15, top - 5}, 2.5, false, g.describe())
+  p.text(Point{15, top - 9}, 2.5, false, "the disc as seen from the data side: lay the transparency printed side up, the center cross on the middle of the hole")
+
+  // spokes
+  p.stroke(0.1, overlay_grey, false)
+  for d:=0; d<360; d+=30 {
+    p.line(at(Hole_radius, float64(d)), at(Disc_radius, float64(d)))
+    p.text(at(Disc_radius + 4, float64(d)), 2.5, true, fmt.Sprintf("%d°", d))
+  }
+
+  // radii, their labels along a spoke of their own when the previous one is
+  // too close
+  last, spoke := 0.0, 0
+  for _, r := range radii {
+    if r.design {
+      p.stroke(0.15, overlay_red, false)
+    } else {
+      p.stroke(0.1, overlay_black, true)
+    }
+    p.circle(c, r.radius)
+    if r.radius - last < 3 {
+      spoke = (spoke + 1) % 3
+    } else {
+      spoke = 0
+    }
+    last = r.radius
+    p.text(at(r.radius + 0.5, 45 + float64(spoke) * 30), 2, false, fmt.Sprintf("%s %s", r.name, Length(r.radius)))
+  }
+
+  // where the spiral starts
+  p.stroke(0.3, overlay_red, false)
+  start, radius := g.start_angle.degrees(), float64(g.start_radius)
+  p.line(at(radius - 1.5, start), at(radius + 1.5, start))
+  p.text(at(radius - 3.5, start), 2, true, "start")
+
+  // center cross and ruler, along the spoke at 0°
+  p.stroke(0.1, overlay_black, false)
+  p.line(Point{c.x - 3, c.y}, Point{c.x + 3, c.y})
+  p.line(Point{c.x, c.y - 3}, Point{c.x, c.y + Disc_radius})
+  for i:=int(2 * Hole_radius); i<=int(2 * Disc_radius); i++ {
+    r := float64(i) / 2
+    tick := 0.6
+    switch {
+      case i % 10 == 0:
+        tick = 2
+        p.text(Point{c.x - 3.2, c.y + r - 0.6}, 1.8, true, fmt.Sprintf("%d", i / 2))
+      case i % 2 == 0:
+        tick = 1
+    }
+    p.line(Point{c.x, c.y + r}, Point{c.x + tick, c.y + r})
+  }
+
+  // scale bar
+  bar := Point{(paper.width - Overlay_scale_bar) / 2, 20}
+  p.line(bar, Point{bar.x + Overlay_scale_bar, bar.y})
+  for i:=0; i<=int(Overlay_scale_bar); i++ {
+    tick := 1.0
+    if i % 10 == 0 {
+      tick = 2.5
+      p.text(Point{bar.x + float64(i), bar.y - 4}, 2, true, fmt.Sprintf("%d", i))
+    }
+    p.line(Point{bar.x + float64(i), bar.y}, Point{bar.x + float64(i), bar.y + tick})
+  }
+  p.text(Point{paper.width / 2, bar.y + 5}, 2.5, true, fmt.Sprintf("print at actual size, 100%%: this bar must measure %gmm", Overlay_scale_bar))
+  return p.document(paper), nil
+}
+
+func overlay_command(fs *flag.FlagSet) func() int {
+  o := pattern_flags(fs)
+  g := geometry_flags(fs)
+  project := project_flag(fs)
+  output := fs.String("o", "overlay.pdf", "output file, - for stdout")
+  paper := fs.String("paper", papers[0].name, "paper size: a4 or letter")
+  fs.Usage = pattern_usage(fs, "<pattern> | -project <file>")
+  return func() int {
+    pattern, err := pattern_argument(fs, *project, o.variables)
+    if err != nil {
+      logger.errorf("%s", err)
+      return Exit_usage
+    }
+    if pattern == "" {
+      fs.Usage()
+      return Exit_usage
+    }
+    known := false
+    for _, p := range patterns {
+      known = known || p.name == pattern
+    }
+    if !known {
+      logger.errorf("unknown pattern: %s", pattern)
+      return Exit_usage
+    }
+    p, err := find_paper(*paper)
+    if err != nil {
+      logger.errorf("%s", err)
+      return Exit_usage
+    }
+    if err := g.validate(); err != nil {
+      logger.errorf("%s", err)
+      return Exit_usage
+    }
+
+    logger.infof("%s", g.describe())
+    data, err := overlay_pdf(pattern, o, *g, p)
+    if err != nil {
+      logger.errorf("%s", err)
+      return Exit_usage
+    }
+    if err := write_output(*output, data); err != nil {
+      logger.errorf("%s", err)
+      return Exit_failure
+    }
+    return 0
+  }
+}
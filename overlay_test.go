@@ -0,0 +1,43 @@
+package main
+
+import (
+  "bytes"
+  "flag"
+  "fmt"
+  "testing"
+)
+
+/**
+ * The overlay's cross reference table points at its objects, and its scale
+ * bar is 100mm long on the page.
+ */
+func TestOverlayPdf(t *testing.T) {
+  fs := flag.NewFlagSet("", flag.ContinueOnError)
+  o, g, _ := design_flags(fs)
+  if err := fs.Parse([]string{"-duration", "20m", "-silent-intro", "4s"}); err != nil {
+    t.Fatal(err)
+  }
+  data, err := overlay_pdf(Pie, o, *g, papers[0])
+  if err != nil {
+    t.Fatal(err)
+  }
+  var xref int
+  if _, err := fmt.Sscanf(string(data[bytes.LastIndex(data, []byte("startxref")):]), "startxref\n%d", &xref); err != nil {
+    t.Fatal(err)
+  }
+  if !bytes.HasPrefix(data[xref:], []byte("xref\n0 6\n")) {
+    t.Fatalf("startxref %d doesn't point at the table", xref)
+  }
+  for i:=1; i<=5; i++ {
+    var offset int
+    fmt.Sscanf(string(data[xref + 9 + i * 20:]), "%d", &offset)
+    if !bytes.HasPrefix(data[offset:], []byte(fmt.Sprintf("%d 0 obj\n", i))) {
+      t.Errorf("object %d: offset %d points at %q", i, offset, data[offset:offset + 10])
+    }
+  }
+  x := (papers[0].width - Overlay_scale_bar) / 2
+  bar := fmt.Sprintf("%.3f %.3f m %.3f %.3f l S", x * Pdf_points_per_mm, 20 * Pdf_points_per_mm, (x + 100) * Pdf_points_per_mm, 20 * Pdf_points_per_mm)
+  if !bytes.Contains(data, []byte(bar)) {
+    t.Errorf("no 100mm scale bar, expecting %q", bar)
+  }
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+  "encoding/json"
+  "flag"
+  "fmt"
+  "os"
+)
+
+type Parameter_description struct {
+  Name string `json:"name"`
+  Type string `json:"type"`
+  Default string `json:"default"`
+  Description string `json:"description"`
+}
+
+type Pattern_description struct {
+  Name string `json:"name"`
+  Description string `json:"description"`
+  Parameters []Parameter_description `json:"parameters"`
+}
+
+/**
+ * Describes every pattern and its parameters. The types and defaults come
+ * straight from the flags.
+ */
+func describe_patterns() []Pattern_description {
+  fs := flag.NewFlagSet("", flag.ContinueOnError)
+  pattern_flags(fs)
+
+  r := []Pattern_description{}
+  for _, p := range patterns {
+    d := Pattern_description{Name: string(p.name), Description: p.description, Parameters: []Parameter_description{}}
+    for _, name := range p.parameters {
+      f := fs.Lookup(name)
+      kind, usage := flag.UnquoteUsage(f)
+      d.Parameters = append(d.Parameters, Parameter_description{name, kind, f.DefValue, usage})
+    }
+    r = append(r, d)
+  }
+  return r
+}
+
+func patterns_command(fs *flag.FlagSet) func() int {
+  as_json := fs.Bool("json", false, "machine-readable output")
+  fs.Usage = func() {
+    fmt.Fprintf(fs.Output(), "usage: %s patterns [options]\n\noptions:\n", os.Args[0])
+    fs.PrintDefaults()
+  }
+  return func() int {
+    if fs.NArg() != 0 {
+      fs.Usage()
+      return Exit_usage
+    }
+
+    descriptions := describe_patterns()
+    if *as_json {
+      data, err := json.MarshalIndent(descriptions, "", "  ")
+      if err != nil {
+        logger.errorf("%s", err)
+        return Exit_failure
+      }
+      fmt.Printf("%s\n", data)
+      return 0
+    }
+    for _, p := range descriptions {
+      fmt.Printf("%s: %s\n", p.Name, p.Description)
+      for _, param := range p.Parameters {
+        fmt.Printf("  -%s %s (default %q)\n", param.Name, param.Type, param.Default)
+        fmt.Printf("      %s\n", param.Description)
+      }
+    }
+    return 0
+  }
+}
@@ -0,0 +1,415 @@
+package main
+
+import (
+  "bytes"
+  "fmt"
+  "math"
+  "path/filepath"
+  "strconv"
+  "strings"
+  "unicode"
+)
+
+/**
+ * Drawings made for pen plotters, as G-code or HPGL files, or in CAD, as DXF
+ * files. The pen down moves are engraved as strokes of -width, the pen up
+ * moves are skipped.
+ *
+ * Drawings come in any size: by default the drawing is centered on the disc
+ * and scaled so that it reaches the end of the program area. Parts of it
+ * which fall over the hole or the hub aren't visible. With -actual-size, the
+ * drawing is engraved as is instead, its origin at the center of the disc.
+ */
+type Drawing [][]Point // polylines, in mm
+
+const Hpgl_unit = 0.025 // in mm
+
+var drawing_formats = []struct {
+  name string
+  extensions []string
+  parse func(data []byte) (Drawing, error)
+}{
+  {"G-code", []string{".gcode", ".nc", ".ngc", ".tap"}, parse_gcode},
+  {"HPGL", []string{".hpgl", ".hpg", ".plt"}, parse_hpgl},
+  {"DXF", []string{".dxf"}, parse_dxf},
+}
+
+/**
+ * Follows the pen, collecting the strokes it draws.
+ */
+type Pen struct {
+  drawing Drawing
+  at Point
+  stroke bool // whether the last move drew
+}
+
+func (p *Pen) move_to(to Point, down bool) {
+  if down {
+    if !p.stroke {
+      p.drawing = append(p.drawing, []Point{p.at})
+      p.stroke = true
+    }
+    last := len(p.drawing) - 1
+    p.drawing[last] = append(p.drawing[last], to)
+  } else {
+    p.stroke = false
+  }
+  p.at = to
+}
+
+/**
+ * Moves along an arc around center, turning by sweep radians, counter
+ * clockwise when positive, and ending at end. The radius goes smoothly from
+ * the start's to the end's, files are rarely exact.
+ */
+func (p *Pen) arc(center Point, sweep float64, end Point, down bool) {
+  r0 := math.Hypot(p.at.x - center.x, p.at.y - center.y)
+  r1 := math.Hypot(end.x - center.x, end.y - center.y)
+  a0 := math.Atan2(p.at.y - center.y, p.at.x - center.x)
+  n := int(math.Ceil(math.Abs(sweep) / (math.Pi / 180)))
+  for i:=1; i<n; i++ {
+    t := float64(i) / float64(n)
+    r, a := r0 + (r1 - r0) * t, a0 + sweep * t
+    p.move_to(Point{center.x + r * math.Cos(a), center.y + r * math.Sin(a)}, down)
+  }
+  p.move_to(end, down)
+}
+
+/**
+ * Returns the angle from a to b around center, in (0, 2π] counter clockwise
+ * or in [-2π, 0) clockwise. The same point twice is a full turn.
+ */
+func sweep_angle(center Point, a Point, b Point, clockwise bool) float64 {
+  d := math.Atan2(b.y - center.y, b.x - center.x) - math.Atan2(a.y - center.y, a.x - center.x)
+  if clockwise {
+    d = -d
+  }
+  d = math.Mod(d + 4 * math.Pi, 2 * math.Pi)
+  if d < 1e-9 {
+    d = 2 * math.Pi
+  }
+  if clockwise {
+    return -d
+  }
+  return d
+}
+
+/**
+ * Reads the subset of G-code plotters and lasers use: G0 and G1 moves, G2
+ * and G3 arcs given by I,J or R, G20/G21 units and G90/G91 positioning. The
+ * pen is down while Z is 0 or less, or between M3/M4 and M5, e.g. a laser.
+ * Other codes are ignored.
+ */
+func parse_gcode(data []byte) (Drawing, error) {
+  pen := Pen{}
+  down := true
+  motion := 0
+  unit := 1.0 // mm per unit of the file
+  absolute := true
+  for n, line := range strings.Split(string(data), "\n") {
+    if i := strings.IndexByte(line, ';'); i >= 0 {
+      line = line[:i]
+    }
+    if strings.HasPrefix(strings.TrimSpace(line), "%") {
+      // start and end of the program
+      continue
+    }
+    for {
+      start := strings.IndexByte(line, '(')
+      end := strings.IndexByte(line, ')')
+      if start < 0 || end < start {
+        break
+      }
+      line = line[:start] + " " + line[end+1:]
+    }
+
+    words := map[byte]float64{}
+    codes := []string{} // G and M words, in order
+    fields := strings.Fields(strings.ToUpper(line))
+    s := strings.Join(fields, "")
+    for i:=0; i<len(s); {
+      letter := s[i]
+      j := i + 1
+      for j < len(s) && !unicode.IsLetter(rune(s[j])) {
+        j++
+      }
+      v, err := strconv.ParseFloat(s[i+1:j], 64)
+      if !unicode.IsLetter(rune(letter)) || err != nil {
+        return nil, fmt.Errorf("line %d: invalid word %q", n + 1, s[i:j])
+      }
+      if letter == 'G' || letter == 'M' {
+        codes = append(codes, fmt.Sprintf("%c%g", letter, v))
+      } else {
+        words[letter] = v
+      }
+      i = j
+    }
+
+    for _, code := range codes {
+      switch code {
+        case "G0", "G1", "G2", "G3":
+          motion = int(code[1] - '0')
+        case "G20":
+          unit = 25.4
+        case "G21":
+          unit = 1
+        case "G90":
+          absolute = true
+        case "G91":
+          absolute = false
+        case "M3", "M4":
+          down = true
+        case "M5":
+          down = false
+      }
+    }
+    // relative moves only tell by their direction
+    if z, ok := words['Z']; ok && (absolute || z != 0) {
+      down = z <= 0
+    }
+    _, has_x := words['X']
+    _, has_y := words['Y']
+    if !has_x && !has_y {
+      continue
+    }
+    to := pen.at
+    if absolute {
+      if has_x {
+        to.x = words['X'] * unit
+      }
+      if has_y {
+        to.y = words['Y'] * unit
+      }
+    } else {
+      to.x += words['X'] * unit
+      to.y += words['Y'] * unit
+    }
+    drawing := motion != 0 && down
+    switch motion {
+      case 0, 1:
+        pen.move_to(to, drawing)
+      case 2, 3:
+        clockwise := motion == 2
+        var center Point
+        if r, ok := words['R']; ok {
+          // the center is on the right of the chord for clockwise arcs, on
+          // its left otherwise, and swaps sides past half a turn (R < 0)
+          r *= unit
+          dx, dy := to.x - pen.at.x, to.y - pen.at.y
+          d := math.Hypot(dx, dy)
+          if d == 0 || d / 2 > math.Abs(r) * 1.0001 {
+            return nil, fmt.Errorf("line %d: no arc of radius %g goes through both ends", n + 1, r / unit)
+          }
+          h := math.Sqrt(math.Max(0, r * r - d * d / 4))
+          side := 1.0
+          if !clockwise {
+            side = -side
+          }
+          if r < 0 {
+            side = -side
+          }
+          center = Point{(pen.at.x + to.x) / 2 + side * h * dy / d, (pen.at.y + to.y) / 2 - side * h * dx / d}
+        } else {
+          center = Point{pen.at.x + words['I'] * unit, pen.at.y + words['J'] * unit}
+        }
+        pen.arc(center, sweep_angle(center, pen.at, to, clockwise), to, drawing)
+    }
+  }
+  return pen.drawing, nil
+}
+
+/**
+ * Reads the plotting instructions of HPGL: PU and PD, absolute (PA) and
+ * relative (PR) coordinates, circles (CI) and arcs (AA, AR). Instructions
+ * are two letters followed by numbers, separated by commas or spaces, and
+ * end with ';' or the next instruction. Labels and other instructions are
+ * skipped.
+ */
+func parse_hpgl(data []byte) (Drawing, error) {
+  pen := Pen{}
+  down := false
+  absolute := true
+  s := string(data)
+  for i:=0; i<len(s); {
+    c := s[i]
+    if !unicode.IsLetter(rune(c)) {
+      i++
+      continue
+    }
+    if i + 1 >= len(s) {
+      break
+    }
+    mnemonic := strings.ToUpper(s[i:i+2])
+    i += 2
+    if mnemonic == "LB" {
+      // the label's text runs up to the terminator, ^C by default
+      end := strings.IndexByte(s[i:], 3)
+      if end < 0 {
+        break
+      }
+      i += end + 1
+      continue
+    }
+    j := i
+    for j < len(s) && !unicode.IsLetter(rune(s[j])) && s[j] != ';' {
+      j++
+    }
+    values := []float64{}
+    for _, f := range strings.FieldsFunc(s[i:j], func(r rune) bool { return r == ',' || unicode.IsSpace(r) }) {
+      v, err := strconv.ParseFloat(f, 64)
+      if err != nil {
+        return nil, fmt.Errorf("%s at byte %d: invalid number %q", mnemonic, i, f)
+      }
+      if (mnemonic != "AA" && mnemonic != "AR") || len(values) < 2 {
+        // everything but the angle of arcs is in plotter units
+        v *= Hpgl_unit
+      }
+      values = append(values, v)
+    }
+    i = j
+
+    point := func(x float64, y float64) Point {
+      if absolute {
+        return Point{x, y}
+      }
+      return Point{pen.at.x + x, pen.at.y + y}
+    }
+    switch mnemonic {
+      case "IN":
+        down, absolute = false, true
+      case "PU", "PD", "PA", "PR":
+        switch mnemonic {
+          case "PU":
+            down = false
+            pen.stroke = false
+          case "PD":
+            down = true
+          case "PA":
+            absolute = true
+          case "PR":
+            absolute = false
+        }
+        for k:=0; k+1<len(values); k+=2 {
+          pen.move_to(point(values[k], values[k+1]), down)
+        }
+      case "CI":
+        if len(values) == 0 {
+          return nil, fmt.Errorf("CI at byte %d: missing radius", i)
+        }
+        center, r := pen.at, values[0]
+        pen.stroke = false
+        pen.at = Point{center.x + r, center.y}
+        pen.arc(center, 2 * math.Pi, pen.at, true)
+        pen.stroke = false
+        pen.at = center
+      case "AA", "AR":
+        if len(values) < 3 {
+          return nil, fmt.Errorf("%s at byte %d: expecting x,y,angle", mnemonic, i)
+        }
+        center := Point{values[0], values[1]}
+        if mnemonic == "AR" {
+          center = Point{pen.at.x + values[0], pen.at.y + values[1]}
+        }
+        sweep := values[2] * math.Pi / 180
+        r := math.Hypot(pen.at.x - center.x, pen.at.y - center.y)
+        a := math.Atan2(pen.at.y - center.y, pen.at.x - center.x) + sweep
+        pen.arc(center, sweep, Point{center.x + r * math.Cos(a), center.y + r * math.Sin(a)}, down)
+    }
+  }
+  return pen.drawing, nil
+}
+
+/**
+ * Reads a drawing, picking the format from the file's extension. May be an
+ * http(s) url.
+ */
+func read_drawing(filename string) (Drawing, error) {
+  data, err := read_asset(filename)
+  if err != nil {
+    return nil, err
+  }
+  ext := strings.ToLower(filepath.Ext(filename))
+  names := []string{}
+  for _, f := range drawing_formats {
+    for _, e := range f.extensions {
+      if e == ext {
+        d, err := f.parse(data)
+        if err != nil {
+          return nil, fmt.Errorf("%s: %w", filename, err)
+        }
+        if len(d) == 0 {
+          return nil, fmt.Errorf("%s: nothing is drawn, there are no pen down moves", filename)
+        }
+        return d, nil
+      }
+    }
+    names = append(names, fmt.Sprintf("%s (%s)", f.name, strings.Join(f.extensions, ", ")))
+  }
+  return nil, fmt.Errorf("%s: unknown drawing format, expecting %s", filename, strings.Join(names, " or "))
+}
+
+/**
+ * Returns the distance from center to the farthest point of the drawing.
+ */
+func (d Drawing) reach(center Point) float64 {
+  farthest := 0.0
+  for _, stroke := range d {
+    for _, p := range stroke {
+      farthest = math.Max(farthest, math.Hypot(p.x - center.x, p.y - center.y))
+    }
+  }
+  return farthest
+}
+
+/**
+ * Centers the drawing on the disc and scales it so that its farthest point
+ * is at radius outer.
+ */
+func (d Drawing) fit(outer float64) (Drawing, error) {
+  min_x, min_y := math.Inf(1), math.Inf(1)
+  max_x, max_y := math.Inf(-1), math.Inf(-1)
+  for _, stroke := range d {
+    for _, p := range stroke {
+      min_x, max_x = math.Min(min_x, p.x), math.Max(max_x, p.x)
+      min_y, max_y = math.Min(min_y, p.y), math.Max(max_y, p.y)
+    }
+  }
+  center := Point{(min_x + max_x) / 2, (min_y + max_y) / 2}
+  farthest := d.reach(center)
+  if farthest == 0 {
+    return nil, fmt.Errorf("the drawing is a single point")
+  }
+  scale := outer / farthest
+  r := Drawing{}
+  for _, stroke := range d {
+    points := []Point{}
+    for _, p := range stroke {
+      points = append(points, Point{(p.x - center.x) * scale, (p.y - center.y) * scale})
+    }
+    r = append(r, points)
+  }
+  return r, nil
+}
+
+func plot(buf *bytes.Buffer, g Geometry, d Drawing, width float64, actual_size bool, jitter bool) error {
+  if actual_size {
+    if farthest := d.reach(Point{0, 0}); farthest > float64(g.end_radius()) {
+      logger.warnf("the drawing reaches %s from the center, past the end of the program area at %s", Length(farthest), g.end_radius())
+    }
+  } else {
+    var err error
+    if d, err = d.fit(float64(g.end_radius()) - width / 2); err != nil {
+      return err
+    }
+  }
+  c := new_canvas(Disc_radius, Canvas_resolution)
+  for _, stroke := range d {
+    if len(stroke) == 1 {
+      c.line(stroke[0], stroke[0], width)
+    } else {
+      c.polyline(stroke, width)
+    }
+  }
+  engrave(buf, c, g, jitter)
+  return nil
+}
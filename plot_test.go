@@ -0,0 +1,121 @@
+package main
+
+import (
+  "fmt"
+  "math"
+  "testing"
+)
+
+type Drawing_case struct {
+  name string
+  data string
+  strokes [][]Point // as outline() tells them
+}
+
+/**
+ * The points of a drawing worth comparing: every point of short strokes, the
+ * start, middle and end of the long ones, which are arcs drawn a degree at a
+ * time.
+ */
+func outline(d Drawing) [][]Point {
+  r := [][]Point{}
+  for _, stroke := range d {
+    if len(stroke) < 8 {
+      r = append(r, stroke)
+      continue
+    }
+    a, b := stroke[(len(stroke) - 1) / 2], stroke[len(stroke) / 2]
+    r = append(r, []Point{stroke[0], {(a.x + b.x) / 2, (a.y + b.y) / 2}, stroke[len(stroke) - 1]})
+  }
+  return r
+}
+
+/**
+ * Parses each case and compares its outline, to a µm.
+ */
+func check_drawings(t *testing.T, parse func(data []byte) (Drawing, error), cases []Drawing_case) {
+  for _, c := range cases {
+    d, err := parse([]byte(c.data))
+    if err != nil {
+      t.Errorf("%s: %s", c.name, err)
+      continue
+    }
+    got := outline(d)
+    same := len(got) == len(c.strokes)
+    for i:=0; same && i<len(got); i++ {
+      same = len(got[i]) == len(c.strokes[i])
+      for j:=0; same && j<len(got[i]); j++ {
+        same = math.Abs(got[i][j].x - c.strokes[i][j].x) < 1e-3 && math.Abs(got[i][j].y - c.strokes[i][j].y) < 1e-3
+      }
+    }
+    if !same {
+      t.Errorf("%s: got %s, expecting %s", c.name, format_strokes(got), format_strokes(c.strokes))
+    }
+  }
+}
+
+func format_strokes(strokes [][]Point) string {
+  s := ""
+  for _, stroke := range strokes {
+    s += "["
+    for i, p := range stroke {
+      if i > 0 {
+        s += " "
+      }
+      s += fmt.Sprintf("%.3f,%.3f", p.x, p.y)
+    }
+    s += "]"
+  }
+  return s
+}
+
+// 10mm at 45 degrees
+const diagonal = 7.0710678
+
+func TestParseGcode(t *testing.T) {
+  check_drawings(t, parse_gcode, []Drawing_case{
+    {"pen up and down with Z", "G21 G90\nG0 X0 Y0\nG1 Z-1\nG1 X10 Y0\nG1 X10 Y5\nG0 Z1\nG0 X20 Y20\nG1 Z-1 (down)\nG1 X25 Y20 ; done\n",
+      [][]Point{{{0, 0}, {10, 0}, {10, 5}}, {{20, 20}, {25, 20}}}},
+    {"laser on and off", "M5\nG1 X5 Y0\nM3\nG1 X5 Y5\n",
+      [][]Point{{{5, 0}, {5, 5}}}},
+    {"inches", "G20\nG1 X1 Y0\nG1 X1 Y1\n",
+      [][]Point{{{0, 0}, {25.4, 0}, {25.4, 25.4}}}},
+    {"relative moves", "G91\nG1 X5\nG1 Y5\nG1 Z1\nG1 X5\nG1 Z-1\nG1 X5\nG90\nG1 X0 Y0\n",
+      [][]Point{{{0, 0}, {5, 0}, {5, 5}}, {{10, 5}, {15, 5}, {0, 0}}}},
+    {"clockwise arc", "G0 X10 Y0\nG2 X0 Y-10 I-10 J0\n",
+      [][]Point{{{10, 0}, {diagonal, -diagonal}, {0, -10}}}},
+    {"counter clockwise arc", "G0 X10 Y0\nG3 X0 Y-10 I-10 J0\n",
+      [][]Point{{{10, 0}, {-diagonal, diagonal}, {0, -10}}}},
+    {"clockwise arc by radius, center on the right", "G0 X10 Y0\nG2 X0 Y-10 R10\n",
+      [][]Point{{{10, 0}, {diagonal, -diagonal}, {0, -10}}}},
+    {"counter clockwise arc by radius, center on the left", "G0 X10 Y0\nG3 X0 Y-10 R10\n",
+      [][]Point{{{10, 0}, {10 - diagonal, diagonal - 10}, {0, -10}}}},
+    {"clockwise arc past half a turn", "G0 X10 Y0\nG2 X0 Y-10 R-10\n",
+      [][]Point{{{10, 0}, {10 + diagonal, -10 - diagonal}, {0, -10}}}},
+  })
+  if _, err := parse_gcode([]byte("G0 X0\nG2 X30 Y0 R10\n")); err == nil {
+    t.Errorf("expected an error for an arc shorter than its chord")
+  }
+}
+
+func TestParseHpgl(t *testing.T) {
+  check_drawings(t, parse_hpgl, []Drawing_case{
+    {"absolute", "IN;SP1;PU0,0;PD400,0,400,400;PU;PA800,0;PD800,400;",
+      [][]Point{{{0, 0}, {10, 0}, {10, 10}}, {{20, 0}, {20, 10}}}},
+    {"relative", "IN;PU200,200;PD;PR400,0 0,400;PU;PR-400,0;PD0,-400;",
+      [][]Point{{{5, 5}, {15, 5}, {15, 15}}, {{5, 15}, {5, 5}}}},
+    {"label", "IN;PU0,0;LBPD400,400;\x03PD400,0;",
+      [][]Point{{{0, 0}, {10, 0}}}},
+    {"counter clockwise arc", "IN;PU400,0;PD;AA0,0,90;",
+      [][]Point{{{10, 0}, {diagonal, diagonal}, {0, 10}}}},
+    {"clockwise arc", "IN;PU400,0;PD;AA0,0,-90;",
+      [][]Point{{{10, 0}, {diagonal, -diagonal}, {0, -10}}}},
+    {"relative arc", "IN;PU400,0;PD;AR-400,0,180;",
+      [][]Point{{{10, 0}, {0, 10}, {-10, 0}}}},
+    {"circle", "IN;PU400,400;CI200;PD400,0;",
+      [][]Point{{{15, 10}, {5, 10}, {15, 10}}, {{10, 10}, {10, 0}}}},
+  })
+  if _, err := parse_hpgl([]byte("IN;PD1,2.5.5;")); err == nil {
+    t.Errorf("expected an error for an invalid number")
+  }
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+  "encoding/json"
+  "fmt"
+  "os"
+  "strconv"
+  "strings"
+)
+
+/**
+ * Presets adjust any design for a purpose, on top of its options.
+ *
+ * high-contrast is for low-vision viewing: the design is burned with the
+ * dark/light pair which shows the most contrast, and no feature is smaller
+ * than what the burner reliably resolves. Strokes, letters, bands and cells
+ * below that size get raised to it, with a warning for each, so that a
+ * design made for this preset reports what it loses.
+ *
+ * Which bytes contrast the most depends on how EFM turns them into pits, and
+ * on the dye: a measurement of a calibration disc burned on the same blanks
+ * (-contrast, as written by the contrast command) tells, along with the
+ * smallest feature, half a line pair at its mtf50. Without one, the preset
+ * uses 0x00/0xff, the calibration disc's extremes, and High_contrast_feature.
+ */
+type Preset string
+const (
+  No_preset Preset = ""
+  High_contrast Preset = "high-contrast"
+)
+
+const High_contrast_feature = 0.5 // in mm
+
+type Contrast_preset struct {
+  dark byte
+  light byte
+  feature float64 // smallest feature, in mm
+}
+
+func high_contrast_settings(filename string) (Contrast_preset, error) {
+  s := Contrast_preset{0x00, 0xff, High_contrast_feature}
+  if filename == "" {
+    return s, nil
+  }
+  data, err := os.ReadFile(filename)
+  if err != nil {
+    return s, err
+  }
+  c := Contrast{}
+  if err := json.Unmarshal(data, &c); err != nil {
+    return s, fmt.Errorf("%s: %s", filename, err)
+  }
+  best := -1.0
+  for _, p := range c.Pairs {
+    dark, err1 := strconv.ParseUint(p.Dark, 0, 8)
+    light, err2 := strconv.ParseUint(p.Light, 0, 8)
+    if err1 != nil || err2 != nil {
+      return s, fmt.Errorf("%s: invalid pair %s/%s", filename, p.Dark, p.Light)
+    }
+    if p.Michelson > best {
+      best, s.dark, s.light = p.Michelson, byte(dark), byte(light)
+    }
+  }
+  if c.Mtf50 > 0 {
+    s.feature = 1 / (2 * c.Mtf50)
+  }
+  logger.infof("%s: pair 0x%02x/0x%02x, smallest feature %s", filename, s.dark, s.light, Length(s.feature))
+  return s, nil
+}
+
+/**
+ * Raises the options of o which draw features smaller than the given size.
+ * A letter has two gaps between its strokes, from top to bottom.
+ */
+func enforce_features(pattern Pattern, o *Pattern_options, g Geometry, feature float64) {
+  raise := func(name string, v *float64, min float64) {
+    if *v < min {
+      logger.warnf("-%s %s makes features smaller than %s, using %s", name, Length(*v), Length(feature), Length(min))
+      *v = min
+    }
+  }
+  raise("width", &o.width, feature)
+  switch pattern {
+    case Text:
+      raise("text-height", &o.text_height, 2 * (feature + o.width))
+    case Code:
+      raise("cell-size", &o.cell_size, feature)
+    case Bands:
+      if n := int(float64(g.end_radius() - g.start_radius) / feature); o.bands > n {
+        logger.warnf("-bands %d makes bands narrower than %s, using %d", o.bands, Length(feature), n)
+        o.bands = n
+      }
+  }
+  if o.watermark.text != "" {
+    raise("watermark-size", &o.watermark.size, 2 * (feature + o.width))
+  }
+}
+
+/**
+ * Checks the preset, and adjusts the options of o for it. Returns the pair
+ * to burn the design with.
+ */
+func apply_preset(pattern Pattern, o *Pattern_options, g Geometry) (Contrast_preset, error) {
+  switch Preset(o.preset) {
+    case No_preset:
+      return Contrast_preset{Dark, Light, 0}, nil
+    case High_contrast:
+      switch pattern {
+        case Pitch, Sweep, Tones, Channels, Verify:
+          return Contrast_preset{}, fmt.Errorf("the %s preset is for designs, %s is a sound", High_contrast, pattern)
+      }
+      s, err := high_contrast_settings(o.contrast)
+      if err != nil {
+        return s, err
+      }
+      enforce_features(pattern, o, g, s.feature)
+      return s, nil
+  }
+  return Contrast_preset{}, fmt.Errorf("unknown preset: %s, expecting %s", o.preset, High_contrast)
+}
+
+/**
+ * A dark/light pair for the rings between two radii. Zoned drives burn the
+ * inner disc slower than the outer one, and the pair which shows the best
+ * at one speed isn't always the best at the other.
+ */
+type Zone_pair struct {
+  inner float64 // in mm
+  outer float64
+  dark byte
+  light byte
+}
+
+type Zone_pairs []Zone_pair
+
+func (z *Zone_pairs) Set(s string) error {
+  for _, part := range strings.Split(s, ",") {
+    radii, pair, _ := strings.Cut(strings.TrimSpace(part), ":")
+    from, to, ok1 := strings.Cut(radii, "-")
+    d, l, ok2 := strings.Cut(pair, "/")
+    var inner, outer Length
+    dark, err1 := strconv.ParseUint(strings.TrimSpace(d), 0, 8)
+    light, err2 := strconv.ParseUint(strings.TrimSpace(l), 0, 8)
+    if !ok1 || !ok2 || inner.Set(from) != nil || outer.Set(to) != nil || inner >= outer || err1 != nil || err2 != nil {
+      return fmt.Errorf("invalid zone pair: %q, expecting inner-outer:dark/light, e.g. 25mm-40mm:0x00/0xff", part)
+    }
+    *z = append(*z, Zone_pair{float64(inner), float64(outer), byte(dark), byte(light)})
+  }
+  return nil
+}
+
+func (z Zone_pairs) String() string {
+  r := []string{}
+  for _, x := range z {
+    r = append(r, fmt.Sprintf("%s-%s:0x%02x/0x%02x", Length(x.inner), Length(x.outer), x.dark, x.light))
+  }
+  return strings.Join(r, ",")
+}
+
+/**
+ * Burns the design's dark and light bytes, from sample first on, with the
+ * preset's pair instead, or with the pair of the zone each ring lies in.
+ * The last zone given wins where zones overlap.
+ */
+func remap(samples []byte, g Geometry, first int, s Contrast_preset, zones Zone_pairs) error {
+  rings := g.rings(Duration(len(samples) / 4))
+  for _, z := range zones {
+    if z.inner >= float64(g.end_radius()) || z.outer <= float64(g.start_radius) {
+      return fmt.Errorf("zone pair %s-%s is outside of the program area, %s to %s", Length(z.inner), Length(z.outer), g.start_radius, g.end_radius())
+    }
+    logger.infof("zone %s-%s: pair 0x%02x/0x%02x", Length(z.inner), Length(z.outer), z.dark, z.light)
+  }
+  for _, ring := range rings {
+    dark, light := s.dark, s.light
+    for _, z := range zones {
+      if float64(ring.radius) >= z.inner && float64(ring.radius) < z.outer {
+        dark, light = z.dark, z.light
+      }
+    }
+    for i:=max(first, ring.start) * 4; i<(ring.start + ring.samples) * 4; i++ {
+      switch samples[i] {
+        case Dark:
+          samples[i] = dark
+        case Light:
+          samples[i] = light
+      }
+    }
+  }
+  return nil
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+  "bytes"
+  "flag"
+  "fmt"
+  "image"
+  "image/png"
+  "math"
+  "os"
+)
+
+/**
+ * Sums the tones of the bytes which land in each pixel of a size x size
+ * image of the disc, seen from the data side, and counts them.
+ */
+func accumulate(data []byte, g Geometry, size int) ([]float64, []int) {
+  sum := make([]float64, size * size)
+  count := make([]int, size * size)
+  scale := float64(size) / (2 * Disc_radius)
+  logger.debugf("rendering %d samples at %dx%d", len(data) / 4, size, size)
+
+  for _, ring := range g.rings(Duration(len(data) / 4)) {
+    radius, angle := float64(ring.radius), float64(ring.angle)
+    delta := float64(g.sample_length()) / 4 / radius
+    cos_d, sin_d := math.Cos(delta), math.Sin(delta)
+    x, y := radius * math.Cos(angle), radius * math.Sin(angle)
+    for i:=ring.start * 4; i<(ring.start + ring.samples) * 4; i++ {
+      px, py := int((x + Disc_radius) * scale), int((Disc_radius - y) * scale)
+      if px >= 0 && py >= 0 && px < size && py < size {
+        sum[py * size + px] += tone(data[i])
+        count[py * size + px]++
+      }
+      x, y = x * cos_d - y * sin_d, x * sin_d + y * cos_d
+    }
+  }
+  return sum, count
+}
+
+/**
+ * Renders a stream of samples the way it would be laid out on the disc, seen
+ * from the data side. Each pixel is the average of all the bytes which land
+ * in it. Pixels which don't receive any data are left mid-gray.
+ */
+func render(data []byte, g Geometry, size int) *image.Gray {
+  sum, count := accumulate(data, g, size)
+  img := image.NewGray(image.Rect(0, 0, size, size))
+  for i := range img.Pix {
+    if count[i] == 0 {
+      img.Pix[i] = 0x80
+    } else {
+      img.Pix[i] = uint8(sum[i] / float64(count[i]))
+    }
+  }
+  return img
+}
+
+/**
+ * Brightness of a byte in the preview. Dark and light are pushed to the
+ * extremes, any other value is shown as is.
+ */
+func tone(b byte) float64 {
+  switch b {
+    case Dark:
+      return 0x20
+    case Light:
+      return 0xe0
+  }
+  return float64(b)
+}
+
+/**
+ * A coarser spiral covering the same area, with about two turns and two
+ * bytes per pixel of a size x size preview instead of thousands. Returns the
+ * number of samples of g which each sample stands for.
+ */
+func fast_geometry(g Geometry, size int) (Geometry, int) {
+  pixel := 2 * Disc_radius / float64(size)
+  k := max(1, int(pixel / 2 / float64(g.track_pitch)))
+  j := max(1, int(pixel / 2 / float64(g.sample_length() / 4)))
+  g.track_pitch *= Length(k)
+  g.linear_speed *= Speed(j)
+  g.samples = max(1, g.samples / Duration(k * j))
+  return g, k * j
+}
+
+/**
+ * Creates a pattern for a fast preview, laid out on the coarser spiral. The
+ * intro and the protected ranges hold audio, which the coarser spiral can't,
+ * they are left out.
+ */
+func fast_pattern(pattern Pattern, o *Pattern_options, g Geometry, size int) (*bytes.Buffer, Geometry, error) {
+  if err := g.validate(); err != nil {
+    return nil, g, err
+  }
+  coarse, factor := fast_geometry(g, size)
+  fast := *o
+  fast.fill_to = Duration(int(o.fill_to) / factor)
+  if fast.intro != "" || fast.silent_intro > 0 || len(fast.protect) > 0 {
+    logger.warnf("fast preview: leaving out the intro and protected ranges")
+    fast.intro, fast.silent_intro, fast.protect = "", 0, nil
+  }
+  logger.debugf("fast preview: one sample for %d, %d samples", factor, coarse.samples)
+  buf, _, err := compose(pattern, &fast, coarse)
+  return buf, coarse, err
+}
+
+func write_png(filename string, img image.Image) error {
+  buf := bytes.Buffer{}
+  if err := png.Encode(&buf, img); err != nil {
+    return err
+  }
+  return write_output(filename, buf.Bytes())
+}
+
+func preview_command(fs *flag.FlagSet) func() int {
+  o := pattern_flags(fs)
+  g := geometry_flags(fs)
+  m := seed_flag(fs)
+  project := project_flag(fs)
+  output := fs.String("o", "preview.png", "output file, - for stdout")
+  size := fs.Int("size", 800, "width and height of the png, in pixels")
+  dye := dye_flag(fs)
+  light := light_flag(fs)
+  quality := fs.String("quality", "full", "full renders every byte, fast a coarser spiral in a fraction of the time, for quick iterations")
+  frames := fs.Int("frames", 0, "writes an animated gif of the disc being written along the spiral instead, in this many frames evenly spaced in time")
+  fs.Usage = pattern_usage(fs, "<pattern> | -project <file>")
+  return func() int {
+    pattern, err := pattern_argument(fs, *project, o.variables)
+    if err != nil {
+      logger.errorf("%s", err)
+      return Exit_usage
+    }
+    if pattern == "" || *size <= 0 || *frames < 0 {
+      fs.Usage()
+      return Exit_usage
+    }
+    d, err := find_dye(*dye)
+    if err != nil {
+      logger.errorf("%s", err)
+      return Exit_usage
+    }
+    l, err := parse_lighting(*light)
+    if err != nil {
+      logger.errorf("%s", err)
+      return Exit_usage
+    }
+    if (d != nil || l != Reflected_light) && *frames > 0 {
+      logger.errorf("-dye and -light don't apply to animations, which show the bytes as they are")
+      return Exit_usage
+    }
+
+    logger.infof("creating pattern: %s", pattern)
+    logger.infof("%s", g.describe())
+    m.reseed()
+    var buf *bytes.Buffer
+    layout := *g
+    switch *quality {
+      case "full":
+        buf, _, err = generate_pattern(pattern, o, *g)
+      case "fast":
+        buf, layout, err = fast_pattern(pattern, o, *g, *size)
+      default:
+        err = fmt.Errorf("unknown quality: %s, expecting full or fast", *quality)
+    }
+    if err != nil {
+      logger.errorf("%s", err)
+      return Exit_usage
+    }
+    if *frames > 0 {
+      logger.infof("%d frames, %s of writing each", *frames, o.output_geometry(*g).samples / Duration(*frames))
+      if err := write_gif(*output, animate(buf.Bytes()[Wav_header_size:], layout, *size, *frames)); err != nil {
+        logger.errorf("%s", err)
+        return Exit_failure
+      }
+      return 0
+    }
+    if err := write_png(*output, preview_image(buf.Bytes()[Wav_header_size:], layout, *size, d, l)); err != nil {
+      logger.errorf("%s", err)
+      return Exit_failure
+    }
+    return 0
+  }
+}
+
+func decode_command(fs *flag.FlagSet) func() int {
+  g := geometry_flags(fs)
+  output := fs.String("o", "decode.png", "output file, - for stdout")
+  size := fs.Int("size", 800, "width and height of the png, in pixels")
+  dye := dye_flag(fs)
+  light := light_flag(fs)
+  fs.Usage = func() {
+    fmt.Fprintf(fs.Output(), "usage: %s decode [options] <file.wav>\n\n", os.Args[0])
+    fmt.Fprintf(fs.Output(), "renders any CD audio wav file, e.g. a song, the way it would look burned.\n")
+    fmt.Fprintf(fs.Output(), "-duration is the file's own. The burn command burns such a file as is.\n\noptions:\n")
+    fs.PrintDefaults()
+  }
+  return func() int {
+    if fs.NArg() != 1 || *size <= 0 {
+      fs.Usage()
+      return Exit_usage
+    }
+    d, err := find_dye(*dye)
+    if err != nil {
+      logger.errorf("%s", err)
+      return Exit_usage
+    }
+    l, err := parse_lighting(*light)
+    if err != nil {
+      logger.errorf("%s", err)
+      return Exit_usage
+    }
+
+    data, err := read_wav(fs.Arg(0))
+    if err != nil {
+      logger.errorf("%s", err)
+      return Exit_failure
+    }
+    g.samples = Duration(len(data) / 4)
+    if err := g.validate(); err != nil {
+      logger.errorf("%s: %s", fs.Arg(0), err)
+      return Exit_failure
+    }
+    logger.infof("%s: %s, %s to %s", fs.Arg(0), g.samples, g.start_radius, g.end_radius())
+    if err := write_png(*output, preview_image(data, *g, *size, d, l)); err != nil {
+      logger.errorf("%s", err)
+      return Exit_failure
+    }
+    return 0
+  }
+}
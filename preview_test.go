@@ -0,0 +1,227 @@
+package main
+
+import (
+  "bytes"
+  "flag"
+  "fmt"
+  "image"
+  "image/png"
+  "math"
+  "os"
+  "path/filepath"
+  "testing"
+)
+
+/**
+ * Renders each pattern as a small png and compares it with the images in
+ * testdata/preview. Unlike the golden wav files, the comparison tolerates
+ * small differences: a change which moves a few bytes around passes, one
+ * which visibly breaks the geometry doesn't.
+ *
+ * Regenerate the images with:
+ *
+ *   go test *.go -run Preview -update
+ */
+const (
+  Preview_size = 200
+  // pixels are blurred before being compared, then at most Preview_changed
+  // of them may be off by more than Preview_threshold
+  Preview_threshold = 32
+  Preview_changed = 0.01
+)
+
+var preview_cases = []struct {
+  name string
+  pattern Pattern
+  args []string
+}{
+  {"pitch", Pitch, []string{}},
+  {"bands", Bands, []string{"-bands", "5"}},
+  {"pie", Pie, []string{}},
+  {"world", World, []string{"-marker", "37.77,-122.42"}},
+  {"world-mercator", World, []string{"-projection", "mercator"}},
+  {"spirograph", Spirograph, []string{"-gears", "105,30,20"}},
+  {"text", Text, []string{"-text", "PREVIEW 0123"}},
+}
+
+func read_png(filename string) (*image.Gray, error) {
+  f, err := os.Open(filename)
+  if err != nil {
+    return nil, err
+  }
+  defer f.Close()
+  img, err := png.Decode(f)
+  if err != nil {
+    return nil, err
+  }
+  gray, ok := img.(*image.Gray)
+  if !ok {
+    return nil, fmt.Errorf("%s: not a grayscale image", filename)
+  }
+  return gray, nil
+}
+
+/**
+ * 3x3 box blur, so that a line which moves by a pixel isn't a difference.
+ */
+func blur(img *image.Gray) []float64 {
+  size := img.Bounds().Dx()
+  r := make([]float64, size * size)
+  for y:=0; y<size; y++ {
+    for x:=0; x<size; x++ {
+      sum, n := 0.0, 0
+      for dy:=-1; dy<=1; dy++ {
+        for dx:=-1; dx<=1; dx++ {
+          if x + dx >= 0 && y + dy >= 0 && x + dx < size && y + dy < size {
+            sum += float64(img.Pix[(y + dy) * img.Stride + x + dx])
+            n++
+          }
+        }
+      }
+      r[y * size + x] = sum / float64(n)
+    }
+  }
+  return r
+}
+
+/**
+ * Returns the fraction of pixels which differ noticeably.
+ */
+func compare_previews(a *image.Gray, b *image.Gray) float64 {
+  if a.Bounds() != b.Bounds() {
+    return 1
+  }
+  ba, bb := blur(a), blur(b)
+  changed := 0
+  for i := range ba {
+    if math.Abs(ba[i] - bb[i]) > Preview_threshold {
+      changed++
+    }
+  }
+  return float64(changed) / float64(len(ba))
+}
+
+func TestPreview(t *testing.T) {
+  if testing.Short() {
+    t.Skip("rendering full previews is slow")
+  }
+  for _, c := range preview_cases {
+    t.Run(c.name, func(t *testing.T) {
+      // long enough for the program area to cover a few pixels
+      data := generate_test_pattern(t, c.pattern, append([]string{"-duration", "10m"}, c.args...))
+      fs := flag.NewFlagSet("", flag.ContinueOnError)
+      g := geometry_flags(fs)
+      fs.Parse([]string{"-duration", "10m"})
+      img := render(data[Wav_header_size:Wav_header_size + int(g.samples) * 4], *g, Preview_size)
+
+      filename := filepath.Join("testdata", "preview", c.name + ".png")
+      if *update {
+        buf := bytes.Buffer{}
+        if err := png.Encode(&buf, img); err != nil {
+          t.Fatal(err)
+        }
+        if err := os.WriteFile(filename, buf.Bytes(), 0644); err != nil {
+          t.Fatal(err)
+        }
+        return
+      }
+
+      golden, err := read_png(filename)
+      if err != nil {
+        t.Fatalf("%s (run with -update to create it)", err)
+      }
+      if changed := compare_previews(img, golden); changed > Preview_changed {
+        // kept around, to compare with the expected image
+        actual := filepath.Join(os.TempDir(), "micro-engraving-" + c.name + ".png")
+        buf := bytes.Buffer{}
+        png.Encode(&buf, img)
+        os.WriteFile(actual, buf.Bytes(), 0644)
+        t.Errorf("%.1f%% of the pixels changed, see %s", changed * 100, actual)
+      }
+    })
+  }
+}
+
+func TestRenderDye(t *testing.T) {
+  fs := flag.NewFlagSet("", flag.ContinueOnError)
+  g := geometry_flags(fs)
+  fs.Parse([]string{"-duration", "1m"})
+  data := bytes.Repeat([]byte{Dark}, int(g.samples) * 4)
+  d, err := find_dye("azo")
+  if err != nil {
+    t.Fatal(err)
+  }
+  img := render_dye(data, *g, Preview_size, d)
+  at := func(radius float64) [3]uint8 {
+    scale := float64(Preview_size) / (2 * Disc_radius)
+    c := img.RGBAAt(int((Disc_radius + radius) * scale), int(Disc_radius * scale))
+    return [3]uint8{c.R, c.G, c.B}
+  }
+  for _, c := range []struct {
+    radius float64
+    expected [3]uint8
+  }{
+    {float64(g.start_radius) + 0.3, [3]uint8{d.burned.R, d.burned.G, d.burned.B}},
+    {50, [3]uint8{d.unburned.R, d.unburned.G, d.unburned.B}},
+    {15, [3]uint8{polycarbonate.R, polycarbonate.G, polycarbonate.B}},
+  } {
+    if got := at(c.radius); got != c.expected {
+      t.Errorf("at %gmm: got %v, expected %v", c.radius, got, c.expected)
+    }
+  }
+  if _, err := find_dye("cyan"); err == nil {
+    t.Errorf("expected an error for an unknown dye")
+  }
+}
+
+/**
+ * Burned marks show lighter than the unburned dye against a light, the
+ * opposite of the reflected view.
+ */
+func TestRenderTransmitted(t *testing.T) {
+  fs := flag.NewFlagSet("", flag.ContinueOnError)
+  g := geometry_flags(fs)
+  fs.Parse([]string{"-duration", "1m"})
+  data := bytes.Repeat([]byte{Dark}, int(g.samples) * 4)
+  img := render_transmitted(data, *g, Preview_size, nil)
+  at := func(radius float64) uint8 {
+    scale := float64(Preview_size) / (2 * Disc_radius)
+    return img.RGBAAt(int((Disc_radius + radius) * scale), int(Disc_radius * scale)).G
+  }
+  burned, unburned, hub, hole := at(float64(g.start_radius) + 0.3), at(50), at(15), at(3)
+  if !(unburned < burned && burned < hub && hub < hole) {
+    t.Errorf("got unburned %d, burned %d, hub %d and hole %d, expecting them from the darkest to the lightest", unburned, burned, hub, hole)
+  }
+  if _, err := parse_lighting("backlit"); err == nil {
+    t.Errorf("expected an error for an unknown light")
+  }
+}
+
+/**
+ * Fast previews must look like the full ones, give or take the edges of the
+ * strokes.
+ */
+func TestFastPreview(t *testing.T) {
+  for _, c := range preview_cases {
+    t.Run(c.name, func(t *testing.T) {
+      fs := flag.NewFlagSet(c.name, flag.ContinueOnError)
+      o, g, m := design_flags(fs)
+      if err := fs.Parse(append([]string{"-duration", "10m"}, c.args...)); err != nil {
+        t.Fatal(err)
+      }
+      m.reseed()
+      buf, coarse, err := fast_pattern(c.pattern, o, *g, Preview_size)
+      if err != nil {
+        t.Fatal(err)
+      }
+      img := render(buf.Bytes()[Wav_header_size:], coarse, Preview_size)
+      golden, err := read_png(filepath.Join("testdata", "preview", c.name + ".png"))
+      if err != nil {
+        t.Fatal(err)
+      }
+      if changed := compare_previews(img, golden); changed > Preview_changed * 5 {
+        t.Errorf("%.1f%% of the pixels differ from the full preview", changed * 100)
+      }
+    })
+  }
+}
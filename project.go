@@ -0,0 +1,147 @@
+package main
+
+import (
+  _ "embed"
+  "errors"
+  "flag"
+  "fmt"
+  "os"
+  "strings"
+)
+
+/**
+ * A project file records a pattern along with its options, geometry and
+ * seed, e.g.:
+ *
+ *   {
+ *     "pattern": "world",
+ *     "options": {"projection": "mercator", "marker": "37.77,-122.42"},
+ *     "geometry": {"start_radius": "25mm", "duration": "21m"},
+ *     "seed": 1
+ *   }
+ *
+ * Keys are the names of the command line flags, with _ instead of -. The
+ * file is checked against project.schema.json before anything gets applied,
+ * so that a typo'd key is an error rather than a silently ignored setting.
+ *
+ * String values may use {{name}} placeholders. "variables" holds their
+ * default values, -var and batch columns override them.
+ *
+ * -project - reads the project from stdin, so that another program can
+ * pipe one in.
+ */
+//go:embed project.schema.json
+var project_schema string
+
+/**
+ * Loads a project file into the flags which weren't given on the command
+ * line, the command line wins. Returns the pattern to create.
+ */
+func load_project(fs *flag.FlagSet, filename string, v Variables) (Pattern, error) {
+  data, err := read_input(filename)
+  if errors.Is(err, os.ErrNotExist) {
+    data, err = read_template(filename, err)
+  }
+  if err != nil {
+    return "", err
+  }
+  pos := Position{filename: filename, data: data}
+  if filename == "-" {
+    pos.filename = "stdin"
+  }
+  root, err := parse_json(pos)
+  if err != nil {
+    return "", err
+  }
+  // placeholders get expanded first, so that the schema sees actual values
+  variables := Variables{}
+  if defaults, ok := root.values["variables"]; ok {
+    for _, name := range defaults.keys {
+      variables[name] = defaults.values[name].raw
+    }
+  }
+  for name, value := range v {
+    variables[name] = value
+  }
+  if err := expand_json(pos, root, variables); err != nil {
+    return "", err
+  }
+  if errs := validate_json(pos, root, load_schema(project_schema)); len(errs) > 0 {
+    for _, err := range errs[:len(errs)-1] {
+      logger.errorf("%s", err)
+    }
+    return "", errs[len(errs)-1]
+  }
+
+  explicit := map[string]bool{}
+  fs.Visit(func(f *flag.Flag) {
+    explicit[f.Name] = true
+  })
+  set := func(name string, n *Node) error {
+    name = strings.ReplaceAll(name, "_", "-")
+    if explicit[name] {
+      logger.debugf("%s: -%s given on the command line", pos.at(n.offset), name)
+      return nil
+    }
+    if err := fs.Set(name, n.raw); err != nil {
+      return pos.errorf(n.offset, "%s", err)
+    }
+    return nil
+  }
+
+  for _, section := range []string{"options", "geometry"} {
+    if s, ok := root.values[section]; ok {
+      for _, key := range s.keys {
+        if err := set(key, s.values[key]); err != nil {
+          return "", err
+        }
+      }
+    }
+  }
+  if seed, ok := root.values["seed"]; ok {
+    if err := set("seed", seed); err != nil {
+      return "", err
+    }
+  }
+  return Pattern(root.values["pattern"].raw), nil
+}
+
+/**
+ * Returns the pattern to create: either the command's argument or the one in
+ * the project file. Returns "" when the arguments don't make sense.
+ */
+func pattern_argument(fs *flag.FlagSet, project string, v Variables) (Pattern, error) {
+  if project == "" {
+    if fs.NArg() != 1 {
+      return "", nil
+    }
+    return Pattern(fs.Arg(0)), nil
+  }
+  if fs.NArg() != 0 {
+    return "", nil
+  }
+  return load_project(fs, project, v)
+}
+
+func project_flag(fs *flag.FlagSet) *string {
+  return fs.String("project", "", "project file to load the pattern and options from, - for stdin, see the schema command, or the name of a template, see the templates command")
+}
+
+func schema_command(fs *flag.FlagSet) func() int {
+  output := fs.String("o", "-", "output file, - for stdout")
+  fs.Usage = func() {
+    fmt.Fprintf(fs.Output(), "usage: %s schema [options]\n\noptions:\n", os.Args[0])
+    fs.PrintDefaults()
+  }
+  return func() int {
+    if fs.NArg() != 0 {
+      fs.Usage()
+      return Exit_usage
+    }
+    if err := write_output(*output, []byte(project_schema)); err != nil {
+      logger.errorf("%s", err)
+      return Exit_failure
+    }
+    return 0
+  }
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+  "bytes"
+  "fmt"
+  "strings"
+)
+
+/**
+ * Radius ranges the design must leave alone, e.g. to keep a spoken greeting
+ * playable in the middle of the artwork. Each range holds silence or an
+ * audio file, see read_audio, and is written after the pattern, the fill
+ * and the watermark so that none of them can draw over it.
+ *
+ * Set with -protect inner-outer[:file.wav], e.g. -protect 25mm-27mm:hello.wav.
+ * Ranges are separated by commas, the flag may also be repeated. Implements
+ * flag.Value.
+ */
+type Protected_range struct {
+  inner Length
+  outer Length
+  audio string
+}
+
+type Protected []Protected_range
+
+func (p *Protected) Set(s string) error {
+  for _, part := range strings.Split(s, ",") {
+    radii, audio, _ := strings.Cut(strings.TrimSpace(part), ":")
+    from, to, ok := strings.Cut(radii, "-")
+    var inner, outer Length
+    if !ok || inner.Set(from) != nil || outer.Set(to) != nil || inner >= outer {
+      return fmt.Errorf("invalid protected range: %q, expecting inner-outer[:file.wav], e.g. 25mm-27mm", part)
+    }
+    *p = append(*p, Protected_range{inner, outer, audio})
+  }
+  return nil
+}
+
+func (p Protected) String() string {
+  r := []string{}
+  for _, x := range p {
+    s := x.inner.String() + "-" + x.outer.String()
+    if x.audio != "" {
+      s += ":" + x.audio
+    }
+    r = append(r, s)
+  }
+  return strings.Join(r, ",")
+}
+
+/**
+ * Returns the samples of the rings which lie within the range, as first and
+ * end (excluded).
+ */
+func (x Protected_range) samples(g Geometry) (int, int) {
+  first, end := -1, -1
+  for _, ring := range g.rings(g.samples) {
+    if ring.radius >= x.inner && ring.radius < x.outer {
+      if first < 0 {
+        first = ring.start
+      }
+      end = ring.start + ring.samples
+    }
+  }
+  if first < 0 {
+    return 0, 0
+  }
+  return first, end
+}
+
+/**
+ * Writes the protected ranges over a wav file holding a whole design.
+ */
+func protect(buf *bytes.Buffer, p Protected, g Geometry) error {
+  samples := buf.Bytes()[Wav_header_size:]
+  for _, x := range p {
+    first, end := x.samples(g)
+    if first == end {
+      return fmt.Errorf("protected range %s-%s is outside of the program area, which ends at %s", x.inner, x.outer, g.end_radius())
+    }
+    var audio []byte
+    if x.audio != "" {
+      var err error
+      if audio, err = read_audio(x.audio); err != nil {
+        return err
+      }
+      if len(audio) > (end - first) * 4 {
+        return fmt.Errorf("%s lasts %.1fs, protected range %s-%s only holds %.1fs", x.audio, float64(len(audio) / 4) / float64(Sample_rate), x.inner, x.outer, float64(end - first) / float64(Sample_rate))
+      }
+    }
+    region := samples[first * 4:end * 4]
+    clear(region)
+    copy(region, audio)
+    logger.infof("protected %s-%s: samples %d to %d, %.1fs of audio", x.inner, x.outer, first, end, float64(len(audio) / 4) / float64(Sample_rate))
+  }
+  return nil
+}
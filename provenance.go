@@ -0,0 +1,91 @@
+package main
+
+import (
+  "bytes"
+  "fmt"
+  "math"
+  "time"
+)
+
+/**
+ * A line of text just outside the hub, past the signature ring if any, which
+ * tells when a disc was generated, by which version, and the first bytes of
+ * the hash of its design, the one -signature design writes: enough for a disc
+ * found years later to identify itself, with a magnifier and without any
+ * software. The text is dark on light, over whatever the design has there.
+ */
+const (
+  Provenance_height = 0.8 // in mm, of the capital letters
+  Provenance_digest = 4 // bytes of the design's hash
+)
+
+func provenance_text(pattern Pattern, o *Pattern_options, g Geometry, now time.Time) (string, error) {
+  digest, err := signature_value("design", pattern, o, g)
+  if err != nil {
+    return "", err
+  }
+  return fmt.Sprintf("%s %s %s %x", now.Format("2006-01-02 15:04"), version, pattern, digest[:Provenance_digest]), nil
+}
+
+/**
+ * Stamps the provenance line, from radius inner outwards, centered on the
+ * top.
+ */
+func stamp_provenance(samples []byte, text string, g Geometry, inner Length) error {
+  outer := inner + Provenance_height * 1.6
+  if outer > g.end_radius() {
+    return fmt.Errorf("provenance: the program area ends at %s, the line needs up to %s", g.end_radius(), outer)
+  }
+  scale := Provenance_height / Glyph_height
+  baseline := float64(inner + Provenance_height * 0.3)
+  runes := []rune(text)
+  length := line_length(len(runes), scale)
+  if length / baseline > 2 * math.Pi {
+    return fmt.Errorf("provenance: %q doesn't fit on a single turn at %s", text, Length(baseline))
+  }
+  c := new_canvas(Disc_radius, Canvas_resolution)
+  offsets := make([]float64, len(runes))
+  for i := range runes {
+    offsets[i] = Glyph_advance * float64(i) * scale
+  }
+  draw_line(c, runes, offsets, baseline, math.Pi / 2 + length / 2 / baseline, scale, scale)
+
+  for _, ring := range g.rings(Duration(len(samples) / 4)) {
+    if ring.radius < inner || ring.radius >= outer {
+      continue
+    }
+    radius, angle := float64(ring.radius), float64(ring.angle)
+    delta := float64(g.sample_length()) / 4 / radius
+    cos_d, sin_d := math.Cos(delta), math.Sin(delta)
+    x, y := radius * math.Cos(angle), radius * math.Sin(angle)
+    for i:=ring.start * 4; i<(ring.start + ring.samples) * 4; i++ {
+      samples[i] = Light
+      if c.at(x, y) > 0.5 {
+        samples[i] = Dark
+      }
+      x, y = x * cos_d - y * sin_d, x * sin_d + y * cos_d
+    }
+  }
+  return nil
+}
+
+/**
+ * Stamps the provenance line, if asked for, at the start of the design, past
+ * the signature ring when there is one. disc is the geometry of the whole
+ * output.
+ */
+func provenance(buf *bytes.Buffer, enabled bool, pattern Pattern, o *Pattern_options, g Geometry, disc Geometry) error {
+  if !enabled {
+    return nil
+  }
+  text, err := provenance_text(pattern, o, disc, time.Now())
+  if err != nil {
+    return err
+  }
+  inner := g.visible_radius()
+  if o.signature != "" {
+    inner += Signature_width
+  }
+  logger.infof("provenance: %q, at %s", text, inner)
+  return stamp_provenance(buf.Bytes()[Wav_header_size:], text, disc, inner)
+}
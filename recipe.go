@@ -0,0 +1,294 @@
+package main
+
+import (
+  "crypto/sha256"
+  "encoding/json"
+  "flag"
+  "fmt"
+  "os"
+  "path/filepath"
+  "sort"
+  "strings"
+)
+
+/**
+ * A recipe is everything a run of generate used, in one file to share: the
+ * value of every design option, defaults and what a project or template set
+ * included, the seed, and the files the options name, e.g. a drawing or a
+ * payload. recipe import recreates the run from it, byte for byte when both
+ * ends run the same version.
+ *
+ * Keys are the names of the command line flags, with _ instead of -, as in
+ * project files.
+ */
+type Recipe struct {
+  Version string `json:"version"`
+  Pattern Pattern `json:"pattern"`
+  Options map[string]string `json:"options"`
+  Geometry map[string]string `json:"geometry"`
+  Variables map[string]string `json:"variables,omitempty"`
+  Seed int64 `json:"seed"`
+  Files map[string]Recipe_file `json:"files,omitempty"` // by the name the options use
+}
+
+type Recipe_file struct {
+  Sha256 string `json:"sha256"`
+  Data []byte `json:"data"` // base64 in the file
+}
+
+/**
+ * Options which name a file, the ones a recipe carries along.
+ */
+var recipe_file_options = []string{"drawing", "payload", "watermark-image", "intro", "contrast", "signature", "stack", "protect"}
+
+/**
+ * The files an option's value names. protect names one per range, signature
+ * names one unless it's the design's.
+ */
+func option_files(name string, value string) []string {
+  named := false
+  for _, n := range recipe_file_options {
+    named = named || n == name
+  }
+  switch {
+    case !named || value == "":
+      return nil
+    case name == "signature" && value == "design":
+      return nil
+    case name == "protect":
+      var p Protected
+      p.Set(value)
+      r := []string{}
+      for _, x := range p {
+        if x.audio != "" {
+          r = append(r, x.audio)
+        }
+      }
+      return r
+  }
+  return []string{value}
+}
+
+func export_recipe(fs *flag.FlagSet, pattern Pattern, o *Pattern_options, seed int64) (Recipe, error) {
+  r := Recipe{
+    Version: version,
+    Pattern: pattern,
+    Options: map[string]string{},
+    Geometry: map[string]string{},
+    Variables: o.variables,
+    Seed: seed,
+    Files: map[string]Recipe_file{},
+  }
+  geometry := flag.NewFlagSet("", flag.ContinueOnError)
+  geometry_flags(geometry)
+  design := flag.NewFlagSet("", flag.ContinueOnError)
+  design_flags(design)
+  var err error
+  design.VisitAll(func(f *flag.Flag) {
+    if f.Name == "var" || f.Name == "seed" || f.Name == "no-cache" || err != nil {
+      return
+    }
+    value := fs.Lookup(f.Name).Value.String()
+    key := strings.ReplaceAll(f.Name, "-", "_")
+    if geometry.Lookup(f.Name) != nil {
+      r.Geometry[key] = value
+      return
+    }
+    r.Options[key] = value
+    for _, name := range option_files(f.Name, value) {
+      data, e := read_asset(name)
+      if e != nil {
+        err = fmt.Errorf("-%s: %s", f.Name, e)
+        return
+      }
+      r.Files[name] = Recipe_file{fmt.Sprintf("%x", sha256.Sum256(data)), data}
+    }
+  })
+  return r, err
+}
+
+/**
+ * Sets the flags from the recipe. Its files get written to dir, the options
+ * which named them name the copies instead.
+ */
+func import_recipe(fs *flag.FlagSet, r Recipe, dir string) error {
+  copies := map[string]string{}
+  names := []string{}
+  for name := range r.Files {
+    names = append(names, name)
+  }
+  sort.Strings(names)
+  for i, name := range names {
+    f := r.Files[name]
+    if fmt.Sprintf("%x", sha256.Sum256(f.Data)) != f.Sha256 {
+      return fmt.Errorf("%s: the recipe's copy is corrupted", name)
+    }
+    copies[name] = filepath.Join(dir, fmt.Sprintf("%d-%s", i + 1, filepath.Base(name)))
+    if err := os.WriteFile(copies[name], f.Data, 0644); err != nil {
+      return err
+    }
+  }
+
+  for _, section := range []map[string]string{r.Options, r.Geometry} {
+    keys := []string{}
+    for key := range section {
+      keys = append(keys, key)
+    }
+    sort.Strings(keys)
+    for _, key := range keys {
+      name, value := strings.ReplaceAll(key, "_", "-"), section[key]
+      f := fs.Lookup(name)
+      if f == nil {
+        return fmt.Errorf("unknown option: %s, the recipe may come from a newer version", key)
+      }
+      if value == f.DefValue {
+        // e.g. an empty -protect, which doesn't parse
+        continue
+      }
+      for _, file := range option_files(name, value) {
+        copy, ok := copies[file]
+        if !ok {
+          return fmt.Errorf("-%s: %s is missing from the recipe", name, file)
+        }
+        value = strings.Replace(value, file, copy, 1)
+      }
+      if err := fs.Set(name, value); err != nil {
+        return fmt.Errorf("-%s: %s", name, err)
+      }
+    }
+  }
+  for name, value := range r.Variables {
+    fs.Set("var", name + "=" + value)
+  }
+  return fs.Set("seed", fmt.Sprint(r.Seed))
+}
+
+func recipe_export_command(fs *flag.FlagSet) func() int {
+  o, _, m := design_flags(fs)
+  project := project_flag(fs)
+  output := fs.String("o", "-", "output file, - for stdout")
+  fs.Usage = pattern_usage(fs, "<pattern> | -project <file>")
+  return func() int {
+    pattern, err := pattern_argument(fs, *project, o.variables)
+    if err != nil {
+      logger.errorf("%s", err)
+      return Exit_usage
+    }
+    if pattern == "" {
+      fs.Usage()
+      return Exit_usage
+    }
+    r, err := export_recipe(fs, pattern, o, m.seed)
+    if err != nil {
+      logger.errorf("%s", err)
+      return Exit_failure
+    }
+    data, err := json.MarshalIndent(r, "", "  ")
+    if err != nil {
+      logger.errorf("%s", err)
+      return Exit_failure
+    }
+    logger.infof("%s, %d option(s), %d file(s)", pattern, len(r.Options) + len(r.Geometry), len(r.Files))
+    if err := write_output(*output, append(data, '\n')); err != nil {
+      logger.errorf("%s", err)
+      return Exit_failure
+    }
+    return 0
+  }
+}
+
+func recipe_import_command(fs *flag.FlagSet) func() int {
+  o, g, m := design_flags(fs)
+  output := fs.String("o", "-", "output file, - for stdout")
+  fs.Usage = func() {
+    fmt.Fprintf(fs.Output(), "usage: %s recipe import [options] <recipe.json>\n\n", os.Args[0])
+    fmt.Fprintf(fs.Output(), "generates the wav file a recipe describes.\n\noptions:\n")
+    fs.PrintDefaults()
+  }
+  return func() int {
+    if fs.NArg() != 1 {
+      fs.Usage()
+      return Exit_usage
+    }
+    data, err := read_input(fs.Arg(0))
+    if err != nil {
+      logger.errorf("%s", err)
+      return Exit_failure
+    }
+    r := Recipe{}
+    if err := json.Unmarshal(data, &r); err != nil {
+      logger.errorf("%s: %s", fs.Arg(0), err)
+      return Exit_failure
+    }
+    if r.Version != version {
+      logger.warnf("%s comes from micro-engraving %s, this is %s: the output may differ", fs.Arg(0), r.Version, version)
+    }
+    dir, err := os.MkdirTemp("", "micro-engraving")
+    if err != nil {
+      logger.errorf("%s", err)
+      return Exit_failure
+    }
+    defer os.RemoveAll(dir)
+    if err := import_recipe(fs, r, dir); err != nil {
+      logger.errorf("%s: %s", fs.Arg(0), err)
+      return Exit_failure
+    }
+
+    logger.infof("creating pattern: %s", r.Pattern)
+    logger.infof("%s", g.describe())
+    m.reseed()
+    buf, _, err := generate_pattern(r.Pattern, o, *g)
+    if err != nil {
+      logger.errorf("%s", err)
+      return Exit_failure
+    }
+    if err := check_length(buf, o.output_geometry(*g).samples); err != nil {
+      logger.errorf("%s", err)
+      return Exit_failure
+    }
+    stamp(buf, *m)
+    if err := write_output(*output, buf.Bytes()); err != nil {
+      logger.errorf("%s", err)
+      return Exit_failure
+    }
+    return 0
+  }
+}
+
+var recipe_commands = []Command{
+  {"export", "writes the recipe of a design, with every option and the files they name", Pattern_argument, recipe_export_command},
+  {"import", "generates the wav file a recipe describes", File_argument, recipe_import_command},
+}
+
+/**
+ * Dispatches to export or import, which have their own options.
+ */
+func recipe_command(fs *flag.FlagSet) func() int {
+  fs.Usage = func() {
+    fmt.Fprintf(fs.Output(), "usage: %s recipe <export | import> [options] ...\n\n", os.Args[0])
+    for _, c := range recipe_commands {
+      fmt.Fprintf(fs.Output(), "  %-8s %s\n", c.name, c.description)
+    }
+  }
+  return func() int {
+    if fs.NArg() == 0 {
+      fs.Usage()
+      return Exit_usage
+    }
+    for _, c := range recipe_commands {
+      if c.name == fs.Arg(0) {
+        sub := flag.NewFlagSet("recipe " + c.name, flag.ExitOnError)
+        apply_logging := logging_flags(sub)
+        run := c.setup(sub)
+        sub.Parse(fs.Args()[1:])
+        if err := apply_logging(); err != nil {
+          logger.errorf("%s", err)
+          return Exit_usage
+        }
+        return run()
+      }
+    }
+    logger.errorf("unknown recipe command: %s, expecting export or import", fs.Arg(0))
+    return Exit_usage
+  }
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+  "fmt"
+)
+
+/**
+ * Reed-Solomon codes over GF(256), the kind CDs use for CIRC: n bytes hold
+ * n - k data bytes followed by k parity bytes, and up to k/2 wrong bytes
+ * anywhere in the block get corrected. Blocks are at most 255 bytes long.
+ *
+ * Polynomials are lists of coefficients, highest degree first. The field is
+ * built from x^8 + x^4 + x^3 + x^2 + 1, α = 2, and the generator's roots are
+ * α^0 to α^(k-1).
+ */
+const Gf_polynomial = 0x11d
+
+var gf_exp [512]byte
+var gf_log [256]int
+
+func init() {
+  x := 1
+  for i:=0; i<255; i++ {
+    gf_exp[i] = byte(x)
+    gf_log[x] = i
+    x <<= 1
+    if x & 0x100 != 0 {
+      x ^= Gf_polynomial
+    }
+  }
+  // saves a modulo in gf_mul
+  for i:=255; i<512; i++ {
+    gf_exp[i] = gf_exp[i - 255]
+  }
+}
+
+func gf_mul(a byte, b byte) byte {
+  if a == 0 || b == 0 {
+    return 0
+  }
+  return gf_exp[gf_log[a] + gf_log[b]]
+}
+
+func gf_div(a byte, b byte) byte {
+  if a == 0 {
+    return 0
+  }
+  return gf_exp[(gf_log[a] + 255 - gf_log[b]) % 255]
+}
+
+func gf_pow(a byte, n int) byte {
+  return gf_exp[((gf_log[a] * n) % 255 + 255) % 255]
+}
+
+func gf_inverse(a byte) byte {
+  return gf_exp[255 - gf_log[a]]
+}
+
+func gf_poly_scale(p []byte, x byte) []byte {
+  r := make([]byte, len(p))
+  for i := range p {
+    r[i] = gf_mul(p[i], x)
+  }
+  return r
+}
+
+func gf_poly_add(p []byte, q []byte) []byte {
+  r := make([]byte, max(len(p), len(q)))
+  for i := range p {
+    r[i + len(r) - len(p)] = p[i]
+  }
+  for i := range q {
+    r[i + len(r) - len(q)] ^= q[i]
+  }
+  return r
+}
+
+func gf_poly_mul(p []byte, q []byte) []byte {
+  r := make([]byte, len(p) + len(q) - 1)
+  for j := range q {
+    for i := range p {
+      r[i + j] ^= gf_mul(p[i], q[j])
+    }
+  }
+  return r
+}
+
+func gf_poly_eval(p []byte, x byte) byte {
+  y := p[0]
+  for i:=1; i<len(p); i++ {
+    y = gf_mul(y, x) ^ p[i]
+  }
+  return y
+}
+
+/**
+ * Divides by a monic polynomial, returns the remainder.
+ */
+func gf_poly_mod(dividend []byte, divisor []byte) []byte {
+  r := append([]byte{}, dividend...)
+  for i:=0; i<len(dividend) - (len(divisor) - 1); i++ {
+    if c := r[i]; c != 0 {
+      for j:=1; j<len(divisor); j++ {
+        r[i + j] ^= gf_mul(divisor[j], c)
+      }
+    }
+  }
+  return r[len(r) - (len(divisor) - 1):]
+}
+
+func rs_generator(parity int) []byte {
+  g := []byte{1}
+  for i:=0; i<parity; i++ {
+    g = gf_poly_mul(g, []byte{1, gf_pow(2, i)})
+  }
+  return g
+}
+
+/**
+ * Returns the data followed by its parity bytes.
+ */
+func rs_encode(data []byte, parity int) []byte {
+  if len(data) + parity > 255 {
+    panic("Reed-Solomon blocks are at most 255 bytes long")
+  }
+  padded := append(append([]byte{}, data...), make([]byte, parity)...)
+  return append(append([]byte{}, data...), gf_poly_mod(padded, rs_generator(parity))...)
+}
+
+/**
+ * Corrects a block in place. Returns how many bytes were wrong, or an error
+ * when there are too many to correct.
+ */
+func rs_decode(block []byte, parity int) (int, error) {
+  // the syndromes are all 0 when the block is intact
+  syndromes := make([]byte, parity)
+  intact := true
+  for i := range syndromes {
+    syndromes[i] = gf_poly_eval(block, gf_pow(2, i))
+    intact = intact && syndromes[i] == 0
+  }
+  if intact {
+    return 0, nil
+  }
+
+  // Berlekamp-Massey finds the error locator, whose roots tell where the
+  // errors are
+  locator, old := []byte{1}, []byte{1}
+  for i:=0; i<parity; i++ {
+    delta := syndromes[i]
+    for j:=1; j<len(locator); j++ {
+      delta ^= gf_mul(locator[len(locator) - 1 - j], syndromes[i - j])
+    }
+    old = append(old, 0)
+    if delta != 0 {
+      if len(old) > len(locator) {
+        next := gf_poly_scale(old, delta)
+        old = gf_poly_scale(locator, gf_inverse(delta))
+        locator = next
+      }
+      locator = gf_poly_add(locator, gf_poly_scale(old, delta))
+    }
+  }
+  for len(locator) > 0 && locator[0] == 0 {
+    locator = locator[1:]
+  }
+  errors := len(locator) - 1
+  if errors * 2 > parity {
+    return 0, fmt.Errorf("too many errors to correct")
+  }
+
+  // Chien search: the roots of the locator, reversed
+  reversed := make([]byte, len(locator))
+  for i := range locator {
+    reversed[i] = locator[len(locator) - 1 - i]
+  }
+  positions := []int{}
+  for i:=0; i<len(block); i++ {
+    if gf_poly_eval(reversed, gf_pow(2, i)) == 0 {
+      positions = append(positions, len(block) - 1 - i)
+    }
+  }
+  if len(positions) != errors {
+    return 0, fmt.Errorf("too many errors to correct")
+  }
+
+  // Forney's algorithm gives the values of the errors
+  x := make([]byte, len(positions))
+  errata := []byte{1}
+  for i, p := range positions {
+    x[i] = gf_pow(2, len(block) - 1 - p)
+    errata = gf_poly_mul(errata, gf_poly_add([]byte{1}, []byte{x[i], 0}))
+  }
+  s := make([]byte, parity)
+  for i := range syndromes {
+    s[i] = syndromes[parity - 1 - i]
+  }
+  evaluator := gf_poly_mod(gf_poly_mul(s, errata), append([]byte{1}, make([]byte, len(errata))...))
+  for i, xi := range x {
+    inverse := gf_inverse(xi)
+    derivative := byte(1)
+    for j, xj := range x {
+      if j != i {
+        derivative = gf_mul(derivative, 1 ^ gf_mul(inverse, xj))
+      }
+    }
+    y := gf_poly_eval(evaluator, inverse)
+    if derivative == 0 {
+      return 0, fmt.Errorf("too many errors to correct")
+    }
+    block[positions[i]] ^= gf_div(y, derivative)
+  }
+  for i := range syndromes {
+    if gf_poly_eval(block, gf_pow(2, i)) != 0 {
+      return 0, fmt.Errorf("too many errors to correct")
+    }
+  }
+  return errors, nil
+}
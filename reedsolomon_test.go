@@ -0,0 +1,28 @@
+package main
+
+import (
+  "bytes"
+  "testing"
+)
+
+func TestReedSolomon(t *testing.T) {
+  data := []byte("every byte of this block can be wrong, up to half the parity")
+  block := rs_encode(data, 16)
+  for i:=0; i<8; i++ {
+    block[i * 7] ^= byte(0x55 + i)
+  }
+  n, err := rs_decode(block, 16)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if n != 8 || !bytes.Equal(block[:len(data)], data) {
+    t.Errorf("corrected %d bytes, got %q", n, block[:len(data)])
+  }
+  block[0] ^= 1
+  for i:=0; i<9; i++ {
+    block[i * 5 + 1] ^= 0xff
+  }
+  if _, err := rs_decode(block, 16); err == nil {
+    t.Errorf("10 errors corrected with 16 parity bytes")
+  }
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+  "bytes"
+  "encoding/base64"
+  "encoding/json"
+  "flag"
+  "fmt"
+  "html/template"
+  "image"
+  "image/png"
+  "os"
+  "path/filepath"
+  "sort"
+  "strings"
+)
+
+/**
+ * One blank in the comparison: the measurements of its calibration disc.
+ */
+type Medium struct {
+  Name string
+  Contrast Contrast
+  Reference float64 // contrast of the pair the patterns use
+  Best Pair_contrast
+  Contrast_rank int
+  Resolution_rank int
+  Thumbnail template.URL
+  Curve string // svg points of the mtf curve
+}
+
+/**
+ * Orders media by the sum of their contrast and resolution ranks, ties going
+ * to the one with the most contrast.
+ */
+func rank_media(media []*Medium) {
+  by := func(less func(a *Medium, b *Medium) bool, rank func(m *Medium, r int)) {
+    sort.SliceStable(media, func(i int, j int) bool {
+      return less(media[i], media[j])
+    })
+    for i, m := range media {
+      rank(m, i + 1)
+    }
+  }
+  by(func(a *Medium, b *Medium) bool { return a.Contrast.Mtf50 > b.Contrast.Mtf50 },
+    func(m *Medium, r int) { m.Resolution_rank = r })
+  by(func(a *Medium, b *Medium) bool { return a.Reference > b.Reference },
+    func(m *Medium, r int) { m.Contrast_rank = r })
+  sort.SliceStable(media, func(i int, j int) bool {
+    return media[i].Contrast_rank + media[i].Resolution_rank < media[j].Contrast_rank + media[j].Resolution_rank
+  })
+}
+
+/**
+ * Returns a small png of the disc, as a data url.
+ */
+func thumbnail(filename string, c Contrast, size int) template.URL {
+  img, _, err := read_image(filename)
+  if err != nil {
+    return ""
+  }
+  px_per_mm := c.Dpi / 25.4
+  t := image.NewGray(image.Rect(0, 0, size, size))
+  for y:=0; y<size; y++ {
+    for x:=0; x<size; x++ {
+      // nearest neighbour is good enough for a thumbnail
+      mx := c.Center[0] + (float64(x) / float64(size) * 2 - 1) * Disc_radius
+      my := c.Center[1] + (float64(y) / float64(size) * 2 - 1) * Disc_radius
+      p := image.Pt(int(mx * px_per_mm), int(my * px_per_mm))
+      if p.In(img.Bounds()) {
+        t.Pix[y * t.Stride + x] = img.GrayAt(p.X, p.Y).Y
+      }
+    }
+  }
+  buf := bytes.Buffer{}
+  png.Encode(&buf, t)
+  return template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()))
+}
+
+/**
+ * Plots the mtf against the spatial frequency, on a log scale.
+ */
+func mtf_curve(c Contrast, width float64, height float64) string {
+  points := []string{}
+  for i, chart := range c.Chart {
+    x := float64(i) / float64(max(1, len(c.Chart) - 1)) * width
+    y := (1 - min(max(chart.Mtf, 0), 1)) * height
+    points = append(points, fmt.Sprintf("%.1f,%.1f", x, y))
+  }
+  return strings.Join(points, " ")
+}
+
+var report_template = template.Must(template.New("report").Funcs(template.FuncMap{
+  "inc": func(i int) int { return i + 1 },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>micro-engraving media comparison</title>
+<style>
+  body { font-family: sans-serif; margin: 2em; }
+  table { border-collapse: collapse; }
+  td, th { padding: 0.3em 0.8em; border-bottom: 1px solid #ddd; text-align: right; }
+  td.name, th.name { text-align: left; }
+  svg { background: #f8f8f8; }
+</style>
+</head>
+<body>
+<h1>Media comparison</h1>
+<p>{{len .Media}} blanks, ranked by the sum of their contrast and resolution ranks. Contrast is the
+Michelson contrast of the {{.Dark}}/{{.Light}} pair used by every pattern, resolution is the spatial
+frequency at which the MTF drops to 50%.</p>
+<table>
+<tr><th>#</th><th class="name">medium</th><th>contrast</th><th>rank</th><th>MTF50 (lp/mm)</th><th>rank</th><th>best pair</th><th>MTF</th><th>disc</th></tr>
+{{range $i, $m := .Media}}
+<tr>
+  <td>{{inc $i}}</td>
+  <td class="name">{{$m.Name}}</td>
+  <td>{{printf "%.3f" $m.Reference}}</td>
+  <td>{{$m.Contrast_rank}}</td>
+  <td>{{printf "%.2f" $m.Contrast.Mtf50}}</td>
+  <td>{{$m.Resolution_rank}}</td>
+  <td>{{$m.Best.Dark}}/{{$m.Best.Light}}: {{printf "%.3f" $m.Best.Michelson}}</td>
+  <td><svg width="160" height="60"><polyline points="{{$m.Curve}}" fill="none" stroke="black"/><line x1="0" y1="30" x2="160" y2="30" stroke="#ccc"/></svg></td>
+  <td>{{if $m.Thumbnail}}<img src="{{$m.Thumbnail}}" width="120" height="120">{{end}}</td>
+</tr>
+{{end}}
+</table>
+<h2>Contrast of every pair</h2>
+<table>
+<tr><th class="name">medium</th>{{range (index .Media 0).Contrast.Pairs}}<th>{{.Dark}}/{{.Light}}</th>{{end}}</tr>
+{{range .Media}}
+<tr><td class="name">{{.Name}}</td>{{range .Contrast.Pairs}}<td>{{printf "%.3f" .Michelson}}</td>{{end}}</tr>
+{{end}}
+</table>
+</body>
+</html>
+`))
+
+func report_command(fs *flag.FlagSet) func() int {
+  measure := contrast_flags(fs)
+  output := fs.String("o", "report.html", "output file, - for stdout")
+  fs.Usage = func() {
+    fmt.Fprintf(fs.Output(), "usage: %s report [options] <name=scan.png>...\n\n", os.Args[0])
+    fmt.Fprintf(fs.Output(), "compares scans of the same calibration disc burned on different blanks. Each\n")
+    fmt.Fprintf(fs.Output(), "scan is either an image or the json output of the contrast command. Media are\n")
+    fmt.Fprintf(fs.Output(), "named after their file, unless given as name=file.\n\noptions:\n")
+    fs.PrintDefaults()
+  }
+  return func() int {
+    if fs.NArg() == 0 {
+      fs.Usage()
+      return Exit_usage
+    }
+
+    media := []*Medium{}
+    for _, arg := range fs.Args() {
+      name, filename, ok := strings.Cut(arg, "=")
+      if !ok {
+        filename = arg
+        name = strings.TrimSuffix(filepath.Base(arg), filepath.Ext(arg))
+      }
+      m := &Medium{Name: name}
+      if strings.EqualFold(filepath.Ext(filename), ".json") {
+        data, err := os.ReadFile(filename)
+        if err == nil {
+          err = json.Unmarshal(data, &m.Contrast)
+        }
+        if err != nil {
+          logger.errorf("%s: %s", filename, err)
+          return Exit_failure
+        }
+      } else {
+        var err error
+        if m.Contrast, err = measure(filename); err != nil {
+          logger.errorf("%s", err)
+          return Exit_failure
+        }
+        m.Thumbnail = thumbnail(filename, m.Contrast, 240)
+      }
+      if len(m.Contrast.Pairs) == 0 {
+        logger.errorf("%s: no measurements", filename)
+        return Exit_failure
+      }
+      m.Reference = m.Contrast.Pairs[0].Michelson
+      m.Best = m.Contrast.Pairs[0]
+      for _, p := range m.Contrast.Pairs {
+        if p.Michelson > m.Best.Michelson {
+          m.Best = p
+        }
+      }
+      m.Curve = mtf_curve(m.Contrast, 160, 60)
+      logger.infof("%s: contrast %.3f, mtf50 %.2f lp/mm", name, m.Reference, m.Contrast.Mtf50)
+      media = append(media, m)
+    }
+    rank_media(media)
+
+    buf := bytes.Buffer{}
+    err := report_template.Execute(&buf, map[string]interface{}{
+      "Media": media,
+      "Dark": fmt.Sprintf("0x%02x", Dark),
+      "Light": fmt.Sprintf("0x%02x", Light),
+    })
+    if err != nil {
+      logger.errorf("%s", err)
+      return Exit_failure
+    }
+    if err := write_output(*output, buf.Bytes()); err != nil {
+      logger.errorf("%s", err)
+      return Exit_failure
+    }
+    return 0
+  }
+}
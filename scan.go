@@ -0,0 +1,230 @@
+package main
+
+import (
+  "bytes"
+  "encoding/binary"
+  "flag"
+  "fmt"
+  "hash/crc32"
+  "image"
+  "image/draw"
+  _ "image/jpeg"
+  "image/png"
+  "math"
+  "os"
+  "os/exec"
+  "path/filepath"
+  "runtime"
+  "strconv"
+  "strings"
+)
+
+/**
+ * The disc goes in the top left corner of the glass, pushed against both
+ * edges, so that its center ends up at a known position. The scanned area is
+ * a little larger than the disc.
+ */
+const Scan_area = 125.0 // in mm
+
+const scan_guidance = `place the disc in the top left corner of the scanner:
+  - data side down, the label facing up
+  - pushed against both edges of the glass
+  - cover it with a sheet of black paper, the lid reflects too much light`
+
+type Scan_options struct {
+  device string
+  dpi int
+}
+
+/**
+ * A program which knows how to acquire an image from a flatbed scanner.
+ * Returns the command line and where the image ends up, "" for stdout. dir is
+ * a scratch directory.
+ */
+type Scanner struct {
+  name string
+  command func(dir string, o Scan_options) ([]string, string)
+}
+
+var scanners = []Scanner{
+  {"scanimage", scanimage_command},
+  {"scanline", scanline_command},
+}
+
+/**
+ * SANE, on Linux and anything else sane-backends runs on.
+ */
+func scanimage_command(dir string, o Scan_options) ([]string, string) {
+  cmd := []string{"scanimage", "--format=png", "--mode=Gray", "--resolution=" + strconv.Itoa(o.dpi),
+    "-l", "0", "-t", "0", "-x", strconv.Itoa(int(Scan_area)), "-y", strconv.Itoa(int(Scan_area))}
+  if o.device != "" {
+    cmd = append(cmd, "--device-name=" + o.device)
+  }
+  return cmd, ""
+}
+
+/**
+ * Mac OS X, through Image Capture (ICA). scanline is a small command line
+ * front end to it: https://github.com/klep/scanline
+ */
+func scanline_command(dir string, o Scan_options) ([]string, string) {
+  cmd := []string{"scanline", "-flatbed", "-jpeg", "-resolution", strconv.Itoa(o.dpi), "-dir", dir, "-name", "scan"}
+  if o.device != "" {
+    cmd = append(cmd, "-scanner", o.device)
+  }
+  return cmd, filepath.Join(dir, "scan.jpg")
+}
+
+func default_scanner() string {
+  if runtime.GOOS == "darwin" {
+    return "scanline"
+  }
+  return "scanimage"
+}
+
+/**
+ * Converts a scan to grayscale and crops it to the scanned area, some
+ * scanners always return the whole glass.
+ */
+func crop_scan(img image.Image, dpi int) *image.Gray {
+  size := int(math.Ceil(Scan_area / 25.4 * float64(dpi)))
+  r := img.Bounds()
+  r.Max.X = min(r.Max.X, r.Min.X + size)
+  r.Max.Y = min(r.Max.Y, r.Min.Y + size)
+  gray := image.NewGray(image.Rect(0, 0, r.Dx(), r.Dy()))
+  draw.Draw(gray, gray.Bounds(), img, r.Min, draw.Src)
+  return gray
+}
+
+/**
+ * Writes a png which records its resolution in a pHYs chunk, so that later
+ * commands know the scale of the image without being told.
+ */
+func write_png_dpi(filename string, img image.Image, dpi int) error {
+  buf := bytes.Buffer{}
+  if err := png.Encode(&buf, img); err != nil {
+    return err
+  }
+  data := buf.Bytes()
+  // 8 byte signature, followed by the IHDR chunk: length, type, 13 bytes, crc
+  ihdr := 8 + 4 + 4 + 13 + 4
+  chunk := bytes.Buffer{}
+  phys := make([]byte, 9)
+  ppm := uint32(math.Round(float64(dpi) / 0.0254))
+  binary.BigEndian.PutUint32(phys[0:4], ppm)
+  binary.BigEndian.PutUint32(phys[4:8], ppm)
+  phys[8] = 1 // pixels per meter
+  binary.Write(&chunk, binary.BigEndian, uint32(len(phys)))
+  chunk.WriteString("pHYs")
+  chunk.Write(phys)
+  binary.Write(&chunk, binary.BigEndian, crc32.ChecksumIEEE(append([]byte("pHYs"), phys...)))
+
+  out := append([]byte{}, data[:ihdr]...)
+  out = append(out, chunk.Bytes()...)
+  out = append(out, data[ihdr:]...)
+  return write_output(filename, out)
+}
+
+/**
+ * Returns the resolution recorded in a png's pHYs chunk, 0 if there isn't
+ * one.
+ */
+func png_dpi(data []byte) int {
+  for i:=8; i+8<=len(data); {
+    length := int(binary.BigEndian.Uint32(data[i:i+4]))
+    if string(data[i+4:i+8]) == "pHYs" && length == 9 && i + 17 <= len(data) && data[i+16] == 1 {
+      return int(math.Round(float64(binary.BigEndian.Uint32(data[i+8:i+12])) * 0.0254))
+    }
+    if string(data[i+4:i+8]) == "IDAT" {
+      break
+    }
+    i += 12 + length
+  }
+  return 0
+}
+
+func scan_command(fs *flag.FlagSet) func() int {
+  backend := fs.String("backend", default_scanner(), "program used to acquire the image")
+  o := Scan_options{}
+  fs.StringVar(&o.device, "device", "", "scanner to use, defaults to the backend's choice")
+  fs.IntVar(&o.dpi, "dpi", 1200, "resolution of the scan")
+  output := fs.String("o", "scan.png", "output file, - for stdout")
+  dry_run := fs.Bool("dry-run", false, "print the command instead of running it")
+  fs.Usage = func() {
+    names := []string{}
+    for _, s := range scanners {
+      names = append(names, s.name)
+    }
+    fmt.Fprintf(fs.Output(), "usage: %s scan [options]\n\n", os.Args[0])
+    fmt.Fprintf(fs.Output(), "acquires an image of a burned disc.\n\n%s\n\n", scan_guidance)
+    fmt.Fprintf(fs.Output(), "backends: %s\n\noptions:\n", strings.Join(names, ", "))
+    fs.PrintDefaults()
+  }
+  return func() int {
+    if fs.NArg() != 0 || o.dpi <= 0 {
+      fs.Usage()
+      return Exit_usage
+    }
+    var scanner *Scanner
+    for i := range scanners {
+      if scanners[i].name == *backend {
+        scanner = &scanners[i]
+      }
+    }
+    if scanner == nil {
+      logger.errorf("unknown backend: %s", *backend)
+      return Exit_usage
+    }
+
+    dir, err := os.MkdirTemp("", "micro-engraving")
+    if err != nil {
+      logger.errorf("%s", err)
+      return Exit_failure
+    }
+    defer os.RemoveAll(dir)
+
+    cmd, file := scanner.command(dir, o)
+    logger.infof("%s", strings.Join(cmd, " "))
+    if *dry_run {
+      return 0
+    }
+
+    logger.infof("%s", scan_guidance)
+    if stat, err := os.Stdin.Stat(); err == nil && stat.Mode() & os.ModeCharDevice != 0 {
+      fmt.Fprintf(os.Stderr, "press enter when ready...")
+      fmt.Scanln()
+    }
+
+    stdout := bytes.Buffer{}
+    c := exec.Command(cmd[0], cmd[1:]...)
+    c.Stdout = &stdout
+    c.Stderr = logger.writer(Level_info)
+    if file != "" {
+      c.Stdout = logger.writer(Level_info)
+    }
+    if err := c.Run(); err != nil {
+      logger.errorf("%s: %s", cmd[0], err)
+      return Exit_failure
+    }
+    data := stdout.Bytes()
+    if file != "" {
+      if data, err = os.ReadFile(file); err != nil {
+        logger.errorf("%s", err)
+        return Exit_failure
+      }
+    }
+    img, _, err := image.Decode(bytes.NewReader(data))
+    if err != nil {
+      logger.errorf("%s: %s", cmd[0], err)
+      return Exit_failure
+    }
+
+    gray := crop_scan(img, o.dpi)
+    logger.infof("scanned %dx%d pixels, %.1fum per pixel", gray.Bounds().Dx(), gray.Bounds().Dy(), 25400 / float64(o.dpi))
+    if err := write_png_dpi(*output, gray, o.dpi); err != nil {
+      logger.errorf("%s", err)
+      return Exit_failure
+    }
+    return 0
+  }
+}
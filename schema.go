@@ -0,0 +1,222 @@
+package main
+
+import (
+  "encoding/json"
+  "fmt"
+  "regexp"
+  "sort"
+  "strconv"
+  "strings"
+)
+
+/**
+ * Validates a document against a JSON Schema. Only the keywords used by the
+ * schemas in this repository are supported: $ref (within the document),
+ * type, enum, pattern, minimum, exclusiveMinimum, maximum, properties,
+ * additionalProperties, required, minProperties, maxProperties, items and
+ * minItems.
+ */
+type Validator struct {
+  pos Position
+  root map[string]interface{}
+  errors []error
+}
+
+func load_schema(data string) map[string]interface{} {
+  schema := map[string]interface{}{}
+  if err := json.Unmarshal([]byte(data), &schema); err != nil {
+    panic(err)
+  }
+  return schema
+}
+
+func validate_json(pos Position, n *Node, schema map[string]interface{}) []error {
+  v := &Validator{pos: pos, root: schema}
+  v.validate(n, schema, "")
+  return v.errors
+}
+
+func (v *Validator) fail(offset int, path string, format string, args ...interface{}) {
+  msg := fmt.Sprintf(format, args...)
+  if path != "" {
+    msg = path + ": " + msg
+  }
+  v.errors = append(v.errors, v.pos.errorf(offset, "%s", msg))
+}
+
+func (v *Validator) resolve(schema map[string]interface{}) map[string]interface{} {
+  ref, ok := schema["$ref"].(string)
+  if !ok {
+    return schema
+  }
+  r := interface{}(v.root)
+  for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+    r = r.(map[string]interface{})[part]
+  }
+  return v.resolve(r.(map[string]interface{}))
+}
+
+func json_type(n *Node) string {
+  if n.kind == "number" && !strings.ContainsAny(n.raw, ".eE") {
+    return "integer"
+  }
+  if n.kind == "bool" {
+    return "boolean"
+  }
+  return n.kind
+}
+
+func (v *Validator) validate(n *Node, schema map[string]interface{}, path string) {
+  schema = v.resolve(schema)
+
+  if t, ok := schema["type"].(string); ok {
+    actual := json_type(n)
+    if actual != t && !(t == "number" && actual == "integer") {
+      v.fail(n.offset, path, "expecting %s, got %s", article(t), article(actual))
+      return
+    }
+  }
+
+  if enum, ok := schema["enum"].([]interface{}); ok {
+    found := false
+    names := []string{}
+    for _, e := range enum {
+      names = append(names, fmt.Sprint(e))
+      if fmt.Sprint(e) == n.raw {
+        found = true
+      }
+    }
+    if !found {
+      v.fail(n.offset, path, "unknown value %q, expecting one of %s%s", n.raw, strings.Join(names, ", "), suggest(n.raw, names))
+      return
+    }
+  }
+
+  if pattern, ok := schema["pattern"].(string); ok && n.kind == "string" {
+    if !regexp.MustCompile(pattern).MatchString(n.raw) {
+      v.fail(n.offset, path, "invalid value %q%s", n.raw, describe(schema))
+    }
+  }
+
+  if n.kind == "number" {
+    f, _ := strconv.ParseFloat(n.raw, 64)
+    if min, ok := schema["minimum"].(float64); ok && f < min {
+      v.fail(n.offset, path, "%s is less than %g", n.raw, min)
+    }
+    if min, ok := schema["exclusiveMinimum"].(float64); ok && f <= min {
+      v.fail(n.offset, path, "%s must be greater than %g", n.raw, min)
+    }
+    if max, ok := schema["maximum"].(float64); ok && f > max {
+      v.fail(n.offset, path, "%s is greater than %g", n.raw, max)
+    }
+  }
+
+  if n.kind == "object" {
+    properties, _ := schema["properties"].(map[string]interface{})
+    names := []string{}
+    for name := range properties {
+      names = append(names, name)
+    }
+    sort.Strings(names)
+    for i, key := range n.keys {
+      child := join_path(path, key)
+      if p, ok := properties[key]; ok {
+        v.validate(n.values[key], p.(map[string]interface{}), child)
+        continue
+      }
+      switch additional := schema["additionalProperties"].(type) {
+        case bool:
+          if !additional {
+            v.fail(n.key_offsets[i], path, "unknown key %q%s", key, suggest(key, names))
+          }
+        case map[string]interface{}:
+          v.validate(n.values[key], additional, child)
+      }
+    }
+    if required, ok := schema["required"].([]interface{}); ok {
+      for _, r := range required {
+        if _, ok := n.values[r.(string)]; !ok {
+          v.fail(n.offset, path, "missing key %q", r)
+        }
+      }
+    }
+    if min, ok := schema["minProperties"].(float64); ok && len(n.keys) < int(min) {
+      v.fail(n.offset, path, "expecting at least %g key(s)%s", min, describe(schema))
+    }
+    if max, ok := schema["maxProperties"].(float64); ok && len(n.keys) > int(max) {
+      v.fail(n.offset, path, "expecting at most %g key(s)%s", max, describe(schema))
+    }
+  }
+
+  if n.kind == "array" {
+    if items, ok := schema["items"].(map[string]interface{}); ok {
+      for i, item := range n.items {
+        v.validate(item, items, fmt.Sprintf("%s[%d]", path, i))
+      }
+    }
+    if min, ok := schema["minItems"].(float64); ok && len(n.items) < int(min) {
+      v.fail(n.offset, path, "expecting at least %g item(s)", min)
+    }
+  }
+}
+
+func join_path(path string, key string) string {
+  if path == "" {
+    return key
+  }
+  return path + "." + key
+}
+
+func article(t string) string {
+  if strings.IndexByte("aeiou", t[0]) >= 0 {
+    return "an " + t
+  }
+  return "a " + t
+}
+
+/**
+ * Appends the schema's description to an error message, if there is one.
+ */
+func describe(schema map[string]interface{}) string {
+  if d, ok := schema["description"].(string); ok {
+    return " (" + d + ")"
+  }
+  return ""
+}
+
+/**
+ * Returns ", did you mean ...?" when one of the names is close enough to s.
+ */
+func suggest(s string, names []string) string {
+  best, distance := "", 3
+  for _, name := range names {
+    if d := levenshtein(s, name); d < distance {
+      best, distance = name, d
+    }
+  }
+  if best == "" {
+    return ""
+  }
+  return fmt.Sprintf(", did you mean %q?", best)
+}
+
+func levenshtein(a string, b string) int {
+  ra, rb := []rune(a), []rune(b)
+  previous := make([]int, len(rb) + 1)
+  for j := range previous {
+    previous[j] = j
+  }
+  for i:=1; i<=len(ra); i++ {
+    current := make([]int, len(rb) + 1)
+    current[0] = i
+    for j:=1; j<=len(rb); j++ {
+      cost := 1
+      if ra[i-1] == rb[j-1] {
+        cost = 0
+      }
+      current[j] = min(previous[j] + 1, current[j-1] + 1, previous[j-1] + cost)
+    }
+    previous = current
+  }
+  return previous[len(rb)]
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+  "flag"
+  "fmt"
+  "path/filepath"
+  "strings"
+)
+
+/**
+ * Raw sectors: 2352 bytes of audio followed by 96 bytes of subchannel, one
+ * byte per frame with the P to W bits from msb to lsb (cdrdao's RW_RAW,
+ * cdrecord's raw96r).
+ *
+ * The Q subchannel carries the track, index and time of each sector. Putting
+ * a track or index mark on the sector where a ring starts makes any ripper or
+ * drive report the ring boundaries, which gives a ground truth to check the
+ * physical layout against.
+ */
+const (
+  Sector_samples int = Sector_size / 4
+  Subchannel_size int = 96
+  Raw_sector_size int = Sector_size + Subchannel_size
+  Lead_in_sectors int = 150 // the 2 second pregap of track 1, absolute time starts there
+  Max_tracks int = 99
+  Max_indexes int = 99
+)
+
+type Marks string
+const (
+  Track_marks Marks = "tracks"
+  Index_marks Marks = "indexes"
+)
+
+type Sector_options struct {
+  marks string
+  every int
+}
+
+func sector_flags(fs *flag.FlagSet) *Sector_options {
+  o := &Sector_options{}
+  fs.StringVar(&o.marks, "marks", string(Track_marks), "what ring boundaries become in raw formats, tracks or indexes")
+  fs.IntVar(&o.every, "mark-every", 0, "mark one ring out of n, 0 for as many as the marks allow")
+  return o
+}
+
+/**
+ * A track or index boundary, on the sector holding the first sample of a
+ * ring. Rings rarely start on a sector boundary, offset is the sample within
+ * the sector.
+ */
+type Mark struct {
+  sector int
+  track int
+  index int
+  ring Ring
+  offset int
+}
+
+/**
+ * Places the marks. Tracks are numbered 1 to 99, indexes 1 to 99 within track
+ * 1. The Red Book wants tracks to last at least 4 seconds.
+ */
+func ring_marks(g Geometry, o Sector_options) ([]Mark, error) {
+  rings := g.rings(g.samples)
+  max_marks := Max_tracks
+  if Marks(o.marks) == Index_marks {
+    max_marks = Max_indexes
+  } else if Marks(o.marks) != Track_marks {
+    return nil, fmt.Errorf("unknown marks: %s, expecting %s or %s", o.marks, Track_marks, Index_marks)
+  }
+  every := o.every
+  if every <= 0 {
+    every = (len(rings) + max_marks - 1) / max_marks
+    if Marks(o.marks) == Track_marks && len(rings) > 0 {
+      // the innermost rings are the shortest
+      every = max(every, (Min_track_samples + Sector_size + rings[0].samples - 1) / rings[0].samples)
+    }
+  }
+  if n := (len(rings) + every - 1) / every; n > max_marks {
+    return nil, fmt.Errorf("%d rings, marking one out of %d needs %d %s, at most %d fit on a disc",
+      len(rings), every, n, o.marks, max_marks)
+  }
+
+  marks := []Mark{}
+  for i:=0; i<len(rings); i+=every {
+    r := rings[i]
+    m := Mark{sector: r.start / Sector_samples, track: 1, index: 1, ring: r, offset: r.start % Sector_samples}
+    if Marks(o.marks) == Track_marks {
+      m.track = len(marks) + 1
+    } else {
+      m.index = len(marks) + 1
+    }
+    if len(marks) > 0 && Marks(o.marks) == Track_marks && m.sector - marks[len(marks)-1].sector < Min_track_samples / Sector_samples {
+      return nil, fmt.Errorf("track %d would be shorter than %s, mark fewer rings", len(marks), Duration(Min_track_samples))
+    }
+    marks = append(marks, m)
+  }
+  return marks, nil
+}
+
+func bcd(n int) byte {
+  return byte(n / 10 << 4 | n % 10)
+}
+
+/**
+ * Minutes, seconds and frames (1/75th of a second) of a sector count.
+ */
+func msf(sectors int) (int, int, int) {
+  return sectors / (60 * 75), sectors / 75 % 60, sectors % 75
+}
+
+/**
+ * CRC-16 of the Q subchannel: polynomial x^16 + x^12 + x^5 + 1, stored
+ * inverted.
+ */
+func crc16(data []byte) uint16 {
+  crc := uint16(0)
+  for _, b := range data {
+    crc ^= uint16(b) << 8
+    for i:=0; i<8; i++ {
+      if crc & 0x8000 != 0 {
+        crc = crc << 1 ^ 0x1021
+      } else {
+        crc <<= 1
+      }
+    }
+  }
+  return ^crc
+}
+
+/**
+ * Mode 1 Q subchannel (ECMA-130, 22.3.3): two channel audio, current track,
+ * index, time within the track and absolute time.
+ */
+func q_subchannel(sector int, m Mark, track_start int) [12]byte {
+  q := [12]byte{}
+  q[0] = 0x01 // control 0: audio without pre-emphasis, adr 1: position
+  q[1] = bcd(m.track)
+  q[2] = bcd(m.index)
+  minutes, seconds, frames := msf(sector - track_start)
+  q[3], q[4], q[5] = bcd(minutes), bcd(seconds), bcd(frames)
+  minutes, seconds, frames = msf(sector + Lead_in_sectors)
+  q[7], q[8], q[9] = bcd(minutes), bcd(seconds), bcd(frames)
+  crc := crc16(q[0:10])
+  q[10], q[11] = byte(crc >> 8), byte(crc)
+  return q
+}
+
+/**
+ * Appends the subchannel to each sector of samples, the last sector padded
+ * with silence. The P channel, the pause flag, is raised during the 2
+ * seconds before each track but the first.
+ */
+func raw_sectors(samples []byte, marks []Mark) []byte {
+  sectors := (len(samples) + Sector_size - 1) / Sector_size
+  out := make([]byte, sectors * Raw_sector_size)
+  m := 0
+  track_start := 0
+  for s:=0; s<sectors; s++ {
+    copy(out[s * Raw_sector_size:s * Raw_sector_size + Sector_size], samples[min(s * Sector_size, len(samples)):min((s + 1) * Sector_size, len(samples))])
+    for m + 1 < len(marks) && marks[m + 1].sector <= s {
+      m++
+      if marks[m].index == 1 {
+        track_start = marks[m].sector
+      }
+    }
+    pause := false
+    for _, next := range marks[m+1:] {
+      if next.index == 1 {
+        pause = next.sector - s <= Lead_in_sectors
+        break
+      }
+    }
+    q := q_subchannel(s, marks[m], track_start)
+    sub := out[s * Raw_sector_size + Sector_size:(s + 1) * Raw_sector_size]
+    for i:=0; i<Subchannel_size; i++ {
+      if pause {
+        sub[i] |= 0x80
+      }
+      if q[i / 8] & (0x80 >> (i % 8)) != 0 {
+        sub[i] |= 0x40
+      }
+    }
+  }
+  return out
+}
+
+func format_msf(sectors int) string {
+  minutes, seconds, frames := msf(sectors)
+  return fmt.Sprintf("%02d:%02d:%02d", minutes, seconds, frames)
+}
+
+/**
+ * A cdrdao toc file for the raw sectors. cdrdao generates its own Q
+ * subchannel from the toc, which puts the marks on the same sectors.
+ */
+func raw_toc(filename string, sectors int, marks []Mark, m Metadata) string {
+  toc := strings.Builder{}
+  fmt.Fprintf(&toc, "CD_DA\n// micro-engraving %s, seed=%d\n", version, m.seed)
+  fmt.Fprintf(&toc, "// each mark is on the sector holding the first sample of a ring\n")
+  for i, mark := range marks {
+    if mark.index == 1 {
+      length := sectors - mark.sector
+      for _, next := range marks[i+1:] {
+        if next.index == 1 {
+          length = next.sector - mark.sector
+          break
+        }
+      }
+      fmt.Fprintf(&toc, "\nTRACK AUDIO RW_RAW\nNO COPY\n")
+      fmt.Fprintf(&toc, "// ring %d at %s, sample %d of the sector\n", mark.ring.index, mark.ring.radius, mark.offset)
+      fmt.Fprintf(&toc, "FILE %q %s %s\n", filename, format_msf(mark.sector), format_msf(length))
+      continue
+    }
+    track_start := 0
+    for _, previous := range marks[:i] {
+      if previous.index == 1 {
+        track_start = previous.sector
+      }
+    }
+    fmt.Fprintf(&toc, "INDEX %s // ring %d at %s, sample %d of the sector\n",
+      format_msf(mark.sector - track_start), mark.ring.index, mark.ring.radius, mark.offset)
+  }
+  return toc.String()
+}
+
+/**
+ * A track of an image, in sectors. indexes holds where index 2 and up start.
+ */
+type Disc_track struct {
+  number int
+  start int
+  end int
+  indexes []int
+}
+
+func disc_tracks(marks []Mark, sectors int) []Disc_track {
+  tracks := []Disc_track{}
+  for _, mark := range marks {
+    if mark.index == 1 {
+      if len(tracks) > 0 {
+        tracks[len(tracks)-1].end = mark.sector
+      }
+      tracks = append(tracks, Disc_track{mark.track, mark.sector, sectors, nil})
+    } else {
+      tracks[len(tracks)-1].indexes = append(tracks[len(tracks)-1].indexes, mark.sector)
+    }
+  }
+  return tracks
+}
+
+/**
+ * The sectors of a design, with their subchannel, and the marks they carry.
+ * The wav header and the chunks after the samples don't go on the disc.
+ */
+func raw_image(wav []byte, g Geometry, o Sector_options) ([]byte, []Mark, error) {
+  marks, err := ring_marks(g, o)
+  if err != nil {
+    return nil, nil, err
+  }
+  data := raw_sectors(wav[Wav_header_size:Wav_header_size + int(g.samples) * 4], marks)
+  logger.infof("%d sectors, %d %s", len(data) / Raw_sector_size, len(marks), o.marks)
+  return data, marks, nil
+}
+
+/**
+ * Replaces the extension of a file name, for the files which go along an
+ * image.
+ */
+func companion(filename string, extension string) string {
+  return strings.TrimSuffix(filename, filepath.Ext(filename)) + extension
+}
+
+/**
+ * Writes the raw sectors, with the toc next to them.
+ */
+func write_raw96(filename string, wav []byte, g Geometry, m Metadata, o Sector_options) error {
+  data, marks, err := raw_image(wav, g, o)
+  if err != nil {
+    return err
+  }
+  if err := write_output(filename, data); err != nil {
+    return err
+  }
+  if filename == "-" {
+    logger.warnf("writing to stdout, no toc file")
+    return nil
+  }
+  toc := raw_toc(filepath.Base(filename), len(data) / Raw_sector_size, marks, m)
+  return write_output(companion(filename, ".toc"), []byte(toc))
+}
+
+/**
+ * What generate writes: a wav file, or sectors ready for a raw burn, as is
+ * or in the image formats of Windows burning suites.
+ */
+type Format struct {
+  name string
+  description string
+  write func(filename string, wav []byte, g Geometry, m Metadata, o Sector_options) error
+}
+
+var formats = []Format{
+  {"wav", "16 bit stereo wav file", write_wav},
+  {"raw96", "raw sectors with P-W subchannel (2352+96 bytes) and a cdrdao toc", write_raw96},
+  {"nrg", "Nero image, raw sectors with subchannel", write_nrg},
+  {"mds", "Alcohol 120% image, an .mds descriptor and .mdf raw sectors with subchannel", write_mds},
+}
+
+func write_wav(filename string, wav []byte, g Geometry, m Metadata, o Sector_options) error {
+  return write_output(filename, wav)
+}
+
+func find_format(name string) (*Format, error) {
+  names := []string{}
+  for i := range formats {
+    if formats[i].name == name {
+      return &formats[i], nil
+    }
+    names = append(names, formats[i].name)
+  }
+  return nil, fmt.Errorf("unknown format: %s%s", name, suggest(name, names))
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+  "bytes"
+  "encoding/binary"
+  "flag"
+  "fmt"
+  "os"
+  "path/filepath"
+  "strings"
+)
+
+const (
+  Sector_size int = 2352 // bytes of audio per sector, i.e. 1/75th of a second
+  Min_track_samples int = 4 * Sample_rate // the Red Book's shortest track
+  Max_disc_samples int = 80 * 60 * Sample_rate // an 80 minute blank
+)
+
+/**
+ * Outcome of the checks performed on a file. Failures are files a burner
+ * would reject or mangle, warnings are files which burn but probably not the
+ * way they were meant to.
+ */
+type Report struct {
+  failures int
+  warnings int
+  lines []string
+}
+
+func (r *Report) check(ok bool, format string, v ...interface{}) bool {
+  status := "ok  "
+  if !ok {
+    status = "FAIL"
+    r.failures++
+  }
+  r.lines = append(r.lines, status + " " + fmt.Sprintf(format, v...))
+  return ok
+}
+
+func (r *Report) warn(format string, v ...interface{}) {
+  r.warnings++
+  r.lines = append(r.lines, "warn " + fmt.Sprintf(format, v...))
+}
+
+/**
+ * Checks a wav file: every chunk must fit in the file, the format must be CD
+ * audio and the samples must make a burnable track.
+ */
+func check_wav(data []byte, r *Report) (samples int) {
+  if !r.check(len(data) >= 12 && bytes.Equal(data[0:4], []byte("RIFF")) && bytes.Equal(data[8:12], []byte("WAVE")),
+    "RIFF/WAVE header") {
+    return 0
+  }
+  riff_length := int(binary.LittleEndian.Uint32(data[4:8]))
+  r.check(riff_length == len(data) - 8, "riff length: %d, file holds %d", riff_length, len(data) - 8)
+
+  found_fmt, found_data := false, false
+  for i:=12; i<len(data); {
+    if i + 8 > len(data) {
+      r.check(false, "%d trailing bytes at offset %d", len(data) - i, i)
+      break
+    }
+    id := string(data[i:i+4])
+    length := int(binary.LittleEndian.Uint32(data[i+4:i+8]))
+    if i + 8 + length > len(data) {
+      r.check(false, "%q chunk at offset %d: %d bytes, only %d left in the file", id, i, length, len(data) - i - 8)
+      break
+    }
+    chunk := data[i+8:i+8+length]
+    switch id {
+      case "fmt ":
+        found_fmt = true
+        if !r.check(length >= 16, "fmt chunk: %d bytes", length) {
+          break
+        }
+        format := binary.LittleEndian.Uint16(chunk[0:2])
+        channels := binary.LittleEndian.Uint16(chunk[2:4])
+        rate := binary.LittleEndian.Uint32(chunk[4:8])
+        byte_rate := binary.LittleEndian.Uint32(chunk[8:12])
+        align := binary.LittleEndian.Uint16(chunk[12:14])
+        bits := binary.LittleEndian.Uint16(chunk[14:16])
+        r.check(format == 1, "audio format: %d (pcm)", format)
+        r.check(channels == 2, "channels: %d", channels)
+        r.check(rate == uint32(Sample_rate), "sample rate: %d", rate)
+        r.check(bits == 16, "bits per sample: %d", bits)
+        r.check(byte_rate == 176400 && align == 4, "byte rate: %d, block align: %d", byte_rate, align)
+      case "data":
+        found_data = true
+        if i != Wav_header_size - 8 {
+          // fine when burning audio, e.g. a song from another program, a raw image would burn the chunks before
+          r.warn("data chunk at offset %d, after other chunks", i)
+        }
+        r.check(length % 4 == 0, "data chunk: %d bytes, a whole number of samples", length)
+        samples = length / 4
+      default:
+        r.lines = append(r.lines, fmt.Sprintf("     %q chunk: %d bytes, ignored", id, length))
+    }
+    // chunks are padded to an even length
+    i += 8 + length + length % 2
+  }
+  if !found_fmt {
+    r.check(false, "fmt chunk is missing")
+  }
+  if !found_data {
+    r.check(false, "data chunk is missing")
+  }
+  return samples
+}
+
+/**
+ * Checks the samples make a track a burner accepts as is.
+ */
+func check_samples(samples int, expected int, r *Report) {
+  r.check(samples >= Min_track_samples, "duration: %s (%d samples), at least %s", Duration(samples), samples, Duration(Min_track_samples))
+  r.check(samples <= Max_disc_samples, "duration: %s fits on an 80 minute blank", Duration(samples))
+  if expected > 0 {
+    r.check(samples == expected, "duration: %s, expecting %s", Duration(samples), Duration(expected))
+  }
+  if samples * 4 % Sector_size != 0 {
+    r.warn("%d bytes isn't a whole number of sectors, the burner will pad the last %d bytes",
+      samples * 4, Sector_size - samples * 4 % Sector_size)
+  }
+}
+
+/**
+ * Checks a wav file, or a raw .bin file (samples without any header).
+ */
+func selfcheck(filename string, expected int) (*Report, error) {
+  data, err := os.ReadFile(filename)
+  if err != nil {
+    return nil, err
+  }
+  r := &Report{}
+  samples := 0
+  if strings.EqualFold(filepath.Ext(filename), ".bin") {
+    r.check(len(data) % 4 == 0, "length: %d bytes", len(data))
+    samples = len(data) / 4
+  } else {
+    samples = check_wav(data, r)
+  }
+  check_samples(samples, expected, r)
+  return r, nil
+}
+
+func selfcheck_command(fs *flag.FlagSet) func() int {
+  var duration Duration
+  fs.Var(&duration, "duration", "expected duration, e.g. 21m. Not checked by default")
+  fs.Usage = func() {
+    fmt.Fprintf(fs.Output(), "usage: %s selfcheck [options] <file.wav|file.bin>\n\n", os.Args[0])
+    fmt.Fprintf(fs.Output(), "checks that a file is ready to be burned.\n\noptions:\n")
+    fs.PrintDefaults()
+  }
+  return func() int {
+    if fs.NArg() != 1 {
+      fs.Usage()
+      return Exit_usage
+    }
+    r, err := selfcheck(fs.Arg(0), int(duration))
+    if err != nil {
+      logger.errorf("%s", err)
+      return Exit_failure
+    }
+    for _, line := range r.lines {
+      fmt.Println(line)
+    }
+    if r.failures > 0 {
+      fmt.Printf("%s: FAIL, %d problem(s), %d warning(s)\n", fs.Arg(0), r.failures, r.warnings)
+      return Exit_failure
+    }
+    fmt.Printf("%s: pass, %d warning(s)\n", fs.Arg(0), r.warnings)
+    return 0
+  }
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+  "bytes"
+  "crypto/sha256"
+  "encoding/binary"
+  "encoding/hex"
+  "flag"
+  "fmt"
+  "hash/crc32"
+  "image"
+  "math"
+  "os"
+  "path/filepath"
+  "sort"
+  "strings"
+)
+
+/**
+ * A ring of dark and light cells just outside the hub, holding a hash of the
+ * design's parameters, or of a file, e.g. a certificate. It gives each disc
+ * an identity which the signature command reads back, from the wav file or
+ * from a scan or photo of the burned disc.
+ *
+ * The ring starts with a sync mark, four dark cells then four light ones,
+ * followed by 64 bits of sha256 and 16 bits of crc32 of those. Each bit is
+ * two cells, dark then light for a 1, light then dark for a 0: there are
+ * never more than two cells of the same tone in a row outside the sync
+ * mark, and the reader doesn't need a clock. Cells go clockwise from the
+ * top, seen from the data side.
+ */
+const (
+  Signature_bytes = 8
+  Signature_width = 1.5 // in mm, across the ring
+  Signature_sync = "DDDDLLLL"
+  Signature_cells = len(Signature_sync) + (Signature_bytes + 2) * 8 * 2
+  Signature_samples = 8 // per cell, when reading
+)
+
+/**
+ * Hashes what -signature names: "design" for the pattern and its options,
+ * or a file.
+ */
+func signature_value(s string, pattern Pattern, o *Pattern_options, g Geometry) ([]byte, error) {
+  var h [32]byte
+  if s == "design" {
+    p := *o
+    p.signature, p.no_cache = "", false
+    h = sha256.Sum256([]byte(fmt.Sprintf("%s|%+v|%s|%+v", pattern, p, o.inputs(), g)))
+  } else {
+    data, err := read_asset(s)
+    if err != nil {
+      return nil, fmt.Errorf("signature: %s", err)
+    }
+    h = sha256.Sum256(data)
+  }
+  return h[:Signature_bytes], nil
+}
+
+/**
+ * Returns the tones of the cells, true for dark.
+ */
+func signature_cells(value []byte) []bool {
+  data := binary.BigEndian.AppendUint16(append([]byte{}, value...), uint16(crc32.ChecksumIEEE(value)))
+  cells := []bool{}
+  for _, c := range Signature_sync {
+    cells = append(cells, c == 'D')
+  }
+  for _, b := range data {
+    for i:=7; i>=0; i-- {
+      bit := b >> i & 1 == 1
+      cells = append(cells, bit, !bit)
+    }
+  }
+  return cells
+}
+
+/**
+ * Angle of (x, y) clockwise from the top, between 0 and 2π.
+ */
+func clockwise_angle(x float64, y float64) float64 {
+  return math.Mod(math.Atan2(x, y) + 2 * math.Pi, 2 * math.Pi)
+}
+
+/**
+ * Writes the ring over the samples, from radius inner outwards. The ring is
+ * narrower when the program area doesn't go that far.
+ */
+func stamp_signature(samples []byte, cells []bool, g Geometry, inner Length) {
+  outer := inner + Signature_width
+  for _, ring := range g.rings(Duration(len(samples) / 4)) {
+    if ring.radius < inner || ring.radius >= outer {
+      continue
+    }
+    radius, angle := float64(ring.radius), float64(ring.angle)
+    delta := float64(g.sample_length()) / 4 / radius
+    cos_d, sin_d := math.Cos(delta), math.Sin(delta)
+    x, y := radius * math.Cos(angle), radius * math.Sin(angle)
+    for i:=ring.start * 4; i<(ring.start + ring.samples) * 4; i++ {
+      cell := int(clockwise_angle(x, y) / (2 * math.Pi) * float64(len(cells))) % len(cells)
+      samples[i] = Light
+      if cells[cell] {
+        samples[i] = Dark
+      }
+      x, y = x * cos_d - y * sin_d, x * sin_d + y * cos_d
+    }
+  }
+}
+
+/**
+ * Stamps the signature ring, if any, at the start of the design, which
+ * comes after the intro when there is one. disc is the geometry of the
+ * whole output.
+ */
+func signature(buf *bytes.Buffer, s string, pattern Pattern, o *Pattern_options, g Geometry, disc Geometry) error {
+  if s == "" {
+    return nil
+  }
+  value, err := signature_value(s, pattern, o, disc)
+  if err != nil {
+    return err
+  }
+  logger.infof("signature: %x, at %s", value, g.visible_radius())
+  stamp_signature(buf.Bytes()[Wav_header_size:], signature_cells(value), disc, g.visible_radius())
+  return nil
+}
+
+/**
+ * Tries to read a ring along the circle of the given radius, in mm. center
+ * is the center of the disc, in mm from the top left corner of the image.
+ * Both directions are tried, a photo may show the disc mirrored.
+ */
+func read_signature_at(img *image.Gray, center Point, px_per_mm float64, radius float64) ([]byte, bool) {
+  n := Signature_cells * Signature_samples
+  values := make([]float64, n)
+  b := img.Bounds()
+  for k:=0; k<n; k++ {
+    a := 2 * math.Pi * float64(k) / float64(n)
+    sum, count := 0.0, 0
+    // a few radii across the ring, to average out noise
+    for _, r := range []float64{radius - Signature_width / 4, radius, radius + Signature_width / 4} {
+      px := int((center.x + r * math.Sin(a)) * px_per_mm)
+      py := int((center.y - r * math.Cos(a)) * px_per_mm)
+      if image.Pt(px, py).In(b) {
+        sum += float64(img.GrayAt(px, py).Y)
+        count++
+      }
+    }
+    if count == 0 {
+      return nil, false
+    }
+    values[k] = sum / float64(count)
+  }
+  sorted := append([]float64{}, values...)
+  sort.Float64s(sorted)
+  threshold := sorted[n / 2]
+
+  expected := signature_cells(make([]byte, Signature_bytes))
+  for _, direction := range []int{1, -1} {
+    for offset:=0; offset<n; offset++ {
+      cells := make([]bool, Signature_cells)
+      for j := range cells {
+        // the middle half of the cell
+        sum := 0.0
+        for s:=Signature_samples/4; s<Signature_samples*3/4; s++ {
+          sum += values[((offset + direction * (j * Signature_samples + s)) % n + n) % n]
+        }
+        cells[j] = sum / float64(Signature_samples / 2) < threshold
+      }
+      ok := true
+      for j:=0; j<len(Signature_sync) && ok; j++ {
+        ok = cells[j] == expected[j]
+      }
+      for j:=len(Signature_sync); j<len(cells) && ok; j+=2 {
+        ok = cells[j] != cells[j+1]
+      }
+      if !ok {
+        continue
+      }
+      data := []byte{}
+      for j:=len(Signature_sync); j<len(cells); j+=16 {
+        v := byte(0)
+        for i:=0; i<16; i+=2 {
+          v <<= 1
+          if cells[j+i] {
+            v |= 1
+          }
+        }
+        data = append(data, v)
+      }
+      value := data[:Signature_bytes]
+      if binary.BigEndian.Uint16(data[Signature_bytes:]) == uint16(crc32.ChecksumIEEE(value)) {
+        return value, true
+      }
+    }
+  }
+  return nil, false
+}
+
+/**
+ * Looks for the ring between the two radii.
+ */
+func read_signature(img *image.Gray, center Point, px_per_mm float64, from float64, to float64) ([]byte, float64, error) {
+  for r:=from + Signature_width / 2; r<to; r+=Signature_width / 4 {
+    if value, ok := read_signature_at(img, center, px_per_mm, r); ok {
+      return value, r, nil
+    }
+  }
+  return nil, 0, fmt.Errorf("no signature found between %s and %s", Length(from), Length(to))
+}
+
+/**
+ * Registers the options needed to find the disc in a wav file or a scan.
+ * Returns the function which loads one: wav files are rendered, scans need
+ * their resolution and the position of the disc's center. Along with the
+ * image, returns the center, in mm from the top left corner, and the
+ * pixels per mm.
+ */
+func disc_image_flags(fs *flag.FlagSet, g *Geometry) func(filename string) (*image.Gray, Point, float64, error) {
+  dpi := fs.Float64("dpi", 0, "resolution of a scan, defaults to the one recorded by the scan command")
+  center := fs.String("center", fmt.Sprintf("%g,%g", Disc_radius, Disc_radius), "center of the disc in a scan, in mm from the top left corner of the image, as x,y")
+  return func(filename string) (*image.Gray, Point, float64, error) {
+    if strings.ToLower(filepath.Ext(filename)) == ".wav" {
+      data, err := read_wav(filename)
+      if err != nil {
+        return nil, Point{}, 0, err
+      }
+      size := int(2 * Disc_radius / Canvas_resolution)
+      return render(data, *g, size), Point{Disc_radius, Disc_radius}, float64(size) / (2 * Disc_radius), nil
+    }
+    c, err := parse_point(*center)
+    if err != nil {
+      return nil, Point{}, 0, err
+    }
+    img, recorded, err := read_image(filename)
+    if err != nil {
+      return nil, Point{}, 0, err
+    }
+    if *dpi != 0 {
+      recorded = *dpi
+    }
+    if recorded <= 0 {
+      return nil, Point{}, 0, fmt.Errorf("%s: unknown resolution, use -dpi", filename)
+    }
+    return img, c, recorded / 25.4, nil
+  }
+}
+
+func signature_command(fs *flag.FlagSet) func() int {
+  g := geometry_flags(fs)
+  load := disc_image_flags(fs, g)
+  expect := fs.String("expect", "", "signature the disc should have, in hex. Fails when it doesn't")
+  fs.Usage = func() {
+    fmt.Fprintf(fs.Output(), "usage: %s signature [options] <file.wav | scan.png>\n\n", os.Args[0])
+    fmt.Fprintf(fs.Output(), "reads the ring written by -signature. The geometry options must match the\n")
+    fmt.Fprintf(fs.Output(), "ones the disc was created with.\n\noptions:\n")
+    fs.PrintDefaults()
+  }
+  return func() int {
+    if fs.NArg() != 1 {
+      fs.Usage()
+      return Exit_usage
+    }
+    if err := g.validate(); err != nil {
+      logger.errorf("%s", err)
+      return Exit_usage
+    }
+    filename := fs.Arg(0)
+    img, c, px_per_mm, err := load(filename)
+    if err != nil {
+      logger.errorf("%s", err)
+      return Exit_failure
+    }
+
+    value, radius, err := read_signature(img, c, px_per_mm, float64(g.visible_radius()), float64(g.end_radius()))
+    if err != nil {
+      logger.errorf("%s: %s", filename, err)
+      return Exit_failure
+    }
+    logger.infof("ring at %s", Length(radius))
+    fmt.Printf("%x\n", value)
+    if *expect != "" {
+      want, err := hex.DecodeString(*expect)
+      if err != nil {
+        logger.errorf("invalid signature: %q, expecting hex", *expect)
+        return Exit_usage
+      }
+      if !bytes.Equal(want, value) {
+        logger.errorf("%s: signature %x, expecting %x", filename, value, want)
+        return Exit_failure
+      }
+    }
+    return 0
+  }
+}
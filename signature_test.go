@@ -0,0 +1,41 @@
+package main
+
+import (
+  "bytes"
+  "flag"
+  "image"
+  "testing"
+)
+
+/**
+ * Reads the signature ring back from a rendering of the disc, and from its
+ * mirror image, the way a photo of the disc may show it.
+ */
+func TestSignature(t *testing.T) {
+  args := []string{"-duration", "4m", "-signature", "design"}
+  data := generate_test_pattern(t, Pie, args)
+  fs := flag.NewFlagSet("", flag.ContinueOnError)
+  o, g, _ := design_flags(fs)
+  fs.Parse(args)
+  want, err := signature_value("design", Pie, o, *g)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  size := 2400
+  img := render(data[Wav_header_size:], *g, size)
+  mirror := image.NewGray(img.Bounds())
+  for y:=0; y<size; y++ {
+    for x:=0; x<size; x++ {
+      mirror.Pix[y * size + x] = img.Pix[y * size + size - 1 - x]
+    }
+  }
+  for name, img := range map[string]*image.Gray{"render": img, "mirror": mirror} {
+    got, _, err := read_signature(img, Point{Disc_radius, Disc_radius}, float64(size) / (2 * Disc_radius), float64(g.visible_radius()), float64(g.end_radius()))
+    if err != nil {
+      t.Errorf("%s: %s", name, err)
+    } else if !bytes.Equal(got, want) {
+      t.Errorf("%s: got %x, expecting %x", name, got, want)
+    }
+  }
+}
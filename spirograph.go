@@ -0,0 +1,88 @@
+package main
+
+import (
+  "bytes"
+  "fmt"
+  "math"
+  "strconv"
+  "strings"
+)
+
+/**
+ * A spirograph made of a fixed ring, a rolling gear and a pen hole. The gears
+ * are counted in teeth, the pen offset is in the same unit.
+ */
+type Gears struct {
+  fixed int
+  rolling int
+  pen float64
+}
+
+func default_gears() Gears {
+  return Gears{fixed: 96, rolling: 36, pen: 30}
+}
+
+/**
+ * Parses "fixed,rolling,pen". E.g. "96,36,30".
+ */
+func parse_gears(s string) (Gears, error) {
+  parts := strings.Split(s, ",")
+  if len(parts) != 3 {
+    return Gears{}, fmt.Errorf("expecting fixed,rolling,pen, got %q", s)
+  }
+  fixed, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+  if err != nil || fixed <= 0 {
+    return Gears{}, fmt.Errorf("invalid fixed gear: %q", parts[0])
+  }
+  rolling, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+  if err != nil || rolling <= 0 || rolling >= fixed {
+    return Gears{}, fmt.Errorf("invalid rolling gear: %q", parts[1])
+  }
+  pen, err := strconv.ParseFloat(strings.TrimSpace(parts[2]), 64)
+  if err != nil || pen < 0 {
+    return Gears{}, fmt.Errorf("invalid pen offset: %q", parts[2])
+  }
+  return Gears{fixed, rolling, pen}, nil
+}
+
+func gcd(a int, b int) int {
+  for b != 0 {
+    a, b = b, a % b
+  }
+  return a
+}
+
+/**
+ * Draws a hypotrochoid: the curve traced by a pen on a gear rolling inside a
+ * fixed ring. The curve has fixed/gcd(fixed, rolling) fold symmetry.
+ *
+ * The curve is stretched radially so that it fills the program area, the
+ * angles are left untouched.
+ */
+func spirograph(buf *bytes.Buffer, g Geometry, gears Gears, width float64, jitter bool) {
+  inner := float64(g.visible_radius()) + width / 2
+  outer := float64(g.end_radius()) - width / 2
+
+  R, r, d := float64(gears.fixed), float64(gears.rolling), gears.pen
+  min_r, max_r := math.Abs(R - r - d), R - r + d
+
+  // the pen is back where it started after rolling/gcd turns
+  turns := gears.rolling / gcd(gears.fixed, gears.rolling)
+  n := turns * 3600
+  points := []Point{}
+  for i:=0; i<=n; i++ {
+    t := 2 * math.Pi * float64(i) / 3600
+    x := (R - r) * math.Cos(t) + d * math.Cos((R - r) / r * t)
+    y := (R - r) * math.Sin(t) - d * math.Sin((R - r) / r * t)
+    radius := inner
+    if max_r > min_r {
+      radius += (math.Hypot(x, y) - min_r) / (max_r - min_r) * (outer - inner)
+    }
+    a := math.Atan2(y, x)
+    points = append(points, Point{radius * math.Cos(a), radius * math.Sin(a)})
+  }
+
+  c := new_canvas(Disc_radius, Canvas_resolution)
+  c.polyline(points, width)
+  engrave(buf, c, g, jitter)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+  "bytes"
+  "encoding/json"
+  "fmt"
+  "math"
+)
+
+/**
+ * Marks to align a stack of discs, e.g. the frames of an animation or the
+ * layers of a sculpture: notches at the same radii and angles on every
+ * disc, and an index mark which moves by a step from one disc to the next,
+ * so that a stack in the right order shows a staircase.
+ *
+ * Every disc of a set reads the same definition, -stack, rather than working
+ * the marks out from its own geometry, which differs from one disc to the
+ * next. E.g.:
+ *
+ *   {
+ *     "inner": "36mm",
+ *     "outer": "37.5mm",
+ *     "angles": [0, 120, 240],
+ *     "width": 3,
+ *     "index_from": 20,
+ *     "index_step": 4
+ *   }
+ *
+ * Angles are in degrees clockwise from the top, seen from the data side. The
+ * notches are width degrees wide across the whole band, the index mark of
+ * disc n sits at index_from + (n - 1) * index_step degrees, across the outer
+ * half of the band.
+ */
+type Stack struct {
+  Inner Length `json:"inner"`
+  Outer Length `json:"outer"`
+  Angles []float64 `json:"angles"`
+  Width float64 `json:"width"`
+  Index_from float64 `json:"index_from"`
+  Index_step float64 `json:"index_step"`
+}
+
+func read_stack(filename string) (Stack, error) {
+  s := Stack{Width: 2}
+  data, err := read_asset(filename)
+  if err != nil {
+    return s, err
+  }
+  if err := json.Unmarshal(data, &s); err != nil {
+    return s, fmt.Errorf("%s: %s", filename, err)
+  }
+  if s.Inner <= 0 || s.Outer <= s.Inner {
+    return s, fmt.Errorf("%s: invalid band, %s to %s", filename, s.Inner, s.Outer)
+  }
+  if len(s.Angles) == 0 {
+    return s, fmt.Errorf("%s: no angles, expecting at least one notch", filename)
+  }
+  return s, nil
+}
+
+/**
+ * Whether the angle a, in degrees, is within half a width of the mark's.
+ */
+func near_angle(a float64, mark float64, width float64) bool {
+  d := math.Mod(math.Abs(a - mark), 360)
+  return math.Min(d, 360 - d) <= width / 2
+}
+
+/**
+ * Stamps the notches and the index mark of disc index, 0 for none, over the
+ * samples. g is the geometry of the whole output, which must reach the band.
+ */
+func stack(buf *bytes.Buffer, filename string, index int, g Geometry) error {
+  if filename == "" {
+    return nil
+  }
+  s, err := read_stack(filename)
+  if err != nil {
+    return err
+  }
+  inner, outer := s.Inner, s.Outer
+  if inner < g.visible_radius() || outer > g.end_radius() {
+    return fmt.Errorf("the stack's marks, %s to %s, go past the program area, %s to %s", s.Inner, s.Outer, g.visible_radius(), g.end_radius())
+  }
+  index_at := s.Index_from + float64(index - 1) * s.Index_step
+  logger.infof("stack marks at %s to %s, index mark at %g degrees", s.Inner, s.Outer, index_at)
+
+  samples := buf.Bytes()[Wav_header_size:]
+  for _, ring := range g.rings(Duration(len(samples) / 4)) {
+    if ring.radius < inner || ring.radius >= outer {
+      continue
+    }
+    radius, angle := float64(ring.radius), float64(ring.angle)
+    delta := float64(g.sample_length()) / 4 / radius
+    cos_d, sin_d := math.Cos(delta), math.Sin(delta)
+    x, y := radius * math.Cos(angle), radius * math.Sin(angle)
+    for i:=ring.start * 4; i<(ring.start + ring.samples) * 4; i++ {
+      a := clockwise_angle(x, y) * 180 / math.Pi
+      mark := false
+      for _, notch := range s.Angles {
+        mark = mark || near_angle(a, notch, s.Width)
+      }
+      if index > 0 && ring.radius >= (inner + outer) / 2 && near_angle(a, index_at, s.Width) {
+        mark = true
+      }
+      if mark {
+        samples[i] = Dark
+      }
+      x, y = x * cos_d - y * sin_d, x * sin_d + y * cos_d
+    }
+  }
+  return nil
+}
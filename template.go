@@ -0,0 +1,87 @@
+package main
+
+import (
+  "fmt"
+  "regexp"
+  "sort"
+  "strings"
+)
+
+/**
+ * Values for the {{name}} placeholders found in text and project files. Set
+ * with -var name=value, or from the extra columns of a batch file. Implements
+ * flag.Value.
+ */
+type Variables map[string]string
+
+var variable_name = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+var placeholder = regexp.MustCompile(`\{\{\s*([^{}]*?)\s*\}\}`)
+
+func (v *Variables) Set(s string) error {
+  name, value, ok := strings.Cut(s, "=")
+  if !ok || !variable_name.MatchString(name) {
+    return fmt.Errorf("expecting name=value, got %q", s)
+  }
+  if *v == nil {
+    *v = Variables{}
+  }
+  (*v)[name] = value
+  return nil
+}
+
+func (v Variables) String() string {
+  r := []string{}
+  for name, value := range v {
+    r = append(r, name + "=" + value)
+  }
+  sort.Strings(r)
+  return strings.Join(r, ",")
+}
+
+/**
+ * Replaces every {{name}} in s. Using an undefined variable is an error,
+ * otherwise a typo would end up engraved.
+ */
+func expand(s string, v Variables) (string, error) {
+  var err error
+  r := placeholder.ReplaceAllStringFunc(s, func(m string) string {
+    name := placeholder.FindStringSubmatch(m)[1]
+    value, ok := v[name]
+    if !ok && err == nil {
+      names := []string{}
+      for n := range v {
+        names = append(names, n)
+      }
+      sort.Strings(names)
+      err = fmt.Errorf("undefined variable %q%s", name, suggest(name, names))
+    }
+    return value
+  })
+  return r, err
+}
+
+/**
+ * Expands the variables in every string value of a json document.
+ */
+func expand_json(pos Position, n *Node, v Variables) error {
+  var err error
+  switch n.kind {
+    case "string":
+      if n.raw, err = expand(n.raw, v); err != nil {
+        return pos.errorf(n.offset, "%s", err)
+      }
+    case "object":
+      for _, key := range n.keys {
+        if err := expand_json(pos, n.values[key], v); err != nil {
+          return err
+        }
+      }
+    case "array":
+      for _, item := range n.items {
+        if err := expand_json(pos, item, v); err != nil {
+          return err
+        }
+      }
+  }
+  return nil
+}
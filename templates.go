@@ -0,0 +1,112 @@
+package main
+
+import (
+  "embed"
+  "flag"
+  "fmt"
+  "os"
+  "path"
+  "sort"
+  "strings"
+)
+
+/**
+ * Built-in projects for common occasions, loaded with -project <name>. Their
+ * text comes from variables, e.g.:
+ *
+ *   micro-engraving generate -var names="Ann & Lee" -project wedding
+ *
+ * A variable without a default value has to be set.
+ */
+//go:embed templates/*.json
+var templates embed.FS
+
+func template_names() []string {
+  r := []string{}
+  entries, _ := templates.ReadDir("templates")
+  for _, e := range entries {
+    r = append(r, strings.TrimSuffix(e.Name(), ".json"))
+  }
+  sort.Strings(r)
+  return r
+}
+
+/**
+ * Returns the template called name, or err when there isn't any. err is the
+ * error opening the file called name, which is what the user most likely
+ * meant when there's no such template.
+ */
+func read_template(name string, err error) ([]byte, error) {
+  data, e := templates.ReadFile(path.Join("templates", name + ".json"))
+  if e != nil || strings.ContainsAny(name, "/\\.") {
+    return nil, fmt.Errorf("%s, and no template called %q%s", err, name, suggest(name, template_names()))
+  }
+  logger.debugf("loading template %s", name)
+  return data, nil
+}
+
+type Template_variable struct {
+  Name string
+  Default string
+  Required bool
+}
+
+/**
+ * Returns the description of a template and its variables, in the order
+ * they first appear.
+ */
+func describe_template(name string) (string, []Template_variable, error) {
+  data, err := read_template(name, fmt.Errorf("unknown template"))
+  if err != nil {
+    return "", nil, err
+  }
+  root, err := parse_json(Position{filename: name, data: data})
+  if err != nil {
+    return "", nil, err
+  }
+  r := []Template_variable{}
+  defaults := root.values["variables"]
+  seen := map[string]bool{}
+  for _, m := range placeholder.FindAllStringSubmatch(string(data), -1) {
+    v := m[1]
+    if seen[v] {
+      continue
+    }
+    seen[v] = true
+    if d, ok := defaults.values[v]; defaults != nil && ok {
+      r = append(r, Template_variable{v, d.raw, false})
+    } else {
+      r = append(r, Template_variable{v, "", true})
+    }
+  }
+  return root.values["description"].raw, r, nil
+}
+
+func templates_command(fs *flag.FlagSet) func() int {
+  fs.Usage = func() {
+    fmt.Fprintf(fs.Output(), "usage: %s templates\n\n", os.Args[0])
+    fmt.Fprintf(fs.Output(), "lists the built-in projects, use them with -project <name>.\n")
+  }
+  return func() int {
+    if fs.NArg() != 0 {
+      fs.Usage()
+      return Exit_usage
+    }
+    for _, name := range template_names() {
+      description, variables, err := describe_template(name)
+      if err != nil {
+        logger.errorf("%s", err)
+        return Exit_failure
+      }
+      fmt.Printf("%s: %s\n", name, description)
+      for _, v := range variables {
+        if v.Required {
+          fmt.Printf("  -var %s=... (required)\n", v.Name)
+        } else {
+          fmt.Printf("  -var %s=... (default %q)\n", v.Name, v.Default)
+        }
+      }
+    }
+    return 0
+  }
+}
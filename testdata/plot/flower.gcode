@@ -0,0 +1,23 @@
+%
+(a square with a circle and two arcs, in inches)
+G20 G90
+G0 Z0.1
+G0 X-1 Y-1
+G1 Z-0.01 F20
+G1 X1
+Y1
+X-1
+Y-1 ; back to the start
+G0 Z0.1
+G0 X0.5 Y0
+G1 Z-0.01
+G2 X0.5 Y0 I-0.5 J0
+G0 Z0.1
+G0 X-0.5 Y0.5
+M3
+G1 Z0
+G3 X0.5 Y0.5 R0.5
+G2 X-0.5 Y-0.5 R-1
+M5
+G0 X0 Y0
+%
@@ -0,0 +1,351 @@
+package main
+
+import (
+  "bytes"
+  "fmt"
+  "math"
+  "strconv"
+  "strings"
+  "unicode"
+)
+
+/**
+ * A minimal stroke font. Glyphs sit on a 4x6 grid, with the baseline at 0.
+ * Each glyph is a list of polylines separated by ';', a polyline being a list
+ * of x,y points. A single point is a dot.
+ */
+const (
+  Glyph_width = 4.0
+  Glyph_height = 6.0
+  Glyph_advance = 6.0
+)
+
+var glyph_strokes = map[rune]string{
+  'A': "0,0 2,6 4,0; 0.7,2 3.3,2",
+  'B': "0,0 0,6 3,6 4,5 4,4 3,3 0,3; 3,3 4,2 4,1 3,0 0,0",
+  'C': "4,5 3,6 1,6 0,5 0,1 1,0 3,0 4,1",
+  'D': "0,0 0,6 2,6 4,4 4,2 2,0 0,0",
+  'E': "4,6 0,6 0,0 4,0; 0,3 3,3",
+  'F': "4,6 0,6 0,0; 0,3 3,3",
+  'G': "4,5 3,6 1,6 0,5 0,1 1,0 3,0 4,1 4,3 2,3",
+  'H': "0,0 0,6; 4,0 4,6; 0,3 4,3",
+  'I': "1,6 3,6; 2,6 2,0; 1,0 3,0",
+  'J': "4,6 4,1 3,0 1,0 0,1",
+  'K': "0,0 0,6; 4,6 0,2; 1.5,3.5 4,0",
+  'L': "0,6 0,0 4,0",
+  'M': "0,0 0,6 2,3 4,6 4,0",
+  'N': "0,0 0,6 4,0 4,6",
+  'O': "1,0 0,1 0,5 1,6 3,6 4,5 4,1 3,0 1,0",
+  'P': "0,0 0,6 3,6 4,5 4,4 3,3 0,3",
+  'Q': "1,0 0,1 0,5 1,6 3,6 4,5 4,1 3,0 1,0; 2.5,1.5 4,0",
+  'R': "0,0 0,6 3,6 4,5 4,4 3,3 0,3; 2,3 4,0",
+  'S': "4,5 3,6 1,6 0,5 0,4 1,3 3,3 4,2 4,1 3,0 1,0 0,1",
+  'T': "0,6 4,6; 2,6 2,0",
+  'U': "0,6 0,1 1,0 3,0 4,1 4,6",
+  'V': "0,6 2,0 4,6",
+  'W': "0,6 1,0 2,4 3,0 4,6",
+  'X': "0,0 4,6; 0,6 4,0",
+  'Y': "0,6 2,3 4,6; 2,3 2,0",
+  'Z': "0,6 4,6 0,0 4,0",
+  '0': "1,0 0,1 0,5 1,6 3,6 4,5 4,1 3,0 1,0; 0,1 4,5",
+  '1': "1,5 2,6 2,0; 1,0 3,0",
+  '2': "0,5 1,6 3,6 4,5 4,4 0,0 4,0",
+  '3': "0,5 1,6 3,6 4,5 4,4 3,3 4,2 4,1 3,0 1,0 0,1; 1,3 3,3",
+  '4': "3,0 3,6 0,2 4,2",
+  '5': "4,6 0,6 0,3 3,3 4,2 4,1 3,0 1,0 0,1",
+  '6': "4,5 3,6 1,6 0,5 0,1 1,0 3,0 4,1 4,2 3,3 0,3",
+  '7': "0,6 4,6 1,0",
+  '8': "1,3 0,4 0,5 1,6 3,6 4,5 4,4 3,3 1,3 0,2 0,1 1,0 3,0 4,1 4,2 3,3",
+  '9': "4,3 1,3 0,4 0,5 1,6 3,6 4,5 4,1 3,0 1,0 0,1",
+  ' ': "",
+  '.': "2,0",
+  ',': "2,0.5 1.5,-1",
+  '!': "2,6 2,2; 2,0",
+  '?': "0,5 1,6 3,6 4,5 4,4 2,3 2,2; 2,0",
+  '-': "1,3 3,3",
+  '+': "2,1 2,5; 0,3 4,3",
+  '\'': "2,6 2,4.5",
+  ':': "2,4; 2,1",
+  '/': "0,0 4,6",
+  '(': "3,6 2,5 1.5,3 2,1 3,0",
+  ')': "1,6 2,5 2.5,3 2,1 1,0",
+  '&': "4,0 1,4 1,5 2,6 3,5 3,4 0,2 0,1 1,0 2,0 4,2",
+}
+
+type Border string
+const (
+  No_border Border = "none"
+  Line_border Border = "lines"
+  Ornament_border Border = "ornament"
+)
+
+/**
+ * Draws a border along the circle of the given radius, on its inside when
+ * inward, its outside otherwise. Returns the room the border takes.
+ */
+func border(c *Canvas, style Border, radius float64, inward bool, width float64) (float64, error) {
+  side := 1.0 // towards the center
+  if !inward {
+    side = -1
+  }
+  switch style {
+    case No_border:
+      return 0, nil
+    case Line_border:
+      c.circle(Point{0, 0}, radius, width)
+      return 3 * width, nil
+    case Ornament_border:
+      // two lines with beads between them
+      c.circle(Point{0, 0}, radius, width)
+      c.circle(Point{0, 0}, radius - side * 4 * width, width)
+      middle := radius - side * 2 * width
+      n := int(2 * math.Pi * middle / (4 * width))
+      for i:=0; i<n; i++ {
+        a := 2 * math.Pi * float64(i) / float64(n)
+        p := Point{middle * math.Cos(a), middle * math.Sin(a)}
+        c.line(p, p, 2 * width)
+      }
+      return 7 * width, nil
+  }
+  return 0, fmt.Errorf("unknown border: %s, expecting %s, %s or %s", style, No_border, Line_border, Ornament_border)
+}
+
+/**
+ * Returns the polylines of a glyph, in grid units. Lowercase letters are
+ * drawn as uppercase ones.
+ */
+func glyph(r rune) ([][]Point, bool) {
+  strokes, ok := glyph_strokes[unicode.ToUpper(r)]
+  if !ok {
+    return nil, false
+  }
+  lines := [][]Point{}
+  for _, stroke := range strings.Split(strokes, ";") {
+    points := []Point{}
+    for _, p := range strings.Fields(stroke) {
+      xy := strings.Split(p, ",")
+      x, _ := strconv.ParseFloat(xy[0], 64)
+      y, _ := strconv.ParseFloat(xy[1], 64)
+      points = append(points, Point{x, y})
+    }
+    if len(points) > 0 {
+      lines = append(lines, points)
+    }
+  }
+  return lines, true
+}
+
+/**
+ * Text laid out as paragraphs, in a part of a ring: between two radii and two
+ * angles, in degrees clockwise from the top of the disc. Set with
+ * -sector inner-outer:from-to, e.g. 40mm-55mm:300-60 for the top sixth of a
+ * band. The angles may go past the top, from 300 to 60 degrees wraps around.
+ * Implements flag.Value, the zero value is no sector.
+ */
+type Sector struct {
+  inner Length
+  outer Length
+  from Angle
+  to Angle
+}
+
+func (x *Sector) Set(s string) error {
+  radii, angles, _ := strings.Cut(s, ":")
+  inner_s, outer_s, ok1 := strings.Cut(radii, "-")
+  from_s, to_s, ok2 := strings.Cut(angles, "-")
+  var inner, outer Length
+  from, err1 := strconv.ParseFloat(from_s, 64)
+  to, err2 := strconv.ParseFloat(to_s, 64)
+  if !ok1 || !ok2 || inner.Set(inner_s) != nil || outer.Set(outer_s) != nil || inner >= outer ||
+    err1 != nil || err2 != nil || from < 0 || from > 360 || to < 0 || to > 360 {
+    return fmt.Errorf("invalid sector: %q, expecting inner-outer:from-to, in degrees from the top, e.g. 40mm-55mm:300-60", s)
+  }
+  *x = Sector{inner, outer, Angle(math.Pi / 2 - from * math.Pi / 180), Angle(math.Pi / 2 - to * math.Pi / 180)}
+  return nil
+}
+
+func (x Sector) String() string {
+  if x == (Sector{}) {
+    return ""
+  }
+  return fmt.Sprintf("%s-%s:%.6g-%.6g", x.inner, x.outer, x.from.degrees(), x.to.degrees())
+}
+
+/**
+ * Angle the sector covers, in radians.
+ */
+func (x Sector) span() float64 {
+  d := math.Mod(float64(x.from - x.to) + 2 * math.Pi, 2 * math.Pi)
+  if d == 0 {
+    d = 2 * math.Pi
+  }
+  return d
+}
+
+/**
+ * How the lines of a paragraph sit in their sector. Full justification
+ * stretches the spaces so that lines reach both sides, except for the last
+ * line of a paragraph, which stays on the left.
+ */
+type Justify string
+const (
+  Left_justify Justify = "left"
+  Center_justify Justify = "center"
+  Right_justify Justify = "right"
+  Full_justify Justify = "full"
+)
+
+/**
+ * Length of a line of n glyphs along its circle, in mm.
+ */
+func line_length(n int, scale float64) float64 {
+  return (Glyph_advance * float64(n) - (Glyph_advance - Glyph_width)) * scale
+}
+
+/**
+ * Draws a line along the circle of radius baseline, reading clockwise from
+ * the angle start, in radians from the x axis. offsets are where each glyph
+ * starts along the circle, in mm.
+ */
+func draw_line(c *Canvas, runes []rune, offsets []float64, baseline float64, start float64, scale float64, width float64) {
+  for i, r := range runes {
+    strokes, ok := glyph(r)
+    if !ok {
+      logger.warnf("no glyph for %q, drawing '?' instead", r)
+      strokes, _ = glyph('?')
+    }
+    for _, stroke := range strokes {
+      points := []Point{}
+      for _, p := range stroke {
+        // the text reads clockwise, seen from the data side
+        a := start - (offsets[i] + p.x * scale) / baseline
+        radius := baseline + p.y * scale
+        points = append(points, Point{radius * math.Cos(a), radius * math.Sin(a)})
+      }
+      if len(points) == 1 {
+        c.line(points[0], points[0], width)
+      } else {
+        c.polyline(points, width)
+      }
+    }
+  }
+}
+
+/**
+ * Wraps the paragraphs of s, one per line of input, into the sector. Lines
+ * go from the outer radius inwards, each one taking as many words as fit
+ * along its baseline. inner and outer are the radii the sector has to stay
+ * between.
+ */
+func paragraphs(c *Canvas, s string, x Sector, justify Justify, inner float64, outer float64, height float64, width float64) error {
+  switch justify {
+    case Left_justify, Center_justify, Right_justify, Full_justify:
+    default:
+      return fmt.Errorf("unknown justification: %s, expecting %s, %s, %s or %s", justify, Left_justify, Center_justify, Right_justify, Full_justify)
+  }
+  if x.inner < Length(inner) || x.outer > Length(outer) {
+    return fmt.Errorf("sector %s goes past the visible part of the program area, %s to %s", x, Length(inner), Length(outer))
+  }
+  scale := height / Glyph_height
+  spacing := height * 1.5
+  start := float64(x.from)
+  k := 0
+  for _, paragraph := range strings.Split(s, "\n") {
+    words := strings.Fields(paragraph)
+    for first := true; first || len(words) > 0; first = false {
+      baseline := float64(x.outer) - height - spacing * float64(k)
+      if baseline < float64(x.inner) {
+        return fmt.Errorf("the text doesn't fit in sector %s, it holds %d line(s) of %gmm text", x, k, height)
+      }
+      k++
+      if len(words) == 0 {
+        // an empty paragraph, i.e. a blank line
+        continue
+      }
+      room := baseline * x.span()
+      n := 0
+      for n < len(words) && line_length(len([]rune(strings.Join(words[:n+1], " "))), scale) <= room {
+        n++
+      }
+      if n == 0 {
+        return fmt.Errorf("%q is too long to fit on a line of sector %s", words[0], x)
+      }
+      runes := []rune(strings.Join(words[:n], " "))
+      words = words[n:]
+
+      extra := room - line_length(len(runes), scale)
+      spaces := strings.Count(string(runes), " ")
+      offsets := make([]float64, len(runes))
+      shift, gap := 0.0, 0.0
+      switch {
+        case justify == Center_justify:
+          shift = extra / 2
+        case justify == Right_justify:
+          shift = extra
+        case justify == Full_justify && len(words) > 0 && spaces > 0:
+          gap = extra / float64(spaces)
+      }
+      for i, r := range runes {
+        offsets[i] = shift + Glyph_advance * float64(i) * scale
+        if r == ' ' {
+          shift += gap
+        }
+      }
+      draw_line(c, runes, offsets, baseline, start, scale, width)
+    }
+  }
+  return nil
+}
+
+/**
+ * Writes text along circles, centered at the top of the disc. Each line of
+ * text gets its own circle, the first line being the outermost one. height
+ * is the height of a capital letter, in mm. The border, if any, goes along
+ * both edges of the program area.
+ *
+ * With a sector, the text is wrapped into it instead, see paragraphs().
+ */
+func text(buf *bytes.Buffer, g Geometry, s string, height float64, width float64, style Border, sector Sector, justify Justify, jitter bool) error {
+  if height <= 0 {
+    return fmt.Errorf("invalid text height: %f", height)
+  }
+  c := new_canvas(Disc_radius, Canvas_resolution)
+  lines := strings.Split(s, "\n")
+  scale := height / Glyph_height
+  spacing := height * 1.5
+  inner := float64(g.visible_radius()) + width / 2
+  outer := float64(g.end_radius()) - width / 2
+  room, err := border(c, style, inner, false, width)
+  if err != nil {
+    return err
+  }
+  border(c, style, outer, true, width)
+  inner, outer = inner + room, outer - room
+  if sector != (Sector{}) {
+    if err := paragraphs(c, s, sector, justify, inner, outer, height, width); err != nil {
+      return err
+    }
+    engrave(buf, c, g, jitter)
+    return nil
+  }
+  total := height + spacing * float64(len(lines) - 1)
+  if total > outer - inner {
+    return fmt.Errorf("%d line(s) of %gmm text don't fit in the visible part of the program area", len(lines), height)
+  }
+
+  for k, line := range lines {
+    baseline := (inner + outer + total) / 2 - height - spacing * float64(k)
+    runes := []rune(line)
+    length := line_length(len(runes), scale)
+    if length / baseline > 2 * math.Pi {
+      return fmt.Errorf("line %q is too long to fit on a single turn", line)
+    }
+    offsets := make([]float64, len(runes))
+    for i := range runes {
+      offsets[i] = Glyph_advance * float64(i) * scale
+    }
+    draw_line(c, runes, offsets, baseline, math.Pi / 2 + length / 2 / baseline, scale, width)
+  }
+  engrave(buf, c, g, jitter)
+  return nil
+}
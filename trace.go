@@ -0,0 +1,110 @@
+package main
+
+import (
+  "flag"
+  "fmt"
+  "os"
+)
+
+/**
+ * Where the bytes of a sample end up on the disc. The burner doesn't write
+ * samples in order: CIRC (ECMA-130, clause 16) spreads the 24 bytes of each
+ * frame of 6 samples over 111 frames, and that's before EFM turns them into
+ * pits. The stages, for byte b of sample n:
+ *
+ *   F1 frame      n / 6, at 4 * (n % 6) + b: left low, left high, right
+ *                 low, right high
+ *   scrambling    samples 0, 2 and 4 of the frame go to symbols 0 to 11 of
+ *                 the C2 word, 2 frames later, samples 1, 3 and 5 to symbols
+ *                 16 to 27. C2 adds its parity as symbols 12 to 15
+ *   interleaving  symbol i is delayed by 4 * i frames
+ *   C1            adds its parity as symbols 28 to 31, then the even ones
+ *                 are delayed by one more frame
+ *   F3 frame      588 channel bits: sync and merging bits, the subchannel
+ *                 symbol, then the 32 symbols, 14 bits of EFM codeword and 3
+ *                 merging bits each
+ *
+ * trace tells where the EFM codeword and the merging bits go, not what they
+ * are: that takes ECMA-130's 8 to 14 table and the neighbouring symbols,
+ * and there's no EFM encoder in this code, see the TODO in µ-engraving.go.
+ */
+const (
+  Frame_samples = 6
+  Frame_channel_bits = 588
+  Scrambling_delay = 2 // frames
+  Interleave_delay = 4 // frames, per symbol
+  Symbol_channel_bits = 17 // codeword and merging bits
+  Sync_channel_bits = 27 // sync pattern and merging bits
+)
+
+type Trace struct {
+  offset int // in the wav data
+  frame int  // F1 frame
+  position int
+  symbol int // in the C1 and C2 words, and in the F3 frame
+  delay int  // in frames, from the F1 frame to the F3 frame
+  bit int    // first channel bit of the codeword, from the start of the program area
+}
+
+/**
+ * The journey of byte b, 0 to 3, of sample n.
+ */
+func trace(n int, b int) Trace {
+  t := Trace{offset: n * 4 + b, frame: n / Frame_samples, position: (n % Frame_samples) * 4 + b}
+  s := n % Frame_samples
+  t.symbol = s / 2 * 4 + b
+  if s % 2 == 1 {
+    t.symbol += 16
+  } else {
+    t.delay += Scrambling_delay
+  }
+  t.delay += Interleave_delay * t.symbol
+  if t.symbol % 2 == 0 {
+    t.delay++
+  }
+  t.bit = (t.frame + t.delay) * Frame_channel_bits + Sync_channel_bits + Symbol_channel_bits * (t.symbol + 1)
+  return t
+}
+
+
+func trace_command(fs *flag.FlagSet) func() int {
+  g := geometry_flags(fs)
+  sample := fs.Int("sample", -1, "sample to trace, from 0 at the start of the program area")
+  fs.Usage = func() {
+    fmt.Fprintf(fs.Output(), "usage: %s trace [options] -sample <n>\n\n", os.Args[0])
+    fmt.Fprintf(fs.Output(), "shows where each byte of a sample goes: its frame, its symbol through\n")
+    fmt.Fprintf(fs.Output(), "CIRC's interleaving, its channel bits and where they land on the disc,\n")
+    fmt.Fprintf(fs.Output(), "compared with where the sample would land if it was written in order.\n\noptions:\n")
+    fs.PrintDefaults()
+  }
+  return func() int {
+    if fs.NArg() != 0 || *sample < 0 {
+      fs.Usage()
+      return Exit_usage
+    }
+    if err := g.validate(); err != nil {
+      logger.errorf("%s", err)
+      return Exit_usage
+    }
+    if *sample >= int(g.samples) {
+      logger.warnf("sample %d is past the end of the design, %d samples", *sample, g.samples)
+    }
+    // the last bytes land over a hundred frames later
+    last := trace(*sample, 3)
+    rings := g.rings(Duration(last.bit / Frame_channel_bits * Frame_samples + 2 * Frame_samples))
+    radius, angle := g.position(rings, float64(*sample))
+    fmt.Printf("sample %d, %.4fs into the program area: F1 frame %d, sector %s\n", *sample, float64(*sample) / float64(Sample_rate), *sample / Frame_samples, format_msf(*sample / Sector_samples))
+    fmt.Printf("in order, it would land at %s, %s\n", radius, angle)
+    for b, name := range []string{"left low", "left high", "right low", "right high"} {
+      t := trace(*sample, b)
+      at := float64(t.bit) / Frame_channel_bits * Frame_samples
+      r, a := g.position(rings, at)
+      fmt.Printf("\nbyte %d, %s, at %d in the wav data\n", b, name, t.offset)
+      fmt.Printf("  F1 frame %d, byte %d\n", t.frame, t.position)
+      fmt.Printf("  symbol %d of the C2 and C1 words, delayed %d frames\n", t.symbol, t.delay)
+      fmt.Printf("  F3 frame %d, codeword at channel bits %d to %d, merging bits to %d\n", t.frame + t.delay, t.bit, t.bit + 13, t.bit + 16)
+      fmt.Printf("  lands at %s, %s, %s along the track past the sample\n", r, a, Length((at - float64(*sample)) * float64(g.sample_length())))
+    }
+    return 0
+  }
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+  "bytes"
+  "encoding/json"
+  "flag"
+  "fmt"
+  "os"
+  "os/exec"
+  "sort"
+  "strings"
+)
+
+/**
+ * A keyboard driven editor: a fast preview drawn with half blocks, one
+ * pixel above the other in each character, next to the parameters of the
+ * design. Up and down pick a parameter, left and right nudge it, e writes a
+ * project file and q quits, printing the matching command line.
+ *
+ * The terminal is switched to raw mode with stty, so that keys arrive one at
+ * a time.
+ */
+const (
+  Tui_size = 48 // pixels across the preview, i.e. characters
+)
+
+/**
+ * Amounts by which the arrow keys change the parameters which have a unit.
+ * Other numbers change by 5%, integers by 1.
+ */
+var tui_steps = map[string]string{
+  "start-radius": "0.5mm",
+  "track-pitch": "0.01um",
+  "linear-speed": "0.01m/s",
+  "duration": "1m",
+  "fill-to": "1m",
+  "watermark-size": "0.5mm",
+}
+
+/**
+ * The parameters worth editing: the geometry, then the numeric options of
+ * the pattern.
+ */
+func tui_parameters(fs *flag.FlagSet, pattern Pattern) []string {
+  r := []string{"start-radius", "track-pitch", "linear-speed", "duration"}
+  for _, p := range patterns {
+    if p.name != pattern {
+      continue
+    }
+    for _, name := range p.parameters {
+      if _, ok := tui_steps[name]; ok {
+        r = append(r, name)
+      } else if g, ok := fs.Lookup(name).Value.(flag.Getter); ok {
+        switch g.Get().(type) {
+          case float64, int:
+            r = append(r, name)
+        }
+      }
+    }
+  }
+  return r
+}
+
+/**
+ * Changes a parameter by one step, up or down.
+ */
+func nudge(fs *flag.FlagSet, name string, direction float64) error {
+  f := fs.Lookup(name)
+  if s, ok := tui_steps[name]; ok {
+    var step Length
+    switch v := f.Value.(type) {
+      case *Length:
+        step.Set(s)
+        return fs.Set(name, Length(float64(*v) + direction * float64(step)).String())
+      case *Speed:
+        var speed Speed
+        speed.Set(s)
+        return fs.Set(name, Speed(float64(*v) + direction * float64(speed)).String())
+      case *Duration:
+        var d Duration
+        d.Set(s)
+        return fs.Set(name, Duration(int(*v) + int(direction) * int(d)).String())
+    }
+  }
+  switch v := f.Value.(flag.Getter).Get().(type) {
+    case float64:
+      return fs.Set(name, fmt.Sprint(v * (1 + direction * 0.05)))
+    case int:
+      return fs.Set(name, fmt.Sprint(v + int(direction)))
+  }
+  return fmt.Errorf("-%s can't be nudged", name)
+}
+
+/**
+ * Returns the design flags which differ from their defaults, sorted.
+ */
+func changed_flags(fs *flag.FlagSet) []*flag.Flag {
+  r := []*flag.Flag{}
+  fs.VisitAll(func(f *flag.Flag) {
+    if f.Value.String() != f.DefValue && f.Name != "project" && f.Name != "export" {
+      r = append(r, f)
+    }
+  })
+  sort.Slice(r, func(i int, j int) bool {
+    return r[i].Name < r[j].Name
+  })
+  return r
+}
+
+/**
+ * Writes a project file recreating the design: the options and geometry
+ * which differ from the defaults, and the seed.
+ */
+func project_json(fs *flag.FlagSet, pattern Pattern, o *Pattern_options, m *Metadata) ([]byte, error) {
+  geometry := flag.NewFlagSet("", flag.ContinueOnError)
+  geometry_flags(geometry)
+  options := flag.NewFlagSet("", flag.ContinueOnError)
+  pattern_flags(options)
+
+  project := map[string]any{"pattern": pattern, "seed": m.seed}
+  sections := map[string]map[string]any{"options": {}, "geometry": {}}
+  for _, f := range changed_flags(fs) {
+    key := strings.ReplaceAll(f.Name, "-", "_")
+    var value any = f.Value.String()
+    if g, ok := f.Value.(flag.Getter); ok {
+      value = g.Get()
+    }
+    switch {
+      case geometry.Lookup(f.Name) != nil:
+        sections["geometry"][key] = value
+      case f.Name == "var":
+        project["variables"] = o.variables
+      case options.Lookup(f.Name) != nil && f.Name != "no-cache":
+        sections["options"][key] = value
+    }
+  }
+  for name, section := range sections {
+    if len(section) > 0 {
+      project[name] = section
+    }
+  }
+  data, err := json.MarshalIndent(project, "", "  ")
+  return append(data, '\n'), err
+}
+
+/**
+ * The equivalent command line.
+ */
+func command_line(fs *flag.FlagSet, pattern Pattern) string {
+  r := []string{os.Args[0], "generate"}
+  for _, f := range changed_flags(fs) {
+    if f.Name == "var" {
+      for _, v := range strings.Split(f.Value.String(), ",") {
+        r = append(r, "-var", fmt.Sprintf("%q", v))
+      }
+      continue
+    }
+    r = append(r, fmt.Sprintf("-%s=%q", f.Name, f.Value.String()))
+  }
+  return strings.Join(append(r, string(pattern)), " ")
+}
+
+/**
+ * Draws the preview, two pixels per character, in 256 color grays.
+ */
+func draw_preview(pattern Pattern, o *Pattern_options, g Geometry, m *Metadata) ([]string, error) {
+  m.reseed()
+  buf, coarse, err := fast_pattern(pattern, o, g, Tui_size)
+  if err != nil {
+    return nil, err
+  }
+  img := render(buf.Bytes()[Wav_header_size:], coarse, Tui_size)
+  gray := func(v uint8) int {
+    return 232 + int(v) * 23 / 255
+  }
+  lines := []string{}
+  for y:=0; y<Tui_size; y+=2 {
+    line := strings.Builder{}
+    for x:=0; x<Tui_size; x++ {
+      fmt.Fprintf(&line, "\x1b[38;5;%dm\x1b[48;5;%dm▀", gray(img.GrayAt(x, y).Y), gray(img.GrayAt(x, y + 1).Y))
+    }
+    line.WriteString("\x1b[0m")
+    lines = append(lines, line.String())
+  }
+  return lines, nil
+}
+
+func stty(args ...string) (string, error) {
+  c := exec.Command("stty", args...)
+  c.Stdin = os.Stdin
+  out, err := c.Output()
+  return strings.TrimSpace(string(out)), err
+}
+
+func tui_command(fs *flag.FlagSet) func() int {
+  o, g, m := design_flags(fs)
+  project := project_flag(fs)
+  export := fs.String("export", "project.json", "project file written by the e key")
+  fs.Usage = pattern_usage(fs, "<pattern> | -project <file>")
+  return func() int {
+    pattern, err := pattern_argument(fs, *project, o.variables)
+    if err != nil {
+      logger.errorf("%s", err)
+      return Exit_usage
+    }
+    if pattern == "" {
+      fs.Usage()
+      return Exit_usage
+    }
+    parameters := tui_parameters(fs, pattern)
+
+    saved, err := stty("-g")
+    if err != nil {
+      logger.errorf("stty: %s, is stdin a terminal?", err)
+      return Exit_failure
+    }
+    if _, err := stty("raw", "-echo"); err != nil {
+      logger.errorf("stty: %s", err)
+      return Exit_failure
+    }
+    defer stty(saved)
+    // logs would scroll the screen
+    level := logger.level
+    logger.level = Level_error
+    defer func() { logger.level = level }()
+
+    selected := 0
+    status := "↑↓ pick, ←→ change, e export, q quit"
+    key := make([]byte, 3)
+    for {
+      out := bytes.Buffer{}
+      out.WriteString("\x1b[H\x1b[2J")
+      lines, err := draw_preview(pattern, o, *g, m)
+      if err != nil {
+        lines = []string{"", fmt.Sprintf("%-*s", Tui_size, "  " + err.Error())}
+      }
+      for i:=0; i<max(len(lines), len(parameters) + 2); i++ {
+        if i < len(lines) {
+          out.WriteString(lines[i])
+        } else {
+          out.WriteString(strings.Repeat(" ", Tui_size))
+        }
+        if i < len(parameters) {
+          marker := "  "
+          if i == selected {
+            marker = "> "
+          }
+          fmt.Fprintf(&out, "  %s%-16s %s", marker, parameters[i], fs.Lookup(parameters[i]).Value)
+        } else if i == len(parameters) + 1 {
+          fmt.Fprintf(&out, "  %s", status)
+        }
+        out.WriteString("\r\n")
+      }
+      os.Stdout.Write(out.Bytes())
+
+      n, err := os.Stdin.Read(key)
+      if err != nil {
+        break
+      }
+      status = ""
+      switch string(key[:n]) {
+        case "q", "\x03":
+          fmt.Printf("\x1b[H\x1b[2J%s\r\n", command_line(fs, pattern))
+          return 0
+        case "\x1b[A":
+          selected = (selected + len(parameters) - 1) % len(parameters)
+        case "\x1b[B":
+          selected = (selected + 1) % len(parameters)
+        case "\x1b[C", "\x1b[D":
+          direction := 1.0
+          if key[2] == 'D' {
+            direction = -1
+          }
+          if err := nudge(fs, parameters[selected], direction); err != nil {
+            status = err.Error()
+          }
+        case "e":
+          data, err := project_json(fs, pattern, o, m)
+          if err == nil {
+            err = write_output(*export, data)
+          }
+          status = "wrote " + *export
+          if err != nil {
+            status = err.Error()
+          }
+      }
+    }
+    return 0
+  }
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+  "encoding/json"
+  "fmt"
+  "math"
+  "sort"
+  "strconv"
+  "strings"
+  "time"
+)
+
+/**
+ * Physical quantities given on the command line must carry their unit, e.g.
+ * "25mm" or "1.48um". Values are converted to the unit used internally: mm
+ * for lengths, mm/s for speeds, samples for durations and radians for
+ * angles. Going from one to the other, e.g. from a sample to where it lands,
+ * goes through the Geometry, which returns these types rather than bare
+ * numbers whose unit has to be guessed.
+ */
+var length_units = map[string]float64{
+  "nm": 0.000001,
+  "um": 0.001,
+  "µm": 0.001,
+  "mm": 1,
+  "cm": 10,
+  "m": 1000,
+}
+
+var speed_units = map[string]float64{
+  "mm/s": 1,
+  "cm/s": 10,
+  "m/s": 1000,
+}
+
+func parse_quantity(s string, units map[string]float64) (float64, error) {
+  s = strings.TrimSpace(s)
+  i := strings.LastIndexAny(s, "0123456789.") + 1
+  unit := strings.TrimSpace(s[i:])
+  v, err := strconv.ParseFloat(s[:i], 64)
+  if err != nil {
+    return 0, fmt.Errorf("invalid number: %q", s)
+  }
+  factor, ok := units[unit]
+  if !ok {
+    names := []string{}
+    for name := range units {
+      names = append(names, name)
+    }
+    sort.Strings(names)
+    if unit == "" {
+      return 0, fmt.Errorf("missing unit in %q, expecting one of %s", s, strings.Join(names, ", "))
+    }
+    return 0, fmt.Errorf("unknown unit %q in %q, expecting one of %s", unit, s, strings.Join(names, ", "))
+  }
+  return v * factor, nil
+}
+
+/**
+ * A length, in mm. Implements flag.Value.
+ */
+type Length float64
+
+func (l *Length) Set(s string) error {
+  v, err := parse_quantity(s, length_units)
+  *l = Length(v)
+  return err
+}
+
+/**
+ * Lengths in json files are strings with their unit, as on the command line.
+ */
+func (l *Length) UnmarshalJSON(data []byte) error {
+  var s string
+  if err := json.Unmarshal(data, &s); err != nil {
+    return fmt.Errorf("expecting a length with its unit, e.g. \"36mm\"")
+  }
+  return l.Set(s)
+}
+
+func (l Length) String() string {
+  if l != 0 && l < 0.1 && l > -0.1 {
+    return strconv.FormatFloat(float64(l) * 1000, 'g', 6, 64) + "um"
+  }
+  return strconv.FormatFloat(float64(l), 'g', 6, 64) + "mm"
+}
+
+/**
+ * A speed, in mm/s. Implements flag.Value.
+ */
+type Speed float64
+
+func (v *Speed) Set(s string) error {
+  r, err := parse_quantity(s, speed_units)
+  *v = Speed(r)
+  return err
+}
+
+func (v Speed) String() string {
+  return strconv.FormatFloat(float64(v) / 1000, 'g', 6, 64) + "m/s"
+}
+
+/**
+ * An angle, in radians, counterclockwise from the x axis as seen from the
+ * data side, like the spiral's. Printed clockwise from the top, in degrees,
+ * the way angles are given on the command line, e.g. -sector.
+ */
+type Angle float64
+
+/**
+ * Clockwise from the top, in degrees, from 0 to 360.
+ */
+func (a Angle) degrees() float64 {
+  return math.Mod(math.Mod(2.5 * math.Pi - float64(a), 2 * math.Pi) + 2 * math.Pi, 2 * math.Pi) * 180 / math.Pi
+}
+
+func (a Angle) String() string {
+  return strconv.FormatFloat(a.degrees(), 'f', 2, 64) + "°"
+}
+
+var time_units = map[string]float64{
+  "samples": 1 / float64(Sample_rate),
+  "ms": 0.001,
+  "s": 1,
+  "sec": 1,
+  "m": 60,
+  "min": 60,
+  "h": 3600,
+}
+
+/**
+ * A duration, stored as a number of samples. Implements flag.Value. Accepts
+ * "70min" as well as Go style durations, e.g. "21m30s".
+ */
+type Duration int
+
+func (d *Duration) Set(s string) error {
+  v, err := parse_quantity(s, time_units)
+  if err != nil {
+    t, err2 := time.ParseDuration(s)
+    if err2 != nil {
+      return err
+    }
+    v = t.Seconds()
+  }
+  *d = Duration(math.Round(v * float64(Sample_rate)))
+  return nil
+}
+
+func (d Duration) String() string {
+  seconds := float64(d) / float64(Sample_rate)
+  s := (time.Duration(seconds * float64(time.Second))).Round(time.Millisecond).String()
+  // durations which aren't a whole number of ms must survive a round trip
+  var r Duration
+  if r.Set(s); r != d {
+    return strconv.Itoa(int(d)) + "samples"
+  }
+  return s
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+  "bytes"
+  "encoding/binary"
+  "encoding/json"
+  "flag"
+  "fmt"
+  "hash/crc32"
+  "os"
+  "path/filepath"
+  "sort"
+  "strings"
+)
+
+/**
+ * The verify pattern is made of blocks, one per sector: a magic number, a
+ * sequence number, bytes which only depend on the sequence number and a crc.
+ * Any byte of a rip can be checked against what was burned, which tells
+ * whether the drives involved are bit transparent: some mute samples they
+ * can't read, shift everything by their read offset or skip and repeat
+ * samples (jitter).
+ */
+const (
+  Block_size int = Sector_size
+  Block_magic = "\xb5EVB" // "µEVB", with µ in latin-1
+  Max_read_offset int = 10 * Sector_size // in bytes, drives are within a few thousand samples
+)
+
+/**
+ * Returns block n.
+ */
+func verify_block(n int) []byte {
+  b := make([]byte, Block_size)
+  copy(b, Block_magic)
+  binary.LittleEndian.PutUint32(b[4:8], uint32(n))
+  // xorshift, seeded with the sequence number
+  x := uint32(n) * 2654435761 + 1
+  for i:=8; i<Block_size-4; i++ {
+    x ^= x << 13
+    x ^= x >> 17
+    x ^= x << 5
+    b[i] = byte(x)
+  }
+  binary.LittleEndian.PutUint32(b[Block_size-4:], crc32.ChecksumIEEE(b[:Block_size-4]))
+  return b
+}
+
+/**
+ * Writes as many blocks as fit, the last one cut short.
+ */
+func verify_pattern(buf *bytes.Buffer, samples int) {
+  for i:=0; i<samples * 4; i+=Block_size {
+    buf.Write(verify_block(i / Block_size)[:min(Block_size, samples * 4 - i)])
+  }
+}
+
+/**
+ * Looks for a whole, valid block in data, returns where it starts and its
+ * sequence number.
+ */
+func find_block(data []byte, from int, to int) (int, int, bool) {
+  for i:=max(from, 0); i+Block_size<=len(data) && i<to; i++ {
+    if string(data[i:i+4]) != Block_magic {
+      continue
+    }
+    b := data[i:i+Block_size]
+    if binary.LittleEndian.Uint32(b[Block_size-4:]) == crc32.ChecksumIEEE(b[:Block_size-4]) {
+      return i, int(binary.LittleEndian.Uint32(b[4:8])), true
+    }
+  }
+  return 0, 0, false
+}
+
+type Rip_report struct {
+  offset int // in samples, where the burned samples start in the rip
+  blocks int
+  good int
+  muted []int
+  shifted map[int]int // block to shift, in samples
+  modified map[int]int // block to number of samples which differ
+  missing []int
+}
+
+/**
+ * Checks every block of a rip. The first valid block gives the read offset,
+ * every other block is expected where the offset puts it. samples is the
+ * duration of the burned pattern, 0 for whatever the rip holds.
+ */
+func verify_rip(data []byte, samples int) (*Rip_report, error) {
+  first, n, ok := find_block(data, 0, Max_read_offset + Block_size)
+  if !ok {
+    return nil, fmt.Errorf("no valid block in the first %d bytes, not a rip of the verify pattern?", Max_read_offset + Block_size)
+  }
+  offset := first - n * Block_size
+  if offset % 4 != 0 {
+    return nil, fmt.Errorf("block %d at byte %d, not on a sample boundary", n, first)
+  }
+  if samples == 0 {
+    samples = (len(data) - offset) / 4
+  }
+  r := &Rip_report{offset: offset / 4, blocks: samples * 4 / Block_size, shifted: map[int]int{}, modified: map[int]int{}}
+  for k:=0; k<r.blocks; k++ {
+    expected := verify_block(k)
+    p := k * Block_size + offset
+    var got []byte
+    if p >= 0 && p + Block_size <= len(data) {
+      got = data[p:p+Block_size]
+    }
+    if bytes.Equal(got, expected) {
+      r.good++
+      continue
+    }
+    if bytes.Count(got, []byte{0}) == Block_size {
+      r.muted = append(r.muted, k)
+      continue
+    }
+    // skipped or repeated samples move the block a little
+    if q, m, ok := find_block(data, p - Block_size / 2, p + Block_size / 2); ok && m == k {
+      r.shifted[k] = (q - p) / 4
+      continue
+    }
+    if got == nil {
+      r.missing = append(r.missing, k)
+      continue
+    }
+    differ := 0
+    for i:=0; i<Block_size; i+=4 {
+      if !bytes.Equal(got[i:i+4], expected[i:i+4]) {
+        differ++
+      }
+    }
+    r.modified[k] = differ
+  }
+  return r, nil
+}
+
+func (r *Rip_report) failures() int {
+  return len(r.muted) + len(r.shifted) + len(r.modified) + len(r.missing)
+}
+
+func verify_rip_command(fs *flag.FlagSet) func() int {
+  var duration Duration
+  fs.Var(&duration, "duration", "duration of the burned pattern, defaults to what the rip holds")
+  checksums := fs.String("checksums", "", "checks a rip of any design against the crcs written by generate -checksums instead")
+  offset := fs.Int("offset", 0, "with -checksums, sample of the rip at which the burned samples start, the drive's read offset when the ripper doesn't correct it")
+  fs.Usage = func() {
+    fmt.Fprintf(fs.Output(), "usage: %s verify-rip [options] <rip.wav|rip.bin>\n\n", os.Args[0])
+    fmt.Fprintf(fs.Output(), "checks a rip of a disc burned with the verify pattern, byte for byte, or a\n")
+    fmt.Fprintf(fs.Output(), "rip of any design against its -checksums, second by second or ring by ring.\n\noptions:\n")
+    fs.PrintDefaults()
+  }
+  return func() int {
+    if fs.NArg() != 1 {
+      fs.Usage()
+      return Exit_usage
+    }
+    filename := fs.Arg(0)
+    var data []byte
+    var err error
+    if strings.EqualFold(filepath.Ext(filename), ".bin") {
+      data, err = os.ReadFile(filename)
+    } else {
+      data, err = read_wav(filename)
+    }
+    if err != nil {
+      logger.errorf("%s", err)
+      return Exit_failure
+    }
+    if *checksums != "" {
+      return verify_checksums_command(filename, data, *checksums, *offset)
+    }
+    r, err := verify_rip(data, int(duration))
+    if err != nil {
+      logger.errorf("%s: %s", filename, err)
+      return Exit_failure
+    }
+    fmt.Printf("offset: the burned samples start at sample %+d of the rip\n", r.offset)
+    fmt.Printf("blocks: %d, identical: %d\n", r.blocks, r.good)
+    report := func(what string, blocks []int, detail func(k int) string) {
+      if len(blocks) == 0 {
+        return
+      }
+      fmt.Printf("%s: %d block(s)\n", what, len(blocks))
+      for i, k := range blocks {
+        if i == 10 {
+          fmt.Printf("  ...\n")
+          break
+        }
+        fmt.Printf("  block %d, sample %d%s\n", k, k * Block_size / 4, detail(k))
+      }
+    }
+    keys := func(m map[int]int) []int {
+      r := []int{}
+      for k := range m {
+        r = append(r, k)
+      }
+      sort.Ints(r)
+      return r
+    }
+    none := func(k int) string { return "" }
+    report("muted", r.muted, none)
+    report("shifted (jitter)", keys(r.shifted), func(k int) string { return fmt.Sprintf(": %+d samples", r.shifted[k]) })
+    report("modified", keys(r.modified), func(k int) string { return fmt.Sprintf(": %d samples differ", r.modified[k]) })
+    report("missing", r.missing, none)
+    if r.failures() > 0 {
+      fmt.Printf("%s: FAIL, the drives involved aren't bit transparent\n", filename)
+      return Exit_failure
+    }
+    fmt.Printf("%s: pass\n", filename)
+    return 0
+  }
+}
+
+func verify_checksums_command(filename string, data []byte, checksums string, offset int) int {
+  j, err := os.ReadFile(checksums)
+  if err != nil {
+    logger.errorf("%s", err)
+    return Exit_failure
+  }
+  t := Checksum_table{}
+  if err := json.Unmarshal(j, &t); err != nil {
+    logger.errorf("%s: %s", checksums, err)
+    return Exit_failure
+  }
+  differ, missing := verify_checksums(data, t, offset)
+  fmt.Printf("%ss: %d, identical: %d\n", t.Per, len(t.Entries), len(t.Entries) - len(differ) - len(missing))
+  report := func(what string, entries []Checksum_entry) {
+    if len(entries) == 0 {
+      return
+    }
+    fmt.Printf("%s: %d %s(s), from %s to %s\n", what, len(entries), t.Per, Length(entries[0].Inner), Length(entries[len(entries) - 1].Outer))
+    for i, e := range entries {
+      if i == 10 {
+        fmt.Printf("  ...\n")
+        break
+      }
+      fmt.Printf("  sample %d, %s, %s to %s\n", e.Start, Duration(e.Start), Length(e.Inner), Length(e.Outer))
+    }
+  }
+  report("differ", differ)
+  report("missing", missing)
+  if len(differ) == len(t.Entries) && len(t.Entries) > 1 {
+    logger.warnf("nothing matches: is the read offset right? see -offset")
+  }
+  if len(differ) + len(missing) > 0 {
+    fmt.Printf("%s: FAIL\n", filename)
+    return Exit_failure
+  }
+  fmt.Printf("%s: pass\n", filename)
+  return 0
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+  "bytes"
+  "testing"
+)
+
+/**
+ * Simulates a rip with everything a drive can do wrong, and checks each
+ * problem gets reported where it happened.
+ */
+func TestVerifyRip(t *testing.T) {
+  buf := &bytes.Buffer{}
+  verify_pattern(buf, 20 * Block_size / 4)
+  burned := buf.Bytes()
+
+  // the drive's read offset adds 30 samples of silence at the start
+  rip := append(make([]byte, 30 * 4), burned...)
+  p := func(block int) int { return 30 * 4 + block * Block_size }
+  // block 5 is muted, one sample of block 7 is wrong
+  copy(rip[p(5):p(6)], make([]byte, Block_size))
+  rip[p(7) + 100] ^= 0xff
+  // a sample of block 10 is skipped, every later block comes one sample early
+  rip = append(rip[:p(10)], rip[p(10) + 4:]...)
+
+  r, err := verify_rip(rip, len(burned) / 4)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if r.offset != 30 {
+    t.Errorf("offset: got %d, expecting 30", r.offset)
+  }
+  if len(r.muted) != 1 || r.muted[0] != 5 {
+    t.Errorf("muted: got %v, expecting [5]", r.muted)
+  }
+  if len(r.modified) != 2 || r.modified[7] != 1 {
+    t.Errorf("modified: got %v, expecting block 7 with 1 sample and the block with the skipped sample", r.modified)
+  }
+  for k:=11; k<20; k++ {
+    if r.shifted[k] != -1 {
+      t.Errorf("block %d: got a shift of %d, expecting -1", k, r.shifted[k])
+    }
+  }
+  if r.good != 8 || len(r.missing) != 0 {
+    t.Errorf("got %d identical and %d missing blocks, expecting 8 and 0", r.good, len(r.missing))
+  }
+}
+
+func TestVerifyRipIdentical(t *testing.T) {
+  buf := &bytes.Buffer{}
+  verify_pattern(buf, 5 * Block_size / 4)
+  r, err := verify_rip(buf.Bytes(), 0)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if r.failures() != 0 || r.good != 5 || r.offset != 0 {
+    t.Errorf("got %d failures, %d identical blocks at offset %d", r.failures(), r.good, r.offset)
+  }
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+  "bytes"
+  "flag"
+  "fmt"
+  "image"
+  "image/color"
+  "image/draw"
+  "math"
+)
+
+/**
+ * A small mark stamped over any design, e.g. the logo of whoever burned the
+ * disc. The mark is either a line of text or an image, the dark parts of
+ * which get burned. It is semi-transparent: only some of the bytes under it
+ * are replaced, the design shows through the others.
+ *
+ * An image with transparent parts, e.g. a logo on a transparent
+ * background, is a layer instead: where it's opaque, its light parts cover
+ * the design as well as its dark ones, where it's transparent the design is
+ * left alone.
+ *
+ * An image gets fit in a box, -watermark-size wide and -watermark-height
+ * high, the image's own height at that width by default:
+ *
+ *   contain  the whole image, as large as the box allows
+ *   cover    the whole box, the image's sides cropped to it
+ *   stretch  the image to the box's sides, out of proportion
+ *   tile     copies of the contained image all around the disc, on the
+ *            circle through -watermark-at, their tops pointing outwards
+ *
+ * The greys of the image become dark and light bytes at random, or as
+ * -watermark-dither says, see halftone, to compare the methods on a burn.
+ */
+type Watermark_options struct {
+  text string
+  image string
+  at string
+  size float64
+  height float64
+  fit string
+  opacity float64
+  dither string // random, or a Dither
+}
+
+const Random_dither = "random"
+
+type Fit string
+const (
+  Contain_fit Fit = "contain"
+  Cover_fit Fit = "cover"
+  Stretch_fit Fit = "stretch"
+  Tile_fit Fit = "tile"
+)
+
+func watermark_flags(fs *flag.FlagSet, w *Watermark_options) {
+  w.size = 3
+  fs.StringVar(&w.text, "watermark", "", "text to stamp over the design")
+  fs.StringVar(&w.image, "watermark-image", "", "image to stamp over the design, its dark parts get burned, or its opaque ones when it has transparent parts. May be an http(s) url")
+  fs.StringVar(&w.at, "watermark-at", "0,-28", "center of the watermark, in mm from the center of the disc, as x,y")
+  fs.Var((*Length)(&w.size), "watermark-size", "height of the text or width of the image's box")
+  fs.Var((*Length)(&w.height), "watermark-height", "height of the image's box, 0 for the image's own height at -watermark-size")
+  fs.StringVar(&w.fit, "watermark-fit", string(Contain_fit), "how the image fits its box: contain, cover, stretch, or tile around the disc")
+  fs.Float64Var(&w.opacity, "watermark-opacity", 0.5, "share of the bytes under the watermark which it replaces, from 0 to 1")
+  fs.StringVar(&w.dither, "watermark-dither", Random_dither, "how the watermark's greys become dark and light bytes: random, bayer or floyd-steinberg, on a grid, or spiral, diffusing the error along the track")
+}
+
+/**
+ * Draws the watermark, a line of text centered on its position, or the
+ * image fit in its box. Returns nil when there isn't any watermark.
+ */
+func watermark_canvas(w Watermark_options, width float64) (*Canvas, error) {
+  if w.text == "" && w.image == "" {
+    return nil, nil
+  }
+  if w.text != "" && w.image != "" {
+    return nil, fmt.Errorf("a watermark is either a text or an image, not both")
+  }
+  if w.size <= 0 || w.height < 0 || w.opacity < 0 || w.opacity > 1 {
+    return nil, fmt.Errorf("invalid watermark: size %s, height %s, opacity %g", Length(w.size), Length(w.height), w.opacity)
+  }
+  switch Fit(w.fit) {
+    case Contain_fit, Cover_fit, Stretch_fit, Tile_fit:
+    default:
+      return nil, fmt.Errorf("unknown watermark fit: %s, expecting %s, %s, %s or %s", w.fit, Contain_fit, Cover_fit, Stretch_fit, Tile_fit)
+  }
+  at, err := parse_point(w.at)
+  if err != nil {
+    return nil, fmt.Errorf("watermark position: %s", err)
+  }
+  if w.dither != Random_dither {
+    if _, err := parse_dither(w.dither); err != nil {
+      return nil, fmt.Errorf("unknown watermark dither: %s, expecting %s, %s, %s or %s", w.dither, Random_dither, Bayer_dither, Floyd_steinberg_dither, Spiral_dither)
+    }
+  }
+
+  c := new_canvas(Disc_radius, Canvas_resolution)
+  if w.text != "" {
+    scale := w.size / Glyph_height
+    runes := []rune(w.text)
+    length := (Glyph_advance * float64(len(runes)) - (Glyph_advance - Glyph_width)) * scale
+    for i, r := range runes {
+      strokes, ok := glyph(r)
+      if !ok {
+        strokes, _ = glyph('?')
+      }
+      for _, stroke := range strokes {
+        points := []Point{}
+        for _, p := range stroke {
+          points = append(points, Point{at.x - length / 2 + (Glyph_advance * float64(i) + p.x) * scale, at.y - w.size / 2 + p.y * scale})
+        }
+        if len(points) == 1 {
+          c.line(points[0], points[0], width)
+        } else {
+          c.polyline(points, width)
+        }
+      }
+    }
+    return c, nil
+  }
+
+  data, err := read_asset(w.image)
+  if err != nil {
+    return nil, err
+  }
+  img, _, err := image.Decode(bytes.NewReader(data))
+  if err != nil {
+    return nil, fmt.Errorf("%s: %s", w.image, err)
+  }
+  b := img.Bounds()
+  gray := image.NewGray(b)
+  draw.Draw(gray, b, image.White, image.Point{}, draw.Src)
+  draw.Draw(gray, b, img, b.Min, draw.Over)
+  var alpha *image.Alpha
+  if transparent(img) {
+    // the tones of the opaque colors, the alpha channel says how much of them shows
+    alpha = image.NewAlpha(b)
+    draw.Draw(alpha, b, img, b.Min, draw.Src)
+    for y:=b.Min.Y; y<b.Max.Y; y++ {
+      for x:=b.Min.X; x<b.Max.X; x++ {
+        c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+        c.A = 0xff
+        gray.Set(x, y, c)
+      }
+    }
+  }
+
+  // pixels per mm across and up the box
+  width, height := w.size, w.height
+  if height == 0 {
+    height = w.size * float64(b.Dy()) / float64(b.Dx())
+  }
+  sx, sy := float64(b.Dx()) / width, float64(b.Dy()) / height
+  switch Fit(w.fit) {
+    case Contain_fit, Tile_fit:
+      sx = math.Max(sx, sy)
+      sy = sx
+    case Cover_fit:
+      sx = math.Min(sx, sy)
+      sy = sx
+  }
+  if Fit(w.fit) != Tile_fit {
+    place_image(c, gray, alpha, at, Point{0, 1}, width, height, sx, sy)
+    return c, nil
+  }
+
+  // as many copies as fit side by side, the first one at -watermark-at
+  width, height = float64(b.Dx()) / sx, float64(b.Dy()) / sy
+  radius := math.Hypot(at.x, at.y)
+  if radius < height / 2 {
+    return nil, fmt.Errorf("tiled watermark: -watermark-at %s is too close to the center", w.at)
+  }
+  n := int(2 * math.Pi * radius / width)
+  if n < 1 {
+    return nil, fmt.Errorf("tiled watermark: the image is wider than the circle it goes around")
+  }
+  logger.infof("watermark tiled %d times, %s wide", n, Length(width))
+  start := math.Atan2(at.y, at.x)
+  for i:=0; i<n; i++ {
+    a := start - 2 * math.Pi * float64(i) / float64(n)
+    up := Point{math.Cos(a), math.Sin(a)}
+    place_image(c, gray, alpha, Point{radius * up.x, radius * up.y}, up, width, height, sx, sy)
+  }
+  return c, nil
+}
+
+/**
+ * Draws the image centered on at, in a box of the given size whose top
+ * points towards up, a unit vector. sx and sy are the image's pixels per mm
+ * across and up the box, what falls outside the box or the image is left.
+ * alpha, nil for opaque images, goes to the canvas' mask.
+ */
+func place_image(c *Canvas, gray *image.Gray, alpha *image.Alpha, at Point, up Point, width float64, height float64, sx float64, sy float64) {
+  b := gray.Bounds()
+  right := Point{up.y, -up.x}
+  // the box's extent along the canvas' axes
+  dx := math.Abs(right.x) * width / 2 + math.Abs(up.x) * height / 2
+  dy := math.Abs(right.y) * width / 2 + math.Abs(up.y) * height / 2
+  for y:=at.y - dy; y<at.y + dy; y+=c.resolution {
+    for x:=at.x - dx; x<at.x + dx; x+=c.resolution {
+      u := (x - at.x) * right.x + (y - at.y) * right.y
+      v := (x - at.x) * up.x + (y - at.y) * up.y
+      if math.Abs(u) > width / 2 || math.Abs(v) > height / 2 {
+        continue
+      }
+      p := image.Pt(b.Min.X + int(math.Floor(float64(b.Dx()) / 2 + u * sx)), b.Min.Y + int(math.Floor(float64(b.Dy()) / 2 - v * sy)))
+      if p.In(b) {
+        c.set(x, y, 1 - float32(gray.GrayAt(p.X, p.Y).Y) / 255)
+        if alpha != nil {
+          c.set_coverage(x, y, float32(alpha.AlphaAt(p.X, p.Y).A) / 255)
+        }
+      }
+    }
+  }
+}
+
+/**
+ * Whether any pixel of the image is less than opaque.
+ */
+func transparent(img image.Image) bool {
+  if o, ok := img.(interface{ Opaque() bool }); ok {
+    return !o.Opaque()
+  }
+  b := img.Bounds()
+  for y:=b.Min.Y; y<b.Max.Y; y++ {
+    for x:=b.Min.X; x<b.Max.X; x++ {
+      if _, _, _, a := img.At(x, y).RGBA(); a != 0xffff {
+        return true
+      }
+    }
+  }
+  return false
+}
+
+/**
+ * Stamps the watermark over the samples, walking the spiral the way engrave
+ * does. A byte under the watermark flips, dark to light and anything else to
+ * dark, so that the mark shows over any part of the design. The probability
+ * grows with the watermark's tone and opacity.
+ *
+ * Under a masked layer, a byte gets replaced with a probability growing with
+ * the layer's coverage and opacity, by a dark byte as often as the layer's
+ * tone says, a light one otherwise.
+ *
+ * A canvas which diffuses its greys gets its tone carried from byte to byte
+ * along the spiral, the way engrave does, rather than drawn at random.
+ */
+func overlay(samples []byte, c *Canvas, g Geometry, opacity float64) {
+  e := 0.0
+  tone := func(v float64) float64 {
+    if !c.diffuse {
+      return v
+    }
+    e += v
+    if e >= 0.5 {
+      e--
+      return 1
+    }
+    return 0
+  }
+  for _, ring := range g.rings(Duration(len(samples) / 4)) {
+    radius, angle := float64(ring.radius), float64(ring.angle)
+    delta := float64(g.sample_length()) / 4 / radius
+    cos_d, sin_d := math.Cos(delta), math.Sin(delta)
+    x, y := radius * math.Cos(angle), radius * math.Sin(angle)
+    for i:=ring.start * 4; i<(ring.start + ring.samples) * 4; i++ {
+      if c.mask != nil {
+        if a := float64(c.coverage(x, y)); a > 0 && random.Float64() < a * opacity {
+          if random.Float64() < tone(float64(c.at(x, y))) {
+            samples[i] = Dark
+          } else {
+            samples[i] = Light
+          }
+        }
+      } else if v := tone(float64(c.at(x, y))); v > 0 && random.Float64() < v * opacity {
+        if samples[i] == Dark {
+          samples[i] = Light
+        } else {
+          samples[i] = Dark
+        }
+      }
+      x, y = x * cos_d - y * sin_d, x * sin_d + y * cos_d
+    }
+  }
+}
+
+/**
+ * Stamps the watermark, if any, over a wav file holding a whole design.
+ */
+func watermark(buf *bytes.Buffer, w Watermark_options, g Geometry, width float64) error {
+  c, err := watermark_canvas(w, width)
+  if err != nil || c == nil {
+    return err
+  }
+  if w.dither != Random_dither {
+    c.halftone(Dither(w.dither))
+  }
+  logger.infof("watermark at %s mm, %.0f%% opacity, %s dither", w.at, w.opacity * 100, w.dither)
+  overlay(buf.Bytes()[Wav_header_size:], c, g, w.opacity)
+  return nil
+}
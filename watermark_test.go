@@ -0,0 +1,33 @@
+package main
+
+import (
+  "testing"
+)
+
+/**
+ * A watermark diffused along the spiral flips as many bytes as its tone
+ * says, to the byte, where drawing at random only gets close.
+ */
+func TestOverlaySpiralDither(t *testing.T) {
+  g := default_geometry()
+  g.samples = Duration(Sample_rate)
+  c := new_canvas(Disc_radius, Canvas_resolution)
+  for i := range c.pixels {
+    c.pixels[i] = 0.25
+  }
+  c.halftone(Spiral_dither)
+  samples := make([]byte, g.samples * 4)
+  for i := range samples {
+    samples[i] = Light
+  }
+  overlay(samples, c, g, 1)
+  dark := 0
+  for _, v := range samples {
+    if v == Dark {
+      dark++
+    }
+  }
+  if want := len(samples) / 4; dark < want - 1 || dark > want + 1 {
+    t.Errorf("%d dark bytes out of %d, expecting %d", dark, len(samples), want)
+  }
+}
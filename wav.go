@@ -0,0 +1,91 @@
+package main
+
+import (
+  "bytes"
+  "encoding/binary"
+  "fmt"
+  "os"
+)
+
+/**
+ * Returns the samples of a wav file, which has to be CD audio: 44.1kHz, 16
+ * bit stereo. Any wav file will do, e.g. a song ripped or exported by
+ * another program, with other chunks before or after the samples.
+ */
+func read_wav(filename string) ([]byte, error) {
+  data, err := os.ReadFile(filename)
+  if err != nil {
+    return nil, err
+  }
+  f, samples, err := parse_wav(filename, data)
+  if err != nil {
+    return nil, err
+  }
+  if !f.cd_audio() {
+    return nil, fmt.Errorf("%s: %s, expecting CD audio: 2 channels, %dHz, 16 bit pcm", filename, f, Sample_rate)
+  }
+  return samples[:len(samples) / 4 * 4], nil
+}
+
+type Wav_format struct {
+  format uint16 // 1 for pcm, 3 for floats
+  channels int
+  rate int
+  bits int
+}
+
+func (f Wav_format) cd_audio() bool {
+  return f.format == 1 && f.channels == 2 && f.rate == Sample_rate && f.bits == 16
+}
+
+func (f Wav_format) String() string {
+  kind := "pcm"
+  if f.format == 3 {
+    kind = "float"
+  }
+  return fmt.Sprintf("%d channel(s), %dHz, %d bit %s", f.channels, f.rate, f.bits, kind)
+}
+
+/**
+ * Walks the chunks of a wav file, returns its format and the bytes of its
+ * data chunk.
+ */
+func parse_wav(filename string, data []byte) (Wav_format, []byte, error) {
+  f := Wav_format{}
+  if len(data) < 12 || !bytes.Equal(data[0:4], []byte("RIFF")) || !bytes.Equal(data[8:12], []byte("WAVE")) {
+    return f, nil, fmt.Errorf("%s: not a wav file", filename)
+  }
+  for i:=12; i + 8 <= len(data); {
+    id := string(data[i:i+4])
+    length := int(binary.LittleEndian.Uint32(data[i+4:i+8]))
+    chunk := data[i+8:]
+    switch id {
+      case "fmt ":
+        if length < 16 || len(chunk) < 16 {
+          return f, nil, fmt.Errorf("%s: truncated fmt chunk", filename)
+        }
+        f.format = binary.LittleEndian.Uint16(chunk[0:2])
+        if f.format == 0xfffe && length >= 26 {
+          // WAVE_FORMAT_EXTENSIBLE, the sub format tells
+          if len(chunk) < 26 {
+            return f, nil, fmt.Errorf("%s: truncated fmt chunk", filename)
+          }
+          f.format = binary.LittleEndian.Uint16(chunk[24:26])
+        }
+        f.channels = int(binary.LittleEndian.Uint16(chunk[2:4]))
+        f.rate = int(binary.LittleEndian.Uint32(chunk[4:8]))
+        f.bits = int(binary.LittleEndian.Uint16(chunk[14:16]))
+      case "data":
+        if f.channels == 0 {
+          return f, nil, fmt.Errorf("%s: no fmt chunk before the samples", filename)
+        }
+        if length > len(chunk) {
+          return f, nil, fmt.Errorf("%s: truncated wav file", filename)
+        }
+        return f, chunk[:length], nil
+    }
+    // chunks are padded to an even length
+    i += 8 + length + length % 2
+  }
+  return f, nil, fmt.Errorf("%s: no data chunk", filename)
+}
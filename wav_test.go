@@ -0,0 +1,52 @@
+package main
+
+import (
+  "bytes"
+  "os"
+  "path/filepath"
+  "strings"
+  "testing"
+)
+
+/**
+ * Wav files from other programs hold other chunks around the samples, and
+ * some aren't CD audio.
+ */
+func TestReadWav(t *testing.T) {
+  data := generate_test_pattern(t, Pie, []string{"-duration", "5s"})
+  chunk := []byte("LIST\x04\x00\x00\x00INFO")
+  song := append(append(append([]byte{}, data[:36]...), chunk...), data[36:]...)
+  filename := filepath.Join(t.TempDir(), "song.wav")
+  if err := os.WriteFile(filename, song, 0644); err != nil {
+    t.Fatal(err)
+  }
+  samples, err := read_wav(filename)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if !bytes.Equal(samples, data[Wav_header_size:Wav_header_size + 5 * Sample_rate * 4]) {
+    t.Errorf("got %d bytes of other samples", len(samples))
+  }
+
+  mono := append([]byte{}, song...)
+  mono[22] = 1
+  if err := os.WriteFile(filename, mono, 0644); err != nil {
+    t.Fatal(err)
+  }
+  if _, err := read_wav(filename); err == nil {
+    t.Errorf("expected an error for a mono file")
+  }
+}
+
+/**
+ * A file cut short within a fmt chunk which claims more is an error, not a
+ * panic.
+ */
+func TestParseWavTruncated(t *testing.T) {
+  extensible := []byte("RIFF\x00\x00\x00\x00WAVEfmt \x28\x00\x00\x00\xfe\xff\x02\x00\x44\xac\x00\x00\x10\xb1\x02\x00\x04\x00\x10\x00")
+  for _, data := range [][]byte{extensible, extensible[:24]} {
+    if _, _, err := parse_wav("truncated.wav", data); err == nil || !strings.Contains(err.Error(), "truncated") {
+      t.Errorf("%d bytes: got %v, expecting a truncated file", len(data), err)
+    }
+  }
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+  "bytes"
+  "fmt"
+  "math"
+  "strconv"
+  "strings"
+)
+
+type Projection string
+
+const (
+  Azimuthal Projection = "azimuthal"
+  Azimuthal_south Projection = "azimuthal-south"
+  Mercator Projection = "mercator"
+)
+
+var projections = []Projection{Azimuthal, Azimuthal_south, Mercator}
+
+type LatLong struct {
+  lat float64
+  long float64
+}
+
+/**
+ * Parses "lat,long", in degrees. E.g. "37.77,-122.42".
+ */
+func parse_lat_long(s string) (*LatLong, error) {
+  parts := strings.Split(s, ",")
+  if len(parts) != 2 {
+    return nil, fmt.Errorf("expecting lat,long, got %q", s)
+  }
+  lat, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+  if err != nil || lat < -90 || lat > 90 {
+    return nil, fmt.Errorf("invalid latitude: %q", parts[0])
+  }
+  long, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+  if err != nil || long < -180 || long > 180 {
+    return nil, fmt.Errorf("invalid longitude: %q", parts[1])
+  }
+  return &LatLong{lat, long}, nil
+}
+
+/**
+ * Maps a position on earth to the annulus between inner and outer. Every
+ * projection puts a pole at the inner edge and runs the parallels as rings,
+ * so that the map fills the program area. Returns false for positions which
+ * fall outside the map.
+ */
+func (p Projection) project(l LatLong, inner float64, outer float64) (Point, bool) {
+  var t, angle float64
+  switch p {
+    case Azimuthal:
+      // equidistant, from the north pole down to 60°S
+      t = (90 - l.lat) / 150
+      angle = l.long
+    case Azimuthal_south:
+      // equidistant, from the south pole up to 60°N. Mirrored so that the
+      // map reads as seen from below.
+      t = (90 + l.lat) / 150
+      angle = -l.long
+    case Mercator:
+      // conformal, from 80°N down to 60°S
+      y := func(lat float64) float64 {
+        return math.Log(math.Tan(math.Pi / 4 + lat * math.Pi / 360))
+      }
+      t = (y(80) - y(l.lat)) / (y(80) - y(-60))
+      angle = l.long
+    default:
+      return Point{}, false
+  }
+  if t < 0 || t > 1 || math.IsNaN(t) {
+    return Point{}, false
+  }
+  r := inner + t * (outer - inner)
+  a := angle * math.Pi / 180
+  return Point{r * math.Cos(a), r * math.Sin(a)}, true
+}
+
+/**
+ * Draws the world's coastlines, with an optional marker to highlight a
+ * given location.
+ */
+func worldmap(buf *bytes.Buffer, g Geometry, projection Projection, marker *LatLong, width float64, jitter bool) error {
+  inner := float64(g.visible_radius())
+  outer := float64(g.end_radius())
+  if _, ok := projection.project(LatLong{0, 0}, inner, outer); !ok {
+    return fmt.Errorf("unknown projection: %s", projection)
+  }
+
+  c := new_canvas(Disc_radius, Canvas_resolution)
+  for _, coastline := range coastlines {
+    for i:=2; i<len(coastline); i+=2 {
+      a := LatLong{coastline[i-1], coastline[i-2]}
+      b := LatLong{coastline[i+1], coastline[i]}
+      // straight lines on the map are curves on the disc, so split each
+      // segment into steps of at most 1°.
+      n := int(math.Ceil(math.Max(math.Abs(b.lat - a.lat), math.Abs(b.long - a.long))))
+      points := []Point{}
+      for j:=0; j<=n; j++ {
+        t := float64(j) / math.Max(1, float64(n))
+        p, ok := projection.project(LatLong{a.lat + t * (b.lat - a.lat), a.long + t * (b.long - a.long)}, inner, outer)
+        if !ok {
+          c.polyline(points, width)
+          points = []Point{}
+          continue
+        }
+        points = append(points, p)
+      }
+      c.polyline(points, width)
+    }
+  }
+
+  if marker != nil {
+    p, ok := projection.project(*marker, inner, outer)
+    if !ok {
+      return fmt.Errorf("marker is outside the map")
+    }
+    c.line(p, p, 1.2)
+    c.circle(p, 1.5, width)
+  }
+
+  engrave(buf, c, g, jitter)
+  return nil
+}
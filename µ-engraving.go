@@ -1,10 +1,12 @@
 package main
 
 import (
-  "log"
+  "flag"
+  "fmt"
   "os"
   "math"
   "bytes"
+  "sort"
 )
 
 /**
@@ -16,13 +18,31 @@ import (
  *
  * To burn with Mac OS X:
  *   mkdir out
- *   go run micro-engraving.go pie > out/a.wav
+ *   go build -o micro-engraving *.go
+ *   ./micro-engraving generate pie > out/a.wav
  *   drutil burn -noverify -nofs -audio -notest -noappendable -erase -eject out
  *
+ * or let the burn command take care of it:
+ *   ./micro-engraving generate -o a.wav pie
+ *   ./micro-engraving burn a.wav
+ *
+ * DVDs have no audio mode, growisofs (dvd+rw-tools) burns a raw image as is:
+ *   ./micro-engraving burn -backend growisofs -speed 4 image.bin
+ *
  * TODO:
  * - try data vs audio. Does one work better than the other?
  * - try different values for dark/light. Does contrast improve?
  * - take F3 re-ordering into account.
+ * - dump the EFM channel bitstream (sync, merging bits, after CIRC) in
+ *   ld-decode's format, one byte per run length (3T to 11T), to compare
+ *   against captures bit for bit. Needs a CIRC and EFM encoder, which this
+ *   code doesn't have yet: samples go to the burner as is. With the encoder,
+ *   trace could print each byte's 14 bit codeword (ECMA-130, annex D) and
+ *   the 3 merging bits picked for the run length limits and the lowest DSV.
+ * - a generation service for render farms, streaming progress then chunks
+ *   of the output, e.g. over gRPC. The build is plain "go build *.go" with
+ *   the standard library only; the gui command's local http server is the
+ *   closest thing for now, and batch covers multi-disc jobs on one machine.
  * - make calibration easier/automatic.
  *
  * Links with useful technical or general information:
@@ -50,48 +70,122 @@ const (
   Pitch Pattern = "pitch"
   Bands Pattern = "bands"
   Pie Pattern = "pie"
+  World Pattern = "world"
+  Spirograph Pattern = "spirograph"
+  Text Pattern = "text"
+  Plot Pattern = "plot"
+  Code Pattern = "code"
+  Sweep Pattern = "sweep"
+  Tones Pattern = "tones"
+  Channels Pattern = "channels"
+  Verify Pattern = "verify"
 
   Wav_header_size int = 44
   Sample_rate int = 44100
-  Samples int = 1400
+  Samples int = 1400 // default duration, in seconds
+
+  // exit codes
+  Exit_failure int = 1
+  Exit_usage int = 2
 )
 
-func main() {
-  pattern := Pattern(os.Args[1])
-  logger := log.New(os.Stderr, "", 0)
+/**
+ * What a command expects after its options, used for shell completion.
+ */
+type Arguments int
+
+const (
+  No_arguments Arguments = iota
+  Pattern_argument
+  File_argument
+  Shell_argument
+)
 
-  logger.Printf("creating pattern: %s\n", pattern)
+/**
+ * A command registers its flags on fs and returns the function which runs
+ * it, once the flags have been parsed.
+ */
+type Command struct {
+  name string
+  description string
+  arguments Arguments
+  setup func(fs *flag.FlagSet) func() int
+}
 
-  buf := bytes.Buffer{}
+func commands() []Command {
+  return []Command{
+    {"generate", "generates a pattern as a wav file", Pattern_argument, generate_command},
+    {"preview", "renders a pattern as a png, as it would look on the disc", Pattern_argument, preview_command},
+    {"label", "renders a pattern as a LightScribe label for the other side of the disc", Pattern_argument, label_command},
+    {"overlay", "exports a true scale pdf of the design's radii, to print on a transparency and lay over the burned disc", Pattern_argument, overlay_command},
+    {"batch", "generates one wav file per row of a csv file", File_argument, batch_command},
+    {"recipe", "exports a design with everything it uses to one file, or generates one from such a file", No_arguments, recipe_command},
+    {"burn", "burns a wav file", File_argument, burn_command},
+    {"calibrate", "generates a calibration disc", No_arguments, calibrate_command},
+    {"experiment", "generates a blind test of burn parameters, with its answer key", No_arguments, experiment_command},
+    {"journal", "creates the next session of a disc which gets one ring per session", No_arguments, journal_command},
+    {"scan", "acquires an image of a burned disc with a flatbed scanner", No_arguments, scan_command},
+    {"estimate", "estimates the burn time and capacity used by a pattern, without generating it", Pattern_argument, estimate_command},
+    {"selfcheck", "checks that a wav file is ready to be burned", File_argument, selfcheck_command},
+    {"contrast", "measures a scan of a burned calibration disc", File_argument, contrast_command},
+    {"report", "compares scans of calibration discs burned on different blanks", File_argument, report_command},
+    {"decode", "renders any existing wav file, e.g. a song, as a png, as it would look on the disc", File_argument, decode_command},
+    {"clone", "creates the samples which would burn about the same picture as a photo of a disc", File_argument, clone_command},
+    {"read-code", "reads the payload of the code pattern from a wav file or a scan of a burned disc", File_argument, read_code_command},
+    {"signature", "reads the signature ring of a wav file or of a scan of a burned disc", File_argument, signature_command},
+    {"verify-rip", "checks a rip of the verify pattern, byte for byte", File_argument, verify_rip_command},
+    {"trace", "shows where the bytes of a sample end up on the disc, through CIRC's interleaving", No_arguments, trace_command},
+    {"tui", "edits a pattern's parameters with the keyboard, with a preview in the terminal", Pattern_argument, tui_command},
+    {"gui", "serves a page to design, preview and burn discs from the browser", No_arguments, gui_command},
+    {"patterns", "lists the patterns and their options", No_arguments, patterns_command},
+    {"schema", "prints the json schema of project files", No_arguments, schema_command},
+    {"templates", "lists the built-in projects", No_arguments, templates_command},
+    {"completion", "prints a shell completion script", Shell_argument, completion_command},
+  }
+}
 
-  wav_header(&buf)
-  if buf.Len() != Wav_header_size {
-    logger.Printf("incorrect header length")
-    os.Exit(-1)
+func usage() {
+  fmt.Fprintf(os.Stderr, "micro-engraving %s\n\n", version)
+  fmt.Fprintf(os.Stderr, "usage: %s <command> [options]\n\n", os.Args[0])
+  fmt.Fprintf(os.Stderr, "commands:\n")
+  for _, c := range commands() {
+    fmt.Fprintf(os.Stderr, "  %-12s %s\n", c.name, c.description)
   }
+  fmt.Fprintf(os.Stderr, "\nrun '%s <command> -h' for the command's options.\n", os.Args[0])
+}
 
-  switch pattern {
-    case Pitch:
-      pitch(&buf, 440)
-    case Bands:
-      bands(&buf, 8)
-    case Pie:
-      pie(&buf, 0.25)
-    default:
-      logger.Printf("unknown pattern")
-      os.Exit(-1)
+func main() {
+  if len(os.Args) < 2 {
+    usage()
+    os.Exit(Exit_usage)
   }
-  if buf.Len() != Sample_rate * Samples * 4 + Wav_header_size {
-    logger.Printf("incorrect total bytes. Expecting %d, got %d\n",
-      Sample_rate * Samples * 4 + Wav_header_size,
-      buf.Len())
-    os.Exit(-1)
+  switch os.Args[1] {
+    case "-h", "-help", "--help", "help":
+      usage()
+      os.Exit(0)
+    case Complete_command:
+      os.Exit(complete(os.Args[2:]))
   }
-  buf.WriteTo(os.Stdout)
+  for _, c := range commands() {
+    if c.name == os.Args[1] {
+      fs := flag.NewFlagSet(c.name, flag.ExitOnError)
+      apply_logging := logging_flags(fs)
+      run := c.setup(fs)
+      fs.Parse(os.Args[2:])
+      if err := apply_logging(); err != nil {
+        logger.errorf("%s", err)
+        os.Exit(Exit_usage)
+      }
+      os.Exit(run())
+    }
+  }
+  logger.errorf("unknown command: %s\n", os.Args[1])
+  usage()
+  os.Exit(Exit_usage)
 }
 
-func wav_header(buf *bytes.Buffer) {
-  len := Sample_rate * 4 * Samples
+func wav_header(buf *bytes.Buffer, samples Duration) {
+  len := 4 * int(samples)
   buf.WriteString("RIFF")                // riff_tag
   write_int32(buf, Wav_header_size + len - 8) // riff_length
   buf.WriteString("WAVE")                // wave_tag
@@ -111,31 +205,177 @@ func wav_header(buf *bytes.Buffer) {
  * Creates a wav file which plays a fixed pitch sound. Used for
  * testing purpose.
  */
-func pitch(buf *bytes.Buffer, frequency float64) {
-  for i:=0; i<Samples; i++ {
-    for j:=0; j<Sample_rate; j++ {
-      s := float64(j) / float64(Sample_rate) * 2 * math.Pi
-      t := int(math.Sin(s * frequency) * 0x7fff)
-      // left
-      write_int16(buf, int(t))
-      // right
-      write_int16(buf, int(t))
+func pitch(buf *bytes.Buffer, samples int, frequency float64) {
+  for i:=0; i<samples; i++ {
+    j := i % Sample_rate
+    s := float64(j) / float64(Sample_rate) * 2 * math.Pi
+    t := int(math.Sin(s * frequency) * 0x7fff)
+    // left
+    write_int16(buf, int(t))
+    // right
+    write_int16(buf, int(t))
+  }
+}
+
+/**
+ * Creates a wav file which plays a logarithmic sweep, from one frequency to
+ * another, over period samples. The sweep starts over every period.
+ */
+func sweep(buf *bytes.Buffer, samples int, from float64, to float64, period int) {
+  k := math.Log(to / from)
+  duration := float64(period) / float64(Sample_rate)
+  for i:=0; i<samples; i++ {
+    s := float64(i % period) / float64(Sample_rate)
+    phase := 2 * math.Pi * from * s
+    if k != 0 {
+      phase = 2 * math.Pi * from * duration / k * (math.Exp(s / duration * k) - 1)
     }
+    t := int(math.Sin(phase) * 0x7fff)
+    write_int16(buf, t)
+    write_int16(buf, t)
   }
 }
 
 /**
- * Draws concentric bands.
+ * Creates a wav file which plays several pitches at once, each at the same
+ * volume.
  */
-func bands(buf *bytes.Buffer, bands int) {
+func tones(buf *bytes.Buffer, samples int, frequencies []float64) {
+  for i:=0; i<samples; i++ {
+    s := float64(i % Sample_rate) / float64(Sample_rate) * 2 * math.Pi
+    v := 0.0
+    for _, f := range frequencies {
+      v += math.Sin(s * f)
+    }
+    t := int(v / float64(len(frequencies)) * 0x7fff)
+    write_int16(buf, t)
+    write_int16(buf, t)
+  }
+}
+
+/**
+ * What each band of the channels pattern plays, as the gain of each channel.
+ */
+var channel_bands = []struct {
+  name string
+  left float64
+  right float64
+}{
+  {"left only", 1, 0},
+  {"right only", 0, 1},
+  {"in phase", 1, 1},
+  {"anti-phase", 1, -1},
+}
+
+/**
+ * Creates a wav file which plays the same pitch in concentric bands, with
+ * different channel content in each band. Left and right samples are
+ * interleaved in the same frames, a burned disc shows where each ends up.
+ * The bands are separated by a dark ring and logged with their radii.
+ */
+func channels(buf *bytes.Buffer, g Geometry, frequency float64) {
+  rings := g.rings(g.samples)
+  radius := func(sample int) Length {
+    i := sort.Search(len(rings), func(i int) bool { return rings[i].start > sample })
+    return rings[max(i - 1, 0)].radius
+  }
+  start := 0
+  for k, band := range channel_bands {
+    n := int(g.samples) / len(channel_bands)
+    if k == len(channel_bands) - 1 {
+      n = int(g.samples) - start
+    }
+    separator := n / 20
+    logger.infof("%s: %s to %s", band.name, radius(start), radius(start + n - separator))
+    for i:=start; i<start + n; i++ {
+      if i >= start + n - separator {
+        buf.Write([]byte{Dark, Dark, Dark, Dark})
+        continue
+      }
+      s := float64(i % Sample_rate) / float64(Sample_rate) * 2 * math.Pi
+      t := math.Sin(s * frequency) * 0x7fff
+      write_int16(buf, int(t * band.left))
+      write_int16(buf, int(t * band.right))
+    }
+    start += n
+  }
+}
+
+/**
+ * How the boundaries between bands get blended: with bytes of both bands,
+ * more and more of the next one, diffusing the error along the track like
+ * clone does (dither), or with the byte values in between the bands'
+ * (palette), which burn to tones the preview can't tell.
+ */
+type Blend string
+const (
+  Dither_blend Blend = "dither"
+  Palette_blend Blend = "palette"
+)
+
+/**
+ * Draws concentric bands. Each boundary gets blended over blend
+ * revolutions, half on each side, 0 for sharp ones: subtle designs don't
+ * need a bright ring where two bands meet.
+ */
+func bands(buf *bytes.Buffer, g Geometry, bands int, blend float64, style Blend) {
+  samples := int(g.samples)
+  values := []float64{float64(Dark), float64(Light)}
+  rings := g.rings(g.samples)
+  revolution := func(i int) float64 {
+    k := sort.Search(len(rings), func(k int) bool { return rings[k].start > i }) - 1
+    if k < 0 {
+      return 0
+    }
+    return float64(k) + float64(i - rings[k].start) / float64(rings[k].samples)
+  }
+  // boundaries, in revolutions, from the start to the end of the bands
+  boundaries := []float64{}
   for i:=0; i<bands; i++ {
-    for j:=0; j<Sample_rate * Samples/bands; j++ {
-      if i % 2 == 0 {
-        write_int16(buf, 0x4040)
-        write_int16(buf, 0x4040)
-      } else {
-        write_int16(buf, 0x4545)
-        write_int16(buf, 0x4545)
+    boundaries = append(boundaries, revolution(i * (samples / bands)))
+  }
+  boundaries = append(boundaries, revolution(samples))
+  narrowest := math.Inf(1)
+  for i:=0; i<bands; i++ {
+    narrowest = math.Min(narrowest, boundaries[i + 1] - boundaries[i])
+  }
+  if blend > narrowest {
+    logger.warnf("-blend %g is wider than the narrowest band, %.1f revolutions, using %.1f", blend, narrowest, narrowest)
+    blend = narrowest
+  }
+
+  e := 0.0
+  for i:=0; i<bands; i++ {
+    n := samples / bands
+    if i == bands - 1 {
+      // the last band takes the leftover samples
+      n = samples - n * (bands - 1)
+    }
+    for j:=0; j<n; j++ {
+      own, other, t := values[i % 2], values[(i + 1) % 2], 1.0
+      if blend > 0 {
+        r := revolution(i * (samples / bands) + j)
+        if i > 0 && r - boundaries[i] < blend / 2 {
+          t = 0.5 + (r - boundaries[i]) / blend
+        } else if i < bands - 1 && boundaries[i + 1] - r < blend / 2 {
+          t = 0.5 + (boundaries[i + 1] - r) / blend
+        }
+      }
+      for k:=0; k<4; k++ {
+        switch {
+          case t >= 1:
+            buf.WriteByte(byte(own))
+          case style == Dither_blend:
+            e += 1 - t
+            if e >= 0.5 {
+              e--
+              buf.WriteByte(byte(other))
+            } else {
+              buf.WriteByte(byte(own))
+            }
+          default:
+            buf.WriteByte(byte(math.Round(own * t + other * (1 - t))))
+        }
       }
     }
   }
@@ -144,16 +384,15 @@ func bands(buf *bytes.Buffer, bands int) {
 /**
  * Draws a pie.
  */
-func pie(buf *bytes.Buffer, width float64) {
-  radius := 25.0  // in mm
-  pitch := 0.00148 // distance between tracks, in mm
-
-  linear_speed := 1300.0 // TODO: how to figure out the right value for this?
-  byte_length := linear_speed / 176400
+func pie(buf *bytes.Buffer, g Geometry, width float64) {
+  radius := g.start_radius
+  byte_length := Length(g.linear_speed / 176400)
+  // past whatever comes before the design, e.g. an intro
+  end := buf.Len() + int(g.samples) * 4
 
   for {
     // calculate number of bytes at the current radius
-    circ := 2 * math.Pi * radius / byte_length
+    circ := float64(2 * math.Pi * radius / byte_length)
     for j:=0.0; j<4; j++ {
       for k:=int(circ / 4 * (j-1)); k<int(circ / 4 * j); k++ {
         if int(j) % 2 == 0 {
@@ -161,12 +400,12 @@ func pie(buf *bytes.Buffer, width float64) {
         } else {
           buf.WriteByte(0x45)
         }
-        if buf.Len() == Sample_rate * Samples * 4 + Wav_header_size {
+        if buf.Len() == end {
           return
         }
       }
     }
-    radius += pitch
+    radius += g.track_pitch
   }
 }
 